@@ -5,25 +5,81 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"Finder-2/backend"
 	"Finder-2/backend/AI"
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/archive"
 	"Finder-2/backend/connections"
+	"Finder-2/backend/credentials"
 	"Finder-2/backend/database"
+	"Finder-2/backend/diagnostics"
+	"Finder-2/backend/duplicates"
 	"Finder-2/backend/filter"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/drivesync"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/transfer"
 	"Finder-2/backend/global"
+	"Finder-2/backend/logging"
 	"Finder-2/backend/open"
+	"Finder-2/backend/pointers"
+	"Finder-2/backend/rename"
+	"Finder-2/backend/sandbox"
+	"Finder-2/backend/settings"
 	"Finder-2/backend/search"
 	"Finder-2/backend/share"
+	"Finder-2/backend/tags"
 	"Finder-2/backend/google"
 	"Finder-2/backend/entity"
 	contextmenu "Finder-2/backend/context-menu"
 
 	"github.com/joho/godotenv"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
+// archiveProgressEvent is emitted with an archive.Progress while an archive
+// is being created or extracted
+const archiveProgressEvent = "archive-progress"
+
+// folderSizeEvent is emitted with a foldersize.Size each time a folder's
+// recursive size becomes available after a listing
+const folderSizeEvent = "folder-size"
+
+// transferProgressEvent is emitted with a transfer.Job whenever an upload
+// or download is queued, makes progress or finishes
+const transferProgressEvent = "transfer-progress"
+
+// syncFinishedEvent is emitted with a drivesync.Report after each sync of
+// a folder with Google Drive
+const syncFinishedEvent = "sync-finished"
+
+// settingsChangedEvent is emitted with the new settings.Settings after
+// they're updated
+const settingsChangedEvent = "settings-changed"
+
+var logger = logging.For("app")
+
 // App struct
 type App struct {
 	ctx context.Context
+
+	// everything the app persists; a memory store when the database
+	// couldn't be opened, as storeStatus then says
+	store       database.Store
+	storeStatus database.Status
+
+	// cancels the folder size calculation for the previous listing
+	sizeCancel context.CancelFunc
+	sizeMux    sync.Mutex
+
+	// cancels the archive operation currently running
+	archiveCancel context.CancelFunc
+	archiveMux    sync.Mutex
+
+	// cancels the disk usage analysis currently running
+	usageCancel context.CancelFunc
+	usageMux    sync.Mutex
 }
 
 // NewApp creates a new App application struct
@@ -36,42 +92,94 @@ func NewApp() *App {
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		fmt.Println("Warning: .env file not found")
-	}
-
-	// Initialize Google OAuth
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
-	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-	if clientID != "" && clientSecret != "" {
-		connections.InitGoogleOAuth(clientID, clientSecret)
-		fmt.Println("Google OAuth initialized")
-	} else {
-		fmt.Println("Warning: Google OAuth credentials not found in .env")
-	}
-
-	// Initialize database
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		fmt.Println("Error getting home directory:", err)
+		logger.Error("failed to get home directory", "error", err)
+		a.store, a.storeStatus = database.Degraded(err)
+		a.startServices()
 		return
 	}
 
 	appDataPath := filepath.Join(homeDir, ".finder-2")
 	if err := os.MkdirAll(appDataPath, 0755); err != nil {
-		fmt.Println("Error creating app data directory:", err)
+		logger.Error("failed to create app data directory", "error", err)
+		a.store, a.storeStatus = database.Degraded(err)
+		a.startServices()
 		return
 	}
 
-	if err := database.Init(appDataPath); err != nil {
-		fmt.Println("Error initializing database:", err)
+	if err := logging.Init(filepath.Join(appDataPath, "logs")); err != nil {
+		logger.Error("failed to open log file", "error", err)
+	}
+
+	// A .env file is optional; credentials set in the app take precedence
+	if err := godotenv.Load(); err != nil {
+		logger.Debug(".env file not found")
 	}
+	credentials.Init(appDataPath)
+
+	a.initGoogleOAuth()
+
+	a.store, a.storeStatus, err = database.OpenOrDegraded(appDataPath)
+	if err != nil {
+		logger.Error("failed to initialize database", "error", err)
+	}
+	a.startServices()
+}
+
+// initGoogleOAuth configures Google login from the stored client ID and
+// secret, if both are set
+func (a *App) initGoogleOAuth() {
+	clientID, idErr := credentials.Get(credentials.GoogleClientID)
+	clientSecret, secretErr := credentials.Get(credentials.GoogleClientSecret)
+	if idErr != nil || secretErr != nil {
+		logger.Warn("Google OAuth client ID or secret not set")
+		return
+	}
+	connections.InitGoogleOAuth(clientID, clientSecret)
+	logger.Info("Google OAuth initialized")
+}
+
+// startServices loads what depends on the store, once a.store is the
+// database or, in degraded mode, a memory store
+func (a *App) startServices() {
+	transfer.OnUpdate(func(job transfer.Job) {
+		runtime.EventsEmit(a.ctx, transferProgressEvent, job)
+	})
+	transfer.Start(a.ctx, a.store)
+
+	if err := settings.Load(a.store); err != nil {
+		logger.Error("failed to load settings", "error", err)
+	}
+	settings.OnChange(func(s settings.Settings) {
+		runtime.EventsEmit(a.ctx, settingsChangedEvent, s)
+	})
+
+	// Catch up on pointer files moved or deleted while the app wasn't
+	// running, looking only in the folders known pointers are in
+	go func() {
+		if _, err := pointers.Reconcile(a.ctx, a.store, nil); err != nil {
+			logger.Warn("failed to reconcile external files", "error", err)
+		}
+	}()
+
+	drivesync.OnSync(func(report drivesync.Report) {
+		runtime.EventsEmit(a.ctx, syncFinishedEvent, report)
+	})
+	drivesync.Start(a.ctx, a.store)
 }
 
 // shutdown is called when the app is closing
 func (a *App) shutdown(ctx context.Context) {
-	database.Close()
+	if a.store != nil {
+		a.store.Close()
+	}
+	logging.Close()
+}
+
+// GetStorageStatus reports whether the app is running without its database
+func (a *App) GetStorageStatus() database.Status {
+	return a.storeStatus
 }
 
 // Greet returns a greeting for the given name
@@ -84,7 +192,55 @@ func (a *App) GetHomeFolders() ([]backend.Folder, error) {
 }
 
 func (a *App) GetFolderContents(path string) ([]backend.FileItem, error) {
-	return backend.GetFolderContents(path)
+	items, err := backend.GetFolderContents(a.store, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.store.AddHistory(path); err != nil {
+		logger.Warn("failed to record history", "path", path, "error", err)
+	}
+
+	a.streamFolderSizes(items)
+	return items, nil
+}
+
+// streamFolderSizes calculates the recursive size of every folder in items in
+// the background, emitting a folderSizeEvent per folder. Starting a new
+// listing cancels the previous calculation.
+func (a *App) streamFolderSizes(items []backend.FileItem) {
+	var paths []string
+	for _, item := range items {
+		if item.IsDirectory && !item.IsApp && !gdrive.IsPath(item.Path) {
+			paths = append(paths, item.Path)
+		}
+	}
+
+	a.sizeMux.Lock()
+	if a.sizeCancel != nil {
+		a.sizeCancel()
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.sizeCancel = cancel
+	a.sizeMux.Unlock()
+
+	if len(paths) == 0 {
+		return
+	}
+
+	go foldersize.CalculateAll(ctx, a.store, paths, func(size foldersize.Size) {
+		runtime.EventsEmit(a.ctx, folderSizeEvent, size)
+	})
+}
+
+// GetFolderSize returns the recursive size of a single folder
+func (a *App) GetFolderSize(path string) (*foldersize.Size, error) {
+	return foldersize.Calculate(a.ctx, a.store, path)
+}
+
+// GetFileInfo returns the full "Get Info" metadata for a path
+func (a *App) GetFileInfo(path string) (backend.FileItem, error) {
+	return backend.GetFileInfo(a.store, path)
 }
 
 func (a *App) GetAppIcon(iconPath string) (string, error) {
@@ -97,11 +253,11 @@ func (a *App) GetAppIcon(iconPath string) (string, error) {
 }
 
 func (a *App) OpenFile(path string) error {
-	return open.OpenFile(path)
+	return open.OpenFile(a.store, path)
 }
 
 func (a *App) OpenApplication(path string) error {
-	return open.OpenApplication(path)
+	return open.OpenApplication(a.store, path)
 }
 
 func (a *App) SortByName(items []backend.FileItem, ascending bool) []backend.FileItem {
@@ -116,12 +272,27 @@ func (a *App) SortBySize(items []backend.FileItem, ascending bool) []backend.Fil
 	return filter.SortBySize(items, ascending)
 }
 
+// ArrangeItems filters and sorts items with a multi-key query
+func (a *App) ArrangeItems(items []backend.FileItem, query filter.Query) ([]backend.FileItem, error) {
+	return filter.Apply(a.store, items, query)
+}
+
+// ArrangeSearchResults filters and sorts search results with a multi-key query
+func (a *App) ArrangeSearchResults(results []search.SearchResult, query filter.Query) ([]search.SearchResult, error) {
+	return filter.ApplyToSearchResults(a.store, results, query)
+}
+
 func (a *App) SearchFilenames(directory string, query string) ([]search.SearchResult, error) {
-	return search.SearchFilenames(directory, query)
+	return search.SearchFilenames(a.store, directory, query)
 }
 
 func (a *App) Search(directory string, query string) ([]search.SearchResult, error) {
-	return search.Search(directory, query)
+	return search.Search(a.store, directory, query)
+}
+
+// SearchWithTags searches by name, keeping only files carrying every tag
+func (a *App) SearchWithTags(directory string, query string, tagNames []string) ([]search.SearchResult, error) {
+	return search.SearchWithTags(a.store, directory, query, tagNames)
 }
 
 func (a *App) GetHomeDirectory() (string, error) {
@@ -138,7 +309,7 @@ func (a *App) CutFile(path string) error {
 }
 
 func (a *App) PasteFile(destinationDir string) error {
-	return contextmenu.PasteFile(destinationDir)
+	return contextmenu.PasteFile(a.store, destinationDir)
 }
 
 func (a *App) HasClipboardContent() bool {
@@ -146,27 +317,201 @@ func (a *App) HasClipboardContent() bool {
 }
 
 func (a *App) TrashFile(path string) error {
-	return contextmenu.TrashFile(path)
+	return contextmenu.TrashFile(a.store, path)
 }
 
 func (a *App) RenameFile(oldPath string, newName string) error {
-	return contextmenu.RenameFile(oldPath, newName)
+	return contextmenu.RenameFile(a.store, oldPath, newName)
+}
+
+// Batch Rename Methods
+func (a *App) PreviewBatchRename(paths []string, rules []rename.Rule) (*rename.Preview, error) {
+	return rename.PreviewRename(paths, rules)
+}
+
+func (a *App) ApplyBatchRename(paths []string, rules []rename.Rule) (*rename.Preview, error) {
+	return rename.ApplyRename(a.store, paths, rules)
+}
+
+func (a *App) UndoBatchRename() error {
+	return rename.UndoLastRename(a.store)
 }
 
 func (a *App) CreateFile(directory string, name string) error {
-	return contextmenu.CreateFile(directory, name)
+	return contextmenu.CreateFile(a.store, directory, name)
 }
 
 func (a *App) CreateFolder(directory string, name string) error {
-	return contextmenu.CreateFolder(directory, name)
+	return contextmenu.CreateFolder(a.store, directory, name)
 }
 
 func (a *App) Zip(path string) error {
-	return contextmenu.Zip(path)
+	return contextmenu.Zip(a.store, path)
+}
+
+// CreateArchive creates an archive with the given options, emitting
+// archiveProgressEvent as it goes, and returns the archive's path
+func (a *App) CreateArchive(opts archive.Options) (string, error) {
+	ctx, done, err := a.startArchiveJob()
+	if err != nil {
+		return "", err
+	}
+	defer done()
+
+	return archive.Create(ctx, a.store, opts, func(p archive.Progress) {
+		runtime.EventsEmit(a.ctx, archiveProgressEvent, p)
+	})
+}
+
+// ExtractArchive unpacks a zip, tar, compressed tar or compressed file,
+// emitting archiveProgressEvent as it goes, and returns the folder it was
+// extracted into
+func (a *App) ExtractArchive(archivePath string, opts archive.ExtractOptions) (string, error) {
+	ctx, done, err := a.startArchiveJob()
+	if err != nil {
+		return "", err
+	}
+	defer done()
+
+	return archive.Extract(ctx, a.store, archivePath, opts, func(p archive.Progress) {
+		runtime.EventsEmit(a.ctx, archiveProgressEvent, p)
+	})
+}
+
+// ListArchive returns the entries of an archive without extracting it
+func (a *App) ListArchive(archivePath string) ([]archive.Entry, error) {
+	return archive.List(archivePath)
+}
+
+// CopyFromArchive extracts just the selected members of an archive into
+// destDir, renaming any whose names are taken. paths point inside a single
+// archive, e.g. "/a/foo.zip/docs".
+func (a *App) CopyFromArchive(paths []string, destDir string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("nothing selected")
+	}
+
+	archivePath, _, ok := archive.SplitPath(paths[0])
+	if !ok {
+		return fmt.Errorf("%s is not inside an archive", paths[0])
+	}
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		inArchive, inner, ok := archive.SplitPath(p)
+		if !ok || inArchive != archivePath {
+			return fmt.Errorf("all selected files must be in the same archive")
+		}
+		names[i] = inner
+	}
+
+	ctx, done, err := a.startArchiveJob()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	return archive.ExtractEntries(ctx, a.store, archivePath, names, archive.ExtractOptions{Destination: destDir}, func(p archive.Progress) {
+		runtime.EventsEmit(a.ctx, archiveProgressEvent, p)
+	})
+}
+
+// startArchiveJob registers a cancellable archive operation. Only one runs
+// at a time; call done when it finishes.
+func (a *App) startArchiveJob() (context.Context, func(), error) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.archiveMux.Lock()
+	defer a.archiveMux.Unlock()
+	if a.archiveCancel != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("another archive operation is already running")
+	}
+	a.archiveCancel = cancel
+
+	return ctx, func() {
+		a.archiveMux.Lock()
+		a.archiveCancel = nil
+		a.archiveMux.Unlock()
+		cancel()
+	}, nil
+}
+
+// CancelArchive stops the archive operation currently running
+func (a *App) CancelArchive() {
+	a.archiveMux.Lock()
+	defer a.archiveMux.Unlock()
+	if a.archiveCancel != nil {
+		a.archiveCancel()
+	}
+}
+
+// UploadToDrive queues local files and folders to be uploaded into a Drive
+// folder. Progress is reported through transferProgressEvent.
+func (a *App) UploadToDrive(localPaths []string, driveFolder string) (transfer.Job, error) {
+	return transfer.Upload(localPaths, driveFolder)
+}
+
+// DownloadFromDrive queues Drive files and folders to be downloaded into
+// localDir, exporting Google Docs as "office" (docx, xlsx, pptx) or "pdf"
+func (a *App) DownloadFromDrive(drivePaths []string, localDir string, format string) (transfer.Job, error) {
+	return transfer.Download(drivePaths, localDir, format)
+}
+
+// ListTransfers returns the queued, running and finished uploads and
+// downloads
+func (a *App) ListTransfers() []transfer.Job {
+	return transfer.List()
+}
+
+func (a *App) CancelTransfer(id string) error {
+	return transfer.Cancel(id)
+}
+
+func (a *App) ClearFinishedTransfers() {
+	transfer.ClearFinished()
+}
+
+// AddSyncFolder starts mirroring a local folder to a Drive folder and runs
+// its first sync in the background
+func (a *App) AddSyncFolder(localPath string, driveFolder string) (database.SyncRoot, error) {
+	root, err := drivesync.AddFolder(a.ctx, a.store, localPath, driveFolder)
+	if err != nil {
+		return root, err
+	}
+	go func() {
+		if _, err := drivesync.Sync(a.ctx, a.store, root.Path); err != nil {
+			logger.Warn("first sync failed", "root", root.Path, "error", err)
+		}
+	}()
+	return root, nil
+}
+
+func (a *App) RemoveSyncFolder(localPath string) error {
+	return drivesync.RemoveFolder(a.store, localPath)
+}
+
+func (a *App) ListSyncFolders() ([]database.SyncRoot, error) {
+	return drivesync.ListFolders(a.store)
+}
+
+// SyncNow syncs one folder, or every synced folder when localPath is empty
+func (a *App) SyncNow(localPath string) ([]drivesync.Report, error) {
+	if localPath == "" {
+		return drivesync.SyncAll(a.ctx, a.store)
+	}
+	report, err := drivesync.Sync(a.ctx, a.store, localPath)
+	if err != nil {
+		return nil, err
+	}
+	return []drivesync.Report{*report}, nil
+}
+
+// ResolveSyncConflict marks a file kept after a sync conflict as synced
+func (a *App) ResolveSyncConflict(path string) error {
+	return drivesync.ResolveConflict(a.store, path)
 }
 
 func (a *App) UnZip(zipPath string) error {
-	return contextmenu.UnZip(zipPath)
+	return contextmenu.UnZip(a.store, zipPath)
 }
 
 // AI Methods
@@ -175,14 +520,136 @@ func (a *App) GetAICommands(prompt string, currentPath string) ([]AI.Command, er
 }
 
 func (a *App) ExecuteAICommands(commands []AI.Command) []error {
-	return AI.ExecuteCommands(commands)
+	return AI.ExecuteCommands(a.store, commands)
 }
 
 func (a *App) SummarizeDirectory(directoryPath string) (*AI.SummarizeResponse, error) {
-	return AI.SummarizeDirectory(directoryPath)
+	return AI.SummarizeDirectory(a.store, directoryPath)
+}
+
+// GetPathPolicy returns the folders the app may change and those it protects
+func (a *App) GetPathPolicy() sandbox.Policy {
+	return sandbox.GetPolicy()
+}
+
+// SetPathPolicy replaces the allowed and protected folders
+func (a *App) SetPathPolicy(policy sandbox.Policy) error {
+	_, err := settings.Modify(a.store, func(s *settings.Settings) {
+		s.PathPolicy = policy
+	})
+	return err
+}
+
+// ListCredentials reports which credentials are set and where, never their
+// values
+func (a *App) ListCredentials() ([]credentials.Status, error) {
+	return credentials.List()
+}
+
+// SetCredential stores an API key or OAuth client setting
+func (a *App) SetCredential(name string, value string) error {
+	if err := credentials.CheckConfigurable(name); err != nil {
+		return err
+	}
+	if err := credentials.Set(name, value); err != nil {
+		return err
+	}
+	if name == credentials.GoogleClientID || name == credentials.GoogleClientSecret {
+		a.initGoogleOAuth()
+	}
+	return nil
+}
+
+// DeleteCredential removes a stored credential. One also set in the
+// environment will still be used.
+func (a *App) DeleteCredential(name string) error {
+	if err := credentials.CheckConfigurable(name); err != nil {
+		return err
+	}
+	return credentials.Delete(name)
+}
+
+// TestCredential checks a stored credential against its service
+func (a *App) TestCredential(name string) error {
+	if err := credentials.CheckConfigurable(name); err != nil {
+		return err
+	}
+
+	switch name {
+	case credentials.CerebrasAPIKey:
+		apiKey, err := credentials.Get(name)
+		if err != nil {
+			return apperror.New(apperror.CodeNotFound, "no Cerebras API key set")
+		}
+		return AI.TestAPIKey(apiKey)
+	default:
+		clientID, err := credentials.Get(credentials.GoogleClientID)
+		if err != nil {
+			return apperror.New(apperror.CodeNotFound, "no Google client ID set")
+		}
+		clientSecret, err := credentials.Get(credentials.GoogleClientSecret)
+		if err != nil {
+			return apperror.New(apperror.CodeNotFound, "no Google client secret set")
+		}
+		return connections.TestClientConfig(clientID, clientSecret)
+	}
+}
+
+// GetSettings returns every user-configurable option
+func (a *App) GetSettings() settings.Settings {
+	return settings.Get()
+}
+
+// UpdateSettings validates and saves s, returning the settings in effect
+func (a *App) UpdateSettings(s settings.Settings) (settings.Settings, error) {
+	return settings.Update(a.store, s)
+}
+
+// ExportDiagnostics writes a zip of the logs and app configuration to destDir,
+// or the Downloads folder when it's empty, and returns its path
+func (a *App) ExportDiagnostics(destDir string) (string, error) {
+	return diagnostics.Export(a.store, a.storeStatus, destDir)
+}
+
+// SetLogLevel changes how verbose a subsystem's logs are, or the default
+// when subsystem is ""
+func (a *App) SetLogLevel(subsystem string, level string) error {
+	_, err := settings.Modify(a.store, func(s *settings.Settings) {
+		s.LogLevels[subsystem] = level
+	})
+	return err
+}
+
+// ReconcileExternalFiles fixes up the mappings of pointer files, such as
+// .goox files, under roots or the home folder when none are given
+func (a *App) ReconcileExternalFiles(roots []string) (*pointers.Report, error) {
+	if len(roots) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		roots = []string{homeDir}
+	}
+	return pointers.Reconcile(a.ctx, a.store, roots)
+}
+
+// RebuildExternalFiles repopulates the mappings of pointer files from the
+// pointers under roots, or the home folder when none are given, upgrading
+// legacy ones to the current format
+func (a *App) RebuildExternalFiles(roots []string) (*pointers.RebuildReport, error) {
+	return pointers.Rebuild(a.ctx, a.store, roots, connections.GetConnectedEmail())
+}
+
+// GetRecentFolders returns up to limit folders visited, most recent first
+func (a *App) GetRecentFolders(limit int) ([]database.HistoryEntry, error) {
+	return a.store.ListHistory(limit)
 }
 
 func (a *App) GoUpDirectory(currentPath string) (string, error) {
+	if gdrive.IsPath(currentPath) {
+		return gdrive.Parent(context.Background(), currentPath)
+	}
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -191,7 +658,32 @@ func (a *App) GoUpDirectory(currentPath string) (string, error) {
 }
 
 func (a *App) ReadFileContent(filePath string) (string, error) {
-	return backend.ReadFileContent(filePath)
+	return backend.ReadFileContent(a.ctx, filePath)
+}
+
+// Tag Methods
+func (a *App) ListTags() ([]database.Tag, error) {
+	return tags.ListTags(a.store)
+}
+
+func (a *App) CreateTag(name string, color string) error {
+	return tags.CreateTag(a.store, name, color)
+}
+
+func (a *App) DeleteTag(name string) error {
+	return tags.DeleteTag(a.store, name)
+}
+
+func (a *App) AddTag(path string, name string) error {
+	return tags.AddTag(a.store, path, name)
+}
+
+func (a *App) RemoveTag(path string, name string) error {
+	return tags.RemoveTag(a.store, path, name)
+}
+
+func (a *App) GetFileTags(path string) ([]string, error) {
+	return tags.GetFileTags(a.store, path)
 }
 
 // Google Authentication Methods
@@ -229,7 +721,26 @@ func (a *App) ShareFile(filePath string, recipientEmail string) error {
 
 // Google Docs Methods
 func (a *App) CreateGoogleDoc(directory string, name string) error {
-	return google.CreateGoogleDoc(directory, name)
+	return google.CreateGoogleDoc(a.store, directory, name)
+}
+
+// ImportGoogleFiles writes pointer files into directory for the Drive files
+// fileIDs, such as Docs picked from ListGoogleDocs, skipping ones that are
+// already linked
+func (a *App) ImportGoogleFiles(directory string, fileIDs []string) (*google.ImportReport, error) {
+	return google.ImportGoogleFiles(a.ctx, a.store, directory, fileIDs)
+}
+
+// CreateGoogleFile creates a Google file of one of the pointer kinds, such
+// as "google_sheet", with a pointer file for it in directory
+func (a *App) CreateGoogleFile(directory string, name string, fileType string) error {
+	return google.CreateGoogleFile(a.store, directory, name, fileType)
+}
+
+// GetPointerKinds lists the Google file types that can be created and the
+// extensions of their pointer files
+func (a *App) GetPointerKinds() []pointers.Kind {
+	return pointers.Kinds
 }
 
 // Entity Map Methods
@@ -237,11 +748,44 @@ func (a *App) GetFolderTree(rootPath string, maxDepth int) (*entity.FolderNode,
 	return entity.GetFolderTree(rootPath, maxDepth)
 }
 
+// GetDiskUsage analyzes where the bytes under rootPath go. Starting another
+// analysis cancels the one running.
+func (a *App) GetDiskUsage(rootPath string, maxDepth int, topN int) (*entity.DiskUsage, error) {
+	a.usageMux.Lock()
+	if a.usageCancel != nil {
+		a.usageCancel()
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.usageCancel = cancel
+	a.usageMux.Unlock()
+	defer cancel()
+
+	return entity.GetDiskUsage(ctx, rootPath, maxDepth, topN)
+}
+
+// CancelDiskUsage stops the disk usage analysis currently running
+func (a *App) CancelDiskUsage() {
+	a.usageMux.Lock()
+	defer a.usageMux.Unlock()
+	if a.usageCancel != nil {
+		a.usageCancel()
+	}
+}
+
+// Duplicate Finder Methods
+func (a *App) FindDuplicates(roots []string, opts duplicates.Options) (*duplicates.Report, error) {
+	return duplicates.FindDuplicates(a.ctx, roots, opts)
+}
+
+func (a *App) ResolveDuplicates(set duplicates.DuplicateSet, action string, keepPath string) error {
+	return duplicates.Resolve(a.store, set, action, keepPath)
+}
+
 // AI Recommendation Methods
 func (a *App) RecommendMove(fileName string, fileData string) (*AI.RecommendMoveResponse, error) {
 	return AI.RecommendMove(fileName, fileData)
 }
 
 func (a *App) MoveFile(sourcePath string, destinationDir string) error {
-	return contextmenu.MoveFile(sourcePath, destinationDir)
+	return contextmenu.MoveFile(a.store, sourcePath, destinationDir)
 }
@@ -3,18 +3,25 @@ package AI
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/credentials"
+	"Finder-2/backend/database"
 	"Finder-2/backend/entity"
-
-	"github.com/joho/godotenv"
+	"Finder-2/backend/logging"
+	"Finder-2/backend/settings"
 )
 
+var logger = logging.For("ai")
+
 // Command represents a single AI command to execute
 type Command struct {
 	Action string `json:"action"` // "createFolder" or "createFile"
@@ -68,16 +75,11 @@ type ChatResponse struct {
 	Choices []ChatChoice `json:"choices"`
 }
 
-// init loads environment variables
-func init() {
-	godotenv.Load()
-}
-
 // GetAICommands takes a user prompt and current path, returns commands to execute
 func GetAICommands(userPrompt string, currentPath string) ([]Command, error) {
-	apiKey := os.Getenv("CEREBRAS_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("CEREBRAS_API_KEY not found in environment variables")
+	apiKey, err := getAPIKey()
+	if err != nil {
+		return nil, err
 	}
 
 	// Create system prompt to guide AI
@@ -104,7 +106,7 @@ Rules:
 - NO explanations, ONLY JSON`, currentPath, currentPath, currentPath)
 
 	requestBody := ChatRequest{
-		Model: "qwen-3-235b-a22b-instruct-2507",
+		Model: settings.Get().AIModel,
 		Messages: []Message{
 			{Role: "system", Content: systemPrompt},
 			{Role: "user", Content: userPrompt},
@@ -128,27 +130,27 @@ Rules:
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, apperror.AIProvider(err, "failed to send request")
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, apperror.AIProvider(err, "failed to read response")
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, statusError(resp.StatusCode, body)
 	}
 
 	var chatResponse ChatResponse
 	err = json.Unmarshal(body, &chatResponse)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, apperror.AIProvider(err, "failed to parse response")
 	}
 
 	if len(chatResponse.Choices) == 0 {
-		return nil, fmt.Errorf("no response from API")
+		return nil, apperror.New(apperror.CodeAIProvider, "no response from API")
 	}
 
 	// Parse the AI's JSON response
@@ -156,29 +158,73 @@ Rules:
 	var aiResponse AIResponse
 	err = json.Unmarshal([]byte(aiContent), &aiResponse)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse AI commands: %w. Response: %s", err, aiContent)
+		return nil, apperror.AIProvider(err, "failed to parse AI commands from response %q", aiContent)
 	}
 
 	return aiResponse.Commands, nil
 }
 
+// statusError turns a failed API response into a typed error. Cerebras
+// answers 429 when the rate limit or token quota is used up.
+func statusError(status int, body []byte) error {
+	err := fmt.Errorf("API request failed with status %d: %s", status, string(body))
+	if status == http.StatusTooManyRequests {
+		return apperror.QuotaExceeded("Cerebras", err)
+	}
+	return apperror.AIProvider(err, "the AI service returned an error")
+}
+
+// getAPIKey returns the Cerebras key from the credentials manager
+func getAPIKey() (string, error) {
+	apiKey, err := credentials.Get(credentials.CerebrasAPIKey)
+	if errors.Is(err, credentials.ErrNotFound) {
+		return "", apperror.New(apperror.CodeAIProvider, "no Cerebras API key set, add one in settings")
+	}
+	return apiKey, err
+}
+
+// TestAPIKey checks that apiKey is accepted by listing the available models
+func TestAPIKey(apiKey string) error {
+	req, err := http.NewRequest("GET", "https://api.cerebras.ai/v1/models", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return apperror.AIProvider(err, "failed to reach the AI service")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return apperror.New(apperror.CodeAIProvider, "the Cerebras API key was rejected")
+		}
+		return statusError(resp.StatusCode, body)
+	}
+	return nil
+}
+
 // ExecuteCommands executes the approved commands
-func ExecuteCommands(commands []Command) []error {
+func ExecuteCommands(sizes database.FolderSizeStore, commands []Command) []error {
 	var errors []error
 
 	for _, cmd := range commands {
 		var err error
 		switch cmd.Action {
 		case "createFolder":
-			err = CreateFolder(cmd.Path, cmd.Name)
+			err = CreateFolder(sizes, cmd.Path, cmd.Name)
 		case "createFile":
-			err = CreateFile(cmd.Path, cmd.Name)
+			err = CreateFile(sizes, cmd.Path, cmd.Name)
 		default:
-			err = fmt.Errorf("unknown action: %s", cmd.Action)
+			err = apperror.New(apperror.CodeInvalid, "unknown action: %s", cmd.Action)
 		}
 
 		if err != nil {
-			errors = append(errors, fmt.Errorf("failed to execute %s '%s': %w", cmd.Action, cmd.Name, err))
+			errors = append(errors, apperror.Wrap(apperror.CodeOf(err), err, "failed to execute %s '%s'", cmd.Action, cmd.Name))
 		}
 	}
 
@@ -186,10 +232,10 @@ func ExecuteCommands(commands []Command) []error {
 }
 
 // SummarizeDirectory analyzes a directory and returns descriptions for each item
-func SummarizeDirectory(directoryPath string) (*SummarizeResponse, error) {
-	apiKey := os.Getenv("CEREBRAS_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("CEREBRAS_API_KEY not found in environment variables")
+func SummarizeDirectory(sizes database.FolderSizeStore, directoryPath string) (*SummarizeResponse, error) {
+	apiKey, err := getAPIKey()
+	if err != nil {
+		return nil, err
 	}
 
 	// Read directory contents
@@ -249,7 +295,7 @@ Rules:
 	userPrompt := fmt.Sprintf("Directory: %s\n\nContents:\n%s", directoryPath, itemsList)
 
 	requestBody := ChatRequest{
-		Model: "qwen-3-235b-a22b-instruct-2507",
+		Model: settings.Get().AIModel,
 		Messages: []Message{
 			{Role: "system", Content: systemPrompt},
 			{Role: "user", Content: userPrompt},
@@ -273,27 +319,27 @@ Rules:
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, apperror.AIProvider(err, "failed to send request")
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, apperror.AIProvider(err, "failed to read response")
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, statusError(resp.StatusCode, body)
 	}
 
 	var chatResponse ChatResponse
 	err = json.Unmarshal(body, &chatResponse)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, apperror.AIProvider(err, "failed to parse response")
 	}
 
 	if len(chatResponse.Choices) == 0 {
-		return nil, fmt.Errorf("no response from API")
+		return nil, apperror.New(apperror.CodeAIProvider, "no response from API")
 	}
 
 	// Parse the AI's JSON response
@@ -301,11 +347,11 @@ Rules:
 	var summarizeResponse SummarizeResponse
 	err = json.Unmarshal([]byte(aiContent), &summarizeResponse)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse AI summary: %w. Response: %s", err, aiContent)
+		return nil, apperror.AIProvider(err, "failed to parse AI summary from response %q", aiContent)
 	}
 
 	// Write the summary to a file in the directory
-	err = writeSummaryFile(directoryPath, &summarizeResponse)
+	err = writeSummaryFile(sizes, directoryPath, &summarizeResponse)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write summary file: %w", err)
 	}
@@ -314,7 +360,7 @@ Rules:
 }
 
 // writeSummaryFile creates a summary text file in the directory
-func writeSummaryFile(directoryPath string, summary *SummarizeResponse) error {
+func writeSummaryFile(sizes database.FolderSizeStore, directoryPath string, summary *SummarizeResponse) error {
 	var content string
 	content += "=== Directory Summary ===\n\n"
 	content += summary.Summary + "\n\n"
@@ -326,7 +372,7 @@ func writeSummaryFile(directoryPath string, summary *SummarizeResponse) error {
 
 	content += "---\nGenerated by Finder AI\n"
 
-	return CreateFileWithContent(directoryPath, ".directory_summary.txt", content)
+	return CreateFileWithContent(sizes, directoryPath, ".directory_summary.txt", content)
 }
 
 // RecommendMoveResponse represents the AI response for move recommendations
@@ -336,31 +382,29 @@ type RecommendMoveResponse struct {
 
 // RecommendMove analyzes a file and recommends top 3 folders to move it to
 func RecommendMove(fileName string, fileData string) (*RecommendMoveResponse, error) {
-	fmt.Println("[RecommendMove] Starting for file:", fileName)
+	log := logger.With("op", "RecommendMove", "file", fileName)
+	log.Debug("starting")
 
-	apiKey := os.Getenv("CEREBRAS_API_KEY")
-	if apiKey == "" {
-		fmt.Println("[RecommendMove] ERROR: CEREBRAS_API_KEY not found")
-		return nil, fmt.Errorf("CEREBRAS_API_KEY not found in environment variables")
+	apiKey, err := getAPIKey()
+	if err != nil {
+		log.Error("no Cerebras API key", "error", err)
+		return nil, err
 	}
-	fmt.Println("[RecommendMove] API key found")
 
 	// Get the Documents directory
-	homeDir, err := os.UserHomeDir()
+	documentsPath, err := settings.DocumentsRoot()
 	if err != nil {
-		fmt.Println("[RecommendMove] ERROR: failed to get home directory:", err)
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		log.Error("failed to get Documents directory", "error", err)
+		return nil, fmt.Errorf("failed to get Documents directory: %w", err)
 	}
-	documentsPath := filepath.Join(homeDir, "Documents")
-	fmt.Println("[RecommendMove] Documents path:", documentsPath)
 
 	// Collect all folder names (stopping at project boundaries)
 	folders := collectFolders(documentsPath, 10)
-	fmt.Println("[RecommendMove] Found", len(folders), "folders")
+	log.Debug("collected folders", "root", documentsPath, "count", len(folders))
 
 	if len(folders) == 0 {
-		fmt.Println("[RecommendMove] ERROR: no folders found")
-		return nil, fmt.Errorf("no folders found in Documents directory")
+		log.Warn("no folders found", "root", documentsPath)
+		return nil, apperror.New(apperror.CodeNotFound, "no folders found in %s", documentsPath)
 	}
 
 	// Build folder list for prompt
@@ -394,7 +438,7 @@ Rules:
 	userPrompt := fmt.Sprintf("File name: %s\n\nFile data/content:\n%s\n\nAvailable folders:\n%s", fileName, truncatedData, folderList)
 
 	requestBody := ChatRequest{
-		Model: "qwen-3-235b-a22b-instruct-2507",
+		Model: settings.Get().AIModel,
 		Messages: []Message{
 			{Role: "system", Content: systemPrompt},
 			{Role: "user", Content: userPrompt},
@@ -418,47 +462,44 @@ Rules:
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, apperror.AIProvider(err, "failed to send request")
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, apperror.AIProvider(err, "failed to read response")
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		fmt.Println("[RecommendMove] ERROR: API request failed with status", resp.StatusCode)
-		fmt.Println("[RecommendMove] Response body:", string(body))
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		log.Error("API request failed", "status", resp.StatusCode, "body", string(body))
+		return nil, statusError(resp.StatusCode, body)
 	}
 
-	fmt.Println("[RecommendMove] API request successful")
-
 	var chatResponse ChatResponse
 	err = json.Unmarshal(body, &chatResponse)
 	if err != nil {
-		fmt.Println("[RecommendMove] ERROR: failed to parse response:", err)
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		log.Error("failed to parse response", "error", err)
+		return nil, apperror.AIProvider(err, "failed to parse response")
 	}
 
 	if len(chatResponse.Choices) == 0 {
-		fmt.Println("[RecommendMove] ERROR: no choices in response")
-		return nil, fmt.Errorf("no response from API")
+		log.Error("no choices in response")
+		return nil, apperror.New(apperror.CodeAIProvider, "no response from API")
 	}
 
 	// Parse the AI's JSON response
 	aiContent := chatResponse.Choices[0].Message.Content
-	fmt.Println("[RecommendMove] AI response:", aiContent)
+	log.Debug("AI response", "content", aiContent)
 
 	var recommendResponse RecommendMoveResponse
 	err = json.Unmarshal([]byte(aiContent), &recommendResponse)
 	if err != nil {
-		fmt.Println("[RecommendMove] ERROR: failed to parse AI JSON:", err)
-		return nil, fmt.Errorf("failed to parse AI recommendations: %w. Response: %s", err, aiContent)
+		log.Error("failed to parse AI JSON", "error", err)
+		return nil, apperror.AIProvider(err, "failed to parse AI recommendations from response %q", aiContent)
 	}
 
-	fmt.Println("[RecommendMove] Successfully parsed", len(recommendResponse.Paths), "recommendations")
+	log.Info("recommendations ready", "count", len(recommendResponse.Paths))
 	return &recommendResponse, nil
 }
 
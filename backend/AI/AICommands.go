@@ -4,40 +4,53 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/sandbox"
 )
 
 // CreateFolder creates a new folder at the specified path with the given name
-func CreateFolder(path string, name string) error {
-	fullPath := filepath.Join(path, name)
+func CreateFolder(sizes database.FolderSizeStore, path string, name string) error {
+	fullPath, err := checkTarget(path, name)
+	if err != nil {
+		return err
+	}
 
 	if _, err := os.Stat(fullPath); err == nil {
-		return fmt.Errorf("folder already exists: %s", fullPath)
+		return apperror.AlreadyExists(fullPath)
 	}
 
-	err := os.Mkdir(fullPath, 0755)
+	err = os.Mkdir(fullPath, 0755)
 	if err != nil {
-		return fmt.Errorf("failed to create folder: %w", err)
+		return apperror.FromOS(err, fullPath)
 	}
 
+	foldersize.Invalidate(sizes, fullPath)
 	return nil
 }
 
-func CreateFile(path string, name string) error {
-	return CreateFileWithContent(path, name, "")
+func CreateFile(sizes database.FolderSizeStore, path string, name string) error {
+	return CreateFileWithContent(sizes, path, name, "")
 }
 
 // CreateFileWithContent creates a new file with the given content
-func CreateFileWithContent(path string, name string, content string) error {
-	fullPath := filepath.Join(path, name)
+func CreateFileWithContent(sizes database.FolderSizeStore, path string, name string, content string) error {
+	fullPath, err := checkTarget(path, name)
+	if err != nil {
+		return err
+	}
 
 	if _, err := os.Stat(fullPath); err == nil {
-		return fmt.Errorf("file already exists: %s", fullPath)
+		return apperror.AlreadyExists(fullPath)
 	}
 
 	file, err := os.Create(fullPath)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return apperror.FromOS(err, fullPath)
 	}
+	defer foldersize.Invalidate(sizes, fullPath)
 	defer file.Close()
 
 	if content != "" {
@@ -49,3 +62,12 @@ func CreateFileWithContent(path string, name string, content string) error {
 
 	return nil
 }
+
+// checkTarget applies the sandbox to a path and name suggested by the model,
+// which must not be trusted to stay inside the allowed folders
+func checkTarget(path string, name string) (string, error) {
+	if err := sandbox.CheckName(name); err != nil {
+		return "", err
+	}
+	return sandbox.Check(filepath.Join(path, name), sandbox.Write)
+}
@@ -0,0 +1,220 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// Error codes sent to the frontend alongside the message
+const (
+	CodeNotFound         = "not_found"
+	CodeAlreadyExists    = "already_exists"
+	CodePermissionDenied = "permission_denied"
+	CodeCrossDevice      = "cross_device"
+	CodeNotConnected     = "not_connected"
+	CodeReauthRequired   = "reauth_required"
+	CodeAIProvider       = "ai_provider_error"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodePasswordRequired = "password_required"
+	CodeConflict         = "conflict" // the file changed since the UI last saw it
+	CodeInvalid          = "invalid"
+	CodeUnknown          = "unknown"
+)
+
+// Error is an error the frontend can act on by its Code
+type Error struct {
+	Code    string
+	Message string // shown to the user as is
+	Path    string // the file involved, if any
+	Err     error  // the underlying cause, if any
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON sends the same shape as Format, for errors returned inside
+// values such as a list of per-command failures
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Format(e))
+}
+
+// Is makes errors.Is(err, &Error{Code: ...}) match on the code alone
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.Code == e.Code
+}
+
+// New returns an Error with the given code
+func New(code string, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap returns an Error with the given code that wraps err, whose message
+// is appended like fmt.Errorf("...: %w")
+func Wrap(code string, err error, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...) + ": " + err.Error(), Err: err}
+}
+
+func NotFound(path string) *Error {
+	return &Error{Code: CodeNotFound, Message: fmt.Sprintf("%s doesn't exist", path), Path: path}
+}
+
+func AlreadyExists(path string) *Error {
+	return &Error{Code: CodeAlreadyExists, Message: fmt.Sprintf("%s already exists", path), Path: path}
+}
+
+func PermissionDenied(path string) *Error {
+	return &Error{Code: CodePermissionDenied, Message: fmt.Sprintf("not allowed to change %s", path), Path: path}
+}
+
+func CrossDevice(path string) *Error {
+	return &Error{Code: CodeCrossDevice, Message: fmt.Sprintf("%s is on another disk and can't be moved there directly", path), Path: path}
+}
+
+// NotConnected is returned when an account such as Google isn't linked
+func NotConnected(service string) *Error {
+	return &Error{Code: CodeNotConnected, Message: fmt.Sprintf("not connected to %s", service)}
+}
+
+// ReauthRequired is returned when an account is linked, but its sign-in
+// doesn't grant everything the app now asks for and has to be redone
+func ReauthRequired(service string, err error) *Error {
+	return &Error{Code: CodeReauthRequired, Message: fmt.Sprintf("%s needs to be reconnected to grant the access this app now uses", service), Err: err}
+}
+
+// AIProvider is returned when the AI service fails or returns nonsense
+func AIProvider(err error, format string, args ...any) *Error {
+	return Wrap(CodeAIProvider, err, format, args...)
+}
+
+// QuotaExceeded is returned when a service rate-limits or runs out of space
+func QuotaExceeded(service string, err error) *Error {
+	return &Error{Code: CodeQuotaExceeded, Message: fmt.Sprintf("%s quota exceeded", service), Err: err}
+}
+
+// PasswordRequired is returned when an encrypted file is opened without
+// its password, or with the wrong one
+func PasswordRequired(path string, format string, args ...any) *Error {
+	return &Error{Code: CodePasswordRequired, Message: fmt.Sprintf(format, args...), Path: path}
+}
+
+// Conflict is returned when a file changed after the UI last looked at it,
+// so acting on what it showed could lose data
+func Conflict(path string, format string, args ...any) *Error {
+	return &Error{Code: CodeConflict, Message: fmt.Sprintf(format, args...), Path: path}
+}
+
+// FromOS classifies a filesystem error, returning err unchanged when it
+// isn't one of the known kinds. path is used when err doesn't name one.
+func FromOS(err error, path string) error {
+	if err == nil {
+		return nil
+	}
+	var typed *Error
+	if errors.As(err, &typed) {
+		return err
+	}
+
+	code := codeOfOS(err)
+	if code == "" {
+		return err
+	}
+
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	if errors.As(err, &pathErr) {
+		path = pathErr.Path
+	} else if errors.As(err, &linkErr) {
+		path = linkErr.Old
+	}
+
+	var e *Error
+	switch code {
+	case CodeNotFound:
+		e = NotFound(path)
+	case CodeAlreadyExists:
+		e = AlreadyExists(path)
+	case CodePermissionDenied:
+		e = PermissionDenied(path)
+	case CodeCrossDevice:
+		e = CrossDevice(path)
+	}
+	e.Err = err
+	return e
+}
+
+func codeOfOS(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return CodeNotFound
+	case errors.Is(err, fs.ErrExist):
+		return CodeAlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		return CodePermissionDenied
+	case errors.Is(err, syscall.EXDEV):
+		return CodeCrossDevice
+	}
+	return ""
+}
+
+// coded is implemented by errors from other packages that map onto a code,
+// such as the sandbox's. ErrorReason gives the finer-grained cause.
+type coded interface {
+	ErrorCode() string
+	ErrorReason() string
+}
+
+// CodeOf returns the code for any error, classifying plain filesystem
+// errors as well
+func CodeOf(err error) string {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Code
+	}
+	var c coded
+	if errors.As(err, &c) {
+		return c.ErrorCode()
+	}
+	if code := codeOfOS(err); code != "" {
+		return code
+	}
+	return CodeUnknown
+}
+
+// Payload is what the frontend receives in place of an error string
+type Payload struct {
+	Code    string `json:"code"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message"`
+	Path    string `json:"path,omitempty"`
+}
+
+// Format converts an error returned from a bound method for the frontend.
+// It's used as the Wails ErrorFormatter.
+func Format(err error) any {
+	payload := Payload{Code: CodeOf(err), Message: err.Error()}
+
+	var typed *Error
+	if errors.As(err, &typed) {
+		payload.Path = typed.Path
+	}
+	var c coded
+	if errors.As(err, &c) {
+		payload.Reason = c.ErrorReason()
+	}
+	var pathErr *fs.PathError
+	if payload.Path == "" && errors.As(err, &pathErr) {
+		payload.Path = pathErr.Path
+	}
+
+	return payload
+}
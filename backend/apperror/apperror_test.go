@@ -0,0 +1,122 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// sandboxError stands in for the errors of packages that implement coded
+type sandboxError struct{}
+
+func (sandboxError) Error() string       { return "outside the allowed folders" }
+func (sandboxError) ErrorCode() string   { return CodePermissionDenied }
+func (sandboxError) ErrorReason() string { return "outside_roots" }
+
+func TestFromOS(t *testing.T) {
+	typed := New(CodeInvalid, "bad input")
+	plain := errors.New("something else")
+	eio := &fs.PathError{Op: "read", Path: "/a/x", Err: syscall.EIO}
+
+	tests := []struct {
+		name string
+		err  error
+		path string
+		code string // "" when err should come back unchanged
+		want string // path the result names
+	}{
+		{"not exist", &fs.PathError{Op: "open", Path: "/a/x", Err: syscall.ENOENT}, "/other", CodeNotFound, "/a/x"},
+		{"exists", &fs.PathError{Op: "mkdir", Path: "/a/x", Err: syscall.EEXIST}, "", CodeAlreadyExists, "/a/x"},
+		{"access", &fs.PathError{Op: "open", Path: "/a/x", Err: syscall.EACCES}, "", CodePermissionDenied, "/a/x"},
+		{"not permitted", &fs.PathError{Op: "unlink", Path: "/a/x", Err: syscall.EPERM}, "", CodePermissionDenied, "/a/x"},
+		{"cross device", &os.LinkError{Op: "rename", Old: "/a/x", New: "/b/x", Err: syscall.EXDEV}, "", CodeCrossDevice, "/a/x"},
+		{"bare errno", syscall.ENOENT, "/given", CodeNotFound, "/given"},
+		{"wrapped", fmt.Errorf("copying: %w", &fs.PathError{Op: "open", Path: "/a/x", Err: syscall.ENOENT}), "", CodeNotFound, "/a/x"},
+		{"other errno", eio, "", "", ""},
+		{"plain", plain, "/a/x", "", ""},
+		{"already typed", typed, "/a/x", "", ""},
+	}
+	for _, tt := range tests {
+		got := FromOS(tt.err, tt.path)
+		if tt.code == "" {
+			if got != tt.err {
+				t.Errorf("%s: FromOS = %v, want the error unchanged", tt.name, got)
+			}
+			continue
+		}
+		var e *Error
+		if !errors.As(got, &e) {
+			t.Errorf("%s: FromOS = %T, want *Error", tt.name, got)
+			continue
+		}
+		if e.Code != tt.code || e.Path != tt.want {
+			t.Errorf("%s: code/path = %s/%s, want %s/%s", tt.name, e.Code, e.Path, tt.code, tt.want)
+		}
+		if !errors.Is(got, tt.err) {
+			t.Errorf("%s: result doesn't wrap the original error", tt.name)
+		}
+	}
+
+	if FromOS(nil, "/a/x") != nil {
+		t.Error("FromOS(nil) isn't nil")
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"typed", NotFound("/a/x"), CodeNotFound},
+		{"wrapped typed", fmt.Errorf("listing: %w", QuotaExceeded("Google", nil)), CodeQuotaExceeded},
+		{"twice wrapped typed", fmt.Errorf("sync: %w", fmt.Errorf("upload: %w", ReauthRequired("Google", nil))), CodeReauthRequired},
+		{"typed wrapping another code", Wrap(CodeInvalid, NotFound("/a/x"), "bad"), CodeInvalid},
+		{"coded", sandboxError{}, CodePermissionDenied},
+		{"wrapped coded", fmt.Errorf("rename: %w", sandboxError{}), CodePermissionDenied},
+		{"filesystem", &fs.PathError{Op: "open", Path: "/a/x", Err: syscall.ENOENT}, CodeNotFound},
+		{"wrapped filesystem", fmt.Errorf("open: %w", fs.ErrExist), CodeAlreadyExists},
+		{"cross device", &os.LinkError{Op: "rename", Old: "/a", New: "/b", Err: syscall.EXDEV}, CodeCrossDevice},
+		{"plain", errors.New("boom"), CodeUnknown},
+	}
+	for _, tt := range tests {
+		if got := CodeOf(tt.err); got != tt.want {
+			t.Errorf("%s: CodeOf = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Payload
+	}{
+		{"typed", NotFound("/a/x"), Payload{Code: CodeNotFound, Message: "/a/x doesn't exist", Path: "/a/x"}},
+		{"wrapped typed", fmt.Errorf("moving: %w", AlreadyExists("/a/x")), Payload{Code: CodeAlreadyExists, Message: "moving: /a/x already exists", Path: "/a/x"}},
+		{"coded", fmt.Errorf("rename: %w", sandboxError{}), Payload{Code: CodePermissionDenied, Reason: "outside_roots", Message: "rename: outside the allowed folders"}},
+		{"filesystem", &fs.PathError{Op: "open", Path: "/a/x", Err: syscall.ENOENT}, Payload{Code: CodeNotFound, Message: "open /a/x: no such file or directory", Path: "/a/x"}},
+		{"plain", errors.New("boom"), Payload{Code: CodeUnknown, Message: "boom"}},
+	}
+	for _, tt := range tests {
+		got, ok := Format(tt.err).(Payload)
+		if !ok || got != tt.want {
+			t.Errorf("%s: Format = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalJSONMatchesFormat(t *testing.T) {
+	data, err := json.Marshal(map[string]error{"error": PermissionDenied("/a/x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"error":{"code":"permission_denied","message":"not allowed to change /a/x","path":"/a/x"}}`
+	if string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,218 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Ways of handling symlinks when creating an archive
+const (
+	SymlinksPreserve = "preserve" // store the link itself (default)
+	SymlinksFollow   = "follow"   // store what the link points to
+	SymlinksSkip     = "skip"     // leave links out
+)
+
+// DefaultExcludes are left out of archives made from the context menu
+var DefaultExcludes = []string{
+	".git",
+	"node_modules",
+	".DS_Store",
+	"__pycache__",
+}
+
+// Progress reports how far an archive operation has got
+type Progress struct {
+	BytesDone  int64  `json:"bytesDone"`
+	BytesTotal int64  `json:"bytesTotal"`
+	FilesDone  int    `json:"filesDone"`
+	FilesTotal int    `json:"filesTotal"`
+	Current    string `json:"current"` // entry being processed
+}
+
+// ProgressFunc receives progress updates; it may be nil
+type ProgressFunc func(Progress)
+
+// entry is a file or folder to be written into an archive
+type entry struct {
+	path string      // on disk
+	name string      // inside the archive, slash-separated
+	info os.FileInfo // Lstat info, or Stat info when following links
+}
+
+// collectEntries walks the inputs and returns everything to archive. Names
+// are relative to each input's parent folder, so archiving "a/b" stores
+// "b/...".
+func collectEntries(ctx context.Context, inputs []string, exclude []string, symlinks string) ([]entry, error) {
+	return collect(ctx, inputs, exclude, symlinks, nil)
+}
+
+// collect does the work of collectEntries. following holds the folders
+// being walked, including those reached through followed links, so a link
+// back into one of them, such as "loop -> .", isn't followed forever.
+func collect(ctx context.Context, inputs []string, exclude []string, symlinks string, following []os.FileInfo) ([]entry, error) {
+	var entries []entry
+
+	for _, input := range inputs {
+		input = filepath.Clean(input)
+		base := filepath.Dir(input)
+
+		chain := following[:len(following):len(following)]
+		if info, err := os.Stat(input); err == nil && info.IsDir() {
+			chain = append(chain, info)
+		}
+
+		err := filepath.WalkDir(input, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+
+			rel, err := filepath.Rel(base, p)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+
+			// Inputs the user picked explicitly are never excluded
+			if p != input && isExcluded(name, exclude) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			if info.Mode()&os.ModeSymlink != 0 {
+				switch symlinks {
+				case SymlinksSkip:
+					return nil
+				case SymlinksFollow:
+					target, err := os.Stat(p)
+					if err != nil {
+						// Broken links have nothing to follow
+						return nil
+					}
+					if target.IsDir() {
+						if isFollowing(chain, target) {
+							return nil
+						}
+						linked, err := collect(ctx, []string{p}, exclude, symlinks, chain)
+						if err != nil {
+							return err
+						}
+						prefix := path.Dir(name)
+						for _, e := range linked {
+							if prefix != "." {
+								e.name = prefix + "/" + e.name
+							}
+							entries = append(entries, e)
+						}
+						return nil
+					}
+					info = target
+				}
+			}
+
+			entries = append(entries, entry{path: p, name: name, info: info})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// isFollowing reports whether dir is one of the folders being walked
+func isFollowing(chain []os.FileInfo, dir os.FileInfo) bool {
+	for _, info := range chain {
+		if os.SameFile(info, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcluded matches each glob against the entry's base name and its full
+// archive path, so both "*.log" and "src/generated" work
+func isExcluded(name string, patterns []string) bool {
+	base := path.Base(name)
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// uniquePath returns path, or "name 1.ext", "name 2.ext"... if it's taken
+func uniquePath(p string, ext string) string {
+	if _, err := os.Lstat(p); os.IsNotExist(err) {
+		return p
+	}
+
+	dir := filepath.Dir(p)
+	base := strings.TrimSuffix(filepath.Base(p), ext)
+	for counter := 1; ; counter++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s %d%s", base, counter, ext))
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// defaultDestination names the archive after a single input, or "Archive"
+// when several are combined, next to the first input
+func defaultDestination(inputs []string, ext string) string {
+	dir := filepath.Dir(filepath.Clean(inputs[0]))
+	name := "Archive"
+	if len(inputs) == 1 {
+		name = filepath.Base(filepath.Clean(inputs[0]))
+	}
+	return uniquePath(filepath.Join(dir, name+ext), ext)
+}
+
+// progressWriter counts bytes written and reports them, checking for
+// cancellation as it goes
+type progressWriter struct {
+	ctx        context.Context
+	w          io.Writer
+	progress   *Progress
+	onProgress ProgressFunc
+	unreported int64
+}
+
+// Report at most this often while copying a large file
+const progressInterval = 256 * 1024
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	if err := pw.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := pw.w.Write(p)
+	pw.progress.BytesDone += int64(n)
+	pw.unreported += int64(n)
+	if pw.onProgress != nil && pw.unreported >= progressInterval {
+		pw.onProgress(*pw.progress)
+		pw.unreported = 0
+	}
+	return n, err
+}
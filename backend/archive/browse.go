@@ -0,0 +1,408 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/sandbox"
+)
+
+// MaxMemberPreview caps how much of a single member ReadMember returns
+const MaxMemberPreview = 64 * 1024 * 1024
+
+// SplitPath splits a path that points into an archive, such as
+// "/a/foo.zip/inner/dir", into the archive file and the slash-separated
+// name inside it ("inner/dir"). ok is false for ordinary paths.
+func SplitPath(p string) (archivePath string, inner string, ok bool) {
+	p = filepath.Clean(p)
+	for candidate := p; ; candidate = filepath.Dir(candidate) {
+		info, err := os.Stat(candidate)
+		if err == nil {
+			if !info.Mode().IsRegular() || !isBrowsable(candidate) {
+				return "", "", false
+			}
+			rel, err := filepath.Rel(candidate, p)
+			if err != nil {
+				return "", "", false
+			}
+			if rel == "." {
+				rel = ""
+			}
+			return candidate, filepath.ToSlash(rel), true
+		}
+
+		parent := filepath.Dir(candidate)
+		if parent == candidate {
+			return "", "", false
+		}
+	}
+}
+
+// isBrowsable reports whether an archive has members that can be listed
+func isBrowsable(archivePath string) bool {
+	format, err := Detect(archivePath)
+	if err != nil {
+		return false
+	}
+	return format == FormatZip || format == FormatTar || format == FormatSevenZip || tarCompressions[format] != ""
+}
+
+// ListDir returns the direct children of dir inside an archive. Folders
+// that only exist implicitly, as the parent of some member, are included.
+func ListDir(archivePath string, dir string) ([]Entry, error) {
+	entries, err := cachedList(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir = strings.Trim(dir, "/")
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	children := []Entry{}
+	seen := make(map[string]int)
+	found := dir == ""
+	for _, e := range entries {
+		name := strings.TrimPrefix(path.Clean("/"+e.Name), "/")
+		if name == dir {
+			found = true
+			continue
+		}
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		found = true
+
+		rest := strings.TrimPrefix(name, prefix)
+		child, _, nested := strings.Cut(rest, "/")
+		childName := prefix + child
+
+		if i, ok := seen[child]; ok {
+			// An explicit entry for the folder replaces the implied one
+			if !nested && e.IsDirectory {
+				children[i] = e
+				children[i].Name = childName
+			}
+			continue
+		}
+
+		if nested {
+			children = append(children, Entry{Name: childName, IsDirectory: true, ModifiedTime: e.ModifiedTime, Permissions: (os.ModeDir | 0755).String()})
+		} else {
+			e.Name = childName
+			children = append(children, e)
+		}
+		seen[child] = len(children) - 1
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%s not found in %s", dir, filepath.Base(archivePath))
+	}
+	return children, nil
+}
+
+// ReadMember returns the content of a single file inside an archive, up to
+// MaxMemberPreview bytes. Encrypted members aren't previewed and return a
+// password_required apperror. Cancelling ctx stops a 7z member being read.
+func ReadMember(ctx context.Context, archivePath string, name string) ([]byte, error) {
+	format, err := Detect(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.Trim(name, "/")
+
+	switch {
+	case format == FormatZip:
+		r, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		for _, f := range r.File {
+			if f.Name != name {
+				continue
+			}
+			if f.Mode().IsDir() {
+				return nil, fmt.Errorf("%s is a folder", name)
+			}
+			rc, err := openZipFile(f, "")
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return readLimited(rc)
+		}
+
+	case format == FormatTar || tarCompressions[format] != "":
+		var found []byte
+		err := walkTar(archivePath, tarCompressions[format], func(header *tar.Header, r io.Reader) (bool, error) {
+			if strings.TrimSuffix(header.Name, "/") != name {
+				return true, nil
+			}
+			if header.Typeflag != tar.TypeReg {
+				return false, fmt.Errorf("%s is not a regular file", name)
+			}
+			data, err := readLimited(r)
+			found = data
+			return false, err
+		})
+		if err != nil || found != nil {
+			return found, err
+		}
+
+	case format == FormatSevenZip:
+		entries, err := cachedList(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if strings.Trim(e.Name, "/") != name {
+				continue
+			}
+			if e.IsDirectory {
+				return nil, fmt.Errorf("%s is a folder", name)
+			}
+			rc, err := openSevenZipMember(ctx, archivePath, e.Name)
+			if err != nil {
+				return nil, err
+			}
+			// Closing stops 7z once the preview limit is reached
+			defer rc.Close()
+			return readLimited(rc)
+		}
+
+	default:
+		return nil, fmt.Errorf("%s archives have no members to read", format)
+	}
+
+	return nil, fmt.Errorf("%s not found in %s", name, filepath.Base(archivePath))
+}
+
+// ExtractEntries copies the selected members, and everything under any
+// selected folders, into opts.Destination, which is required. Each one lands
+// there under its own base name, as if it had been copied out of a folder.
+// The destination's size in sizes is invalidated.
+func ExtractEntries(ctx context.Context, sizes database.FolderSizeStore, archivePath string, names []string, opts ExtractOptions, onProgress ProgressFunc) error {
+	format, err := Detect(archivePath)
+	if err != nil {
+		return err
+	}
+	if opts.Destination == "" {
+		return fmt.Errorf("no destination folder")
+	}
+	if _, err := sandbox.Check(opts.Destination, sandbox.Write); err != nil {
+		return err
+	}
+
+	selected := make(map[string]string, len(names))
+	for _, name := range names {
+		name = strings.Trim(name, "/")
+		if name == "" {
+			return fmt.Errorf("no archive entry selected")
+		}
+		selected[name] = path.Dir(name)
+	}
+
+	x, err := newExtractor(ctx, archivePath, opts.Destination, opts, onProgress)
+	if err != nil {
+		return err
+	}
+	defer foldersize.Invalidate(sizes, opts.Destination)
+	x.rename = func(name string) (string, bool) {
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		for candidate := name; candidate != "." && candidate != "/"; candidate = path.Dir(candidate) {
+			if parent, ok := selected[candidate]; ok {
+				if parent == "." {
+					return name, true
+				}
+				return strings.TrimPrefix(name, parent+"/"), true
+			}
+		}
+		return "", false
+	}
+
+	switch {
+	case format == FormatZip:
+		return x.extractZip(archivePath)
+	case format == FormatTar || tarCompressions[format] != "":
+		return x.extractStream(archivePath, tarCompressions[format], true)
+	case format == FormatSevenZip:
+		return x.extractSevenZip(archivePath)
+	default:
+		return fmt.Errorf("copying out of %s archives is not supported", format)
+	}
+}
+
+// walkTar calls fn for each header in a tar, stopping when fn returns false
+func walkTar(archivePath string, compression string, fn func(*tar.Header, io.Reader) (bool, error)) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if compression != "" {
+		cr, err := compressors[compression].newReader(file)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+		r = cr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		more, err := fn(header, tr)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// sevenZipMember streams one member of a 7z archive out of the 7z tool
+type sevenZipMember struct {
+	out    io.ReadCloser
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
+	stderr bytes.Buffer
+	waited bool
+	err    error
+}
+
+// openSevenZipMember starts "7z x -so" for a single member. Closing the
+// reader, or cancelling ctx, kills 7z if it's still writing.
+func openSevenZipMember(ctx context.Context, archivePath string, name string) (*sevenZipMember, error) {
+	tool, err := exec.LookPath("7z")
+	if err != nil {
+		return nil, fmt.Errorf("reading 7z archives requires the 7z command")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	// -spd matches the name literally rather than as a wildcard
+	m := &sevenZipMember{cmd: exec.CommandContext(ctx, tool, "x", "-so", "-spd", "--", archivePath, name), ctx: ctx, cancel: cancel}
+	m.cmd.Stderr = &m.stderr
+	if m.out, err = m.cmd.StdoutPipe(); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := m.cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *sevenZipMember) Read(p []byte) (int, error) {
+	n, err := m.out.Read(p)
+	if err == io.EOF {
+		if waitErr := m.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (m *sevenZipMember) Close() error {
+	m.cancel()
+	m.wait()
+	return nil
+}
+
+// wait reaps 7z, reporting its error output if it failed on its own
+func (m *sevenZipMember) wait() error {
+	if m.waited {
+		return m.err
+	}
+	m.waited = true
+	if err := m.cmd.Wait(); err != nil {
+		if ctxErr := m.ctx.Err(); ctxErr != nil {
+			m.err = ctxErr
+		} else {
+			m.err = fmt.Errorf("7z failed: %s", strings.TrimSpace(m.stderr.String()))
+		}
+	}
+	return m.err
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxMemberPreview+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxMemberPreview {
+		return nil, fmt.Errorf("file is too large to preview")
+	}
+	return data, nil
+}
+
+// listing is a cached archive listing, valid while the file is unchanged
+type listing struct {
+	size    int64
+	modTime time.Time
+	entries []Entry
+}
+
+// Listing compressed tars means decompressing the whole stream, so recent
+// listings are kept while the user browses around inside an archive
+const maxCachedListings = 16
+
+var (
+	listings   = make(map[string]listing)
+	listingMux sync.Mutex
+)
+
+func cachedList(archivePath string) ([]Entry, error) {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	listingMux.Lock()
+	cached, ok := listings[archivePath]
+	listingMux.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.entries, nil
+	}
+
+	entries, err := List(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	listingMux.Lock()
+	if len(listings) >= maxCachedListings {
+		for key := range listings {
+			delete(listings, key)
+			break
+		}
+	}
+	listings[archivePath] = listing{size: info.Size(), modTime: info.ModTime(), entries: entries}
+	listingMux.Unlock()
+
+	return entries, nil
+}
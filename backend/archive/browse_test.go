@@ -0,0 +1,127 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"Finder-2/backend/database"
+)
+
+// fakeSevenZip puts a stand-in for the 7z tool on PATH. It lists a folder
+// with one small file and, unless FAKE_7Z_SMALL is set, a "big.bin" whose
+// content never ends.
+func fakeSevenZip(t *testing.T, dir string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake 7z is a shell script")
+	}
+	bin := filepath.Join(dir, "bin")
+	script := `#!/bin/sh
+for last; do :; done
+case "$1" in
+l)
+	printf -- '----------\nPath = docs\nFolder = +\n\nPath = docs/a.txt\nSize = 5\nFolder = -\n'
+	[ -n "$FAKE_7Z_SMALL" ] || printf -- '\nPath = big.bin\nSize = 1\nFolder = -\n'
+	;;
+x)
+	case "$last" in
+	docs/a.txt) printf hello ;;
+	big.bin) exec cat /dev/zero ;;
+	esac
+	;;
+esac
+`
+	writeFile(t, filepath.Join(bin, "7z"), script)
+	if err := os.Chmod(filepath.Join(bin, "7z"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	archivePath := filepath.Join(dir, "a.7z")
+	writeFile(t, archivePath, string(sevenZipMagic)+"fake")
+	return archivePath
+}
+
+// withinTime fails the test if fn doesn't return in time, which here means
+// 7z was left writing
+func withinTime(t *testing.T, fn func() error) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(30 * time.Second):
+		t.Fatal("7z was never stopped")
+		return nil
+	}
+}
+
+func TestReadMemberStopsSevenZipAtThePreviewLimit(t *testing.T) {
+	dir := setup(t)
+	archivePath := fakeSevenZip(t, dir)
+
+	data, err := ReadMember(context.Background(), archivePath, "docs/a.txt")
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("docs/a.txt = %q, %v; want hello", data, err)
+	}
+
+	err = withinTime(t, func() error {
+		_, err := ReadMember(context.Background(), archivePath, "big.bin")
+		return err
+	})
+	if err == nil {
+		t.Error("an endless member was previewed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ReadMember(ctx, archivePath, "big.bin"); err == nil {
+		t.Error("reading with a cancelled context succeeded")
+	}
+}
+
+func TestExtractEntriesFromSevenZip(t *testing.T) {
+	dir := setup(t)
+	archivePath := fakeSevenZip(t, dir)
+	dest := mkdir(t, filepath.Join(dir, "out"))
+
+	if err := ExtractEntries(context.Background(), database.NewMemoryStore(), archivePath, []string{"docs"}, ExtractOptions{Destination: dest}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "docs", "a.txt")); err != nil || string(data) != "hello" {
+		t.Errorf("docs/a.txt = %q, %v; want hello", data, err)
+	}
+
+	err := withinTime(t, func() error {
+		return ExtractEntries(context.Background(), database.NewMemoryStore(), archivePath, []string{"big.bin"}, ExtractOptions{Destination: dest, Limits: Limits{MaxTotalBytes: 1 << 20}}, nil)
+	})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("extracting an endless member = %v, want ErrLimitExceeded", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "big.bin")); err == nil {
+		t.Error("the partly written member was left behind")
+	}
+}
+
+func TestExtractSevenZip(t *testing.T) {
+	dir := setup(t)
+	t.Setenv("FAKE_7Z_SMALL", "1")
+	archivePath := fakeSevenZip(t, dir)
+
+	dest, err := Extract(context.Background(), database.NewMemoryStore(), archivePath, ExtractOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest != filepath.Join(dir, "a") {
+		t.Errorf("extracted into %s, want a folder named after the archive", dest)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "docs", "a.txt")); err != nil || string(data) != "hello" {
+		t.Errorf("docs/a.txt = %q, %v; want hello", data, err)
+	}
+}
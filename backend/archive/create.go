@@ -0,0 +1,264 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/sandbox"
+)
+
+// Options configures Create
+type Options struct {
+	Paths       []string `json:"paths"`
+	Format      string   `json:"format"`      // any Format constant except bz2 and 7z; defaults to zip
+	Destination string   `json:"destination"` // defaults to "<name>.<ext>" or "Archive.<ext>" next to the first path
+	Method      string   `json:"method"`      // zip only: "deflate" (default) or "store"
+	Level       int      `json:"level"`       // 1 (fastest) to 9 (smallest); 0 uses the format's default
+	Exclude     []string `json:"exclude"`     // glob patterns matched against names and archive paths
+	Symlinks    string   `json:"symlinks"`    // "preserve" (default), "follow" or "skip"
+	Password    string   `json:"password"`    // zip only: encrypts file contents with AES-256
+}
+
+// Create writes the inputs into an archive of the requested format and
+// returns its path, invalidating the folder sizes in sizes that it changes.
+// If ctx is cancelled or anything fails, the partial archive is removed.
+func Create(ctx context.Context, sizes database.FolderSizeStore, opts Options, onProgress ProgressFunc) (string, error) {
+	dest, err := create(ctx, opts, onProgress)
+	if err != nil {
+		return "", err
+	}
+	foldersize.Invalidate(sizes, dest)
+	return dest, nil
+}
+
+func create(ctx context.Context, opts Options, onProgress ProgressFunc) (string, error) {
+	if opts.Password != "" && opts.Format != "" && opts.Format != FormatZip {
+		return "", fmt.Errorf("only zip archives can be password protected")
+	}
+
+	switch opts.Format {
+	case "", FormatZip:
+		return CreateZip(ctx, opts, onProgress)
+	case FormatTar, FormatTarGz, FormatTarXz, FormatTarZst:
+		return createTar(ctx, opts, onProgress)
+	case FormatGz, FormatXz, FormatZst:
+		return compressFile(ctx, opts, onProgress)
+	case FormatTarBz2, FormatBz2, FormatSevenZip:
+		return "", fmt.Errorf("creating %s archives is not supported", opts.Format)
+	default:
+		return "", fmt.Errorf("unknown archive format: %s", opts.Format)
+	}
+}
+
+func createTar(ctx context.Context, opts Options, onProgress ProgressFunc) (string, error) {
+	if len(opts.Paths) == 0 {
+		return "", fmt.Errorf("no files to archive")
+	}
+	if opts.Level < 0 || opts.Level > 9 {
+		return "", fmt.Errorf("compression level must be between 1 and 9")
+	}
+
+	entries, err := collectEntries(ctx, opts.Paths, opts.Exclude, opts.Symlinks)
+	if err != nil {
+		return "", err
+	}
+
+	dest := opts.Destination
+	if dest == "" {
+		dest = defaultDestination(opts.Paths, extensionFor(opts.Format))
+	}
+	if _, err := sandbox.Check(dest, sandbox.Write); err != nil {
+		return "", err
+	}
+
+	if err := writeTarFile(ctx, dest, opts.Format, opts.Level, entries, onProgress); err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	return dest, nil
+}
+
+func writeTarFile(ctx context.Context, dest string, format string, level int, entries []entry, onProgress ProgressFunc) error {
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var out io.Writer = file
+	var compressed io.WriteCloser
+	if stream, ok := tarCompressions[format]; ok {
+		compressed, err = compressors[stream].newWriter(file, level)
+		if err != nil {
+			return err
+		}
+		out = compressed
+	}
+
+	if err := writeTar(ctx, out, dest, entries, onProgress); err != nil {
+		return err
+	}
+
+	if compressed != nil {
+		if err := compressed.Close(); err != nil {
+			return err
+		}
+	}
+	return file.Close()
+}
+
+func writeTar(ctx context.Context, out io.Writer, dest string, entries []entry, onProgress ProgressFunc) error {
+	progress := totals(entries)
+	tw := tar.NewWriter(out)
+
+	absDest, _ := filepath.Abs(dest)
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Don't archive the archive when it's written inside an input folder
+		if absPath, _ := filepath.Abs(e.path); absPath == absDest {
+			continue
+		}
+		if !e.info.Mode().IsRegular() && !e.info.IsDir() && e.info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		link := ""
+		if e.info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(e.path)
+			if err != nil {
+				return err
+			}
+			link = target
+		}
+
+		// FileInfoHeader records the mode, mtime and owner
+		header, err := tar.FileInfoHeader(e.info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = e.name
+		if e.info.IsDir() {
+			header.Name += "/"
+		}
+		header.Format = tar.FormatPAX
+
+		progress.Current = e.name
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to add %s: %w", e.name, err)
+		}
+		if !e.info.Mode().IsRegular() {
+			continue
+		}
+
+		if err := copyFileTo(ctx, tw, e.path, &progress, onProgress); err != nil {
+			return fmt.Errorf("failed to add %s: %w", e.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if onProgress != nil {
+		onProgress(progress)
+	}
+	return nil
+}
+
+// compressFile compresses a single file, e.g. "notes.txt" to "notes.txt.gz"
+func compressFile(ctx context.Context, opts Options, onProgress ProgressFunc) (string, error) {
+	if len(opts.Paths) != 1 {
+		return "", fmt.Errorf("%s compresses a single file; use tar.%s for several", opts.Format, opts.Format)
+	}
+
+	src := filepath.Clean(opts.Paths[0])
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s compresses a single file; use tar.%s for folders", opts.Format, opts.Format)
+	}
+	if opts.Level < 0 || opts.Level > 9 {
+		return "", fmt.Errorf("compression level must be between 1 and 9")
+	}
+
+	c := compressors[opts.Format]
+	dest := opts.Destination
+	if dest == "" {
+		dest = uniquePath(src+c.ext, c.ext)
+	}
+	if _, err := sandbox.Check(dest, sandbox.Write); err != nil {
+		return "", err
+	}
+
+	err = func() error {
+		file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		w, err := c.newWriter(file, opts.Level)
+		if err != nil {
+			return err
+		}
+
+		progress := Progress{BytesTotal: info.Size(), FilesTotal: 1, Current: filepath.Base(src)}
+		if err := copyFileTo(ctx, w, src, &progress, onProgress); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		if onProgress != nil {
+			onProgress(progress)
+		}
+		return file.Close()
+	}()
+	if err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+
+	return dest, nil
+}
+
+// copyFileTo streams a file into w, reporting progress
+func copyFileTo(ctx context.Context, w io.Writer, path string, progress *Progress, onProgress ProgressFunc) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	pw := &progressWriter{ctx: ctx, w: w, progress: progress, onProgress: onProgress}
+	if _, err := io.Copy(pw, file); err != nil {
+		return err
+	}
+
+	progress.FilesDone++
+	if onProgress != nil {
+		onProgress(*progress)
+	}
+	return nil
+}
+
+// totals counts the regular files and bytes about to be archived
+func totals(entries []entry) Progress {
+	progress := Progress{}
+	for _, e := range entries {
+		if e.info.Mode().IsRegular() {
+			progress.BytesTotal += e.info.Size()
+			progress.FilesTotal++
+		}
+	}
+	return progress
+}
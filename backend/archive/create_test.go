@@ -0,0 +1,369 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"Finder-2/backend/sandbox"
+)
+
+// setup allows writes inside a temporary folder and returns it
+func setup(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	previous := sandbox.GetPolicy()
+	if err := sandbox.SetPolicy(sandbox.Policy{AllowedRoots: []string{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sandbox.SetPolicy(previous) })
+	return dir
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func zipNames(t *testing.T, path string) []string {
+	t.Helper()
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCreateZipKeepsModesTimesAndExcludes(t *testing.T) {
+	dir := setup(t)
+	src := filepath.Join(dir, "project")
+	writeFile(t, filepath.Join(src, "run.sh"), "#!/bin/sh\n")
+	writeFile(t, filepath.Join(src, "node_modules", "dep.js"), "x")
+	writeFile(t, filepath.Join(src, "debug.log"), "x")
+	if err := os.Chmod(filepath.Join(src, "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "run.sh"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := Create(context.Background(), database.NewMemoryStore(), Options{
+		Paths:   []string{src},
+		Exclude: []string{"node_modules", "*.log"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"project/", "project/run.sh"}
+	if got := zipNames(t, dest); !equal(got, want) {
+		t.Fatalf("entries = %v, want %v", got, want)
+	}
+
+	r, err := zip.OpenReader(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name != "project/run.sh" {
+			continue
+		}
+		if f.Mode().Perm() != 0755 {
+			t.Errorf("mode = %v, want 0755", f.Mode().Perm())
+		}
+		if !f.Modified.Equal(modTime) {
+			t.Errorf("modified = %v, want %v", f.Modified, modTime)
+		}
+	}
+}
+
+func TestCreateFollowsSymlinkLoopsOnce(t *testing.T) {
+	dir := setup(t)
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "a")
+	if err := os.Symlink(".", filepath.Join(src, "loop")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Create(context.Background(), database.NewMemoryStore(), Options{
+			Paths:       []string{src},
+			Destination: filepath.Join(dir, "out.tar"),
+			Format:      FormatTar,
+			Symlinks:    SymlinksFollow,
+		}, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("following a symlink loop didn't finish")
+	}
+
+	file, err := os.Open(filepath.Join(dir, "out.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var names []string
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"src/", "src/a.txt"}; !equal(names, want) {
+		t.Errorf("entries = %v, want %v", names, want)
+	}
+}
+
+func TestCreateCompressedFormatsRoundTrip(t *testing.T) {
+	dir := setup(t)
+	content := bytes.Repeat([]byte("compress me "), 1000)
+	src := filepath.Join(dir, "data.txt")
+	writeFile(t, src, string(content))
+
+	for _, format := range []string{FormatGz, FormatXz, FormatZst} {
+		for _, level := range []int{0, 1, 9} {
+			dest := filepath.Join(dir, "data-"+format+string(rune('0'+level)))
+			if _, err := Create(context.Background(), database.NewMemoryStore(), Options{Paths: []string{src}, Format: format, Level: level, Destination: dest}, nil); err != nil {
+				t.Fatalf("%s level %d: %v", format, level, err)
+			}
+			file, err := os.Open(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := compressors[format].newReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			file.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("%s level %d didn't round trip", format, level)
+			}
+		}
+	}
+
+	if _, err := Create(context.Background(), database.NewMemoryStore(), Options{Paths: []string{src}, Format: FormatXz, Level: 12}, nil); err == nil {
+		t.Error("level 12 was accepted")
+	}
+}
+
+func TestCreateEncryptedZip(t *testing.T) {
+	dir := setup(t)
+	content := bytes.Repeat([]byte("secret "), 500)
+	writeFile(t, filepath.Join(dir, "src", "secret.txt"), string(content))
+
+	for _, method := range []string{MethodDeflate, MethodStore} {
+		dest := filepath.Join(dir, method+".zip")
+		_, err := Create(context.Background(), database.NewMemoryStore(), Options{
+			Paths:       []string{filepath.Join(dir, "src")},
+			Destination: dest,
+			Method:      method,
+			Password:    "hunter2",
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := zip.OpenReader(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range r.File {
+			if f.Name == "src/secret.txt" && (f.Method != methodAES || f.Flags&0x1 == 0) {
+				t.Errorf("%s: method %d flags %#x, want an encrypted AES entry", method, f.Method, f.Flags)
+			}
+		}
+		r.Close()
+
+		out := filepath.Join(dir, method+"-out")
+		if _, err := Extract(context.Background(), database.NewMemoryStore(), dest, ExtractOptions{Destination: mkdir(t, out)}, nil); apperror.CodeOf(err) != apperror.CodePasswordRequired {
+			t.Errorf("%s: extracting without a password = %v, want password_required", method, err)
+		}
+		if _, err := Extract(context.Background(), database.NewMemoryStore(), dest, ExtractOptions{Destination: out, Password: "wrong"}, nil); apperror.CodeOf(err) != apperror.CodePasswordRequired {
+			t.Errorf("%s: extracting with the wrong password = %v, want password_required", method, err)
+		}
+		if _, err := Extract(context.Background(), database.NewMemoryStore(), dest, ExtractOptions{Destination: out, Password: "hunter2", Conflict: ConflictOverwrite}, nil); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(out, "src", "secret.txt")); err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%s: extracted content doesn't match (%v)", method, err)
+		}
+
+		if _, err := ReadMember(context.Background(), dest, "src/secret.txt"); apperror.CodeOf(err) != apperror.CodePasswordRequired {
+			t.Errorf("%s: previewing an encrypted member = %v, want password_required", method, err)
+		}
+	}
+
+	if _, err := Create(context.Background(), database.NewMemoryStore(), Options{Paths: []string{filepath.Join(dir, "src")}, Format: FormatTarGz, Password: "x"}, nil); err == nil {
+		t.Error("a password was accepted for tar.gz")
+	}
+}
+
+// The fixtures in testdata were written by libarchive (bsdtar) with the
+// password "secret", so reading them checks the key derivation, password
+// verifier, counter mode, HMAC and AE-1 CRC against another implementation
+func TestReadAESZipFromOtherTools(t *testing.T) {
+	tests := []struct {
+		file string
+		name string
+		want string
+	}{
+		{"libarchive-aes-store.zip", "hello.txt", "hello from libarchive\n"},
+		{"libarchive-aes128-store.zip", "hello.txt", "hello from libarchive\n"},
+		{"libarchive-aes-deflate.zip", "big.txt", strings.Repeat("deflate me ", 200)},
+	}
+	for _, tt := range tests {
+		r, err := zip.OpenReader(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := r.File[0]
+		if f.Name != tt.name {
+			t.Fatalf("%s: first entry is %s, want %s", tt.file, f.Name, tt.name)
+		}
+
+		if _, err := openZipFile(f, "wrong"); apperror.CodeOf(err) != apperror.CodePasswordRequired {
+			t.Errorf("%s: wrong password = %v, want password_required", tt.file, err)
+		}
+		rc, err := openZipFile(f, "secret")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: content = %q, want %q", tt.file, got, tt.want)
+		}
+		r.Close()
+	}
+}
+
+func TestReadAESZipRejectsTamperedData(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", "libarchive-aes-store.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The local header is 30 bytes plus the name and extra field, then
+	// come the 16-byte salt and 2-byte verifier; flip a ciphertext byte
+	headerSize := 30 + int(binary.LittleEndian.Uint16(data[26:])) + int(binary.LittleEndian.Uint16(data[28:]))
+	data[headerSize+aesSaltSize+aesVerifierSize] ^= 0xff
+	tampered := filepath.Join(dir, "tampered.zip")
+	if err := os.WriteFile(tampered, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	rc, err := openZipFile(r.File[0], "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); err == nil {
+		t.Error("tampered data was read without an error")
+	}
+}
+
+// TestEncryptedZipOpensWithOtherTools checks an archive from Create with
+// 7-Zip or libarchive, whichever is installed
+func TestEncryptedZipOpensWithOtherTools(t *testing.T) {
+	sevenZip, _ := exec.LookPath("7z")
+	bsdtar, _ := exec.LookPath("bsdtar")
+	if sevenZip == "" && bsdtar == "" {
+		t.Skip("neither 7z nor bsdtar is installed")
+	}
+
+	dir := setup(t)
+	content := strings.Repeat("shared with other tools ", 300)
+	writeFile(t, filepath.Join(dir, "src", "secret.txt"), content)
+
+	for _, method := range []string{MethodDeflate, MethodStore} {
+		dest := filepath.Join(dir, method+".zip")
+		_, err := Create(context.Background(), database.NewMemoryStore(), Options{Paths: []string{filepath.Join(dir, "src")}, Destination: dest, Method: method, Password: "hunter2"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sevenZip != "" {
+			if out, err := exec.Command(sevenZip, "t", "-phunter2", dest).CombinedOutput(); err != nil {
+				t.Errorf("%s: 7z t failed: %v\n%s", method, err, out)
+			}
+		}
+		if bsdtar != "" {
+			out, err := exec.Command(bsdtar, "-x", "-O", "--passphrase", "hunter2", "-f", dest, "src/secret.txt").Output()
+			if err != nil {
+				t.Errorf("%s: bsdtar failed: %v", method, err)
+			} else if string(out) != content {
+				t.Errorf("%s: bsdtar extracted different content", method)
+			}
+		}
+	}
+}
+
+func mkdir(t *testing.T, path string) string {
+	t.Helper()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
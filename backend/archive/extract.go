@@ -0,0 +1,781 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/sandbox"
+)
+
+// Ways of handling an extracted file whose name is already taken
+const (
+	ConflictRename    = "rename"    // keep both, naming the new one "name 1.ext" (default)
+	ConflictOverwrite = "overwrite" // replace the existing file
+	ConflictSkip      = "skip"      // keep the existing file
+	ConflictFail      = "fail"      // stop extracting
+)
+
+// Limits guard against archives that expand far beyond their size ("zip
+// bombs"). Zero fields use the DefaultLimits value.
+type Limits struct {
+	MaxTotalBytes int64   `json:"maxTotalBytes"` // bytes written across all files
+	MaxFiles      int     `json:"maxFiles"`      // entries extracted, including folders
+	MaxRatio      float64 `json:"maxRatio"`      // bytes written per byte of archive
+}
+
+// DefaultLimits allow any reasonable archive
+var DefaultLimits = Limits{
+	MaxTotalBytes: 20 << 30,
+	MaxFiles:      200000,
+	MaxRatio:      200,
+}
+
+// Small archives may legitimately compress better than MaxRatio (a file of
+// zeros, say), so the ratio only applies once this much has been written
+const ratioGrace = 32 << 20
+
+// ErrLimitExceeded is returned when an archive trips one of its Limits
+var ErrLimitExceeded = errors.New("archive exceeds the extraction limits")
+
+// ExtractOptions configures Extract and ExtractEntries
+type ExtractOptions struct {
+	// Destination is the folder to extract into. Extract defaults to a new
+	// folder named after the archive, next to it; a single compressed file
+	// is decompressed next to the archive instead.
+	Destination string `json:"destination"`
+	Conflict    string `json:"conflict"` // a Conflict constant; defaults to rename
+	Limits      Limits `json:"limits"`
+	Password    string `json:"password"` // for encrypted zips
+}
+
+// Extract unpacks any supported archive, detecting the format from its
+// contents, and returns the folder it was extracted into. Folder sizes in
+// sizes that it changes are invalidated. Entries that would
+// land outside that folder, including through symlinks, are rejected. If
+// extraction fails, a folder created for it is removed again.
+func Extract(ctx context.Context, sizes database.FolderSizeStore, archivePath string, opts ExtractOptions, onProgress ProgressFunc) (string, error) {
+	format, err := Detect(archivePath)
+	if err != nil {
+		return "", err
+	}
+	singleFile := compressors[format].newReader != nil
+
+	dest := opts.Destination
+	created := false
+	if dest == "" {
+		dest = filepath.Dir(archivePath)
+	}
+	if _, err := sandbox.Check(dest, sandbox.Write); err != nil {
+		return "", err
+	}
+	if opts.Destination == "" && !singleFile {
+		dest = uniquePath(filepath.Join(dest, archiveBaseName(filepath.Base(archivePath))), "")
+		if err := os.Mkdir(dest, 0755); err != nil {
+			return "", err
+		}
+		created = true
+	}
+
+	x, err := newExtractor(ctx, archivePath, dest, opts, onProgress)
+	if err != nil {
+		return "", err
+	}
+	defer foldersize.Invalidate(sizes, dest)
+
+	switch {
+	case format == FormatZip:
+		err = x.extractZip(archivePath)
+	case format == FormatTar:
+		err = x.extractStream(archivePath, "", true)
+	case tarCompressions[format] != "":
+		err = x.extractStream(archivePath, tarCompressions[format], true)
+	case singleFile:
+		err = x.extractStream(archivePath, format, false)
+	case format == FormatSevenZip:
+		err = x.extractSevenZip(archivePath)
+	default:
+		err = fmt.Errorf("extracting %s archives is not supported", format)
+	}
+
+	if err != nil {
+		if created {
+			os.RemoveAll(dest)
+		}
+		return "", err
+	}
+	return dest, nil
+}
+
+// SafeJoin joins an archive entry name onto destDir, refusing names that
+// escape it such as "../../etc/passwd" (the "ZipSlip" attack)
+func SafeJoin(destDir string, name string) (string, error) {
+	destDir = filepath.Clean(destDir)
+	target := filepath.Join(destDir, name)
+	if !strings.HasPrefix(target, destDir+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid file path: %s", name)
+	}
+	return target, nil
+}
+
+// archiveBaseName strips archive extensions, so "photos.tar.gz" becomes
+// "photos"
+func archiveBaseName(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{
+		".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst",
+		".tgz", ".tbz2", ".txz", ".tzst",
+		".zip", ".tar", ".7z", ".gz", ".bz2", ".xz", ".zst",
+	} {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	if ext := filepath.Ext(name); ext != "" && len(name) > len(ext) {
+		return name[:len(name)-len(ext)]
+	}
+	return name + " contents"
+}
+
+// extractor writes entries under destDir
+type extractor struct {
+	ctx        context.Context
+	destDir    string
+	realDest   string // destDir with symlinks resolved
+	conflict   string
+	limits     Limits
+	password   string
+	progress   Progress
+	onProgress ProgressFunc
+
+	// rename, when set, picks which entries to extract and where they go
+	// relative to destDir. Entries it rejects are skipped.
+	rename func(name string) (string, bool)
+
+	archiveSize int64
+	written     int64
+	entries     int
+	placed      map[string]string // entry name to where it was written, for hard links
+	links       []pendingLink     // symlinks, created once everything else is written
+	dirTimes    map[string]time.Time
+	dirOrder    []string
+}
+
+// pendingLink is a symlink entry waiting to be created
+type pendingLink struct {
+	name   string
+	target string
+}
+
+func newExtractor(ctx context.Context, archivePath string, destDir string, opts ExtractOptions, onProgress ProgressFunc) (*extractor, error) {
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = ConflictRename
+	case ConflictRename, ConflictOverwrite, ConflictSkip, ConflictFail:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy: %s", opts.Conflict)
+	}
+
+	limits := opts.Limits
+	if limits.MaxTotalBytes <= 0 {
+		limits.MaxTotalBytes = DefaultLimits.MaxTotalBytes
+	}
+	if limits.MaxFiles <= 0 {
+		limits.MaxFiles = DefaultLimits.MaxFiles
+	}
+	if limits.MaxRatio <= 0 {
+		limits.MaxRatio = DefaultLimits.MaxRatio
+	}
+
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	destInfo, err := os.Stat(destDir)
+	if err != nil {
+		return nil, err
+	}
+	if !destInfo.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder", destDir)
+	}
+	realDest, err := filepath.EvalSymlinks(destDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &extractor{
+		ctx:         ctx,
+		destDir:     filepath.Clean(destDir),
+		realDest:    realDest,
+		conflict:    opts.Conflict,
+		limits:      limits,
+		password:    opts.Password,
+		onProgress:  onProgress,
+		archiveSize: info.Size(),
+		placed:      make(map[string]string),
+		dirTimes:    make(map[string]time.Time),
+	}, nil
+}
+
+// mapName applies rename, if any, to an entry name
+func (x *extractor) mapName(name string) (string, bool) {
+	if x.rename == nil {
+		return name, true
+	}
+	return x.rename(name)
+}
+
+// countEntry enforces MaxFiles
+func (x *extractor) countEntry() error {
+	x.entries++
+	if x.entries > x.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrLimitExceeded, x.limits.MaxFiles)
+	}
+	return nil
+}
+
+// checkWritten enforces MaxTotalBytes and MaxRatio
+func (x *extractor) checkWritten() error {
+	if x.written > x.limits.MaxTotalBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrLimitExceeded, x.limits.MaxTotalBytes)
+	}
+	if x.written > ratioGrace && float64(x.written) > x.limits.MaxRatio*float64(x.archiveSize) {
+		return fmt.Errorf("%w: expands more than %.0f times its size", ErrLimitExceeded, x.limits.MaxRatio)
+	}
+	return nil
+}
+
+func (x *extractor) extractZip(archivePath string) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// The central directory gives the totals up front, so an obvious bomb
+	// is refused before anything is written. Sizes can lie, which is why
+	// the limits are enforced again while writing.
+	var declared uint64
+	selected := 0
+	for _, f := range r.File {
+		if _, ok := x.mapName(f.Name); !ok {
+			continue
+		}
+		selected++
+		// Ask for a password before writing anything, rather than
+		// failing partway through
+		if f.Flags&0x1 != 0 && x.password == "" {
+			return apperror.PasswordRequired(archivePath, "%s is encrypted and needs a password", filepath.Base(archivePath))
+		}
+		if !f.FileInfo().IsDir() {
+			declared += f.UncompressedSize64
+			x.progress.FilesTotal++
+		}
+	}
+	x.progress.BytesTotal = int64(declared)
+	if declared > uint64(x.limits.MaxTotalBytes) {
+		return fmt.Errorf("%w: more than %d bytes", ErrLimitExceeded, x.limits.MaxTotalBytes)
+	}
+	if selected > x.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrLimitExceeded, x.limits.MaxFiles)
+	}
+
+	for _, f := range r.File {
+		if err := x.ctx.Err(); err != nil {
+			return err
+		}
+		name, ok := x.mapName(f.Name)
+		if !ok {
+			continue
+		}
+		if err := x.countEntry(); err != nil {
+			return err
+		}
+		x.progress.Current = name
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.writeDir(name, mode, f.Modified)
+		case mode&os.ModeSymlink != 0:
+			err = x.writeZipSymlink(f, name)
+		default:
+			err = x.writeZipFile(f, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return x.finish()
+}
+
+func (x *extractor) writeZipFile(f *zip.File, name string) error {
+	rc, err := openZipFile(f, x.password)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return x.writeFile(name, f.Mode(), f.Modified, rc, true)
+}
+
+func (x *extractor) writeZipSymlink(f *zip.File, name string) error {
+	rc, err := openZipFile(f, x.password)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// A symlink's content is its target, which is never long
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+	return x.writeSymlink(name, string(target))
+}
+
+// extractSevenZip copies members out of a 7z archive through the 7z tool,
+// one at a time, so they go through the same checks and limits as any
+// other entry instead of 7z writing into destDir itself
+func (x *extractor) extractSevenZip(archivePath string) error {
+	entries, err := cachedList(archivePath)
+	if err != nil {
+		return err
+	}
+
+	var declared int64
+	selected := 0
+	for _, e := range entries {
+		if _, ok := x.mapName(e.Name); !ok {
+			continue
+		}
+		selected++
+		if !e.IsDirectory {
+			declared += e.Size
+			x.progress.FilesTotal++
+		}
+	}
+	x.progress.BytesTotal = declared
+	if declared > x.limits.MaxTotalBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrLimitExceeded, x.limits.MaxTotalBytes)
+	}
+	if selected > x.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrLimitExceeded, x.limits.MaxFiles)
+	}
+
+	for _, e := range entries {
+		if err := x.ctx.Err(); err != nil {
+			return err
+		}
+		name, ok := x.mapName(e.Name)
+		if !ok {
+			continue
+		}
+		if err := x.countEntry(); err != nil {
+			return err
+		}
+		x.progress.Current = name
+
+		modTime, _ := time.Parse(time.RFC3339, e.ModifiedTime)
+		if e.IsDirectory {
+			err = x.writeDir(name, 0755, modTime)
+		} else {
+			err = x.writeSevenZipFile(archivePath, e.Name, name, modTime)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return x.finish()
+}
+
+func (x *extractor) writeSevenZipFile(archivePath string, member string, name string, modTime time.Time) error {
+	rc, err := openSevenZipMember(x.ctx, archivePath, member)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return x.writeFile(name, 0644, modTime, rc, true)
+}
+
+// extractStream reads a tar (optionally compressed) or a single compressed file
+func (x *extractor) extractStream(archivePath string, compression string, isTar bool) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Compressed streams have no index, so progress follows the archive bytes read
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	x.progress.BytesTotal = info.Size()
+	var r io.Reader = &progressReader{r: file, x: x}
+
+	if compression != "" {
+		cr, err := compressors[compression].newReader(r)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+		r = cr
+	}
+
+	if !isTar {
+		name := stripCompressedExt(filepath.Base(archivePath), compression)
+		x.progress.FilesTotal = 1
+		x.progress.Current = name
+		return x.writeFile(name, 0644, info.ModTime(), r, false)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		if err := x.ctx.Err(); err != nil {
+			return err
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			return x.finish()
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := x.mapName(header.Name)
+		if !ok {
+			continue
+		}
+		if err := x.countEntry(); err != nil {
+			return err
+		}
+		x.progress.Current = name
+
+		mode := header.FileInfo().Mode()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.writeDir(name, mode, header.ModTime)
+		case tar.TypeReg:
+			err = x.writeFile(name, mode, header.ModTime, tr, false)
+		case tar.TypeSymlink:
+			err = x.writeSymlink(name, header.Linkname)
+		case tar.TypeLink:
+			linkName, linked := x.mapName(header.Linkname)
+			if !linked {
+				return fmt.Errorf("%s is a hard link to %s, which was not selected", header.Name, header.Linkname)
+			}
+			err = x.writeHardlink(name, linkName)
+		default:
+			// Devices, FIFOs and the like are skipped
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// resolveConflict decides where an entry goes when target is taken. skip is
+// true when the entry shouldn't be written at all.
+func (x *extractor) resolveConflict(target string) (string, bool, error) {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return target, false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	switch x.conflict {
+	case ConflictSkip:
+		return "", true, nil
+	case ConflictFail:
+		return "", false, fmt.Errorf("%s already exists", target)
+	case ConflictOverwrite:
+		if info.IsDir() {
+			return "", false, fmt.Errorf("%s is a folder and can't be overwritten by a file", target)
+		}
+		if err := os.Remove(target); err != nil {
+			return "", false, err
+		}
+		return target, false, nil
+	default:
+		return uniquePath(target, filepath.Ext(target)), false, nil
+	}
+}
+
+// writeDir creates a folder, merging into one that already exists. Its
+// mtime is restored once everything inside it has been written.
+func (x *extractor) writeDir(name string, mode os.FileMode, modTime time.Time) error {
+	target, err := x.join(name)
+	if err != nil {
+		return err
+	}
+	if _, err := x.resolve(x.realDest, name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target, mode.Perm()|0700); err != nil {
+		return err
+	}
+
+	if _, ok := x.dirTimes[target]; !ok {
+		x.dirOrder = append(x.dirOrder, target)
+	}
+	x.dirTimes[target] = modTime
+	return nil
+}
+
+func (x *extractor) writeFile(name string, mode os.FileMode, modTime time.Time, r io.Reader, reportBytes bool) error {
+	target, err := x.join(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	target, skip, err := x.resolveConflict(target)
+	if err != nil {
+		return err
+	}
+	if skip {
+		x.progress.FilesDone++
+		return nil
+	}
+
+	// O_EXCL never writes through a symlink planted by an earlier entry
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(&extractWriter{x: x, w: out, reportBytes: reportBytes}, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+
+	if !modTime.IsZero() {
+		os.Chtimes(target, modTime, modTime)
+	}
+	x.placed[name] = target
+
+	x.progress.FilesDone++
+	if x.onProgress != nil {
+		x.onProgress(x.progress)
+	}
+	return nil
+}
+
+// writeSymlink queues a link to be created by finish, refusing targets that
+// obviously point outside destDir. Creating links last means no entry is
+// ever written through one, so a chain such as "up -> ..", "up2 -> up/.."
+// followed by "up2/file" can't place a file outside destDir.
+func (x *extractor) writeSymlink(name string, linkTarget string) error {
+	if _, err := SafeJoin(x.destDir, name); err != nil {
+		return err
+	}
+	if filepath.IsAbs(linkTarget) {
+		return fmt.Errorf("symlink %s points outside the archive: %s", name, linkTarget)
+	}
+	x.links = append(x.links, pendingLink{name: name, target: linkTarget})
+	return nil
+}
+
+// finish creates the queued symlinks and restores folder times. Each link
+// is checked against what's on disk, and once they all exist each is
+// resolved again, since a later link can change where an earlier one leads.
+func (x *extractor) finish() error {
+	var created []string
+	for _, link := range x.links {
+		target, err := x.join(link.name)
+		if err != nil {
+			return err
+		}
+		parent, err := x.resolve(x.realDest, filepath.Dir(link.name))
+		if err != nil {
+			return err
+		}
+		if _, err := x.resolve(parent, link.target); err != nil {
+			return fmt.Errorf("symlink %s points outside the archive: %s", link.name, link.target)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		target, skip, err := x.resolveConflict(target)
+		if err != nil {
+			return err
+		}
+		if skip {
+			continue
+		}
+		if err := os.Symlink(link.target, target); err != nil {
+			return err
+		}
+		created = append(created, target)
+	}
+
+	var escaped error
+	for _, target := range created {
+		if real, err := filepath.EvalSymlinks(target); err == nil && !within(real, x.realDest) {
+			os.Remove(target)
+			escaped = fmt.Errorf("symlink %s points outside the archive", target)
+		}
+	}
+	if escaped != nil {
+		return escaped
+	}
+
+	x.restoreDirTimes()
+	return nil
+}
+
+// join maps an entry name to its path under destDir like SafeJoin, and
+// checks that the folder it goes in is still inside destDir once symlinks
+// already there, such as in a folder being extracted into, are followed
+func (x *extractor) join(name string) (string, error) {
+	target, err := SafeJoin(x.destDir, name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := x.resolve(x.realDest, filepath.Dir(filepath.FromSlash(name))); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// resolve follows rel from dir one part at a time, the way the system would
+// when opening it, following symlinks that exist on disk. It fails if any
+// step leaves destDir.
+func (x *extractor) resolve(dir string, rel string) (string, error) {
+	current := dir
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+		default:
+			current = filepath.Join(current, part)
+			real, err := filepath.EvalSymlinks(current)
+			if err == nil {
+				current = real
+			} else if !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		if !within(current, x.realDest) {
+			return "", fmt.Errorf("invalid file path: %s leads outside the destination", rel)
+		}
+	}
+	return current, nil
+}
+
+// within reports whether path is root or inside it
+func within(path string, root string) bool {
+	return path == root || strings.HasPrefix(path, root+string(os.PathSeparator))
+}
+
+// writeHardlink links to a file extracted earlier from the same archive
+func (x *extractor) writeHardlink(name string, linkName string) error {
+	target, err := x.join(name)
+	if err != nil {
+		return err
+	}
+	source, ok := x.placed[linkName]
+	if !ok {
+		return fmt.Errorf("%s is a hard link to %s, which wasn't extracted", name, linkName)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	target, skip, err := x.resolveConflict(target)
+	if err != nil || skip {
+		return err
+	}
+	if err := os.Link(source, target); err != nil {
+		return err
+	}
+	x.placed[name] = target
+	return nil
+}
+
+// restoreDirTimes sets folder mtimes last, deepest first, since writing
+// into a folder changes its mtime
+func (x *extractor) restoreDirTimes() {
+	for i := len(x.dirOrder) - 1; i >= 0; i-- {
+		dir := x.dirOrder[i]
+		if modTime := x.dirTimes[dir]; !modTime.IsZero() {
+			os.Chtimes(dir, modTime, modTime)
+		}
+	}
+}
+
+// progressReader reports the archive bytes consumed while extracting a stream
+type progressReader struct {
+	r          io.Reader
+	x          *extractor
+	unreported int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.x.progress.BytesDone += int64(n)
+	pr.unreported += int64(n)
+	if pr.x.onProgress != nil && pr.unreported >= progressInterval {
+		pr.x.onProgress(pr.x.progress)
+		pr.unreported = 0
+	}
+	return n, err
+}
+
+// extractWriter counts what's written against the limits and stops a copy
+// when the context is cancelled. reportBytes is set for formats whose
+// progress follows the bytes written rather than the archive bytes read.
+type extractWriter struct {
+	x           *extractor
+	w           io.Writer
+	reportBytes bool
+	unreported  int64
+}
+
+func (ew *extractWriter) Write(p []byte) (int, error) {
+	if err := ew.x.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := ew.w.Write(p)
+	ew.x.written += int64(n)
+	if limitErr := ew.x.checkWritten(); limitErr != nil {
+		return n, limitErr
+	}
+
+	if ew.reportBytes {
+		ew.x.progress.BytesDone += int64(n)
+		ew.unreported += int64(n)
+		if ew.x.onProgress != nil && ew.unreported >= progressInterval {
+			ew.x.onProgress(ew.x.progress)
+			ew.unreported = 0
+		}
+	}
+	return n, err
+}
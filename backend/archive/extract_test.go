@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Finder-2/backend/database"
+)
+
+// member is one entry of an archive written by writeTestTar or writeTestZip
+type member struct {
+	name     string
+	content  string
+	linkname string // makes the member a symlink
+}
+
+func writeTestTar(t *testing.T, path string, entries []member) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.content))}
+		if e.linkname != "" {
+			header = &tar.Header{Name: e.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: e.linkname}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestZip(t *testing.T, path string, entries []member) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		content := e.content
+		if e.linkname != "" {
+			header.SetMode(os.ModeSymlink | 0777)
+			content = e.linkname
+		} else {
+			header.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chainedEscape links s/up2 to s/up/.., where s/up is itself "..", so each
+// link looks harmless on its own but together they lead out of the archive
+var chainedEscape = []member{
+	{name: "s/up", linkname: ".."},
+	{name: "s/up2", linkname: "up/.."},
+	{name: "s/up2/ESCAPED.txt", content: "escaped"},
+}
+
+func TestExtractRefusesChainedSymlinkEscape(t *testing.T) {
+	for _, format := range []string{"tar", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			dir := setup(t)
+			archive := filepath.Join(dir, "evil."+format)
+			if format == "tar" {
+				writeTestTar(t, archive, chainedEscape)
+			} else {
+				writeTestZip(t, archive, chainedEscape)
+			}
+			dest := filepath.Join(dir, "out", "dest")
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Extract(context.Background(), database.NewMemoryStore(), archive, ExtractOptions{Destination: dest}, nil)
+			if err == nil {
+				t.Error("extracting succeeded, want the escaping link refused")
+			}
+			for _, path := range []string{
+				filepath.Join(dir, "out", "ESCAPED.txt"),
+				filepath.Join(dir, "ESCAPED.txt"),
+			} {
+				if _, err := os.Lstat(path); err == nil {
+					t.Errorf("%s was written outside the destination", path)
+				}
+			}
+			filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.Mode()&os.ModeSymlink == 0 {
+					return nil
+				}
+				if real, err := filepath.EvalSymlinks(path); err == nil && !within(real, dest) {
+					t.Errorf("%s leads outside the destination to %s", path, real)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestExtractRefusesWritingThroughExistingSymlink(t *testing.T) {
+	dir := setup(t)
+	dest := filepath.Join(dir, "dest")
+	outside := filepath.Join(dir, "outside")
+	for _, folder := range []string{dest, outside} {
+		if err := os.Mkdir(folder, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(dest, "link")); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "a.tar")
+	writeTestTar(t, archive, []member{{name: "link/file.txt", content: "x"}})
+
+	if _, err := Extract(context.Background(), database.NewMemoryStore(), archive, ExtractOptions{Destination: dest}, nil); err == nil {
+		t.Error("extracting succeeded, want writing through the link refused")
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "file.txt")); err == nil {
+		t.Error("file was written outside the destination")
+	}
+}
+
+func TestExtractRefusesZipSlip(t *testing.T) {
+	dir := setup(t)
+	dest := filepath.Join(dir, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "a.zip")
+	writeTestZip(t, archive, []member{{name: "../slip.txt", content: "x"}})
+
+	if _, err := Extract(context.Background(), database.NewMemoryStore(), archive, ExtractOptions{Destination: dest}, nil); err == nil {
+		t.Error("extracting succeeded, want ../slip.txt refused")
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "slip.txt")); err == nil {
+		t.Error("slip.txt was written outside the destination")
+	}
+}
+
+func TestExtractKeepsSymlinksInside(t *testing.T) {
+	dir := setup(t)
+	archive := filepath.Join(dir, "a.tar")
+	writeTestTar(t, archive, []member{
+		{name: "docs/readme.txt", content: "hello"},
+		{name: "docs/latest", linkname: "readme.txt"},
+		{name: "top", linkname: "docs"},
+	})
+
+	dest, err := Extract(context.Background(), database.NewMemoryStore(), archive, ExtractOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"docs/latest", "top/readme.txt"} {
+		data, err := os.ReadFile(filepath.Join(dest, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello" {
+			t.Errorf("%s = %q, want hello", path, data)
+		}
+	}
+}
+
+func TestExtractEnforcesLimits(t *testing.T) {
+	dir := setup(t)
+	archive := filepath.Join(dir, "a.tar")
+	writeTestTar(t, archive, []member{
+		{name: "one.txt", content: "1"},
+		{name: "two.txt", content: "2"},
+		{name: "three.txt", content: "3"},
+	})
+
+	_, err := Extract(context.Background(), database.NewMemoryStore(), archive, ExtractOptions{Limits: Limits{MaxFiles: 2}}, nil)
+	if err == nil {
+		t.Fatal("extracting succeeded, want the file limit enforced")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a")); err == nil {
+		t.Error("the folder created for a failed extraction was left behind")
+	}
+}
@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Archive formats
+const (
+	FormatZip      = "zip"
+	FormatTar      = "tar"
+	FormatTarGz    = "tar.gz"
+	FormatTarBz2   = "tar.bz2"
+	FormatTarXz    = "tar.xz"
+	FormatTarZst   = "tar.zst"
+	FormatGz       = "gz"
+	FormatBz2      = "bz2"
+	FormatXz       = "xz"
+	FormatZst      = "zst"
+	FormatSevenZip = "7z"
+)
+
+// compressor wraps a stream compression format. newWriter is nil for
+// formats that can only be read.
+type compressor struct {
+	magic     []byte
+	ext       string
+	newReader func(io.Reader) (io.ReadCloser, error)
+	newWriter func(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+var compressors = map[string]compressor{
+	FormatGz: {
+		magic: []byte{0x1F, 0x8B},
+		ext:   ".gz",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		newWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			return gzip.NewWriterLevel(w, level)
+		},
+	},
+	FormatBz2: {
+		magic: []byte("BZh"),
+		ext:   ".bz2",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		},
+	},
+	FormatXz: {
+		magic: []byte{0xFD, '7', 'z', 'X', 'Z', 0x00},
+		ext:   ".xz",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			xr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(xr), nil
+		},
+		newWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				return xz.NewWriter(w)
+			}
+			// Like xz's presets, higher levels use a larger dictionary
+			return xz.WriterConfig{DictCap: xzDictCaps[level]}.NewWriter(w)
+		},
+	},
+	FormatZst: {
+		magic: []byte{0x28, 0xB5, 0x2F, 0xFD},
+		ext:   ".zst",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+		newWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			// Map the 1-9 scale onto zstd's 1-22
+			zstdLevel := 3
+			if level > 0 {
+				zstdLevel = level * 22 / 9
+			}
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(zstdLevel)))
+		},
+	},
+}
+
+// xzDictCaps is the dictionary size for each compression level, following
+// xz's -1 to -9 presets
+var xzDictCaps = [10]int{
+	1: 1 << 20, 2: 2 << 20, 3: 4 << 20, 4: 4 << 20, 5: 8 << 20,
+	6: 8 << 20, 7: 16 << 20, 8: 32 << 20, 9: 64 << 20,
+}
+
+// tarCompressions maps each compressed tar format to its stream format
+var tarCompressions = map[string]string{
+	FormatTarGz:  FormatGz,
+	FormatTarBz2: FormatBz2,
+	FormatTarXz:  FormatXz,
+	FormatTarZst: FormatZst,
+}
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	emptyZipMagic = []byte("PK\x05\x06")
+	sevenZipMagic = []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}
+	tarMagic      = []byte("ustar")
+)
+
+// tarMagicOffset is where "ustar" sits in a tar header
+const tarMagicOffset = 257
+
+// Detect identifies an archive by its magic bytes rather than its name.
+// For compressed streams it peeks at the decompressed data to tell a
+// compressed tar from a single compressed file.
+func Detect(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	head, _ := r.Peek(tarMagicOffset + len(tarMagic))
+
+	switch {
+	case bytes.HasPrefix(head, zipMagic), bytes.HasPrefix(head, emptyZipMagic):
+		return FormatZip, nil
+	case bytes.HasPrefix(head, sevenZipMagic):
+		return FormatSevenZip, nil
+	case isTarHeader(head):
+		return FormatTar, nil
+	}
+
+	for format, c := range compressors {
+		if !bytes.HasPrefix(head, c.magic) {
+			continue
+		}
+
+		cr, err := c.newReader(r)
+		if err != nil {
+			return "", fmt.Errorf("corrupt %s stream: %w", format, err)
+		}
+		defer cr.Close()
+
+		inner := make([]byte, tarMagicOffset+len(tarMagic))
+		n, _ := io.ReadFull(cr, inner)
+		if isTarHeader(inner[:n]) {
+			return "tar." + format, nil
+		}
+		return format, nil
+	}
+
+	return "", fmt.Errorf("unsupported archive format: %s", path)
+}
+
+// IsArchive reports whether path looks like an archive this package can read
+func IsArchive(path string) bool {
+	format, err := Detect(path)
+	return err == nil && format != ""
+}
+
+func isTarHeader(head []byte) bool {
+	return len(head) >= tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(head[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic)
+}
+
+// extensionFor returns the file extension used for a format
+func extensionFor(format string) string {
+	return "." + format
+}
+
+// stripCompressedExt removes a single-file compressor's extension, so
+// "notes.txt.gz" decompresses to "notes.txt"
+func stripCompressedExt(name string, format string) string {
+	ext := compressors[format].ext
+	if strings.HasSuffix(strings.ToLower(name), ext) && len(name) > len(ext) {
+		return name[:len(name)-len(ext)]
+	}
+	return name + ".out"
+}
@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry describes one member of an archive
+type Entry struct {
+	Name         string `json:"name"` // slash-separated path inside the archive
+	Size         int64  `json:"size"`
+	ModifiedTime string `json:"modifiedTime"`
+	Permissions  string `json:"permissions"`
+	IsDirectory  bool   `json:"isDirectory"`
+	IsSymlink    bool   `json:"isSymlink"`
+	LinkTarget   string `json:"linkTarget,omitempty"`
+}
+
+// List returns the entries of an archive without extracting it. 7z
+// archives are listed with the external 7z tool when it's installed.
+func List(archivePath string) ([]Entry, error) {
+	format, err := Detect(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case format == FormatZip:
+		return listZip(archivePath)
+	case format == FormatTar:
+		return listTar(archivePath, "")
+	case tarCompressions[format] != "":
+		return listTar(archivePath, tarCompressions[format])
+	case format == FormatSevenZip:
+		return listSevenZip(archivePath)
+	default:
+		// A single compressed file holds one member whose size is only
+		// known after decompressing, so none is reported
+		info, err := os.Stat(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		return []Entry{{
+			Name:         stripCompressedExt(filepath.Base(archivePath), format),
+			ModifiedTime: info.ModTime().Format(time.RFC3339),
+			Permissions:  os.FileMode(0644).String(),
+		}}, nil
+	}
+}
+
+func listZip(archivePath string) ([]Entry, error) {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	entries := make([]Entry, 0, len(r.File))
+	for _, f := range r.File {
+		mode := f.Mode()
+		e := Entry{
+			Name:         strings.TrimSuffix(f.Name, "/"),
+			Size:         int64(f.UncompressedSize64),
+			ModifiedTime: f.Modified.Format(time.RFC3339),
+			Permissions:  mode.String(),
+			IsDirectory:  mode.IsDir(),
+			IsSymlink:    mode&os.ModeSymlink != 0,
+		}
+		if e.IsSymlink {
+			if rc, err := f.Open(); err == nil {
+				target, _ := io.ReadAll(io.LimitReader(rc, 4096))
+				rc.Close()
+				e.LinkTarget = string(target)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func listTar(archivePath string, compression string) ([]Entry, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if compression != "" {
+		cr, err := compressors[compression].newReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer cr.Close()
+		r = cr
+	}
+
+	entries := []Entry{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		info := header.FileInfo()
+		e := Entry{
+			Name:         strings.TrimSuffix(header.Name, "/"),
+			Size:         header.Size,
+			ModifiedTime: header.ModTime.Format(time.RFC3339),
+			Permissions:  info.Mode().String(),
+			IsDirectory:  header.Typeflag == tar.TypeDir,
+			IsSymlink:    header.Typeflag == tar.TypeSymlink,
+		}
+		if e.IsSymlink {
+			e.LinkTarget = header.Linkname
+		}
+		entries = append(entries, e)
+	}
+}
+
+// listSevenZip parses the technical listing of "7z l -slt", which prints a
+// "Key = Value" block per member after a "----------" separator
+func listSevenZip(archivePath string) ([]Entry, error) {
+	tool, err := exec.LookPath("7z")
+	if err != nil {
+		return nil, fmt.Errorf("listing 7z archives requires the 7z command")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(tool, "l", "-slt", "--", archivePath)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("7z failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	entries := []Entry{}
+	var current *Entry
+	inMembers := false
+
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !inMembers {
+			inMembers = strings.HasPrefix(line, "----------")
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, " = ")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Path":
+			entries = append(entries, Entry{Name: filepath.ToSlash(value)})
+			current = &entries[len(entries)-1]
+		case "Size":
+			if current != nil {
+				current.Size, _ = strconv.ParseInt(value, 10, 64)
+			}
+		case "Modified":
+			if current != nil {
+				if t, err := time.ParseInLocation("2006-01-02 15:04:05", strings.SplitN(value, ".", 2)[0], time.Local); err == nil {
+					current.ModifiedTime = t.Format(time.RFC3339)
+				}
+			}
+		case "Folder":
+			if current != nil {
+				current.IsDirectory = value == "+"
+			}
+		case "Attributes":
+			if current != nil && strings.HasPrefix(value, "D") {
+				current.IsDirectory = true
+			}
+		}
+	}
+
+	return entries, scanner.Err()
+}
@@ -0,0 +1,150 @@
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"Finder-2/backend/sandbox"
+)
+
+// Compression methods for Options.Method
+const (
+	MethodDeflate = "deflate"
+	MethodStore   = "store"
+)
+
+// CreateZip writes the inputs into a zip archive and returns its path. File
+// modes and modification times are kept in the entry headers. If ctx is
+// cancelled or anything fails, the partial archive is removed.
+func CreateZip(ctx context.Context, opts Options, onProgress ProgressFunc) (string, error) {
+	if len(opts.Paths) == 0 {
+		return "", fmt.Errorf("no files to archive")
+	}
+
+	method := zip.Deflate
+	switch opts.Method {
+	case "", MethodDeflate:
+	case MethodStore:
+		method = zip.Store
+	default:
+		return "", fmt.Errorf("unknown compression method: %s", opts.Method)
+	}
+	if opts.Level < 0 || opts.Level > 9 {
+		return "", fmt.Errorf("compression level must be between 1 and 9")
+	}
+
+	entries, err := collectEntries(ctx, opts.Paths, opts.Exclude, opts.Symlinks)
+	if err != nil {
+		return "", err
+	}
+
+	dest := opts.Destination
+	if dest == "" {
+		dest = defaultDestination(opts.Paths, ".zip")
+	}
+	if _, err := sandbox.Check(dest, sandbox.Write); err != nil {
+		return "", err
+	}
+
+	if err := writeZip(ctx, dest, entries, method, opts.Level, opts.Password, onProgress); err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+
+	return dest, nil
+}
+
+func writeZip(ctx context.Context, dest string, entries []entry, method uint16, level int, password string, onProgress ProgressFunc) error {
+	progress := totals(entries)
+
+	zipFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer zipFile.Close()
+
+	w := zip.NewWriter(zipFile)
+	if level > 0 {
+		w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+
+	absDest, _ := filepath.Abs(dest)
+	for _, e := range entries {
+		// Don't archive the archive when it's written inside an input folder
+		if absPath, _ := filepath.Abs(e.path); absPath == absDest {
+			continue
+		}
+
+		progress.Current = e.name
+		if err := writeZipEntry(ctx, w, e, method, level, password, &progress, onProgress); err != nil {
+			w.Close()
+			return fmt.Errorf("failed to add %s: %w", e.name, err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if onProgress != nil {
+		onProgress(progress)
+	}
+	return zipFile.Close()
+}
+
+func writeZipEntry(ctx context.Context, w *zip.Writer, e entry, method uint16, level int, password string, progress *Progress, onProgress ProgressFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// FileInfoHeader records the mode (including the symlink bit) and mtime
+	header, err := zip.FileInfoHeader(e.info)
+	if err != nil {
+		return err
+	}
+	header.Name = e.name
+	header.Modified = e.info.ModTime()
+
+	switch {
+	case e.info.IsDir():
+		header.Name += "/"
+		header.Method = zip.Store
+		_, err := w.CreateHeader(header)
+		return err
+
+	case e.info.Mode()&os.ModeSymlink != 0:
+		// A preserved symlink's content is its target
+		target, err := os.Readlink(e.path)
+		if err != nil {
+			return err
+		}
+		header.Method = zip.Store
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, target)
+		return err
+
+	case !e.info.Mode().IsRegular():
+		// Sockets, devices and pipes can't be archived meaningfully
+		return nil
+
+	case password != "":
+		return writeEncryptedZipFile(ctx, w, header, e, method, level, password, progress, onProgress)
+	}
+
+	header.Method = method
+	f, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	return copyFileTo(ctx, f, e.path, progress, onProgress)
+}
@@ -0,0 +1,372 @@
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"Finder-2/backend/apperror"
+)
+
+// Zip entries are encrypted with WinZip's AES scheme (AE-2), which 7-Zip,
+// WinZip, macOS's Archive Utility and libarchive can all open. Names and
+// sizes stay readable; only file contents are protected.
+const (
+	methodAES       = 99     // entry method marking WinZip AES encryption
+	aesExtraID      = 0x9901 // header extra field describing it
+	aesVersion      = 2      // AE-2: no CRC, the HMAC authenticates the data
+	aesStrength256  = 3
+	aesKeySize      = 32
+	aesSaltSize     = 16
+	aesVerifierSize = 2
+	aesAuthSize     = 10
+	aesIterations   = 1000
+	aesZipVersion   = 51 // zip spec version needed to extract AES entries
+)
+
+// writeEncryptedZipFile compresses and encrypts a file into a temporary
+// file first, since its sizes go in the entry header before the data
+func writeEncryptedZipFile(ctx context.Context, w *zip.Writer, header *zip.FileHeader, e entry, method uint16, level int, password string, progress *Progress, onProgress ProgressFunc) error {
+	tmp, err := os.CreateTemp("", "finder-zip-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	salt := make([]byte, aesSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	keys, err := pbkdf2.Key(sha1.New, password, salt, aesIterations, 2*aesKeySize+aesVerifierSize)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(salt); err != nil {
+		return err
+	}
+	if _, err := tmp.Write(keys[2*aesKeySize:]); err != nil {
+		return err
+	}
+
+	enc, err := newAESWriter(tmp, keys[:aesKeySize], keys[aesKeySize:2*aesKeySize])
+	if err != nil {
+		return err
+	}
+	var out io.Writer = enc
+	var compressed io.WriteCloser
+	if method == zip.Deflate {
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+		if compressed, err = flate.NewWriter(enc, level); err != nil {
+			return err
+		}
+		out = compressed
+	}
+	counted := &countingWriter{w: out}
+
+	if err := copyFileTo(ctx, counted, e.path, progress, onProgress); err != nil {
+		return err
+	}
+	if compressed != nil {
+		if err := compressed.Close(); err != nil {
+			return err
+		}
+	}
+	if _, err := tmp.Write(enc.mac.Sum(nil)[:aesAuthSize]); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], aesExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], aesVersion)
+	copy(extra[6:], "AE")
+	extra[8] = aesStrength256
+	binary.LittleEndian.PutUint16(extra[9:], method)
+
+	header.Method = methodAES
+	header.CreatorVersion = header.CreatorVersion&0xff00 | aesZipVersion
+	header.ReaderVersion = aesZipVersion
+	header.Flags |= 0x1 // encrypted
+	if !isASCII(header.Name) {
+		header.Flags |= 0x800 // UTF-8 name, which CreateRaw doesn't set
+	}
+	header.CRC32 = 0
+	header.UncompressedSize64 = uint64(counted.n)
+	header.CompressedSize64 = uint64(size)
+	header.Extra = append(header.Extra, extra...)
+
+	f, err := w.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, tmp)
+	return err
+}
+
+// aesStream is AES in WinZip's counter mode, whose counter is
+// little-endian and starts at 1
+type aesStream struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int // bytes of stream already used
+}
+
+func newAESStream(key []byte) (*aesStream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesStream{block: block, used: aes.BlockSize}, nil
+}
+
+// xor encrypts or decrypts src into dst, which may be the same slice
+func (s *aesStream) xor(dst []byte, src []byte) {
+	for i := range src {
+		if s.used == aes.BlockSize {
+			for j := range s.counter {
+				s.counter[j]++
+				if s.counter[j] != 0 {
+					break
+				}
+			}
+			s.block.Encrypt(s.stream[:], s.counter[:])
+			s.used = 0
+		}
+		dst[i] = src[i] ^ s.stream[s.used]
+		s.used++
+	}
+}
+
+// aesWriter encrypts what it writes and authenticates the ciphertext
+type aesWriter struct {
+	w      io.Writer
+	stream *aesStream
+	mac    hash.Hash
+}
+
+func newAESWriter(w io.Writer, key []byte, macKey []byte) (*aesWriter, error) {
+	stream, err := newAESStream(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesWriter{w: w, stream: stream, mac: hmac.New(sha1.New, macKey)}, nil
+}
+
+func (a *aesWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	a.stream.xor(buf, p)
+	a.mac.Write(buf)
+	return a.w.Write(buf)
+}
+
+// openZipFile opens an entry for reading, decrypting WinZip AES entries
+// with password. Entries that need a password it doesn't have, or use the
+// legacy ZipCrypto scheme, return an apperror instead of archive/zip's
+// opaque "unsupported algorithm".
+func openZipFile(f *zip.File, password string) (io.ReadCloser, error) {
+	if f.Flags&0x1 == 0 {
+		return f.Open()
+	}
+	if f.Method != methodAES {
+		return nil, apperror.New(apperror.CodeInvalid, "%s uses legacy zip encryption, which isn't supported", f.Name)
+	}
+	if password == "" {
+		return nil, apperror.PasswordRequired(f.Name, "%s is encrypted and needs a password", f.Name)
+	}
+
+	version, strength, method, ok := parseAESExtra(f.Extra)
+	if !ok || strength < 1 || strength > 3 {
+		return nil, apperror.New(apperror.CodeInvalid, "%s has an unreadable encryption header", f.Name)
+	}
+	if method != zip.Store && method != zip.Deflate {
+		return nil, apperror.New(apperror.CodeInvalid, "%s uses an unsupported compression method (%d)", f.Name, method)
+	}
+	keySize := 8 + 8*int(strength) // 16, 24 or 32 bytes
+	saltSize := keySize / 2
+
+	dataSize := int64(f.CompressedSize64) - int64(saltSize+aesVerifierSize+aesAuthSize)
+	if dataSize < 0 {
+		return nil, apperror.New(apperror.CodeInvalid, "%s is damaged", f.Name)
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, saltSize+aesVerifierSize)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+
+	keys, err := pbkdf2.Key(sha1.New, password, header[:saltSize], aesIterations, 2*keySize+aesVerifierSize)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(header[saltSize:], keys[2*keySize:]) != 1 {
+		return nil, apperror.PasswordRequired(f.Name, "wrong password for %s", f.Name)
+	}
+
+	stream, err := newAESStream(keys[:keySize])
+	if err != nil {
+		return nil, err
+	}
+	dec := &aesReader{
+		r:         raw,
+		name:      f.Name,
+		remaining: dataSize,
+		stream:    stream,
+		mac:       hmac.New(sha1.New, keys[keySize:2*keySize]),
+	}
+
+	entry := &aesEntryReader{plain: dec, dec: dec, name: f.Name}
+	if method == zip.Deflate {
+		inflate := flate.NewReader(dec)
+		entry.plain = inflate
+		entry.closer = inflate
+	}
+	// AE-1 also keeps the CRC of the plain text; AE-2 leaves it out
+	if version == 1 {
+		entry.crc = crc32.NewIEEE()
+		entry.wantCRC = f.CRC32
+	}
+	return entry, nil
+}
+
+// parseAESExtra reads the WinZip AES extra field
+func parseAESExtra(extra []byte) (version uint16, strength byte, method uint16, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return 0, 0, 0, false
+		}
+		if id == aesExtraID && size >= 7 {
+			field := extra[4:]
+			return binary.LittleEndian.Uint16(field), field[4], binary.LittleEndian.Uint16(field[5:]), true
+		}
+		extra = extra[4+size:]
+	}
+	return 0, 0, 0, false
+}
+
+// aesReader decrypts an entry's data, checking the authentication code
+// that follows it once everything has been read
+type aesReader struct {
+	r         io.Reader
+	name      string
+	remaining int64
+	stream    *aesStream
+	mac       hash.Hash
+	verified  bool
+}
+
+func (a *aesReader) Read(p []byte) (int, error) {
+	if a.remaining == 0 {
+		if !a.verified {
+			auth := make([]byte, aesAuthSize)
+			if _, err := io.ReadFull(a.r, auth); err != nil {
+				return 0, err
+			}
+			if !hmac.Equal(auth, a.mac.Sum(nil)[:aesAuthSize]) {
+				return 0, apperror.New(apperror.CodeInvalid, "%s is damaged or was changed", a.name)
+			}
+			a.verified = true
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > a.remaining {
+		p = p[:a.remaining]
+	}
+	n, err := a.r.Read(p)
+	a.remaining -= int64(n)
+	a.mac.Write(p[:n])
+	a.stream.xor(p[:n], p[:n])
+	if err == io.EOF {
+		if a.remaining > 0 {
+			err = io.ErrUnexpectedEOF
+		} else {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+// aesEntryReader returns an entry's plain text. A deflate stream knows
+// where it ends, so once it does the rest of the data is read through to
+// check the authentication code, and the CRC when there is one.
+type aesEntryReader struct {
+	plain   io.Reader
+	dec     *aesReader
+	closer  io.Closer
+	name    string
+	crc     hash.Hash32
+	wantCRC uint32
+}
+
+func (e *aesEntryReader) Read(p []byte) (int, error) {
+	n, err := e.plain.Read(p)
+	if e.crc != nil {
+		e.crc.Write(p[:n])
+	}
+	if err == io.EOF {
+		if _, verifyErr := io.Copy(io.Discard, e.dec); verifyErr != nil {
+			return n, verifyErr
+		}
+		if e.crc != nil && e.crc.Sum32() != e.wantCRC {
+			return n, apperror.New(apperror.CodeInvalid, "%s is damaged or was changed", e.name)
+		}
+	}
+	return n, err
+}
+
+func (e *aesEntryReader) Close() error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
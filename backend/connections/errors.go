@@ -0,0 +1,67 @@
+package connections
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"Finder-2/backend/apperror"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// Reasons Google gives for refusing a request because of limits
+var quotaReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"quotaExceeded":         true,
+	"dailyLimitExceeded":    true,
+	"storageQuotaExceeded":  true,
+}
+
+// Reasons Google gives when the token doesn't carry the scope a request needs
+var scopeReasons = map[string]bool{
+	"insufficientPermissions":         true,
+	"ACCESS_TOKEN_SCOPE_INSUFFICIENT": true,
+}
+
+// GoogleError classifies an error from a Google API call so the UI can tell
+// an expired sign-in or a full Drive from a plain failure. action describes
+// what was being done, e.g. "list files".
+func GoogleError(err error, action string) error {
+	if err == nil {
+		return nil
+	}
+
+	// A refresh token that's been revoked or expired surfaces here
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return apperror.Wrap(apperror.CodeNotConnected, err, "Google sign-in has expired, please reconnect")
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		for _, item := range apiErr.Errors {
+			if quotaReasons[item.Reason] {
+				return apperror.QuotaExceeded("Google", err)
+			}
+			if scopeReasons[item.Reason] {
+				return apperror.ReauthRequired("Google", err)
+			}
+		}
+
+		switch apiErr.Code {
+		case http.StatusTooManyRequests:
+			return apperror.QuotaExceeded("Google", err)
+		case http.StatusUnauthorized:
+			return apperror.Wrap(apperror.CodeNotConnected, err, "Google sign-in has expired, please reconnect")
+		case http.StatusForbidden:
+			return apperror.Wrap(apperror.CodePermissionDenied, err, "Google refused to %s", action)
+		case http.StatusNotFound:
+			return apperror.Wrap(apperror.CodeNotFound, err, "failed to %s", action)
+		}
+	}
+
+	return fmt.Errorf("failed to %s: %w", action, err)
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"Finder-2/backend/apperror"
 	"Finder-2/backend/database"
+	"Finder-2/backend/logging"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -17,41 +20,108 @@ import (
 	"google.golang.org/api/option"
 )
 
+var logger = logging.For("google")
+
 var (
 	googleOAuthConfig *oauth2.Config
 	oauthStateString  = "random-state-string" // In production, generate random state
 )
 
+// googleScopes is what the app asks Google for. A saved sign-in missing
+// any of them, such as one from before Drive access was widened, has to be
+// redone.
+var googleScopes = []string{
+	drive.DriveScope,         // Browse and organize Drive like a local folder
+	gmail.GmailReadonlyScope, // Read Gmail messages
+	gmail.GmailSendScope,     // Send emails
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
 // InitGoogleOAuth initializes the Google OAuth configuration
 func InitGoogleOAuth(clientID, clientSecret string) {
 	googleOAuthConfig = &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
-		RedirectURL:  "http://localhost:8080/auth/google/callback",
-		Scopes: []string{
-			drive.DriveFileScope,     // Access to files created by this app
-			drive.DriveMetadataScope, // Read file metadata
-			gmail.GmailReadonlyScope, // Read Gmail messages
-			gmail.GmailSendScope,     // Send emails
-			"https://www.googleapis.com/auth/userinfo.email",
-		},
-		Endpoint: google.Endpoint,
+		RedirectURL:  redirectURL(),
+		Scopes:       googleScopes,
+		Endpoint:     google.Endpoint,
 	}
 }
 
+// grantedScopes returns the scopes Google says a token was granted
+func grantedScopes(token *oauth2.Token) []string {
+	scope, _ := token.Extra("scope").(string)
+	return strings.Fields(scope)
+}
+
+// missingScopes returns the googleScopes that granted lacks
+func missingScopes(granted []string) []string {
+	has := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		has[scope] = true
+	}
+	var missing []string
+	for _, scope := range googleScopes {
+		if !has[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// tokenURL is Google's token endpoint, replaced in tests
+var tokenURL = google.Endpoint.TokenURL
+
+// TestClientConfig checks a client ID and secret against Google's token
+// endpoint. Exchanging a made-up code always fails: Google answers 400
+// invalid_grant once it has accepted the client, and invalid_client when
+// the client itself is wrong. Any other answer proves nothing.
+func TestClientConfig(clientID, clientSecret string) error {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {"finder-2-test"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"redirect_uri":  {redirectURL()},
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.PostForm(tokenURL, form)
+	if err != nil {
+		return fmt.Errorf("failed to reach Google: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest && body.Error == "invalid_grant":
+		return nil
+	case body.Error == "invalid_client" || body.Error == "unauthorized_client":
+		return apperror.New(apperror.CodeNotConnected, "Google rejected the client ID or secret")
+	}
+	return fmt.Errorf("unexpected response from Google: %s %s", resp.Status, body.Error)
+}
+
 // StartGoogleLogin opens the browser for user to login
 func StartGoogleLogin() string {
 	if googleOAuthConfig == nil {
-		log.Println("Google OAuth not initialized")
+		logger.Warn("google OAuth not initialized")
 		return ""
 	}
 
 	// Start callback server
 	if err := StartCallbackServer(); err != nil {
-		log.Println("Error starting callback server:", err)
+		logger.Error("failed to start callback server", "error", err)
 		return ""
 	}
 
+	// The port may have changed in settings since InitGoogleOAuth
+	googleOAuthConfig.RedirectURL = redirectURL()
+
 	url := googleOAuthConfig.AuthCodeURL(oauthStateString,
 		oauth2.AccessTypeOffline,
 		oauth2.ApprovalForce)
@@ -71,8 +141,7 @@ func LoginAndWait() error {
 		return fmt.Errorf("failed to generate auth URL")
 	}
 
-	log.Println("Opening browser for Google login...")
-	log.Println("Auth URL:", authURL)
+	logger.Info("opening browser for Google login")
 
 	// Wait for the callback
 	return WaitForCallback()
@@ -81,24 +150,21 @@ func LoginAndWait() error {
 // HandleGoogleCallback processes the OAuth callback and stores tokens
 func HandleGoogleCallback(code string) error {
 	if googleOAuthConfig == nil {
-		return fmt.Errorf("google OAuth not initialized")
+		return apperror.New(apperror.CodeNotConnected, "google OAuth not initialized")
 	}
 
 	// Exchange code for token
 	token, err := googleOAuthConfig.Exchange(context.Background(), code)
 	if err != nil {
-		return fmt.Errorf("failed to exchange code: %v", err)
+		return GoogleError(err, "exchange code")
 	}
 
-	log.Println("Token received from Google:")
-	log.Println("  - Access Token:", token.AccessToken[:20]+"...")
-	log.Println("  - Refresh Token:", token.RefreshToken)
-	log.Println("  - Expiry:", token.Expiry)
+	logger.Debug("token received from Google", "expiry", token.Expiry, "hasRefreshToken", token.RefreshToken != "")
 
 	// Get user email
 	email, err := getUserEmail(token)
 	if err != nil {
-		log.Println("Warning: could not get user email:", err)
+		logger.Warn("could not get user email", "error", err)
 		email = "unknown"
 	}
 
@@ -108,17 +174,17 @@ func HandleGoogleCallback(code string) error {
 		AccessToken:  token.AccessToken,
 		Email:        email,
 		ExpiresAt:    token.Expiry.Unix(),
+		Scopes:       grantedScopes(token),
+	}
+	if missing := missingScopes(authData.Scopes); len(missing) > 0 {
+		logger.Warn("Google granted fewer scopes than requested", "missing", missing)
 	}
-
-	log.Println("Saving to keychain:")
-	log.Println("  - Refresh Token:", authData.RefreshToken)
-	log.Println("  - Email:", authData.Email)
 
 	if err := database.SaveGoogleAuth(authData); err != nil {
-		return fmt.Errorf("failed to save auth: %v", err)
+		return fmt.Errorf("failed to save auth: %w", err)
 	}
 
-	log.Println("Successfully authenticated with Google as", email)
+	logger.Info("authenticated with Google", "email", email)
 	return nil
 }
 
@@ -150,7 +216,11 @@ func GetGoogleClient() (*http.Client, error) {
 	}
 
 	if authData == nil {
-		return nil, fmt.Errorf("not connected to Google")
+		return nil, apperror.NotConnected("Google")
+	}
+	if missing := missingScopes(authData.Scopes); len(missing) > 0 {
+		logger.Info("saved Google sign-in lacks scopes", "missing", missing)
+		return nil, apperror.ReauthRequired("Google", nil)
 	}
 
 	token := &oauth2.Token{
@@ -194,12 +264,12 @@ type GoogleFile struct {
 func ListGoogleDocs() ([]GoogleFile, error) {
 	client, err := GetGoogleClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get Google client: %v", err)
+		return nil, fmt.Errorf("failed to get Google client: %w", err)
 	}
 
 	srv, err := drive.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Drive service: %v", err)
+		return nil, fmt.Errorf("failed to create Drive service: %w", err)
 	}
 
 	// Query for Google Docs, Sheets, and Slides
@@ -214,7 +284,7 @@ func ListGoogleDocs() ([]GoogleFile, error) {
 		Do()
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to list files: %v", err)
+		return nil, GoogleError(err, "list files")
 	}
 
 	var files []GoogleFile
@@ -243,18 +313,18 @@ type GmailMessage struct {
 func ListGmailMessages() ([]GmailMessage, error) {
 	client, err := GetGoogleClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get Google client: %v", err)
+		return nil, fmt.Errorf("failed to get Google client: %w", err)
 	}
 
 	srv, err := gmail.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Gmail service: %v", err)
+		return nil, fmt.Errorf("failed to create Gmail service: %w", err)
 	}
 
 	// Get messages from inbox
 	msgList, err := srv.Users.Messages.List("me").MaxResults(50).Do()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list messages: %v", err)
+		return nil, GoogleError(err, "list messages")
 	}
 
 	var messages []GmailMessage
@@ -263,7 +333,7 @@ func ListGmailMessages() ([]GmailMessage, error) {
 		msg, err := srv.Users.Messages.Get("me", m.Id).Format("metadata").
 			MetadataHeaders("Subject", "From", "Date").Do()
 		if err != nil {
-			log.Printf("Error getting message %s: %v", m.Id, err)
+			logger.Warn("failed to get message", "id", m.Id, "error", err)
 			continue
 		}
 
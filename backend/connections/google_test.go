@@ -0,0 +1,120 @@
+package connections
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Finder-2/backend/apperror"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestMissingScopes(t *testing.T) {
+	if missing := missingScopes(googleScopes); len(missing) != 0 {
+		t.Errorf("missingScopes(all) = %v, want none", missing)
+	}
+
+	// A sign-in from before Drive access was widened
+	narrow := []string{
+		"https://www.googleapis.com/auth/drive.file",
+		"https://www.googleapis.com/auth/gmail.readonly",
+		"https://www.googleapis.com/auth/gmail.send",
+		"https://www.googleapis.com/auth/userinfo.email",
+	}
+	missing := missingScopes(narrow)
+	if len(missing) != 1 || missing[0] != "https://www.googleapis.com/auth/drive" {
+		t.Errorf("missingScopes(narrow) = %v, want the drive scope", missing)
+	}
+
+	if missing := missingScopes(nil); len(missing) != len(googleScopes) {
+		t.Errorf("missingScopes(nil) = %v, want every scope", missing)
+	}
+}
+
+func TestGrantedScopes(t *testing.T) {
+	token := (&oauth2.Token{AccessToken: "x"}).WithExtra(map[string]any{
+		"scope": "https://www.googleapis.com/auth/drive openid",
+	})
+	got := grantedScopes(token)
+	if len(got) != 2 || got[0] != "https://www.googleapis.com/auth/drive" || got[1] != "openid" {
+		t.Errorf("grantedScopes = %v", got)
+	}
+}
+
+func TestGoogleError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"scope", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "insufficientPermissions"}}}, apperror.CodeReauthRequired},
+		{"scope by status", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "ACCESS_TOKEN_SCOPE_INSUFFICIENT"}}}, apperror.CodeReauthRequired},
+		{"403", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, apperror.CodePermissionDenied},
+		{"403 without reason", &googleapi.Error{Code: http.StatusForbidden}, apperror.CodePermissionDenied},
+		{"rate limit", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, apperror.CodeQuotaExceeded},
+		{"storage quota", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "storageQuotaExceeded"}}}, apperror.CodeQuotaExceeded},
+		{"429", &googleapi.Error{Code: http.StatusTooManyRequests}, apperror.CodeQuotaExceeded},
+		{"401", &googleapi.Error{Code: http.StatusUnauthorized}, apperror.CodeNotConnected},
+		{"404", &googleapi.Error{Code: http.StatusNotFound}, apperror.CodeNotFound},
+		{"wrapped 404", fmt.Errorf("stat: %w", &googleapi.Error{Code: http.StatusNotFound}), apperror.CodeNotFound},
+		{"revoked refresh token", &oauth2.RetrieveError{Response: &http.Response{Status: "400 Bad Request"}, ErrorCode: "invalid_grant"}, apperror.CodeNotConnected},
+		{"500", &googleapi.Error{Code: http.StatusInternalServerError}, apperror.CodeUnknown},
+		{"network", errors.New("connection reset"), apperror.CodeUnknown},
+	}
+	for _, tt := range tests {
+		err := GoogleError(tt.err, "list files")
+		if code := apperror.CodeOf(err); code != tt.code {
+			t.Errorf("%s: GoogleError(%v) = %v, want code %s", tt.name, tt.err, err, tt.code)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: GoogleError doesn't wrap the original error", tt.name)
+		}
+	}
+
+	if GoogleError(nil, "list files") != nil {
+		t.Error("GoogleError(nil) isn't nil")
+	}
+}
+
+func TestTestClientConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		ok     bool
+		code   string
+	}{
+		{"accepted", http.StatusBadRequest, `{"error":"invalid_grant"}`, true, ""},
+		{"wrong client", http.StatusUnauthorized, `{"error":"invalid_client"}`, false, apperror.CodeNotConnected},
+		{"unauthorized client", http.StatusBadRequest, `{"error":"unauthorized_client"}`, false, apperror.CodeNotConnected},
+		{"invalid_grant on a server error", http.StatusInternalServerError, `{"error":"invalid_grant"}`, false, apperror.CodeUnknown},
+		{"other 400", http.StatusBadRequest, `{"error":"invalid_request"}`, false, apperror.CodeUnknown},
+		{"success without an error", http.StatusOK, `{}`, false, apperror.CodeUnknown},
+		{"not JSON", http.StatusBadGateway, `<html>bad gateway</html>`, false, apperror.CodeUnknown},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+		previous := tokenURL
+		tokenURL = server.URL
+
+		err := TestClientConfig("id", "secret")
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("%s: TestClientConfig = %v, want success", tt.name, err)
+		case !tt.ok && err == nil:
+			t.Errorf("%s: TestClientConfig succeeded, want a failure", tt.name)
+		case !tt.ok && apperror.CodeOf(err) != tt.code:
+			t.Errorf("%s: TestClientConfig = %v, want code %s", tt.name, err, tt.code)
+		}
+
+		tokenURL = previous
+		server.Close()
+	}
+}
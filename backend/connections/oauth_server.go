@@ -2,9 +2,10 @@ package connections
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"sync"
+
+	"Finder-2/backend/settings"
 )
 
 var (
@@ -29,21 +30,28 @@ func StartCallbackServer() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/auth/google/callback", handleCallback)
 
+	addr := fmt.Sprintf(":%d", settings.Get().CallbackPort)
 	callbackServer = &http.Server{
-		Addr:    ":8080",
+		Addr:    addr,
 		Handler: mux,
 	}
 
 	go func() {
-		log.Println("Starting OAuth callback server on :8080")
+		logger.Info("starting OAuth callback server", "addr", addr)
 		if err := callbackServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Callback server error: %v", err)
+			logger.Error("callback server failed", "error", err)
 		}
 	}()
 
 	return nil
 }
 
+// redirectURL is where Google sends the browser back to, on the port the
+// callback server listens on
+func redirectURL() string {
+	return fmt.Sprintf("http://localhost:%d/auth/google/callback", settings.Get().CallbackPort)
+}
+
 // StopCallbackServer stops the callback server
 func StopCallbackServer() {
 	serverMutex.Lock()
@@ -1,12 +1,22 @@
 package contextmenu
 
 import (
-	"archive/zip"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/archive"
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/google"
+	"Finder-2/backend/pointers"
+	"Finder-2/backend/sandbox"
+	"Finder-2/backend/tags"
 )
 
 type ClipboardItem struct {
@@ -25,6 +35,11 @@ func CopyFile(path string) error {
 }
 
 func CutFile(path string) error {
+	if !gdrive.IsPath(path) {
+		if _, err := sandbox.Check(path, sandbox.Remove); err != nil {
+			return err
+		}
+	}
 	clipboard = &ClipboardItem{
 		Path:      path,
 		Operation: "cut",
@@ -32,25 +47,62 @@ func CutFile(path string) error {
 	return nil
 }
 
-func PasteFile(destinationDir string) error {
+func PasteFile(store database.Store, destinationDir string) error {
 	if clipboard == nil {
+		return apperror.New(apperror.CodeInvalid, "nothing to paste, the clipboard is empty")
+	}
+
+	if involvesDrive(clipboard.Path, destinationDir) {
+		if err := transferDrive(clipboard.Path, destinationDir, clipboard.Operation == "cut"); err != nil {
+			return err
+		}
+		if clipboard.Operation == "cut" {
+			clipboard = nil
+		}
 		return nil
 	}
 
+	if _, err := sandbox.Check(destinationDir, sandbox.Write); err != nil {
+		return err
+	}
+
 	sourcePath := clipboard.Path
 	fileName := filepath.Base(sourcePath)
 	destPath := filepath.Join(destinationDir, fileName)
 
+	// Files inside an archive are copied out by extracting just them
+	if archivePath, inner, ok := archive.SplitPath(sourcePath); ok && inner != "" {
+		if clipboard.Operation == "cut" {
+			return apperror.New(apperror.CodeInvalid, "files can't be moved out of an archive, copy them instead")
+		}
+		return archive.ExtractEntries(context.Background(), store, archivePath, []string{inner}, archive.ExtractOptions{Destination: destinationDir}, nil)
+	}
+
+	// Never overwrite, which for a paste into the same folder would also
+	// truncate the source
+	if _, err := os.Lstat(destPath); err == nil {
+		return apperror.AlreadyExists(destPath)
+	}
+
 	if clipboard.Operation == "copy" {
 		err := copyFile(sourcePath, destPath)
 		if err != nil {
-			return err
+			return apperror.FromOS(err, sourcePath)
 		}
+		tags.Copied(store, sourcePath, destPath)
+		pointers.Copied(store, sourcePath, destPath)
+		foldersize.Invalidate(store, destPath)
 	} else if clipboard.Operation == "cut" {
+		if _, err := sandbox.Check(sourcePath, sandbox.Remove); err != nil {
+			return err
+		}
 		err := os.Rename(sourcePath, destPath)
 		if err != nil {
-			return err
+			return apperror.FromOS(err, sourcePath)
 		}
+		tags.Moved(store, sourcePath, destPath)
+		pointers.Moved(store, sourcePath, destPath)
+		foldersize.Invalidate(store, sourcePath, destPath)
 		clipboard = nil
 	}
 
@@ -61,7 +113,15 @@ func HasClipboardContent() bool {
 	return clipboard != nil
 }
 
-func TrashFile(path string) error {
+func TrashFile(store database.Store, path string) error {
+	if gdrive.IsPath(path) {
+		return gdrive.Trash(context.Background(), path)
+	}
+
+	if _, err := sandbox.Check(path, sandbox.Remove); err != nil {
+		return err
+	}
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -86,172 +146,117 @@ func TrashFile(path string) error {
 		}
 	}
 
-	return os.Rename(path, trashPath)
-}
-
-func RenameFile(oldPath string, newName string) error {
-	dir := filepath.Dir(oldPath)
-	newPath := filepath.Join(dir, newName)
-	return os.Rename(oldPath, newPath)
-}
-
-func CreateFile(directory string, name string) error {
-	filePath := filepath.Join(directory, name)
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
+	if err := os.Rename(path, trashPath); err != nil {
+		return apperror.FromOS(err, path)
 	}
-	return file.Close()
-}
 
-func CreateFolder(directory string, name string) error {
-	folderPath := filepath.Join(directory, name)
-	return os.Mkdir(folderPath, 0755)
+	tags.Removed(store, path)
+	pointers.Removed(store, path)
+	foldersize.Invalidate(store, path, trashPath)
+	return nil
 }
 
-func Zip(path string) error {
-	// Get the base name for the zip file
-	baseName := filepath.Base(path)
-	dir := filepath.Dir(path)
-	zipPath := filepath.Join(dir, baseName+".zip")
-
-	// Handle duplicate zip names
-	if _, err := os.Stat(zipPath); err == nil {
-		counter := 1
-		for {
-			zipPath = filepath.Join(dir, fmt.Sprintf("%s %d.zip", baseName, counter))
-			if _, err := os.Stat(zipPath); os.IsNotExist(err) {
-				break
-			}
-			counter++
-		}
+func RenameFile(store database.Store, oldPath string, newName string) error {
+	if gdrive.IsPath(oldPath) {
+		return gdrive.Rename(context.Background(), oldPath, newName)
 	}
 
-	// Create the zip file
-	zipFile, err := os.Create(zipPath)
-	if err != nil {
+	if _, err := sandbox.Check(oldPath, sandbox.Remove); err != nil {
 		return err
 	}
-	defer zipFile.Close()
-
-	w := zip.NewWriter(zipFile)
-	defer w.Close()
-
-	// Check if path is a file or directory
-	info, err := os.Stat(path)
-	if err != nil {
+	if err := sandbox.CheckName(newName); err != nil {
 		return err
 	}
 
-	if info.IsDir() {
-		// Walk the directory
-		return filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			// Get relative path
-			relPath, err := filepath.Rel(filepath.Dir(path), filePath)
-			if err != nil {
-				return err
-			}
+	dir := filepath.Dir(oldPath)
+	newPath := filepath.Join(dir, newName)
 
-			if info.IsDir() {
-				// Add directory entry
-				_, err := w.Create(relPath + "/")
-				return err
-			}
+	// os.Rename would silently replace another file. A case-only rename on a
+	// case-insensitive disk finds the file itself, which is fine.
+	if existing, err := os.Lstat(newPath); err == nil {
+		if current, err := os.Lstat(oldPath); err != nil || !os.SameFile(existing, current) {
+			return apperror.AlreadyExists(newPath)
+		}
+	}
 
-			// Create file entry
-			f, err := w.Create(relPath)
-			if err != nil {
-				return err
-			}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return apperror.FromOS(err, oldPath)
+	}
 
-			// Open and copy file contents
-			file, err := os.Open(filePath)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+	tags.Moved(store, oldPath, newPath)
+	pointers.Moved(store, oldPath, newPath)
+	foldersize.Invalidate(store, oldPath, newPath)
+	return nil
+}
 
-			_, err = io.Copy(f, file)
-			return err
-		})
-	} else {
-		// Single file
-		f, err := w.Create(baseName)
-		if err != nil {
-			return err
-		}
+func CreateFile(store database.Store, directory string, name string) error {
+	if gdrive.IsPath(directory) {
+		return apperror.New(apperror.CodeInvalid, "empty files can't be created in Google Drive")
+	}
 
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
+	// A pointer file's name creates its Google file, so "Budget.gsheet"
+	// makes a new Sheet called Budget
+	if kind, ok := pointers.KindOfPath(name); ok {
+		return google.CreateGoogleFile(store, directory, strings.TrimSuffix(name, filepath.Ext(name)), kind.Type)
+	}
 
-		_, err = io.Copy(f, file)
+	if err := checkCreate(directory, name); err != nil {
 		return err
 	}
-}
 
-func UnZip(zipPath string) error {
-	// Open the zip file
-	r, err := zip.OpenReader(zipPath)
+	filePath := filepath.Join(directory, name)
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
-		return err
+		return apperror.FromOS(err, filePath)
 	}
-	defer r.Close()
-
-	// Get the directory where the zip file is located
-	destDir := filepath.Dir(zipPath)
-
-	for _, f := range r.File {
-		// Construct the full path for the file
-		fpath := filepath.Join(destDir, f.Name)
-
-		// Check for ZipSlip vulnerability
-		if !strings.HasPrefix(fpath, filepath.Clean(destDir)+string(os.PathSeparator)) {
-			return fmt.Errorf("invalid file path: %s", fpath)
-		}
+	foldersize.Invalidate(store, filePath)
+	return file.Close()
+}
 
-		if f.FileInfo().IsDir() {
-			// Create directory
-			os.MkdirAll(fpath, os.ModePerm)
-			continue
-		}
+func CreateFolder(store database.FolderSizeStore, directory string, name string) error {
+	if gdrive.IsPath(directory) {
+		_, err := gdrive.CreateFolder(context.Background(), directory, name)
+		return err
+	}
 
-		// Create parent directories if needed
-		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-			return err
-		}
+	if err := checkCreate(directory, name); err != nil {
+		return err
+	}
 
-		// Create the file
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return err
-		}
+	folderPath := filepath.Join(directory, name)
+	if err := os.Mkdir(folderPath, 0755); err != nil {
+		return apperror.FromOS(err, folderPath)
+	}
+	foldersize.Invalidate(store, folderPath)
+	return nil
+}
 
-		rc, err := f.Open()
-		if err != nil {
-			outFile.Close()
-			return err
-		}
+func Zip(sizes database.FolderSizeStore, path string) error {
+	_, err := archive.Create(context.Background(), sizes, archive.Options{
+		Paths:   []string{path},
+		Exclude: archive.DefaultExcludes,
+	}, nil)
+	return err
+}
 
-		_, err = io.Copy(outFile, rc)
-		outFile.Close()
-		rc.Close()
+// UnZip extracts any supported archive into a new folder next to it
+func UnZip(sizes database.FolderSizeStore, zipPath string) error {
+	_, err := archive.Extract(context.Background(), sizes, zipPath, archive.ExtractOptions{}, nil)
+	return err
+}
 
-		if err != nil {
-			return err
-		}
+func MoveFile(store database.Store, sourcePath string, destinationDir string) error {
+	if involvesDrive(sourcePath, destinationDir) {
+		return transferDrive(sourcePath, destinationDir, true)
 	}
 
-	return nil
-}
+	if _, err := sandbox.Check(sourcePath, sandbox.Remove); err != nil {
+		return err
+	}
+	if _, err := sandbox.Check(destinationDir, sandbox.Write); err != nil {
+		return err
+	}
 
-func MoveFile(sourcePath string, destinationDir string) error {
 	fileName := filepath.Base(sourcePath)
 	destPath := filepath.Join(destinationDir, fileName)
 
@@ -270,7 +275,46 @@ func MoveFile(sourcePath string, destinationDir string) error {
 		}
 	}
 
-	return os.Rename(sourcePath, destPath)
+	if err := os.Rename(sourcePath, destPath); err != nil {
+		return apperror.FromOS(err, sourcePath)
+	}
+
+	tags.Moved(store, sourcePath, destPath)
+	pointers.Moved(store, sourcePath, destPath)
+	foldersize.Invalidate(store, sourcePath, destPath)
+	return nil
+}
+
+// ReplaceWithHardlink replaces duplicatePath with a hardlink to sourcePath.
+// The link is created under a temporary name first so duplicatePath is never
+// missing if linking fails.
+func ReplaceWithHardlink(store database.FolderSizeStore, sourcePath string, duplicatePath string) error {
+	if _, err := sandbox.Check(duplicatePath, sandbox.Remove); err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(duplicatePath), fmt.Sprintf(".%s.link-tmp", filepath.Base(duplicatePath)))
+
+	if err := os.Link(sourcePath, tmpPath); err != nil {
+		return apperror.FromOS(err, sourcePath)
+	}
+
+	if err := os.Rename(tmpPath, duplicatePath); err != nil {
+		os.Remove(tmpPath)
+		return apperror.FromOS(err, duplicatePath)
+	}
+
+	foldersize.Invalidate(store, duplicatePath)
+	return nil
+}
+
+// checkCreate applies the sandbox to a new file or folder
+func checkCreate(directory string, name string) error {
+	if err := sandbox.CheckName(name); err != nil {
+		return err
+	}
+	_, err := sandbox.Check(filepath.Join(directory, name), sandbox.Write)
+	return err
 }
 
 func copyFile(src, dst string) error {
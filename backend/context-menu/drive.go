@@ -0,0 +1,45 @@
+package contextmenu
+
+import (
+	"context"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/transfer"
+)
+
+// involvesDrive reports whether an operation between two paths touches
+// Google Drive, which the local file operations can't handle
+func involvesDrive(paths ...string) bool {
+	for _, path := range paths {
+		if gdrive.IsPath(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// transferDrive copies or moves between Drive folders. Copies between Drive
+// and this computer are queued as uploads or downloads and finish in the
+// background.
+func transferDrive(sourcePath string, destinationDir string, move bool) error {
+	fromDrive, toDrive := gdrive.IsPath(sourcePath), gdrive.IsPath(destinationDir)
+	if fromDrive != toDrive {
+		if move {
+			return apperror.New(apperror.CodeInvalid, "files can only be copied between Google Drive and this computer, not moved")
+		}
+		var err error
+		if toDrive {
+			_, err = transfer.Upload([]string{sourcePath}, destinationDir)
+		} else {
+			_, err = transfer.Download([]string{sourcePath}, destinationDir, gdrive.ExportOffice)
+		}
+		return err
+	}
+
+	ctx := context.Background()
+	if move {
+		return gdrive.Move(ctx, sourcePath, destinationDir)
+	}
+	return gdrive.Copy(ctx, sourcePath, destinationDir)
+}
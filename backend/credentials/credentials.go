@@ -0,0 +1,200 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/logging"
+
+	"github.com/zalando/go-keyring"
+)
+
+var logger = logging.For("credentials")
+
+// serviceName is the keyring service every credential is stored under
+const serviceName = "Finder-2"
+
+// Names of the credentials the app uses
+const (
+	CerebrasAPIKey     = "cerebras-api-key"
+	GoogleClientID     = "google-client-id"
+	GoogleClientSecret = "google-client-secret"
+	GoogleOAuth        = "google-oauth" // tokens saved after login
+)
+
+// Credentials that can be set from the UI, with the environment variable
+// each falls back to so an existing .env keeps working
+var Configurable = map[string]string{
+	CerebrasAPIKey:     "CEREBRAS_API_KEY",
+	GoogleClientID:     "GOOGLE_CLIENT_ID",
+	GoogleClientSecret: "GOOGLE_CLIENT_SECRET",
+}
+
+// Where a credential was found
+const (
+	SourceKeyring = "keyring"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+)
+
+// ErrNotFound is returned by Get when a credential isn't set anywhere
+var ErrNotFound = errors.New("credential not found")
+
+// Status describes a credential without revealing it
+type Status struct {
+	Name    string `json:"name"`
+	Set     bool   `json:"set"`
+	Source  string `json:"source,omitempty"`  // SourceKeyring, SourceFile or SourceEnv
+	Warning string `json:"warning,omitempty"` // shown beside the credential when how it's kept is weak
+}
+
+// fileWarning tells the user what the file fallback does and doesn't protect
+const fileWarning = "No system keyring is available, so this is kept in the app's data folder, " +
+	"encrypted with a key derived from this computer's ID. A copy of the folder can't be read " +
+	"elsewhere, but other programs running on this computer could recover it."
+
+// backend is somewhere credentials are kept
+type backend interface {
+	get(name string) (string, error) // ErrNotFound when missing
+	set(name, value string) error
+	delete(name string) error // no error when missing
+	source() string
+}
+
+var (
+	// backends in the order they're read; the first is written to
+	backends   = []backend{keyringBackend{}}
+	backendMux sync.RWMutex
+)
+
+// Init picks where credentials are stored. The OS keyring is used when a
+// secret service answers; otherwise, as on a headless Linux machine, they
+// go to a file in dir encrypted with a key derived from the machine ID.
+func Init(dir string) {
+	file := &fileBackend{dir: dir}
+
+	backendMux.Lock()
+	defer backendMux.Unlock()
+
+	if err := probeKeyring(); err != nil {
+		logger.Warn("OS keyring unavailable, storing credentials in an encrypted file", "dir", dir, "error", err)
+		backends = []backend{file}
+		return
+	}
+	// The file is still read so credentials saved while the keyring was
+	// unavailable aren't lost
+	backends = []backend{keyringBackend{}, file}
+}
+
+func probeKeyring() error {
+	_, err := keyring.Get(serviceName, "probe")
+	if err == nil || errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func currentBackends() []backend {
+	backendMux.RLock()
+	defer backendMux.RUnlock()
+	return backends
+}
+
+// Get returns a credential from the first place it's found, falling back to
+// its environment variable
+func Get(name string) (string, error) {
+	value, _, err := lookup(name)
+	return value, err
+}
+
+func lookup(name string) (string, string, error) {
+	for _, b := range currentBackends() {
+		value, err := b.get(name)
+		if err == nil {
+			return value, b.source(), nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return "", "", err
+		}
+	}
+
+	if env := Configurable[name]; env != "" {
+		if value := os.Getenv(env); value != "" {
+			return value, SourceEnv, nil
+		}
+	}
+	return "", "", ErrNotFound
+}
+
+// Set stores a credential, replacing any previous value
+func Set(name, value string) error {
+	if value == "" {
+		return apperror.New(apperror.CodeInvalid, "%s cannot be empty", name)
+	}
+	return currentBackends()[0].set(name, value)
+}
+
+// Delete removes a credential from every place it's stored. An environment
+// variable can't be removed and will still be used.
+func Delete(name string) error {
+	for _, b := range currentBackends() {
+		if err := b.delete(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the status of every configurable credential
+func List() ([]Status, error) {
+	var statuses []Status
+	for _, name := range []string{CerebrasAPIKey, GoogleClientID, GoogleClientSecret} {
+		_, source, err := lookup(name)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		status := Status{Name: name, Set: err == nil, Source: source}
+		if source == SourceFile {
+			status.Warning = fileWarning
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// CheckConfigurable rejects names the UI may not set, such as the OAuth
+// tokens
+func CheckConfigurable(name string) error {
+	if _, ok := Configurable[name]; !ok {
+		return apperror.New(apperror.CodeInvalid, "unknown credential: %s", name)
+	}
+	return nil
+}
+
+type keyringBackend struct{}
+
+func (keyringBackend) get(name string) (string, error) {
+	value, err := keyring.Get(serviceName, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+func (keyringBackend) set(name, value string) error {
+	return keyring.Set(serviceName, name, value)
+}
+
+func (keyringBackend) delete(name string) error {
+	err := keyring.Delete(serviceName, name)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (keyringBackend) source() string {
+	return SourceKeyring
+}
@@ -0,0 +1,240 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	credentialsFile = "credentials.enc"
+
+	// legacyKeyFile held the random key earlier versions kept beside the
+	// credentials. It's read once to re-encrypt them, then removed.
+	legacyKeyFile = "credentials.key"
+
+	saltSize = 16
+)
+
+// keyInfo binds derived keys to this use, so the machine ID yields no key
+// any other program would derive from it
+const keyInfo = "Finder-2 credentials"
+
+// machineSecret is what the file key is derived from. It's a variable so
+// tests can stand in for another computer.
+var machineSecret = func() ([]byte, error) {
+	id, err := machineID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the machine ID: %w", err)
+	}
+	return []byte(id), nil
+}
+
+// fileBackend keeps credentials in a JSON map encrypted with AES-256-GCM.
+// The key is derived with HKDF-SHA256 from this computer's machine ID and a
+// random salt stored at the start of the file, so nothing beside the file
+// unlocks it and a copy or backup of the folder can't be read on another
+// computer. The machine ID isn't a secret from programs running here,
+// though, so it's weaker than a keyring, and List flags credentials kept
+// here. The file is readable only by the user.
+type fileBackend struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func (f *fileBackend) source() string {
+	return SourceFile
+}
+
+func (f *fileBackend) get(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (f *fileBackend) set(name, value string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values, err := f.load()
+	if err != nil {
+		return err
+	}
+	values[name] = value
+	return f.save(values)
+}
+
+func (f *fileBackend) delete(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := values[name]; !ok {
+		return nil
+	}
+	delete(values, name)
+	return f.save(values)
+}
+
+// load decrypts the file, returning an empty map when there isn't one.
+// Credentials from before the key was derived are re-encrypted.
+func (f *fileBackend) load() (map[string]string, error) {
+	values := make(map[string]string)
+	if f.dir == "" {
+		return values, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(f.dir, credentialsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := f.open(data)
+	if err != nil {
+		legacy, legacyErr := f.openLegacy(data)
+		if legacyErr != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(legacy, &values); err != nil {
+			return nil, err
+		}
+		if err := f.save(values); err != nil {
+			return nil, err
+		}
+		if err := os.Remove(filepath.Join(f.dir, legacyKeyFile)); err != nil {
+			logger.Warn("failed to remove the old credentials key", "error", err)
+		}
+		logger.Info("credentials re-encrypted with a key derived from the machine ID")
+		return values, nil
+	}
+
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// open decrypts data laid out as salt, nonce and sealed JSON
+func (f *fileBackend) open(data []byte) ([]byte, error) {
+	if len(data) < saltSize {
+		return nil, fmt.Errorf("%s is corrupt", credentialsFile)
+	}
+	gcm, err := deriveCipher(data[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s is corrupt", credentialsFile)
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", credentialsFile, err)
+	}
+	return plain, nil
+}
+
+// openLegacy decrypts data laid out as nonce and sealed JSON with the key
+// in legacyKeyFile
+func (f *fileBackend) openLegacy(data []byte) ([]byte, error) {
+	key, err := os.ReadFile(filepath.Join(f.dir, legacyKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s is corrupt", legacyKeyFile)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s is corrupt", credentialsFile)
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// save encrypts values under a fresh salt and nonce and replaces the file
+// atomically
+func (f *fileBackend) save(values map[string]string) error {
+	if f.dir == "" {
+		return fmt.Errorf("credentials folder not initialized")
+	}
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	gcm, err := deriveCipher(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data := gcm.Seal(append(salt, nonce...), nonce, plain, nil)
+
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return err
+	}
+	path := filepath.Join(f.dir, credentialsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// deriveCipher derives the key for salt from the machine secret
+func deriveCipher(salt []byte) (cipher.AEAD, error) {
+	secret, err := machineSecret()
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Key(sha256.New, secret, salt, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
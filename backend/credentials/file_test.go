@@ -0,0 +1,217 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileBackendRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	f := &fileBackend{dir: dir}
+
+	if _, err := f.get(CerebrasAPIKey); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get before anything is saved = %v, want ErrNotFound", err)
+	}
+	if err := f.set(CerebrasAPIKey, "sk-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.set(GoogleClientID, "client"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh backend reads what the first one wrote
+	reopened := &fileBackend{dir: dir}
+	if value, err := reopened.get(CerebrasAPIKey); err != nil || value != "sk-secret" {
+		t.Errorf("get = %q, %v, want sk-secret", value, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, credentialsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-secret") {
+		t.Error("the secret is stored in plain text")
+	}
+
+	if err := reopened.delete(CerebrasAPIKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.delete(CerebrasAPIKey); err != nil {
+		t.Errorf("deleting a missing credential = %v, want no error", err)
+	}
+	if _, err := f.get(CerebrasAPIKey); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after delete = %v, want ErrNotFound", err)
+	}
+	if value, err := f.get(GoogleClientID); err != nil || value != "client" {
+		t.Errorf("other credential = %q, %v, want it kept", value, err)
+	}
+}
+
+func TestFileBackendPermissions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	f := &fileBackend{dir: dir}
+	if err := f.set(CerebrasAPIKey, "sk-secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]os.FileMode{"": 0700, credentialsFile: 0600} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s has mode %o, want %o", filepath.Join(dir, name), got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, credentialsFile+".tmp")); err == nil {
+		t.Error("temporary file left behind")
+	}
+	if _, err := os.Stat(filepath.Join(dir, legacyKeyFile)); err == nil {
+		t.Error("a key was stored beside the credentials")
+	}
+}
+
+// onMachine makes the file key derive from secret until the test ends
+func onMachine(t *testing.T, secret string) {
+	t.Helper()
+	previous := machineSecret
+	machineSecret = func() ([]byte, error) { return []byte(secret), nil }
+	t.Cleanup(func() { machineSecret = previous })
+}
+
+func TestFileBackendCorruption(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, dir string)
+	}{
+		{"copied to another computer", func(t *testing.T, dir string) {
+			onMachine(t, "another-machine")
+		}},
+		{"truncated data", func(t *testing.T, dir string) {
+			write(t, filepath.Join(dir, credentialsFile), []byte("abc"))
+		}},
+		{"altered salt", func(t *testing.T, dir string) {
+			alter(t, filepath.Join(dir, credentialsFile), 0)
+		}},
+		{"altered data", func(t *testing.T, dir string) {
+			path := filepath.Join(dir, credentialsFile)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			alter(t, path, int(info.Size())-1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			onMachine(t, "this-machine")
+			dir := t.TempDir()
+			f := &fileBackend{dir: dir}
+			if err := f.set(CerebrasAPIKey, "sk-secret"); err != nil {
+				t.Fatal(err)
+			}
+			tt.corrupt(t, dir)
+
+			value, err := f.get(CerebrasAPIKey)
+			if err == nil || errors.Is(err, ErrNotFound) {
+				t.Errorf("get = %q, %v, want an error other than ErrNotFound", value, err)
+			}
+			// Saving over unreadable credentials would lose the others for good
+			if err := f.set(GoogleClientID, "client"); err == nil {
+				t.Error("set succeeded over corrupt credentials")
+			}
+		})
+	}
+}
+
+func TestFileBackendReencryptsLegacyCredentials(t *testing.T) {
+	dir := t.TempDir()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	write(t, filepath.Join(dir, legacyKeyFile), key)
+	write(t, filepath.Join(dir, credentialsFile), gcm.Seal(nonce, nonce, []byte(`{"cerebras-api-key":"sk-old"}`), nil))
+
+	f := &fileBackend{dir: dir}
+	if value, err := f.get(CerebrasAPIKey); err != nil || value != "sk-old" {
+		t.Fatalf("get = %q, %v, want sk-old", value, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, legacyKeyFile)); err == nil {
+		t.Error("the old key was left beside the credentials")
+	}
+	if value, err := (&fileBackend{dir: dir}).get(CerebrasAPIKey); err != nil || value != "sk-old" {
+		t.Errorf("get after re-encrypting = %q, %v, want sk-old", value, err)
+	}
+}
+
+func TestFileBackendWithoutFolder(t *testing.T) {
+	f := &fileBackend{}
+	if _, err := f.get(CerebrasAPIKey); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get = %v, want ErrNotFound", err)
+	}
+	if err := f.set(CerebrasAPIKey, "sk-secret"); err == nil {
+		t.Error("set succeeded without a folder")
+	}
+}
+
+func TestListWarnsAboutFileCredentials(t *testing.T) {
+	previous := currentBackends()
+	t.Cleanup(func() {
+		backendMux.Lock()
+		backends = previous
+		backendMux.Unlock()
+	})
+	f := &fileBackend{dir: t.TempDir()}
+	backendMux.Lock()
+	backends = []backend{f}
+	backendMux.Unlock()
+	t.Setenv("GOOGLE_CLIENT_ID", "from-env")
+
+	if err := Set(CerebrasAPIKey, "sk-secret"); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		switch s.Name {
+		case CerebrasAPIKey:
+			if s.Source != SourceFile || s.Warning == "" {
+				t.Errorf("%s: source %q, warning %q, want the file flagged", s.Name, s.Source, s.Warning)
+			}
+		case GoogleClientID:
+			if s.Source != SourceEnv || s.Warning != "" {
+				t.Errorf("%s: source %q, warning %q, want the environment without a warning", s.Name, s.Source, s.Warning)
+			}
+		}
+	}
+}
+
+func write(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// alter flips the byte at offset in the file at path
+func alter(t *testing.T, path string, offset int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset] ^= 0xff
+	write(t, path, data)
+}
@@ -0,0 +1,22 @@
+package credentials
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+)
+
+var platformUUID = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+
+// machineID returns the hardware UUID of the Mac
+func machineID() (string, error) {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return "", err
+	}
+	match := platformUUID.FindSubmatch(out)
+	if match == nil {
+		return "", errors.New("no IOPlatformUUID in ioreg output")
+	}
+	return string(match[1]), nil
+}
@@ -0,0 +1,22 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// machineID returns the ID systemd or D-Bus generated when the system was
+// installed
+func machineID() (string, error) {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	}
+	return "", errors.New("no machine-id found")
+}
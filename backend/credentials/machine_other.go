@@ -0,0 +1,11 @@
+//go:build !darwin && !linux && !windows
+
+package credentials
+
+import "errors"
+
+// machineID has no source on this platform, so the file fallback can't be
+// used
+func machineID() (string, error) {
+	return "", errors.New("no machine ID on this platform")
+}
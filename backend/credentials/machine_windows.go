@@ -0,0 +1,14 @@
+package credentials
+
+import "golang.org/x/sys/windows/registry"
+
+// machineID returns the GUID Windows generated when it was installed
+func machineID() (string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+	id, _, err := key.GetStringValue("MachineGuid")
+	return id, err
+}
@@ -3,12 +3,8 @@ package database
 import (
 	"encoding/json"
 	"errors"
-	"github.com/zalando/go-keyring"
-)
 
-const (
-	serviceName = "Finder-2"
-	googleUser  = "google-oauth"
+	"Finder-2/backend/credentials"
 )
 
 // GoogleAuthData stores Google OAuth tokens
@@ -17,23 +13,25 @@ type GoogleAuthData struct {
 	AccessToken  string `json:"access_token"`
 	Email        string `json:"email"`
 	ExpiresAt    int64  `json:"expires_at"`
+	// Scopes the user granted; tokens saved before these were recorded have none
+	Scopes []string `json:"scopes,omitempty"`
 }
 
-// SaveGoogleAuth stores Google OAuth tokens securely in keychain
+// SaveGoogleAuth stores Google OAuth tokens with the other credentials
 func SaveGoogleAuth(authData GoogleAuthData) error {
 	jsonData, err := json.Marshal(authData)
 	if err != nil {
 		return err
 	}
 
-	return keyring.Set(serviceName, googleUser, string(jsonData))
+	return credentials.Set(credentials.GoogleOAuth, string(jsonData))
 }
 
-// GetGoogleAuth retrieves Google OAuth tokens from keychain
+// GetGoogleAuth retrieves the saved Google OAuth tokens
 func GetGoogleAuth() (*GoogleAuthData, error) {
-	jsonData, err := keyring.Get(serviceName, googleUser)
+	jsonData, err := credentials.Get(credentials.GoogleOAuth)
 	if err != nil {
-		if errors.Is(err, keyring.ErrNotFound) {
+		if errors.Is(err, credentials.ErrNotFound) {
 			return nil, nil
 		}
 		return nil, err
@@ -47,13 +45,9 @@ func GetGoogleAuth() (*GoogleAuthData, error) {
 	return &authData, nil
 }
 
-// DeleteGoogleAuth removes Google OAuth tokens from keychain
+// DeleteGoogleAuth removes the saved Google OAuth tokens
 func DeleteGoogleAuth() error {
-	err := keyring.Delete(serviceName, googleUser)
-	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
-		return err
-	}
-	return nil
+	return credentials.Delete(credentials.GoogleOAuth)
 }
 
 // IsGoogleConnected checks if user has connected their Google account
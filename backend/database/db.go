@@ -2,40 +2,64 @@ package database
 
 import (
 	"database/sql"
-	"log"
 	"path/filepath"
 
+	"Finder-2/backend/logging"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+var logger = logging.For("database")
+
+// SQLiteStore is the Store backed by finder.db
+type SQLiteStore struct {
+	db   *sql.DB
+	path string // the file db was opened from, used for backups
+}
 
-// Init initializes the database connection
-func Init(appDataPath string) error {
+// The driver applies these to every connection it opens: foreign keys make
+// ON DELETE CASCADE work, and the busy timeout makes a connection wait for
+// another's write lock instead of failing with "database is locked"
+const connectionParams = "?_foreign_keys=1&_busy_timeout=5000"
+
+// Open opens the database in the app data directory and migrates it
+func Open(appDataPath string) (*SQLiteStore, error) {
 	// Store DB in app data directory
 	dbPath := filepath.Join(appDataPath, "finder.db")
 
-	var err error
-	DB, err = sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", dbPath+connectionParams)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Test connection
-	if err = DB.Ping(); err != nil {
-		return err
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	log.Println("Database connected:", dbPath)
+	logger.Info("database connected", "path", dbPath)
+
+	s := &SQLiteStore{db: db, path: dbPath}
+	if err := s.RunMigrations(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
 
-	// Run migrations
-	return RunMigrations()
+// OpenOrDegraded opens the database in appDataPath. If it can't be opened
+// it returns a Degraded memory store instead, and the error says why.
+func OpenOrDegraded(appDataPath string) (Store, Status, error) {
+	store, err := Open(appDataPath)
+	if err != nil {
+		memory, status := Degraded(err)
+		return memory, status, err
+	}
+	return store, Status{}, nil
 }
 
 // Close closes the database connection
-func Close() error {
-	if DB != nil {
-		return DB.Close()
-	}
-	return nil
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
 }
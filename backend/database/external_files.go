@@ -3,26 +3,27 @@ package database
 import (
 	"database/sql"
 	"time"
+	"unicode/utf8"
 )
 
 type ExternalFile struct {
 	ID        int       `json:"id"`
-	Type      string    `json:"type"`      
-	Path      string    `json:"path"`      
-	FileID    string    `json:"fileId"`    
+	Type      string    `json:"type"`
+	Path      string    `json:"path"`
+	FileID    string    `json:"fileId"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
-func AddExternalFile(fileType, path, fileID string) error {
+func (s *SQLiteStore) AddExternalFile(fileType, path, fileID string) error {
 	query := `
 		INSERT INTO external_files (type, path, file_id)
 		VALUES (?, ?, ?)
 	`
-	_, err := DB.Exec(query, fileType, path, fileID)
+	_, err := s.db.Exec(query, fileType, path, fileID)
 	return err
 }
 
-func GetExternalFileByPath(path string) (*ExternalFile, error) {
+func (s *SQLiteStore) GetExternalFileByPath(path string) (*ExternalFile, error) {
 	query := `
 		SELECT id, type, path, file_id, created_at
 		FROM external_files
@@ -30,7 +31,7 @@ func GetExternalFileByPath(path string) (*ExternalFile, error) {
 	`
 
 	var file ExternalFile
-	err := DB.QueryRow(query, path).Scan(
+	err := s.db.QueryRow(query, path).Scan(
 		&file.ID,
 		&file.Type,
 		&file.Path,
@@ -45,7 +46,7 @@ func GetExternalFileByPath(path string) (*ExternalFile, error) {
 	return &file, err
 }
 
-func GetExternalFileByID(fileID string) (*ExternalFile, error) {
+func (s *SQLiteStore) GetExternalFileByID(fileID string) (*ExternalFile, error) {
 	query := `
 		SELECT id, type, path, file_id, created_at
 		FROM external_files
@@ -53,7 +54,7 @@ func GetExternalFileByID(fileID string) (*ExternalFile, error) {
 	`
 
 	var file ExternalFile
-	err := DB.QueryRow(query, fileID).Scan(
+	err := s.db.QueryRow(query, fileID).Scan(
 		&file.ID,
 		&file.Type,
 		&file.Path,
@@ -68,7 +69,7 @@ func GetExternalFileByID(fileID string) (*ExternalFile, error) {
 	return &file, err
 }
 
-func ListExternalFilesByType(fileType string) ([]ExternalFile, error) {
+func (s *SQLiteStore) ListExternalFilesByType(fileType string) ([]ExternalFile, error) {
 	query := `
 		SELECT id, type, path, file_id, created_at
 		FROM external_files
@@ -76,7 +77,7 @@ func ListExternalFilesByType(fileType string) ([]ExternalFile, error) {
 		ORDER BY created_at DESC
 	`
 
-	rows, err := DB.Query(query, fileType)
+	rows, err := s.db.Query(query, fileType)
 	if err != nil {
 		return nil, err
 	}
@@ -101,19 +102,88 @@ func ListExternalFilesByType(fileType string) ([]ExternalFile, error) {
 	return files, nil
 }
 
-func UpdateExternalFilePath(oldPath, newPath string) error {
+// ListExternalFiles returns every mapping, of any type
+func (s *SQLiteStore) ListExternalFiles() ([]ExternalFile, error) {
+	query := `
+		SELECT id, type, path, file_id, created_at
+		FROM external_files
+		ORDER BY path
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []ExternalFile
+	for rows.Next() {
+		var file ExternalFile
+		err := rows.Scan(
+			&file.ID,
+			&file.Type,
+			&file.Path,
+			&file.FileID,
+			&file.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+func (s *SQLiteStore) UpdateExternalFilePath(oldPath, newPath string) error {
 	query := `UPDATE external_files SET path = ? WHERE path = ?`
-	_, err := DB.Exec(query, newPath, oldPath)
+	_, err := s.db.Exec(query, newPath, oldPath)
 	return err
 }
 
-func DeleteExternalFile(path string) error {
+func (s *SQLiteStore) DeleteExternalFile(path string) error {
 	query := `DELETE FROM external_files WHERE path = ?`
-	_, err := DB.Exec(query, path)
+	_, err := s.db.Exec(query, path)
+	return err
+}
+
+// MoveExternalFiles re-points the mapping of oldPath, and of everything
+// beneath it when it's a folder, to newPath
+func (s *SQLiteStore) MoveExternalFiles(oldPath, newPath string) error {
+	query := `
+		UPDATE OR REPLACE external_files
+		SET path = ? || substr(path, ?)
+		WHERE path = ? OR (path >= ? AND path < ?)
+	`
+	lo, hi := descendantRange(oldPath)
+	// substr counts characters, not bytes
+	_, err := s.db.Exec(query, newPath, utf8.RuneCountInString(oldPath)+1, oldPath, lo, hi)
+	return err
+}
+
+// CopyExternalFiles maps the copies of oldPath, and of everything beneath
+// it, to the same files as the originals
+func (s *SQLiteStore) CopyExternalFiles(oldPath, newPath string) error {
+	query := `
+		INSERT OR IGNORE INTO external_files (type, path, file_id)
+		SELECT type, ? || substr(path, ?), file_id
+		FROM external_files
+		WHERE path = ? OR (path >= ? AND path < ?)
+	`
+	lo, hi := descendantRange(oldPath)
+	_, err := s.db.Exec(query, newPath, utf8.RuneCountInString(oldPath)+1, oldPath, lo, hi)
+	return err
+}
+
+// DeleteExternalFiles forgets the mapping of path and of everything beneath it
+func (s *SQLiteStore) DeleteExternalFiles(path string) error {
+	query := `DELETE FROM external_files WHERE path = ? OR (path >= ? AND path < ?)`
+	lo, hi := descendantRange(path)
+	_, err := s.db.Exec(query, path, lo, hi)
 	return err
 }
 
-func IsExternalFile(path string) bool {
-	file, err := GetExternalFileByPath(path)
+func (s *SQLiteStore) IsExternalFile(path string) bool {
+	file, err := s.GetExternalFileByPath(path)
 	return err == nil && file != nil
 }
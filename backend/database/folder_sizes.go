@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// FolderSize is a cached recursive size for a directory
+type FolderSize struct {
+	Path         string    `json:"path"`
+	ModTime      int64     `json:"modTime"` // directory mtime (unix nanoseconds) when computed
+	ApparentSize int64     `json:"apparentSize"`
+	DiskSize     int64     `json:"diskSize"`
+	FileCount    int64     `json:"fileCount"`
+	DirCount     int64     `json:"dirCount"`
+	ComputedAt   time.Time `json:"computedAt"`
+}
+
+func (s *SQLiteStore) GetFolderSize(path string) (*FolderSize, error) {
+	query := `
+		SELECT path, mod_time, apparent_size, disk_size, file_count, dir_count, computed_at
+		FROM folder_sizes
+		WHERE path = ?
+	`
+
+	var size FolderSize
+	err := s.db.QueryRow(query, path).Scan(
+		&size.Path,
+		&size.ModTime,
+		&size.ApparentSize,
+		&size.DiskSize,
+		&size.FileCount,
+		&size.DirCount,
+		&size.ComputedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return &size, err
+}
+
+func (s *SQLiteStore) SaveFolderSize(size FolderSize) error {
+	query := `
+		INSERT INTO folder_sizes (path, mod_time, apparent_size, disk_size, file_count, dir_count, computed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET
+			mod_time = excluded.mod_time,
+			apparent_size = excluded.apparent_size,
+			disk_size = excluded.disk_size,
+			file_count = excluded.file_count,
+			dir_count = excluded.dir_count,
+			computed_at = excluded.computed_at
+	`
+	_, err := s.db.Exec(query, size.Path, size.ModTime, size.ApparentSize, size.DiskSize,
+		size.FileCount, size.DirCount, size.ComputedAt)
+	return err
+}
+
+// DeleteFolderSize drops the cached size for path and every folder beneath it
+func (s *SQLiteStore) DeleteFolderSize(path string) error {
+	query := `DELETE FROM folder_sizes WHERE path = ? OR (path >= ? AND path < ?)`
+	lo, hi := descendantRange(path)
+	_, err := s.db.Exec(query, path, lo, hi)
+	return err
+}
+
+// DeleteFolderSizesAt drops the cached sizes of exactly paths, leaving the
+// folders beneath them alone
+func (s *SQLiteStore) DeleteFolderSizesAt(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(paths)), ",")
+	args := make([]any, len(paths))
+	for i, path := range paths {
+		args[i] = path
+	}
+	_, err := s.db.Exec(`DELETE FROM folder_sizes WHERE path IN (`+placeholders+`)`, args...)
+	return err
+}
+
+// descendantRange returns the bounds of the paths strictly beneath path.
+// Comparing with the default BINARY collation is case-sensitive and exact,
+// unlike LIKE, and '0' is the byte right after '/'. A trailing slash is
+// dropped first so the root folder gives "/" rather than "//".
+func descendantRange(path string) (string, string) {
+	path = strings.TrimSuffix(path, "/")
+	return path + "/", path + "0"
+}
+
+// IsBeneath reports whether path is strictly beneath root, comparing the
+// same way the store's queries do
+func IsBeneath(path, root string) bool {
+	lo, hi := descendantRange(root)
+	return path > lo && path < hi
+}
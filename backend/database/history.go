@@ -0,0 +1,58 @@
+package database
+
+import "time"
+
+// maxHistory is how many visited folders are kept
+const maxHistory = 200
+
+// AddHistory records a visit to path, dropping the oldest entries beyond
+// maxHistory
+func (s *SQLiteStore) AddHistory(path string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO history (path, visited_at)
+		VALUES (?, ?)
+		ON CONFLICT(path) DO UPDATE SET visited_at = excluded.visited_at
+	`
+	if _, err := tx.Exec(query, path, time.Now()); err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM history WHERE path NOT IN (
+			SELECT path FROM history ORDER BY visited_at DESC LIMIT ?
+		)
+	`
+	if _, err := tx.Exec(query, maxHistory); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListHistory returns up to limit visited folders, most recent first
+func (s *SQLiteStore) ListHistory(limit int) ([]HistoryEntry, error) {
+	query := `SELECT path, visited_at FROM history ORDER BY visited_at DESC LIMIT ?`
+
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		if err := rows.Scan(&entry.Path, &entry.VisitedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
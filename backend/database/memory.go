@@ -0,0 +1,616 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps everything in memory. It's used when
+// the database can't be opened, so the app keeps working for the session,
+// and anywhere a throwaway store is wanted.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	externalFiles []ExternalFile
+	nextFileID    int
+	folderSizes   map[string]FolderSize
+	tags          map[string]Tag                 // keyed by lowercased name, like COLLATE NOCASE
+	fileTags      map[string]map[string]struct{} // path to lowercased tag names
+	settings      map[string]string
+	history       map[string]time.Time
+	syncRoots     map[string]SyncRoot
+	syncStates    map[string]SyncState // by file ID
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		folderSizes: make(map[string]FolderSize),
+		tags:        make(map[string]Tag),
+		fileTags:    make(map[string]map[string]struct{}),
+		settings:    make(map[string]string),
+		history:     make(map[string]time.Time),
+		syncRoots:   make(map[string]SyncRoot),
+		syncStates:  make(map[string]SyncState),
+	}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// SchemaVersion is always the latest, as there's nothing to migrate
+func (m *MemoryStore) SchemaVersion() (int, error) {
+	return LatestVersion(), nil
+}
+
+func (m *MemoryStore) AddExternalFile(fileType, path, fileID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.externalFileIndex(path) >= 0 {
+		return fmt.Errorf("external file already recorded for %s", path)
+	}
+	m.nextFileID++
+	m.externalFiles = append(m.externalFiles, ExternalFile{
+		ID:        m.nextFileID,
+		Type:      fileType,
+		Path:      path,
+		FileID:    fileID,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) externalFileIndex(path string) int {
+	for i, file := range m.externalFiles {
+		if file.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *MemoryStore) GetExternalFileByPath(path string) (*ExternalFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.externalFileIndex(path); i >= 0 {
+		file := m.externalFiles[i]
+		return &file, nil
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) GetExternalFileByID(fileID string) (*ExternalFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, file := range m.externalFiles {
+		if file.FileID == fileID {
+			return &file, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) ListExternalFilesByType(fileType string) ([]ExternalFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var files []ExternalFile
+	for i := len(m.externalFiles) - 1; i >= 0; i-- {
+		if m.externalFiles[i].Type == fileType {
+			files = append(files, m.externalFiles[i])
+		}
+	}
+	return files, nil
+}
+
+func (m *MemoryStore) ListExternalFiles() ([]ExternalFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := append([]ExternalFile(nil), m.externalFiles...)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+func (m *MemoryStore) UpdateExternalFilePath(oldPath, newPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.externalFileIndex(oldPath)
+	if i < 0 || oldPath == newPath {
+		return nil
+	}
+	if m.externalFileIndex(newPath) >= 0 {
+		return fmt.Errorf("external file already recorded for %s", newPath)
+	}
+	m.externalFiles[i].Path = newPath
+	return nil
+}
+
+func (m *MemoryStore) DeleteExternalFile(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.externalFileIndex(path); i >= 0 {
+		m.externalFiles = append(m.externalFiles[:i], m.externalFiles[i+1:]...)
+	}
+	return nil
+}
+
+func (m *MemoryStore) MoveExternalFiles(oldPath, newPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var moved []ExternalFile
+	var kept []ExternalFile
+	for _, file := range m.externalFiles {
+		if isSameOrBeneath(file.Path, oldPath) {
+			file.Path = newPath + file.Path[len(oldPath):]
+			moved = append(moved, file)
+		} else {
+			kept = append(kept, file)
+		}
+	}
+
+	// Like UPDATE OR REPLACE, a moved mapping replaces one already at its path
+	m.externalFiles = kept[:0:0]
+	for _, file := range kept {
+		replaced := false
+		for _, mv := range moved {
+			if mv.Path == file.Path {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			m.externalFiles = append(m.externalFiles, file)
+		}
+	}
+	m.externalFiles = append(m.externalFiles, moved...)
+	return nil
+}
+
+func (m *MemoryStore) CopyExternalFiles(oldPath, newPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, file := range append([]ExternalFile(nil), m.externalFiles...) {
+		if !isSameOrBeneath(file.Path, oldPath) {
+			continue
+		}
+		path := newPath + file.Path[len(oldPath):]
+		if m.externalFileIndex(path) >= 0 {
+			continue
+		}
+		m.nextFileID++
+		m.externalFiles = append(m.externalFiles, ExternalFile{
+			ID:        m.nextFileID,
+			Type:      file.Type,
+			Path:      path,
+			FileID:    file.FileID,
+			CreatedAt: time.Now(),
+		})
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteExternalFiles(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.externalFiles[:0]
+	for _, file := range m.externalFiles {
+		if !isSameOrBeneath(file.Path, path) {
+			kept = append(kept, file)
+		}
+	}
+	m.externalFiles = kept
+	return nil
+}
+
+func (m *MemoryStore) GetFolderSize(path string) (*FolderSize, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if size, ok := m.folderSizes[path]; ok {
+		return &size, nil
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) SaveFolderSize(size FolderSize) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.folderSizes[size.Path] = size
+	return nil
+}
+
+func (m *MemoryStore) DeleteFolderSize(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for p := range m.folderSizes {
+		if isSameOrBeneath(p, path) {
+			delete(m.folderSizes, p)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteFolderSizesAt(paths []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, path := range paths {
+		delete(m.folderSizes, path)
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateTag(name, color string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := strings.ToLower(name)
+	if tag, ok := m.tags[key]; ok {
+		tag.Color = color
+		m.tags[key] = tag
+		return nil
+	}
+	m.tags[key] = Tag{Name: name, Color: color, CreatedAt: time.Now()}
+	return nil
+}
+
+func (m *MemoryStore) GetTag(name string) (*Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tag, ok := m.tags[strings.ToLower(name)]; ok {
+		return &tag, nil
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) ListTags() ([]Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tags []Tag
+	for _, tag := range m.tags {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name)
+	})
+	return tags, nil
+}
+
+func (m *MemoryStore) DeleteTag(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := strings.ToLower(name)
+	delete(m.tags, key)
+	for path, names := range m.fileTags {
+		delete(names, key)
+		if len(names) == 0 {
+			delete(m.fileTags, path)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) AddFileTag(path, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := strings.ToLower(name)
+	if _, ok := m.tags[key]; !ok {
+		return nil
+	}
+	if m.fileTags[path] == nil {
+		m.fileTags[path] = make(map[string]struct{})
+	}
+	m.fileTags[path][key] = struct{}{}
+	return nil
+}
+
+func (m *MemoryStore) RemoveFileTag(path, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if names, ok := m.fileTags[path]; ok {
+		delete(names, strings.ToLower(name))
+		if len(names) == 0 {
+			delete(m.fileTags, path)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetFileTags(path string) ([]string, error) {
+	tagsByPath, err := m.GetTagsForPaths([]string{path})
+	if err != nil {
+		return nil, err
+	}
+	return tagsByPath[path], nil
+}
+
+func (m *MemoryStore) GetTagsForPaths(paths []string) (map[string][]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tagsByPath := make(map[string][]string)
+	for _, path := range paths {
+		names := m.tagNames(path)
+		if len(names) > 0 {
+			tagsByPath[path] = names
+		}
+	}
+	return tagsByPath, nil
+}
+
+// tagNames returns the display names of path's tags, sorted like ListTags
+func (m *MemoryStore) tagNames(path string) []string {
+	var keys []string
+	for key := range m.fileTags[path] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = m.tags[key].Name
+	}
+	return names
+}
+
+func (m *MemoryStore) GetPathsWithTag(name string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := strings.ToLower(name)
+	var paths []string
+	for path, names := range m.fileTags {
+		if _, ok := names[key]; ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (m *MemoryStore) MoveFileTags(oldPath, newPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	moved := make(map[string]map[string]struct{})
+	for path, names := range m.fileTags {
+		if isSameOrBeneath(path, oldPath) {
+			moved[newPath+path[len(oldPath):]] = names
+			delete(m.fileTags, path)
+		}
+	}
+	for path, names := range moved {
+		m.fileTags[path] = names
+	}
+	return nil
+}
+
+func (m *MemoryStore) CopyFileTags(oldPath, newPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names, ok := m.fileTags[oldPath]
+	if !ok {
+		return nil
+	}
+	if m.fileTags[newPath] == nil {
+		m.fileTags[newPath] = make(map[string]struct{})
+	}
+	for key := range names {
+		m.fileTags[newPath][key] = struct{}{}
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteFileTags(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for p := range m.fileTags {
+		if isSameOrBeneath(p, path) {
+			delete(m.fileTags, p)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetSetting(key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.settings[key]
+	return value, ok, nil
+}
+
+func (m *MemoryStore) SetSetting(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.settings[key] = value
+	return nil
+}
+
+func (m *MemoryStore) DeleteSetting(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.settings, key)
+	return nil
+}
+
+func (m *MemoryStore) SaveSettings(values map[string]string, unset []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, value := range values {
+		m.settings[key] = value
+	}
+	for _, key := range unset {
+		delete(m.settings, key)
+	}
+	return nil
+}
+
+func (m *MemoryStore) ListSettings() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings := make(map[string]string, len(m.settings))
+	for key, value := range m.settings {
+		settings[key] = value
+	}
+	return settings, nil
+}
+
+func (m *MemoryStore) AddHistory(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.history[path] = time.Now()
+	if len(m.history) > maxHistory {
+		oldest := ""
+		for p, visited := range m.history {
+			if oldest == "" || visited.Before(m.history[oldest]) {
+				oldest = p
+			}
+		}
+		delete(m.history, oldest)
+	}
+	return nil
+}
+
+func (m *MemoryStore) ListHistory(limit int) ([]HistoryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]HistoryEntry, 0, len(m.history))
+	for path, visited := range m.history {
+		entries = append(entries, HistoryEntry{Path: path, VisitedAt: visited})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].VisitedAt.After(entries[j].VisitedAt)
+	})
+	if limit >= 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (m *MemoryStore) AddSyncRoot(path, remoteID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.syncRoots[path]; ok {
+		return fmt.Errorf("%s is already synced", path)
+	}
+	m.syncRoots[path] = SyncRoot{Path: path, RemoteID: remoteID, CreatedAt: time.Now()}
+	return nil
+}
+
+func (m *MemoryStore) ListSyncRoots() ([]SyncRoot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	roots := make([]SyncRoot, 0, len(m.syncRoots))
+	for _, root := range m.syncRoots {
+		roots = append(roots, root)
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Path < roots[j].Path })
+	return roots, nil
+}
+
+func (m *MemoryStore) UpdateSyncRoot(root SyncRoot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.syncRoots[root.Path]
+	if !ok {
+		return nil
+	}
+	existing.PageToken = root.PageToken
+	existing.LastSync = root.LastSync
+	existing.LastError = root.LastError
+	m.syncRoots[root.Path] = existing
+	return nil
+}
+
+func (m *MemoryStore) DeleteSyncRoot(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, state := range m.syncStates {
+		if state.Root == path {
+			delete(m.syncStates, id)
+		}
+	}
+	delete(m.syncRoots, path)
+	return nil
+}
+
+func (m *MemoryStore) GetSyncState(fileID string) (*SyncState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.syncStates[fileID]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (m *MemoryStore) ListSyncStates(root string) ([]SyncState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var states []SyncState
+	for _, state := range m.syncStates {
+		if state.Root == root {
+			states = append(states, state)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Path < states[j].Path })
+	return states, nil
+}
+
+func (m *MemoryStore) SaveSyncState(state SyncState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state.UpdatedAt = time.Now()
+	m.syncStates[state.FileID] = state
+	return nil
+}
+
+func (m *MemoryStore) DeleteSyncState(fileID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.syncStates, fileID)
+	return nil
+}
+
+// isSameOrBeneath matches the descendantRange queries of the SQLite store
+func isSameOrBeneath(path, root string) bool {
+	return path == root || IsBeneath(path, root)
+}
@@ -1,21 +1,241 @@
 package database
 
-// RunMigrations creates all necessary tables
-func RunMigrations() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS external_files (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		type TEXT NOT NULL,
-		path TEXT NOT NULL UNIQUE,
-		file_id TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Migration is one forward-only schema change. Versions are applied in
+// order and never edited once released; a change to the schema is a new
+// migration at the end of the list.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// migrations is the full history of the schema. The first three use IF NOT
+// EXISTS, since databases created before versioning already have
+// external_files. The tests migrate from testdata/schema_v0.sql, a dump of
+// that unversioned schema, and from each version built on it.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "external_files",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS external_files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT NOT NULL,
+			path TEXT NOT NULL UNIQUE,
+			file_id TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_type ON external_files(type);
+		CREATE INDEX IF NOT EXISTS idx_path ON external_files(path);
+		CREATE INDEX IF NOT EXISTS idx_file_id ON external_files(file_id);
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "folder_sizes",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS folder_sizes (
+			path TEXT PRIMARY KEY,
+			mod_time INTEGER NOT NULL,
+			apparent_size INTEGER NOT NULL,
+			disk_size INTEGER NOT NULL,
+			file_count INTEGER NOT NULL,
+			dir_count INTEGER NOT NULL,
+			computed_at TIMESTAMP NOT NULL
+		);
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "tags",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			color TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS file_tags (
+			path TEXT NOT NULL,
+			tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+			PRIMARY KEY (path, tag_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_file_tags_tag ON file_tags(tag_id);
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "settings_and_history",
+		SQL: `
+		CREATE TABLE settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+
+		CREATE TABLE history (
+			path TEXT PRIMARY KEY,
+			visited_at TIMESTAMP NOT NULL
+		);
+
+		CREATE INDEX idx_history_visited ON history(visited_at);
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "drive_sync",
+		SQL: `
+		CREATE TABLE sync_roots (
+			path TEXT PRIMARY KEY,
+			remote_id TEXT NOT NULL,
+			page_token TEXT NOT NULL DEFAULT '',
+			last_sync TIMESTAMP,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE sync_state (
+			file_id TEXT PRIMARY KEY,
+			root TEXT NOT NULL,
+			path TEXT NOT NULL,
+			is_folder INTEGER NOT NULL,
+			local_mod_time INTEGER NOT NULL,
+			local_size INTEGER NOT NULL,
+			remote_name TEXT NOT NULL,
+			remote_parent TEXT NOT NULL,
+			remote_md5 TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMP NOT NULL
+		);
+
+		CREATE INDEX idx_sync_state_root ON sync_state(root);
+		`,
+	},
+}
+
+// LatestVersion is the schema version this build migrates to
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// RunMigrations brings the schema up to LatestVersion, applying each pending
+// migration in its own transaction. The database file is backed up first
+// unless it's new.
+func (s *SQLiteStore) RunMigrations() error {
+	return s.migrateTo(LatestVersion())
+}
+
+// migrateTo applies the migrations up to and including version target
+func (s *SQLiteStore) migrateTo(target int) error {
+	if _, err := s.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
 	);
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > LatestVersion() {
+		return fmt.Errorf("database schema version %d is newer than this app supports (%d)", current, LatestVersion())
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > current && m.Version <= target {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	existing, err := s.hasUserTables()
+	if err != nil {
+		return err
+	}
+	if existing {
+		backup, err := s.backup(current)
+		if err != nil {
+			return fmt.Errorf("failed to back up database before migrating: %w", err)
+		}
+		logger.Info("database backed up", "path", backup)
+	}
+
+	for _, m := range pending {
+		if err := s.apply(m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		logger.Info("migration applied", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
 
-	CREATE INDEX IF NOT EXISTS idx_type ON external_files(type);
-	CREATE INDEX IF NOT EXISTS idx_path ON external_files(path);
-	CREATE INDEX IF NOT EXISTS idx_file_id ON external_files(file_id);
-	`
+func (s *SQLiteStore) apply(m Migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, time.Now(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// hasUserTables reports whether the database holds anything besides
+// schema_migrations, so a brand-new file isn't backed up
+func (s *SQLiteStore) hasUserTables() (bool, error) {
+	var count int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_migrations'",
+	).Scan(&count)
+	return count > 0, err
+}
+
+// backup writes a consistent copy of the database next to it, named after
+// the version it's at, and returns its path
+func (s *SQLiteStore) backup(version int) (string, error) {
+	backup := filepath.Join(filepath.Dir(s.path),
+		fmt.Sprintf("%s.v%d-%s.bak", filepath.Base(s.path), version, time.Now().Format("20060102-150405")))
+	if _, err := os.Stat(backup); err == nil {
+		return "", fmt.Errorf("%s already exists", backup)
+	}
+
+	if _, err := s.db.Exec("VACUUM INTO ?", backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
 
-	_, err := DB.Exec(schema)
-	return err
+// SchemaVersion returns the highest migration applied to the database
+func (s *SQLiteStore) SchemaVersion() (int, error) {
+	var version sql.NullInt64
+	if err := s.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
 }
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixture creates finder.db in dir at schema version N, with rows in every
+// table. Version 0 is testdata/schema_v0.sql, a dump of the baseline from
+// before versioning: just external_files and its indexes, with no
+// schema_migrations. Later versions are built from it by the migrations
+// themselves, in another folder so their backups don't count.
+func fixture(t *testing.T, dir string, version int) {
+	t.Helper()
+	dump, err := os.ReadFile(filepath.Join("testdata", "schema_v0.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scratch := t.TempDir()
+	path := filepath.Join(scratch, "finder.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(dump)); err != nil {
+		t.Fatal(err)
+	}
+
+	if version > 0 {
+		s := &SQLiteStore{db: db, path: path}
+		if err := s.migrateTo(version); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for v, rows := range fixtureRows {
+		if v > version {
+			continue
+		}
+		if _, err := db.Exec(rows); err != nil {
+			t.Fatalf("rows for version %d: %v", v, err)
+		}
+	}
+	db.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "finder.db"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixtureRows fills the tables each version added
+var fixtureRows = map[int]string{
+	2: `INSERT INTO folder_sizes VALUES ('/home/a/Projects', 1700000000000000000, 4096, 8192, 3, 1, CURRENT_TIMESTAMP);`,
+	3: `INSERT INTO tags (id, name, color) VALUES (1, 'work', 'red');
+	INSERT INTO file_tags VALUES ('/home/a/Report.gdoc', 1);`,
+	4: `INSERT INTO settings VALUES ('showHidden', 'true');
+	INSERT INTO history VALUES ('/home/a/Projects', CURRENT_TIMESTAMP);`,
+}
+
+func openTest(t *testing.T, dir string) *SQLiteStore {
+	t.Helper()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func backups(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "finder.db.v*.bak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestOpenMigratesEmptyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	s := openTest(t, dir)
+
+	version, err := s.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != LatestVersion() {
+		t.Errorf("schema version = %d, want %d", version, LatestVersion())
+	}
+	if got := backups(t, dir); len(got) != 0 {
+		t.Errorf("a new database was backed up: %v", got)
+	}
+
+	// Opening again has nothing to apply
+	s.Close()
+	s = openTest(t, dir)
+	if version, _ := s.SchemaVersion(); version != LatestVersion() {
+		t.Errorf("schema version after reopening = %d, want %d", version, LatestVersion())
+	}
+}
+
+func TestOpenMigratesOlderVersions(t *testing.T) {
+	for version := 0; version < LatestVersion(); version++ {
+		dir := t.TempDir()
+		fixture(t, dir, version)
+		s := openTest(t, dir)
+
+		got, err := s.SchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != LatestVersion() {
+			t.Errorf("from version %d: schema version = %d, want %d", version, got, LatestVersion())
+		}
+		file, err := s.GetExternalFileByPath("/home/a/Report.gdoc")
+		if err != nil || file == nil || file.FileID != "file-1" {
+			t.Errorf("from version %d: existing row = %v, %v", version, file, err)
+		}
+		if version >= 2 {
+			if size, err := s.GetFolderSize("/home/a/Projects"); err != nil || size == nil || size.DiskSize != 8192 {
+				t.Errorf("from version %d: folder size = %v, %v", version, size, err)
+			}
+		}
+		if version >= 3 {
+			if tags, err := s.GetFileTags("/home/a/Report.gdoc"); err != nil || len(tags) != 1 || tags[0] != "work" {
+				t.Errorf("from version %d: tags = %v, %v", version, tags, err)
+			}
+		}
+		if version >= 4 {
+			if value, ok, err := s.GetSetting("showHidden"); err != nil || !ok || value != "true" {
+				t.Errorf("from version %d: setting = %q, %v, %v", version, value, ok, err)
+			}
+		}
+		if err := s.AddExternalFile("document", "/home/a/New.gdoc", "file-2"); err != nil {
+			t.Errorf("from version %d: adding a row after migrating: %v", version, err)
+		}
+		if got := backups(t, dir); len(got) != 1 {
+			t.Errorf("from version %d: backups = %v, want one", version, got)
+		}
+	}
+}
+
+func TestOpenRefusesNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	s := openTest(t, dir)
+	if _, err := s.db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'future', CURRENT_TIMESTAMP)", LatestVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if s, err := Open(dir); err == nil {
+		s.Close()
+		t.Error("opening a newer schema succeeded, want an error")
+	}
+}
+
+func TestConnectionSettings(t *testing.T) {
+	s := openTest(t, t.TempDir())
+
+	var foreignKeys, busyTimeout int
+	if err := s.db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if foreignKeys != 1 || busyTimeout == 0 {
+		t.Errorf("foreign_keys = %d, busy_timeout = %d, want both on", foreignKeys, busyTimeout)
+	}
+}
+
+func TestDeleteTagCascadesToFiles(t *testing.T) {
+	s := openTest(t, t.TempDir())
+	if err := s.CreateTag("work", "red"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddFileTag("/home/a/x.txt", "work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteTag("work"); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM file_tags").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d file_tags rows left after deleting their tag", count)
+	}
+}
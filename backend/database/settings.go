@@ -0,0 +1,72 @@
+package database
+
+import "database/sql"
+
+// GetSetting returns the value stored for key, and whether there is one
+func (s *SQLiteStore) GetSetting(key string) (string, bool, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return value, err == nil, err
+}
+
+const setSettingQuery = `
+	INSERT INTO settings (key, value)
+	VALUES (?, ?)
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value
+`
+
+func (s *SQLiteStore) SetSetting(key, value string) error {
+	_, err := s.db.Exec(setSettingQuery, key, value)
+	return err
+}
+
+// DeleteSetting removes key, so it reads as unset again
+func (s *SQLiteStore) DeleteSetting(key string) error {
+	_, err := s.db.Exec(`DELETE FROM settings WHERE key = ?`, key)
+	return err
+}
+
+// SaveSettings stores values and deletes the keys in unset in one
+// transaction, so a failure part way leaves every setting as it was
+func (s *SQLiteStore) SaveSettings(values map[string]string, unset []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for key, value := range values {
+		if _, err := tx.Exec(setSettingQuery, key, value); err != nil {
+			return err
+		}
+	}
+	for _, key := range unset {
+		if _, err := tx.Exec(`DELETE FROM settings WHERE key = ?`, key); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ListSettings() (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM settings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+
+	return settings, rows.Err()
+}
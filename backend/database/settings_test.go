@@ -0,0 +1,37 @@
+package database
+
+import "testing"
+
+func TestSaveSettingsIsAllOrNothing(t *testing.T) {
+	s := openTest(t, t.TempDir())
+	if err := s.SaveSettings(map[string]string{"a": "1", "b": "2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make one write fail part way through the batch
+	_, err := s.db.Exec(`
+		CREATE TRIGGER refuse_bad BEFORE INSERT ON settings WHEN NEW.key = 'bad'
+		BEGIN SELECT RAISE(ABORT, 'refused'); END
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveSettings(map[string]string{"c": "3", "bad": "x"}, []string{"a"}); err == nil {
+		t.Fatal("saving succeeded despite the refused key")
+	}
+
+	stored, err := s.ListSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 || stored["a"] != "1" || stored["b"] != "2" {
+		t.Errorf("stored %v after a failed save, want the settings unchanged", stored)
+	}
+
+	if err := s.SaveSettings(map[string]string{"b": "20"}, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := s.ListSettings(); len(stored) != 1 || stored["b"] != "20" {
+		t.Errorf("stored %v, want only b=20", stored)
+	}
+}
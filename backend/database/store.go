@@ -0,0 +1,110 @@
+package database
+
+import (
+	"time"
+)
+
+// ExternalFileStore records local placeholder files that stand for a
+// document in an online service, such as a Google Doc
+type ExternalFileStore interface {
+	AddExternalFile(fileType, path, fileID string) error
+	GetExternalFileByPath(path string) (*ExternalFile, error)
+	GetExternalFileByID(fileID string) (*ExternalFile, error)
+	ListExternalFilesByType(fileType string) ([]ExternalFile, error)
+	ListExternalFiles() ([]ExternalFile, error)
+	UpdateExternalFilePath(oldPath, newPath string) error
+	DeleteExternalFile(path string) error
+	MoveExternalFiles(oldPath, newPath string) error
+	CopyExternalFiles(oldPath, newPath string) error
+	DeleteExternalFiles(path string) error
+}
+
+// FolderSizeStore caches recursive folder sizes
+type FolderSizeStore interface {
+	GetFolderSize(path string) (*FolderSize, error)
+	SaveFolderSize(size FolderSize) error
+	DeleteFolderSize(path string) error
+	DeleteFolderSizesAt(paths []string) error
+}
+
+// TagStore holds tags and the paths they're attached to
+type TagStore interface {
+	CreateTag(name, color string) error
+	GetTag(name string) (*Tag, error)
+	ListTags() ([]Tag, error)
+	DeleteTag(name string) error
+	AddFileTag(path, name string) error
+	RemoveFileTag(path, name string) error
+	GetFileTags(path string) ([]string, error)
+	GetTagsForPaths(paths []string) (map[string][]string, error)
+	GetPathsWithTag(name string) ([]string, error)
+	MoveFileTags(oldPath, newPath string) error
+	CopyFileTags(oldPath, newPath string) error
+	DeleteFileTags(path string) error
+}
+
+// SettingsStore keeps key/value settings
+type SettingsStore interface {
+	GetSetting(key string) (string, bool, error)
+	SetSetting(key, value string) error
+	DeleteSetting(key string) error
+	SaveSettings(values map[string]string, unset []string) error
+	ListSettings() (map[string]string, error)
+}
+
+// HistoryStore remembers the folders visited, most recent first
+type HistoryStore interface {
+	AddHistory(path string) error
+	ListHistory(limit int) ([]HistoryEntry, error)
+}
+
+// SyncStore keeps the folders mirrored to Google Drive and, for each file
+// in them, what it looked like on both sides when it was last in sync
+type SyncStore interface {
+	AddSyncRoot(path, remoteID string) error
+	ListSyncRoots() ([]SyncRoot, error)
+	UpdateSyncRoot(root SyncRoot) error
+	DeleteSyncRoot(path string) error
+	GetSyncState(fileID string) (*SyncState, error)
+	ListSyncStates(root string) ([]SyncState, error)
+	SaveSyncState(state SyncState) error
+	DeleteSyncState(fileID string) error
+}
+
+// Store is everything the app persists
+type Store interface {
+	ExternalFileStore
+	FolderSizeStore
+	TagStore
+	SettingsStore
+	HistoryStore
+	SyncStore
+
+	SchemaVersion() (int, error)
+	Close() error
+}
+
+// HistoryEntry is a visited folder
+type HistoryEntry struct {
+	Path      string    `json:"path"`
+	VisitedAt time.Time `json:"visitedAt"`
+}
+
+// Status describes the store in use, so the UI can warn when nothing will
+// be saved
+type Status struct {
+	Degraded bool   `json:"degraded"`         // using memory because the database couldn't be opened
+	Reason   string `json:"reason,omitempty"` // why the database couldn't be opened
+}
+
+// Degraded returns a memory store for running without the database, such
+// as when it can't be opened. Changes are kept only until the app quits.
+func Degraded(reason error) (Store, Status) {
+	logger.Warn("running without a database; changes won't be saved", "error", reason)
+	return NewMemoryStore(), Status{Degraded: true, Reason: reason.Error()}
+}
+
+var (
+	_ Store = (*SQLiteStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
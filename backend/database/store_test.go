@@ -0,0 +1,58 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenOrDegradedFallsBackToMemory(t *testing.T) {
+	// A file where the app data folder should be can't hold a database
+	notAFolder := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notAFolder, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, status, err := OpenOrDegraded(notAFolder)
+	if err == nil {
+		t.Fatal("opening the database succeeded, want an error")
+	}
+	if !status.Degraded || status.Reason == "" {
+		t.Errorf("status = %+v, want degraded with a reason", status)
+	}
+	if _, ok := store.(*MemoryStore); !ok {
+		t.Fatalf("store is %T, want a memory store", store)
+	}
+
+	// The memory store keeps working for the rest of the session
+	if err := store.CreateTag("work", "red"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddFileTag("/home/a/x.txt", "work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddHistory("/home/a"); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := store.GetFileTags("/home/a/x.txt")
+	if err != nil || len(tags) != 1 || tags[0] != "work" {
+		t.Errorf("GetFileTags = %v, %v, want [work]", tags, err)
+	}
+	history, err := store.ListHistory(10)
+	if err != nil || len(history) != 1 || history[0].Path != "/home/a" {
+		t.Errorf("ListHistory = %v, %v, want /home/a", history, err)
+	}
+}
+
+func TestOpenOrDegradedUsesDatabase(t *testing.T) {
+	store, status, err := OpenOrDegraded(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if status.Degraded {
+		t.Errorf("status = %+v, want not degraded", status)
+	}
+	if _, ok := store.(*SQLiteStore); !ok {
+		t.Errorf("store is %T, want the database", store)
+	}
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SyncRoot is a local folder mirrored to a Drive folder
+type SyncRoot struct {
+	Path      string    `json:"path"`
+	RemoteID  string    `json:"remoteId"`
+	PageToken string    `json:"-"`         // where the next read of Drive's changes starts; empty before the first sync
+	LastSync  time.Time `json:"lastSync"`  // zero until the first sync finishes
+	LastError string    `json:"lastError"` // why the last sync failed, if it did
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SyncState is a synced file or folder as it was, locally and in Drive,
+// the last time the two sides agreed
+type SyncState struct {
+	FileID       string    `json:"fileId"`
+	Root         string    `json:"root"`
+	Path         string    `json:"path"`
+	IsFolder     bool      `json:"isFolder"`
+	LocalModTime int64     `json:"localModTime"` // UnixNano
+	LocalSize    int64     `json:"localSize"`
+	RemoteName   string    `json:"remoteName"`
+	RemoteParent string    `json:"remoteParent"`
+	RemoteMD5    string    `json:"remoteMd5"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+func (s *SQLiteStore) AddSyncRoot(path, remoteID string) error {
+	_, err := s.db.Exec(`INSERT INTO sync_roots (path, remote_id) VALUES (?, ?)`, path, remoteID)
+	return err
+}
+
+func (s *SQLiteStore) ListSyncRoots() ([]SyncRoot, error) {
+	query := `
+		SELECT path, remote_id, page_token, last_sync, last_error, created_at
+		FROM sync_roots
+		ORDER BY path
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roots []SyncRoot
+	for rows.Next() {
+		var root SyncRoot
+		var lastSync sql.NullTime
+		err := rows.Scan(
+			&root.Path,
+			&root.RemoteID,
+			&root.PageToken,
+			&lastSync,
+			&root.LastError,
+			&root.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		root.LastSync = lastSync.Time
+		roots = append(roots, root)
+	}
+
+	return roots, rows.Err()
+}
+
+// UpdateSyncRoot saves the page token, last sync time and error of a root
+func (s *SQLiteStore) UpdateSyncRoot(root SyncRoot) error {
+	query := `
+		UPDATE sync_roots
+		SET page_token = ?, last_sync = ?, last_error = ?
+		WHERE path = ?
+	`
+	var lastSync sql.NullTime
+	if !root.LastSync.IsZero() {
+		lastSync = sql.NullTime{Time: root.LastSync, Valid: true}
+	}
+	_, err := s.db.Exec(query, root.PageToken, lastSync, root.LastError, root.Path)
+	return err
+}
+
+// DeleteSyncRoot forgets a root along with the state of every file in it
+func (s *SQLiteStore) DeleteSyncRoot(path string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM sync_state WHERE root = ?`, path); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM sync_roots WHERE path = ?`, path); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const syncStateColumns = `
+	file_id, root, path, is_folder, local_mod_time, local_size,
+	remote_name, remote_parent, remote_md5, status, error, updated_at
+`
+
+func scanSyncState(row interface{ Scan(...any) error }) (SyncState, error) {
+	var state SyncState
+	err := row.Scan(
+		&state.FileID,
+		&state.Root,
+		&state.Path,
+		&state.IsFolder,
+		&state.LocalModTime,
+		&state.LocalSize,
+		&state.RemoteName,
+		&state.RemoteParent,
+		&state.RemoteMD5,
+		&state.Status,
+		&state.Error,
+		&state.UpdatedAt,
+	)
+	return state, err
+}
+
+func (s *SQLiteStore) GetSyncState(fileID string) (*SyncState, error) {
+	row := s.db.QueryRow(`SELECT `+syncStateColumns+` FROM sync_state WHERE file_id = ?`, fileID)
+	state, err := scanSyncState(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// ListSyncStates returns the state of every file in a root
+func (s *SQLiteStore) ListSyncStates(root string) ([]SyncState, error) {
+	rows, err := s.db.Query(`SELECT `+syncStateColumns+` FROM sync_state WHERE root = ? ORDER BY path`, root)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []SyncState
+	for rows.Next() {
+		state, err := scanSyncState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
+
+// SaveSyncState inserts or replaces the state of a file
+func (s *SQLiteStore) SaveSyncState(state SyncState) error {
+	query := `
+		INSERT OR REPLACE INTO sync_state (` + syncStateColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := s.db.Exec(query,
+		state.FileID,
+		state.Root,
+		state.Path,
+		state.IsFolder,
+		state.LocalModTime,
+		state.LocalSize,
+		state.RemoteName,
+		state.RemoteParent,
+		state.RemoteMD5,
+		state.Status,
+		state.Error,
+		time.Now(),
+	)
+	return err
+}
+
+func (s *SQLiteStore) DeleteSyncState(fileID string) error {
+	_, err := s.db.Exec(`DELETE FROM sync_state WHERE file_id = ?`, fileID)
+	return err
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type Tag struct {
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateTag adds a tag, or updates its color if it already exists
+func (s *SQLiteStore) CreateTag(name, color string) error {
+	query := `
+		INSERT INTO tags (name, color)
+		VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET color = excluded.color
+	`
+	_, err := s.db.Exec(query, name, color)
+	return err
+}
+
+func (s *SQLiteStore) GetTag(name string) (*Tag, error) {
+	query := `SELECT name, color, created_at FROM tags WHERE name = ?`
+
+	var tag Tag
+	err := s.db.QueryRow(query, name).Scan(&tag.Name, &tag.Color, &tag.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return &tag, err
+}
+
+func (s *SQLiteStore) ListTags() ([]Tag, error) {
+	query := `SELECT name, color, created_at FROM tags ORDER BY name`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.Name, &tag.Color, &tag.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// DeleteTag removes a tag; file_tags cascades, detaching it from every file
+func (s *SQLiteStore) DeleteTag(name string) error {
+	_, err := s.db.Exec(`DELETE FROM tags WHERE name = ?`, name)
+	return err
+}
+
+// AddFileTag attaches an existing tag to a path
+func (s *SQLiteStore) AddFileTag(path, name string) error {
+	query := `
+		INSERT OR IGNORE INTO file_tags (path, tag_id)
+		SELECT ?, id FROM tags WHERE name = ?
+	`
+	_, err := s.db.Exec(query, path, name)
+	return err
+}
+
+func (s *SQLiteStore) RemoveFileTag(path, name string) error {
+	query := `DELETE FROM file_tags WHERE path = ? AND tag_id = (SELECT id FROM tags WHERE name = ?)`
+	_, err := s.db.Exec(query, path, name)
+	return err
+}
+
+// GetFileTags returns the names of the tags attached to a path
+func (s *SQLiteStore) GetFileTags(path string) ([]string, error) {
+	tagsByPath, err := s.GetTagsForPaths([]string{path})
+	if err != nil {
+		return nil, err
+	}
+	return tagsByPath[path], nil
+}
+
+// GetTagsForPaths looks up the tags of many paths in one query
+func (s *SQLiteStore) GetTagsForPaths(paths []string) (map[string][]string, error) {
+	tagsByPath := make(map[string][]string)
+	if len(paths) == 0 {
+		return tagsByPath, nil
+	}
+
+	// Stay well below SQLite's limit on bound parameters
+	const batchSize = 500
+	for start := 0; start < len(paths); start += batchSize {
+		end := min(start+batchSize, len(paths))
+		batch := paths[start:end]
+
+		args := make([]any, len(batch))
+		for i, path := range batch {
+			args[i] = path
+		}
+
+		query := `
+			SELECT file_tags.path, tags.name
+			FROM file_tags
+			JOIN tags ON tags.id = file_tags.tag_id
+			WHERE file_tags.path IN (?` + strings.Repeat(", ?", len(batch)-1) + `)
+			ORDER BY tags.name
+		`
+
+		rows, err := s.db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var path, name string
+			if err := rows.Scan(&path, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			tagsByPath[path] = append(tagsByPath[path], name)
+		}
+		rows.Close()
+	}
+
+	return tagsByPath, nil
+}
+
+// GetPathsWithTag returns every path carrying the tag
+func (s *SQLiteStore) GetPathsWithTag(name string) ([]string, error) {
+	query := `
+		SELECT file_tags.path
+		FROM file_tags
+		JOIN tags ON tags.id = file_tags.tag_id
+		WHERE tags.name = ?
+		ORDER BY file_tags.path
+	`
+
+	rows, err := s.db.Query(query, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// MoveFileTags re-points the tags of oldPath, and of everything beneath it
+// when it's a folder, to newPath
+func (s *SQLiteStore) MoveFileTags(oldPath, newPath string) error {
+	query := `
+		UPDATE OR REPLACE file_tags
+		SET path = ? || substr(path, ?)
+		WHERE path = ? OR (path >= ? AND path < ?)
+	`
+	lo, hi := descendantRange(oldPath)
+	// substr counts characters, not bytes
+	_, err := s.db.Exec(query, newPath, utf8.RuneCountInString(oldPath)+1, oldPath, lo, hi)
+	return err
+}
+
+// CopyFileTags gives newPath the same tags as oldPath
+func (s *SQLiteStore) CopyFileTags(oldPath, newPath string) error {
+	query := `
+		INSERT OR IGNORE INTO file_tags (path, tag_id)
+		SELECT ?, tag_id FROM file_tags WHERE path = ?
+	`
+	_, err := s.db.Exec(query, newPath, oldPath)
+	return err
+}
+
+// DeleteFileTags detaches every tag from path and from everything beneath it
+func (s *SQLiteStore) DeleteFileTags(path string) error {
+	query := `DELETE FROM file_tags WHERE path = ? OR (path >= ? AND path < ?)`
+	lo, hi := descendantRange(path)
+	_, err := s.db.Exec(query, path, lo, hi)
+	return err
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+// tagStores runs fn against both stores, which must agree
+func tagStores(t *testing.T, fn func(t *testing.T, s Store)) {
+	t.Run("sqlite", func(t *testing.T) { fn(t, openTest(t, t.TempDir())) })
+	t.Run("memory", func(t *testing.T) { fn(t, NewMemoryStore()) })
+}
+
+func tagFiles(t *testing.T, s Store, name string, paths ...string) {
+	t.Helper()
+	if err := s.CreateTag(name, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if err := s.AddFileTag(path, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func pathsWithTag(t *testing.T, s Store, name string) []string {
+	t.Helper()
+	paths, err := s.GetPathsWithTag(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestMoveFileTagsMovesOnlyTheFolderAndItsContents(t *testing.T) {
+	tagStores(t, func(t *testing.T, s Store) {
+		tagFiles(t, s, "work", "/home/a/b", "/home/a/b/x.txt", "/home/a/b/sub/y.txt", "/home/a/bc.txt", "/home/a/b0")
+		if err := s.MoveFileTags("/home/a/b", "/home/z"); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"/home/a/b0", "/home/a/bc.txt", "/home/z", "/home/z/sub/y.txt", "/home/z/x.txt"}
+		if got := pathsWithTag(t, s, "work"); !reflect.DeepEqual(got, want) {
+			t.Errorf("paths = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestCopyFileTagsCopiesOnlyThePath(t *testing.T) {
+	tagStores(t, func(t *testing.T, s Store) {
+		tagFiles(t, s, "work", "/home/a/x.txt")
+		tagFiles(t, s, "home", "/home/a/x.txt", "/home/a/other.txt")
+		if err := s.CopyFileTags("/home/a/x.txt", "/home/b/x.txt"); err != nil {
+			t.Fatal(err)
+		}
+		tags, err := s.GetFileTags("/home/b/x.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 2 {
+			t.Errorf("copy has tags %v, want home and work", tags)
+		}
+		if got := pathsWithTag(t, s, "home"); len(got) != 3 {
+			t.Errorf("home paths = %v, want the copy added", got)
+		}
+	})
+}
+
+func TestDeleteFileTagsDeletesTheFolderAndItsContents(t *testing.T) {
+	tagStores(t, func(t *testing.T, s Store) {
+		tagFiles(t, s, "work", "/home/a/b", "/home/a/b/x.txt", "/home/a/b/sub/y.txt", "/home/a/bc.txt")
+		if err := s.DeleteFileTags("/home/a/b"); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"/home/a/bc.txt"}
+		if got := pathsWithTag(t, s, "work"); !reflect.DeepEqual(got, want) {
+			t.Errorf("paths = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestTagNamesIgnoreCase(t *testing.T) {
+	tagStores(t, func(t *testing.T, s Store) {
+		tagFiles(t, s, "Work", "/home/a/x.txt")
+		if err := s.AddFileTag("/home/a/y.txt", "WORK"); err != nil {
+			t.Fatal(err)
+		}
+		tag, err := s.GetTag("work")
+		if err != nil || tag == nil {
+			t.Fatalf("GetTag(work) = %v, %v, want the Work tag", tag, err)
+		}
+		if got := pathsWithTag(t, s, "wOrK"); len(got) != 2 {
+			t.Errorf("paths = %v, want both files under one tag", got)
+		}
+		if err := s.CreateTag("WORK", "red"); err != nil {
+			t.Fatal(err)
+		}
+		if tags, _ := s.ListTags(); len(tags) != 1 {
+			t.Errorf("tags = %v, want one tag whatever its case", tags)
+		}
+	})
+}
+
+func TestIsBeneath(t *testing.T) {
+	tests := []struct {
+		path, root string
+		want       bool
+	}{
+		{"/home/a/x.txt", "/home/a", true},
+		{"/home/a/b/x.txt", "/home/a", true},
+		{"/home/a", "/home/a", false},
+		{"/home/ab", "/home/a", false},
+		{"/home/a0", "/home/a", false},
+		{"/home/A/x.txt", "/home/a", false},
+		{"/home/a/x.txt", "/home/a/", true},
+		{"/home/a/x.txt", "/", true},
+		{"/x", "/", true},
+		{"/", "/", false},
+	}
+	for _, tt := range tests {
+		if got := IsBeneath(tt.path, tt.root); got != tt.want {
+			t.Errorf("IsBeneath(%q, %q) = %v, want %v", tt.path, tt.root, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE external_files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		path TEXT NOT NULL UNIQUE,
+		file_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+INSERT INTO external_files VALUES(1,'document','/home/a/Report.gdoc','file-1','2025-03-01 09:00:00');
+INSERT INTO sqlite_sequence VALUES('external_files',1);
+CREATE INDEX idx_type ON external_files(type);
+CREATE INDEX idx_path ON external_files(path);
+CREATE INDEX idx_file_id ON external_files(file_id);
+COMMIT;
@@ -0,0 +1,153 @@
+package diagnostics
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"Finder-2/backend/credentials"
+	"Finder-2/backend/database"
+	"Finder-2/backend/logging"
+	"Finder-2/backend/sandbox"
+	"Finder-2/backend/settings"
+)
+
+// Info is written to the bundle as info.json
+type Info struct {
+	CreatedAt     time.Time            `json:"createdAt"`
+	OS            string               `json:"os"`
+	Arch          string               `json:"arch"`
+	GoVersion     string               `json:"goVersion"`
+	SchemaVersion int                  `json:"schemaVersion"`
+	SchemaError   string               `json:"schemaError,omitempty"`
+	Storage       database.Status      `json:"storage"`
+	LogLevels     map[string]string    `json:"logLevels"` // as applied, which may differ from Settings until saved
+	Settings      settings.Settings    `json:"settings"`
+	Credentials   []credentials.Status `json:"credentials"` // whether each is set, never the value
+}
+
+// Export writes a zip of the logs and a summary of the app's configuration
+// to destDir, or the Downloads folder when it's empty, and returns its path.
+// Secrets are never included: the logs are redacted as they're written and
+// only whether each credential is set is recorded. store and status describe
+// the storage the app is running on.
+func Export(store database.Store, status database.Status, destDir string) (string, error) {
+	if destDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		destDir = filepath.Join(homeDir, "Downloads")
+	}
+	destDir, err := sandbox.Check(destDir, sandbox.Write)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("finder-2-diagnostics-%s.zip", time.Now().Format("20060102-150405"))
+	path := filepath.Join(destDir, name)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	if err := writeBundle(file, store, status); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+func writeBundle(w io.Writer, store database.Store, status database.Status) error {
+	zw := zip.NewWriter(w)
+
+	info, err := json.MarshalIndent(collectInfo(store, status), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(zw, "info.json", strings.NewReader(string(info))); err != nil {
+		return err
+	}
+
+	if err := addLogs(zw); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func collectInfo(store database.Store, status database.Status) Info {
+	info := Info{
+		CreatedAt: time.Now(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		LogLevels: logging.Levels(),
+		Settings:  settings.Get(),
+		Storage:   status,
+	}
+
+	if version, err := store.SchemaVersion(); err != nil {
+		info.SchemaError = err.Error()
+	} else {
+		info.SchemaVersion = version
+	}
+
+	if statuses, err := credentials.List(); err == nil {
+		info.Credentials = statuses
+	}
+	return info
+}
+
+// addLogs copies the current and rotated log files into logs/
+func addLogs(zw *zip.Writer) error {
+	dir := logging.Dir()
+	if dir == "" {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, logging.LogFileName+"*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+
+	for _, match := range matches {
+		f, err := os.Open(match)
+		if err != nil {
+			continue
+		}
+		err = writeEntry(zw, "logs/"+filepath.Base(match), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeEntry(zw *zip.Writer, name string, r io.Reader) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,378 @@
+// Package drivesync mirrors local folders to Google Drive folders in both
+// directions. Each synced file is recorded in external_files under
+// ExternalType, so the app's own moves and deletes keep the mapping current,
+// and its sync_state row remembers both sides as of the last sync. Changes
+// made in Drive are read incrementally from its changes feed; changes made
+// locally are found by comparing each file with its sync_state.
+package drivesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/logging"
+	"Finder-2/backend/pointers"
+	"Finder-2/backend/sandbox"
+)
+
+var logger = logging.For("drivesync")
+
+// ExternalType is the external_files type synced files are recorded under
+const ExternalType = "gdrive_sync"
+
+// Sync statuses of a file or folder
+const (
+	StatusSynced   = "synced"
+	StatusPending  = "pending"  // changed locally since the last sync
+	StatusConflict = "conflict" // both sides changed; both versions were kept
+	StatusError    = "error"
+)
+
+// Interval is how often Start syncs every folder
+const Interval = 5 * time.Minute
+
+// Report describes what one sync of a folder did
+type Report struct {
+	Root       string   `json:"root"`
+	Uploaded   []string `json:"uploaded"`
+	Downloaded []string `json:"downloaded"`
+	Moved      []string `json:"moved"`
+	Deleted    []string `json:"deleted"` // locally or in Drive
+	Conflicts  []string `json:"conflicts"`
+	Errors     []string `json:"errors"`
+}
+
+var (
+	// syncMux lets one sync run at a time
+	syncMux sync.Mutex
+
+	// fileErrors holds failures for files that have no sync_state yet, by
+	// path, from the last sync of their folder
+	fileErrors   = make(map[string]string)
+	fileErrorMux sync.RWMutex
+
+	listeners   []func(Report)
+	listenerMux sync.Mutex
+)
+
+// AddFolder starts mirroring a local folder to a Drive folder. Nothing is
+// transferred until the next sync; the first one merges the two, keeping
+// both versions of any file that differs.
+func AddFolder(ctx context.Context, store database.Store, localPath string, driveFolder string) (database.SyncRoot, error) {
+	path, err := sandbox.Check(localPath, sandbox.Write)
+	if err != nil {
+		return database.SyncRoot{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return database.SyncRoot{}, apperror.FromOS(err, path)
+	}
+	if !info.IsDir() {
+		return database.SyncRoot{}, apperror.New(apperror.CodeInvalid, "%s is not a folder", path)
+	}
+
+	remote, err := gdrive.Stat(ctx, driveFolder)
+	if err != nil {
+		return database.SyncRoot{}, err
+	}
+	if !remote.IsFolder {
+		return database.SyncRoot{}, apperror.New(apperror.CodeInvalid, "%s is not a Google Drive folder", remote.Name)
+	}
+
+	roots, err := store.ListSyncRoots()
+	if err != nil {
+		return database.SyncRoot{}, err
+	}
+	for _, root := range roots {
+		if within(path, root.Path) || within(root.Path, path) {
+			return database.SyncRoot{}, apperror.New(apperror.CodeInvalid, "%s overlaps the synced folder %s", path, root.Path)
+		}
+	}
+
+	if err := store.AddSyncRoot(path, remote.ID); err != nil {
+		return database.SyncRoot{}, err
+	}
+	logger.Info("folder added to sync", "path", path, "remoteId", remote.ID)
+	return findRoot(store, path)
+}
+
+// RemoveFolder stops syncing a folder. The files are left as they are on
+// both sides.
+func RemoveFolder(store database.Store, localPath string) error {
+	syncMux.Lock()
+	defer syncMux.Unlock()
+
+	root, err := findRoot(store, localPath)
+	if err != nil {
+		return err
+	}
+
+	rows, err := store.ListExternalFilesByType(ExternalType)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if within(row.Path, root.Path) {
+			if err := store.DeleteExternalFile(row.Path); err != nil {
+				return err
+			}
+		}
+	}
+	return store.DeleteSyncRoot(root.Path)
+}
+
+// ListFolders returns the folders being synced
+func ListFolders(store database.SyncStore) ([]database.SyncRoot, error) {
+	return store.ListSyncRoots()
+}
+
+func findRoot(store database.SyncStore, localPath string) (database.SyncRoot, error) {
+	path := filepath.Clean(localPath)
+	roots, err := store.ListSyncRoots()
+	if err != nil {
+		return database.SyncRoot{}, err
+	}
+	for _, root := range roots {
+		if root.Path == path {
+			return root, nil
+		}
+	}
+	return database.SyncRoot{}, apperror.New(apperror.CodeNotFound, "%s is not synced with Google Drive", path)
+}
+
+// Sync brings one synced folder and its Drive folder up to date with each
+// other
+func Sync(ctx context.Context, store database.Store, localPath string) (*Report, error) {
+	root, err := findRoot(store, localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	syncMux.Lock()
+	defer syncMux.Unlock()
+	return syncRoot(ctx, store, root)
+}
+
+// SyncAll syncs every folder, carrying on past ones that fail
+func SyncAll(ctx context.Context, store database.Store) ([]Report, error) {
+	roots, err := ListFolders(store)
+	if err != nil {
+		return nil, err
+	}
+
+	syncMux.Lock()
+	defer syncMux.Unlock()
+
+	var reports []Report
+	for _, root := range roots {
+		report, err := syncRoot(ctx, store, root)
+		if err != nil {
+			logger.Warn("sync failed", "root", root.Path, "error", err)
+			report = &Report{Root: root.Path, Errors: []string{err.Error()}}
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+func syncRoot(ctx context.Context, store database.Store, root database.SyncRoot) (*Report, error) {
+	e, err := newEngine(ctx, store, root)
+	if err == nil {
+		err = e.run()
+	}
+
+	root.LastError = ""
+	if err != nil {
+		root.LastError = err.Error()
+	} else {
+		root.LastSync = time.Now()
+		if e.root.PageToken != "" {
+			root.PageToken = e.root.PageToken
+		}
+	}
+	if saveErr := store.UpdateSyncRoot(root); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fileErrorMux.Lock()
+	for path := range fileErrors {
+		if within(path, root.Path) {
+			delete(fileErrors, path)
+		}
+	}
+	for path, message := range e.fileErrors {
+		fileErrors[path] = message
+	}
+	fileErrorMux.Unlock()
+
+	logger.Info("folder synced",
+		"root", root.Path,
+		"uploaded", len(e.report.Uploaded),
+		"downloaded", len(e.report.Downloaded),
+		"moved", len(e.report.Moved),
+		"deleted", len(e.report.Deleted),
+		"conflicts", len(e.report.Conflicts),
+		"errors", len(e.report.Errors))
+	notify(*e.report)
+	return e.report, nil
+}
+
+// OnSync registers fn to be called with the report of every sync that
+// finishes
+func OnSync(fn func(Report)) {
+	listenerMux.Lock()
+	defer listenerMux.Unlock()
+	listeners = append(listeners, fn)
+}
+
+func notify(report Report) {
+	listenerMux.Lock()
+	fns := make([]func(Report), len(listeners))
+	copy(fns, listeners)
+	listenerMux.Unlock()
+
+	for _, fn := range fns {
+		fn(report)
+	}
+}
+
+// Start syncs every folder each Interval until ctx is done
+func Start(ctx context.Context, store database.Store) {
+	go func() {
+		ticker := time.NewTicker(Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := SyncAll(ctx, store); err != nil {
+					logger.Warn("background sync failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Statuses returns the sync status of each of paths that's inside a synced
+// folder. Paths elsewhere are left out.
+func Statuses(store database.Store, paths []string) map[string]string {
+	roots, err := store.ListSyncRoots()
+	if err != nil || len(roots) == 0 {
+		return nil
+	}
+
+	fileErrorMux.RLock()
+	defer fileErrorMux.RUnlock()
+
+	statuses := make(map[string]string)
+	for _, path := range paths {
+		for _, root := range roots {
+			if !within(path, root.Path) {
+				continue
+			}
+			if status := statusOf(store, root, path); status != "" {
+				statuses[path] = status
+			}
+			break
+		}
+	}
+	return statuses
+}
+
+func statusOf(store database.Store, root database.SyncRoot, path string) string {
+	if path == root.Path {
+		switch {
+		case root.LastError != "":
+			return StatusError
+		case root.LastSync.IsZero():
+			return StatusPending
+		}
+		return StatusSynced
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil || skipLocal(path, info) {
+		return ""
+	}
+	if _, failed := fileErrors[path]; failed {
+		return StatusError
+	}
+
+	row, err := store.GetExternalFileByPath(path)
+	if err != nil || row == nil || row.Type != ExternalType {
+		return StatusPending
+	}
+	state, err := store.GetSyncState(row.FileID)
+	if err != nil || state == nil {
+		return StatusPending
+	}
+	if state.Status == StatusConflict || state.Status == StatusError {
+		return state.Status
+	}
+	if localChanged(state, info) || state.Path != path {
+		return StatusPending
+	}
+	return StatusSynced
+}
+
+// ResolveConflict marks a file whose conflict the user has dealt with as
+// synced again
+func ResolveConflict(store database.Store, path string) error {
+	row, err := store.GetExternalFileByPath(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	var state *database.SyncState
+	if row != nil && row.Type == ExternalType {
+		if state, err = store.GetSyncState(row.FileID); err != nil {
+			return err
+		}
+	}
+	if state == nil || state.Status != StatusConflict {
+		return apperror.New(apperror.CodeInvalid, "%s has no sync conflict", path)
+	}
+
+	state.Status = StatusSynced
+	state.Error = ""
+	return store.SaveSyncState(*state)
+}
+
+// skipLocal reports whether a local file is left out of syncing: partial
+// downloads, pointer files (their Google Doc is already in Drive) and
+// anything that isn't a regular file or folder
+func skipLocal(path string, info os.FileInfo) bool {
+	name := filepath.Base(path)
+	switch {
+	case strings.HasPrefix(name, tempPrefix), name == ".DS_Store":
+		return true
+	case info.IsDir():
+		return false
+	case !info.Mode().IsRegular():
+		return true
+	}
+	return pointers.TypeOf(path) != ""
+}
+
+// localChanged reports whether a file was modified since its last sync
+func localChanged(state *database.SyncState, info os.FileInfo) bool {
+	if state.IsFolder {
+		return false
+	}
+	return info.ModTime().UnixNano() != state.LocalModTime || info.Size() != state.LocalSize
+}
+
+// within reports whether path is root or inside it
+func within(path string, root string) bool {
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
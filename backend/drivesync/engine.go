@@ -0,0 +1,727 @@
+package drivesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/tags"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// engine syncs one root. Its maps mirror external_files and sync_state and
+// are kept current as it goes.
+type engine struct {
+	ctx    context.Context
+	srv    *drive.Service
+	store  database.Store
+	root   database.SyncRoot
+	report *Report
+
+	states map[string]*database.SyncState // by Drive file ID
+	ids    map[string]string              // local path to Drive file ID
+	paths  map[string]string              // Drive file ID to local path
+
+	conflicts  map[string]bool   // local paths to record as conflicts
+	fileErrors map[string]string // failures of files without a state
+}
+
+func newEngine(ctx context.Context, store database.Store, root database.SyncRoot) (*engine, error) {
+	srv, err := gdrive.Service(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &engine{
+		ctx:        ctx,
+		srv:        srv,
+		store:      store,
+		root:       root,
+		report:     &Report{Root: root.Path},
+		states:     make(map[string]*database.SyncState),
+		ids:        make(map[string]string),
+		paths:      make(map[string]string),
+		conflicts:  make(map[string]bool),
+		fileErrors: make(map[string]string),
+	}
+
+	states, err := e.store.ListSyncStates(root.Path)
+	if err != nil {
+		return nil, err
+	}
+	for i := range states {
+		e.states[states[i].FileID] = &states[i]
+	}
+
+	rows, err := e.store.ListExternalFilesByType(ExternalType)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if !within(row.Path, root.Path) {
+			continue
+		}
+		// Copying a synced file maps the copy to the same Drive file. The
+		// copy is really a new file, so only the original keeps the ID.
+		if other, ok := e.paths[row.FileID]; ok {
+			keep, drop := other, row.Path
+			if state := e.states[row.FileID]; state != nil && state.Path == row.Path {
+				keep, drop = row.Path, other
+			}
+			delete(e.ids, drop)
+			e.link(keep, row.FileID)
+			if err := e.store.DeleteExternalFile(drop); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		e.link(row.Path, row.FileID)
+	}
+	return e, nil
+}
+
+// link records path as the local copy of a Drive file in memory
+func (e *engine) link(path string, id string) {
+	e.ids[path] = id
+	e.paths[id] = path
+}
+
+func (e *engine) run() error {
+	// A missing folder, such as an unmounted drive, would otherwise look
+	// like every file was deleted
+	info, err := os.Stat(e.root.Path)
+	if err != nil {
+		return apperror.FromOS(err, e.root.Path)
+	}
+	if !info.IsDir() {
+		return apperror.New(apperror.CodeInvalid, "%s is not a folder", e.root.Path)
+	}
+	remote, err := e.srv.Files.Get(e.root.RemoteID).Fields("id, trashed").Context(e.ctx).Do()
+	if err != nil {
+		return e.googleError(err, "get synced Drive folder")
+	}
+	if remote.Trashed {
+		return apperror.New(apperror.CodeNotFound, "the Google Drive folder synced with %s is in the trash", e.root.Path)
+	}
+
+	if e.root.PageToken == "" {
+		err = e.pullAll()
+	} else {
+		err = e.pullChanges()
+	}
+	if err != nil {
+		return err
+	}
+	return e.push()
+}
+
+// pullAll merges the whole Drive folder into the local one, on the first
+// sync. Later syncs only read what changed since.
+func (e *engine) pullAll() error {
+	token, err := e.srv.Changes.GetStartPageToken().Context(e.ctx).Do()
+	if err != nil {
+		return e.googleError(err, "start reading Drive changes")
+	}
+	failed := len(e.report.Errors)
+	if err := e.pullTree(e.root.RemoteID, e.root.Path); err != nil {
+		return err
+	}
+	// Without a token the next sync merges the whole folder again, which
+	// picks up whatever failed this time
+	if len(e.report.Errors) == failed {
+		e.root.PageToken = token.StartPageToken
+	}
+	return nil
+}
+
+// pullTree brings the untracked contents of a Drive folder into dir
+func (e *engine) pullTree(folderID string, dir string) error {
+	files, err := e.listFolder(folderID)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := e.ctx.Err(); err != nil {
+			return err
+		}
+		if skipRemote(f) || e.states[f.Id] != nil {
+			continue
+		}
+		e.pullNew(f, filepath.Join(dir, gdrive.LocalName(f.Name)))
+	}
+	return nil
+}
+
+// pullChanges applies what changed in Drive since the last sync
+func (e *engine) pullChanges() error {
+	changes, token, err := e.listChanges(e.root.PageToken)
+	if err != nil {
+		return err
+	}
+	failed := len(e.report.Errors)
+
+	// A file's parent may come later in the feed than the file, so changes
+	// are retried until no more can be placed
+	pending := changes
+	for {
+		var deferred []*drive.Change
+		for _, change := range pending {
+			if err := e.ctx.Err(); err != nil {
+				return err
+			}
+			if !e.applyChange(change) {
+				deferred = append(deferred, change)
+			}
+		}
+		if len(deferred) == len(pending) {
+			break
+		}
+		pending = deferred
+	}
+
+	// What's left has moved out of the synced folder, or was never in it
+	for _, change := range pending {
+		if state := e.states[change.FileId]; state != nil {
+			e.remoteGone(state)
+		}
+	}
+
+	// A change that failed is only seen again if the feed is read from the
+	// same place, so the token moves on only once every change has been
+	// applied. Changes that did apply are no-ops the second time.
+	if len(e.report.Errors) == failed {
+		e.root.PageToken = token
+	}
+	return nil
+}
+
+// applyChange handles one change from the feed, returning false when the
+// file's folder isn't known (yet)
+func (e *engine) applyChange(change *drive.Change) bool {
+	state := e.states[change.FileId]
+	f := change.File
+	if change.Removed || f == nil || f.Trashed {
+		if state != nil {
+			e.remoteGone(state)
+		}
+		return true
+	}
+	if skipRemote(f) {
+		return true
+	}
+
+	dir, parentID, ok := e.localDirOf(f.Parents)
+	if !ok {
+		return false
+	}
+	local := filepath.Join(dir, gdrive.LocalName(f.Name))
+	if state == nil {
+		e.pullNew(f, local)
+		return true
+	}
+	e.pullChange(state, f, local, parentID)
+	return true
+}
+
+// localDirOf returns the local folder of the first of parents that's
+// synced, and that parent's ID
+func (e *engine) localDirOf(parents []string) (string, string, bool) {
+	for _, parent := range parents {
+		if parent == e.root.RemoteID {
+			return e.root.Path, parent, true
+		}
+		if path, ok := e.paths[parent]; ok && e.states[parent] != nil && e.states[parent].IsFolder {
+			return path, parent, true
+		}
+	}
+	return "", "", false
+}
+
+// pullNew brings a file or folder that isn't tracked yet to local. When
+// something different is already there, both are kept.
+func (e *engine) pullNew(f *drive.File, local string) {
+	folder := f.MimeType == gdrive.FolderMimeType
+	info, err := os.Lstat(local)
+	_, tracked := e.ids[local]
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if folder {
+			if err := os.Mkdir(local, 0755); err != nil {
+				e.fail(local, "", err)
+				return
+			}
+			e.record(local, f)
+			e.report.Downloaded = append(e.report.Downloaded, local)
+			if err := e.pullTree(f.Id, local); err != nil {
+				e.fail(local, f.Id, err)
+			}
+			return
+		}
+		if err := e.download(f, local); err != nil {
+			e.fail(local, "", err)
+			return
+		}
+		e.record(local, f)
+		e.report.Downloaded = append(e.report.Downloaded, local)
+
+	case err != nil:
+		e.fail(local, "", err)
+
+	case !tracked && folder && info.IsDir():
+		e.record(local, f)
+		if err := e.pullTree(f.Id, local); err != nil {
+			e.fail(local, f.Id, err)
+		}
+
+	case !tracked && !folder && info.Mode().IsRegular() && e.sameContent(local, info, f):
+		e.record(local, f)
+
+	default:
+		// Keep both: Drive's version is saved beside the local one, and the
+		// local one is uploaded as a separate file by push
+		copyPath := conflictPath(local)
+		e.conflicts[local] = true
+		e.conflicts[copyPath] = true
+		e.report.Conflicts = append(e.report.Conflicts, local)
+		if folder {
+			if err := os.Mkdir(copyPath, 0755); err != nil {
+				e.fail(copyPath, "", err)
+				return
+			}
+			e.record(copyPath, f)
+			if err := e.pullTree(f.Id, copyPath); err != nil {
+				e.fail(copyPath, f.Id, err)
+			}
+			return
+		}
+		if err := e.download(f, copyPath); err != nil {
+			e.fail(copyPath, "", err)
+			return
+		}
+		e.record(copyPath, f)
+		e.report.Downloaded = append(e.report.Downloaded, copyPath)
+	}
+}
+
+// pullChange applies a change to a tracked file. local is where Drive's
+// version belongs and parentID the Drive folder it's now in.
+func (e *engine) pullChange(state *database.SyncState, f *drive.File, local string, parentID string) {
+	current, tracked := e.paths[state.FileID]
+	if !tracked {
+		// Deleted locally. An edit in Drive wins over the deletion; otherwise
+		// push deletes it from Drive.
+		if !state.IsFolder && f.Md5Checksum != state.RemoteMD5 {
+			e.forget(state)
+			e.pullNew(f, local)
+		}
+		return
+	}
+
+	renamed := f.Name != state.RemoteName || parentID != state.RemoteParent
+	if renamed && current == state.Path && current != local {
+		// Moved or renamed in Drive and not locally. A local move wins, and
+		// push applies it to Drive instead.
+		target := uniquePath(local)
+		if err := os.Rename(current, target); err != nil {
+			e.fail(current, state.FileID, err)
+			return
+		}
+		e.relocate(current, target)
+		state.Path = target
+		current = target
+		e.report.Moved = append(e.report.Moved, target)
+	}
+	if renamed && current == state.Path {
+		state.RemoteName = f.Name
+		state.RemoteParent = parentID
+	}
+
+	if !state.IsFolder && f.Md5Checksum != state.RemoteMD5 {
+		info, err := os.Lstat(current)
+		if err != nil {
+			e.fail(current, state.FileID, err)
+			return
+		}
+		if localChanged(state, info) {
+			// Edited on both sides: Drive's version is saved beside the local
+			// one, which push then uploads over it
+			copyPath := conflictPath(current)
+			if err := e.download(f, copyPath); err != nil {
+				e.fail(current, state.FileID, err)
+				return
+			}
+			state.RemoteMD5 = f.Md5Checksum
+			state.Status = StatusConflict
+			e.conflicts[current] = true
+			e.conflicts[copyPath] = true
+			e.report.Conflicts = append(e.report.Conflicts, current)
+			e.report.Downloaded = append(e.report.Downloaded, copyPath)
+		} else {
+			if err := e.download(f, current); err != nil {
+				e.fail(current, state.FileID, err)
+				return
+			}
+			e.record(current, f)
+			e.report.Downloaded = append(e.report.Downloaded, current)
+			return
+		}
+	}
+	e.save(state)
+}
+
+// remoteGone handles a tracked file deleted in Drive or moved out of the
+// synced folder. The local copy is deleted unless it has changes Drive
+// never saw, in which case push uploads it again.
+func (e *engine) remoteGone(state *database.SyncState) {
+	current, tracked := e.paths[state.FileID]
+	if !tracked {
+		e.forget(state)
+		return
+	}
+
+	if !state.IsFolder {
+		info, err := os.Lstat(current)
+		if err == nil && !localChanged(state, info) {
+			if err := e.trashLocal(current); err != nil {
+				e.fail(current, state.FileID, err)
+				return
+			}
+		}
+		e.forget(state)
+		return
+	}
+
+	// The synced files inside go, deepest first; anything else is left for
+	// push to upload into a new folder
+	var beneath []string
+	for path := range e.ids {
+		if within(path, current) {
+			beneath = append(beneath, path)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(beneath)))
+	for _, path := range beneath {
+		child := e.states[e.ids[path]]
+		if child == nil {
+			continue
+		}
+		info, err := os.Lstat(path)
+		switch {
+		case err != nil:
+		case child.IsFolder:
+			os.Remove(path) // only succeeds once it's empty
+		case !localChanged(child, info):
+			if err := e.trashLocal(path); err != nil {
+				e.fail(path, child.FileID, err)
+				continue
+			}
+		}
+		e.forget(child)
+	}
+	if _, err := os.Lstat(current); errors.Is(err, fs.ErrNotExist) {
+		e.report.Deleted = append(e.report.Deleted, current)
+	}
+}
+
+// push applies local changes to Drive: deletions, then moves, edits and new
+// files in the order the folder is walked, so folders exist before their
+// contents are uploaded
+func (e *engine) push() error {
+	var gone []*database.SyncState
+	for id, state := range e.states {
+		path, tracked := e.paths[id]
+		if tracked {
+			if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+		}
+		gone = append(gone, state)
+	}
+	sort.Slice(gone, func(i, j int) bool { return gone[i].Path < gone[j].Path })
+
+	var trashedFolders []string
+	for _, state := range gone {
+		inTrashed := false
+		for _, folder := range trashedFolders {
+			if within(state.Path, folder) {
+				inTrashed = true
+			}
+		}
+		if !inTrashed {
+			if err := e.trashRemote(state.FileID); err != nil {
+				e.fail(state.Path, state.FileID, err)
+				continue
+			}
+			e.report.Deleted = append(e.report.Deleted, state.Path)
+			if state.IsFolder {
+				trashedFolders = append(trashedFolders, state.Path)
+			}
+		}
+		e.forget(state)
+	}
+
+	return filepath.WalkDir(e.root.Path, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := e.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if path == e.root.Path {
+				return apperror.FromOS(err, path)
+			}
+			e.fail(path, e.ids[path], err)
+			return nil
+		}
+		if path == e.root.Path {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			e.fail(path, e.ids[path], err)
+			return nil
+		}
+		if skipLocal(path, info) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var ok bool
+		if id, tracked := e.ids[path]; tracked && e.states[id] != nil {
+			ok = e.pushTracked(path, info, e.states[id])
+		} else {
+			ok = e.pushNew(path, info)
+		}
+		if !ok && d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// pushNew uploads a file or creates a folder that Drive doesn't have
+func (e *engine) pushNew(path string, info os.FileInfo) bool {
+	parentID, ok := e.remoteFolderOf(filepath.Dir(path))
+	if !ok {
+		return false
+	}
+	if id, tracked := e.ids[path]; tracked {
+		// A mapping without a state, left by an interrupted sync
+		delete(e.paths, id)
+		delete(e.ids, path)
+		if err := e.store.DeleteExternalFile(path); err != nil {
+			e.fail(path, "", err)
+			return false
+		}
+	}
+
+	var f *drive.File
+	var err error
+	if info.IsDir() {
+		f, err = e.createFolder(info.Name(), parentID)
+	} else {
+		f, err = e.uploadNew(path, parentID)
+	}
+	if err != nil {
+		e.fail(path, "", err)
+		return false
+	}
+	e.record(path, f)
+	e.report.Uploaded = append(e.report.Uploaded, path)
+	return true
+}
+
+// pushTracked applies a local move or edit of a synced file to Drive
+func (e *engine) pushTracked(path string, info os.FileInfo, state *database.SyncState) bool {
+	if info.IsDir() != state.IsFolder {
+		// Replaced by something of the other kind; start over with it
+		if err := e.trashRemote(state.FileID); err != nil {
+			e.fail(path, state.FileID, err)
+			return false
+		}
+		e.forget(state)
+		return e.pushNew(path, info)
+	}
+
+	if path != state.Path {
+		parentID, ok := e.remoteFolderOf(filepath.Dir(path))
+		if !ok {
+			return false
+		}
+		if info.Name() != state.RemoteName || parentID != state.RemoteParent {
+			f, err := e.moveRemote(state.FileID, info.Name(), parentID, state.RemoteParent)
+			if err != nil {
+				e.fail(path, state.FileID, err)
+				return false
+			}
+			state.RemoteName = f.Name
+			state.RemoteParent = parentID
+			e.report.Moved = append(e.report.Moved, path)
+		}
+		state.Path = path
+		e.save(state)
+	}
+
+	if localChanged(state, info) {
+		f, err := e.uploadContent(state.FileID, path)
+		if err != nil {
+			e.fail(path, state.FileID, err)
+			return true
+		}
+		e.record(path, f)
+		e.report.Uploaded = append(e.report.Uploaded, path)
+	}
+	return true
+}
+
+// remoteFolderOf returns the Drive ID of a local folder in the root
+func (e *engine) remoteFolderOf(dir string) (string, bool) {
+	if dir == e.root.Path {
+		return e.root.RemoteID, true
+	}
+	id, ok := e.ids[dir]
+	return id, ok && e.states[id] != nil && e.states[id].IsFolder
+}
+
+// record saves a file as in sync: its local copy at path matches Drive's f
+func (e *engine) record(path string, f *drive.File) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		e.fail(path, f.Id, err)
+		return
+	}
+
+	state := e.states[f.Id]
+	if state == nil {
+		state = &database.SyncState{FileID: f.Id, Root: e.root.Path}
+	}
+	status := StatusSynced
+	if e.conflicts[path] || state.Status == StatusConflict {
+		status = StatusConflict
+	}
+	parent := ""
+	if len(f.Parents) > 0 {
+		parent = f.Parents[0]
+	}
+	*state = database.SyncState{
+		FileID:       f.Id,
+		Root:         e.root.Path,
+		Path:         path,
+		IsFolder:     f.MimeType == gdrive.FolderMimeType,
+		LocalModTime: info.ModTime().UnixNano(),
+		LocalSize:    info.Size(),
+		RemoteName:   f.Name,
+		RemoteParent: parent,
+		RemoteMD5:    f.Md5Checksum,
+		Status:       status,
+	}
+	if state.IsFolder {
+		state.LocalModTime, state.LocalSize = 0, 0
+	}
+
+	if existing, ok := e.ids[path]; !ok || existing != f.Id {
+		if ok {
+			e.store.DeleteExternalFile(path)
+		}
+		if err := e.store.AddExternalFile(ExternalType, path, f.Id); err != nil {
+			e.fail(path, "", err)
+			return
+		}
+		e.link(path, f.Id)
+	}
+	e.states[f.Id] = state
+	delete(e.fileErrors, path)
+	e.save(state)
+}
+
+func (e *engine) save(state *database.SyncState) {
+	if err := e.store.SaveSyncState(*state); err != nil {
+		logger.Warn("failed to save sync state", "path", state.Path, "error", err)
+	}
+}
+
+// forget stops tracking a file, leaving it alone on both sides
+func (e *engine) forget(state *database.SyncState) {
+	if path, ok := e.paths[state.FileID]; ok {
+		if err := e.store.DeleteExternalFile(path); err != nil {
+			logger.Warn("failed to delete sync mapping", "path", path, "error", err)
+		}
+		delete(e.ids, path)
+		delete(e.paths, state.FileID)
+	}
+	if err := e.store.DeleteSyncState(state.FileID); err != nil {
+		logger.Warn("failed to delete sync state", "path", state.Path, "error", err)
+	}
+	delete(e.states, state.FileID)
+}
+
+// relocate updates the mappings and tags of a file or folder moved locally
+// by the sync itself
+func (e *engine) relocate(oldPath string, newPath string) {
+	for path, id := range e.ids {
+		if within(path, oldPath) {
+			moved := newPath + path[len(oldPath):]
+			delete(e.ids, path)
+			e.link(moved, id)
+			if state := e.states[id]; state != nil && state.Path == path {
+				state.Path = moved
+				e.save(state)
+			}
+		}
+	}
+	if err := e.store.MoveExternalFiles(oldPath, newPath); err != nil {
+		logger.Warn("failed to move sync mappings", "from", oldPath, "to", newPath, "error", err)
+	}
+	tags.Moved(e.store, oldPath, newPath)
+	foldersize.Invalidate(e.store, oldPath, newPath)
+}
+
+// fail records a failure against a file, carrying on with the rest
+func (e *engine) fail(path string, id string, err error) {
+	logger.Warn("failed to sync file", "path", path, "error", err)
+	e.report.Errors = append(e.report.Errors, fmt.Sprintf("%s: %v", path, err))
+
+	if state := e.states[id]; id != "" && state != nil {
+		state.Status = StatusError
+		state.Error = err.Error()
+		e.save(state)
+		return
+	}
+	e.fileErrors[path] = err.Error()
+}
+
+// conflictPath names the copy kept of the other side's version of path
+func conflictPath(path string) string {
+	ext := filepath.Ext(path)
+	base := path[:len(path)-len(ext)]
+	stamp := time.Now().Format("2006-01-02 150405")
+	return uniquePath(fmt.Sprintf("%s (conflict %s)%s", base, stamp, ext))
+}
+
+// uniquePath returns p, or "name 1.ext", "name 2.ext" and so on when p
+// already exists
+func uniquePath(p string) string {
+	if _, err := os.Lstat(p); errors.Is(err, fs.ErrNotExist) {
+		return p
+	}
+
+	ext := filepath.Ext(p)
+	base := p[:len(p)-len(ext)]
+	for counter := 1; ; counter++ {
+		candidate := fmt.Sprintf("%s %d%s", base, counter, ext)
+		if _, err := os.Lstat(candidate); errors.Is(err, fs.ErrNotExist) {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package drivesync
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/gdrive/fakedrive"
+	"Finder-2/backend/sandbox"
+)
+
+// setup points gdrive at a fake Drive and adds a local folder synced with a
+// Drive folder, returning the server, the store, the local folder and the
+// Drive folder's ID
+func setup(t *testing.T) (*fakedrive.Server, database.Store, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	previous := sandbox.GetPolicy()
+	if err := sandbox.SetPolicy(sandbox.Policy{AllowedRoots: []string{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	store := database.NewMemoryStore()
+	server := fakedrive.New()
+	gdrive.UseEndpoint(server.Client(), server.Endpoint())
+	t.Cleanup(func() {
+		gdrive.UseEndpoint(nil, "")
+		server.Close()
+		sandbox.SetPolicy(previous)
+	})
+
+	folderID := server.Add("root", "Synced", gdrive.FolderMimeType, nil)
+	if _, err := AddFolder(context.Background(), store, dir, gdrive.PathFor(folderID)); err != nil {
+		t.Fatal(err)
+	}
+	return server, store, dir, folderID
+}
+
+func pageToken(t *testing.T, store database.Store, dir string) string {
+	t.Helper()
+	root, err := findRoot(store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root.PageToken
+}
+
+func readLocal(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s wasn't synced: %v", filepath.Base(path), err)
+	}
+	return string(data)
+}
+
+func TestFailedChangeIsPulledAgain(t *testing.T) {
+	server, store, dir, folderID := setup(t)
+	if _, err := Sync(context.Background(), store, dir); err != nil {
+		t.Fatal(err)
+	}
+	token := pageToken(t, store, dir)
+	if token == "" {
+		t.Fatal("first sync saved no page token")
+	}
+
+	server.Add(folderID, "a.txt", "text/plain", []byte("A"))
+	server.Add(folderID, "b.txt", "text/plain", []byte("B"))
+	server.FailDownloads(1, http.StatusInternalServerError)
+
+	report, err := Sync(context.Background(), store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 1 || len(report.Downloaded) != 1 {
+		t.Fatalf("report = %+v, want one download and one failure", report)
+	}
+	if got := pageToken(t, store, dir); got != token {
+		t.Errorf("page token moved from %s to %s past a failed change", token, got)
+	}
+
+	report, err = Sync(context.Background(), store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 0 || len(report.Downloaded) != 1 {
+		t.Errorf("report = %+v, want the failed file downloaded", report)
+	}
+	if readLocal(t, filepath.Join(dir, "a.txt")) != "A" || readLocal(t, filepath.Join(dir, "b.txt")) != "B" {
+		t.Error("synced files have the wrong content")
+	}
+	if pageToken(t, store, dir) == token {
+		t.Error("page token didn't move once every change was applied")
+	}
+}
+
+func TestFailedFirstSyncMergesAgain(t *testing.T) {
+	server, store, dir, folderID := setup(t)
+	server.Add(folderID, "a.txt", "text/plain", []byte("A"))
+	server.Add(folderID, "b.txt", "text/plain", []byte("B"))
+	server.FailDownloads(1, http.StatusInternalServerError)
+
+	report, err := Sync(context.Background(), store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 1 {
+		t.Fatalf("report = %+v, want one failure", report)
+	}
+	if got := pageToken(t, store, dir); got != "" {
+		t.Errorf("page token %s saved after a failed first sync", got)
+	}
+
+	report, err = Sync(context.Background(), store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 0 {
+		t.Errorf("report = %+v, want no failures", report)
+	}
+	if readLocal(t, filepath.Join(dir, "a.txt")) != "A" || readLocal(t, filepath.Join(dir, "b.txt")) != "B" {
+		t.Error("synced files have the wrong content")
+	}
+	if pageToken(t, store, dir) == "" {
+		t.Error("no page token saved once the merge succeeded")
+	}
+}
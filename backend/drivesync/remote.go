@@ -0,0 +1,246 @@
+package drivesync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/connections"
+	contextmenu "Finder-2/backend/context-menu"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/gdrive"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Fields fetched for every synced file
+const syncFields = "id, name, mimeType, md5Checksum, size, parents, trashed"
+
+// Large files are uploaded in chunks of this size through Drive's
+// resumable protocol
+const chunkSize = 8 * 1024 * 1024
+
+// tempPrefix starts the names of files being downloaded, which are renamed
+// into place once complete
+const tempPrefix = ".finder-sync-"
+
+// skipRemote reports whether a Drive file is left out of syncing. Google
+// Docs and other native files have no bytes to download.
+func skipRemote(f *drive.File) bool {
+	return gdrive.IsNative(f.MimeType)
+}
+
+func (e *engine) googleError(err error, action string) error {
+	if ctxErr := e.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return connections.GoogleError(err, action)
+}
+
+// listFolder returns the files in a Drive folder
+func (e *engine) listFolder(folderID string) ([]*drive.File, error) {
+	query := fmt.Sprintf("'%s' in parents and trashed = false", folderID)
+	var files []*drive.File
+	err := e.srv.Files.List().
+		Q(query).
+		Fields("nextPageToken, files("+syncFields+")").
+		PageSize(1000).
+		Pages(e.ctx, func(page *drive.FileList) error {
+			files = append(files, page.Files...)
+			return nil
+		})
+	if err != nil {
+		return nil, e.googleError(err, "list Drive folder")
+	}
+	return files, nil
+}
+
+// listChanges reads the changes feed from token, returning the latest
+// change of each file in the order they happened, and the token to start
+// from next time
+func (e *engine) listChanges(token string) ([]*drive.Change, string, error) {
+	latest := make(map[string]int)
+	var changes []*drive.Change
+	for {
+		list, err := e.srv.Changes.List(token).
+			Fields("nextPageToken, newStartPageToken, changes(fileId, removed, file(" + syncFields + "))").
+			IncludeRemoved(true).
+			Spaces("drive").
+			PageSize(1000).
+			Context(e.ctx).
+			Do()
+		if err != nil {
+			return nil, "", e.googleError(err, "read Drive changes")
+		}
+
+		for _, change := range list.Changes {
+			if i, ok := latest[change.FileId]; ok {
+				changes[i] = nil
+			}
+			latest[change.FileId] = len(changes)
+			changes = append(changes, change)
+		}
+
+		if list.NewStartPageToken != "" {
+			token = list.NewStartPageToken
+			break
+		}
+		token = list.NextPageToken
+	}
+
+	compacted := changes[:0]
+	for _, change := range changes {
+		if change != nil {
+			compacted = append(compacted, change)
+		}
+	}
+	return compacted, token, nil
+}
+
+// download writes a Drive file's content to path, replacing what's there
+// only once the whole file has arrived
+func (e *engine) download(f *drive.File, path string) error {
+	resp, err := e.srv.Files.Get(f.Id).Context(e.ctx).Download()
+	if err != nil {
+		return e.googleError(err, "download "+f.Name)
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return apperror.FromOS(err, path)
+	}
+	_, err = io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return apperror.FromOS(err, path)
+	}
+	foldersize.Invalidate(e.store, path)
+	return nil
+}
+
+// uploadNew uploads a local file into a Drive folder
+func (e *engine) uploadNew(path string, parentID string) (*drive.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, apperror.FromOS(err, path)
+	}
+	defer f.Close()
+
+	created, err := e.srv.Files.Create(&drive.File{Name: filepath.Base(path), Parents: []string{parentID}}).
+		Media(f, googleapi.ChunkSize(chunkSize)).
+		Fields(syncFields).
+		Context(e.ctx).
+		Do()
+	if err != nil {
+		return nil, e.googleError(err, "upload "+filepath.Base(path))
+	}
+	return created, nil
+}
+
+// uploadContent replaces the content of a Drive file with a local file's
+func (e *engine) uploadContent(id string, path string) (*drive.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, apperror.FromOS(err, path)
+	}
+	defer f.Close()
+
+	updated, err := e.srv.Files.Update(id, &drive.File{}).
+		Media(f, googleapi.ChunkSize(chunkSize)).
+		Fields(syncFields).
+		Context(e.ctx).
+		Do()
+	if err != nil {
+		return nil, e.googleError(err, "upload "+filepath.Base(path))
+	}
+	return updated, nil
+}
+
+func (e *engine) createFolder(name string, parentID string) (*drive.File, error) {
+	created, err := e.srv.Files.Create(&drive.File{
+		Name:     name,
+		MimeType: gdrive.FolderMimeType,
+		Parents:  []string{parentID},
+	}).Fields(syncFields).Context(e.ctx).Do()
+	if err != nil {
+		return nil, e.googleError(err, "create Drive folder")
+	}
+	return created, nil
+}
+
+// moveRemote renames a Drive file and moves it from one folder to another
+func (e *engine) moveRemote(id string, name string, newParent string, oldParent string) (*drive.File, error) {
+	call := e.srv.Files.Update(id, &drive.File{Name: name}).Fields(syncFields).Context(e.ctx)
+	if newParent != oldParent {
+		call = call.AddParents(newParent)
+		if oldParent != "" {
+			call = call.RemoveParents(oldParent)
+		}
+	}
+	f, err := call.Do()
+	if err != nil {
+		return nil, e.googleError(err, "move Drive file")
+	}
+	return f, nil
+}
+
+// trashRemote moves a Drive file to Drive's trash. One that's already gone
+// is fine.
+func (e *engine) trashRemote(id string) error {
+	_, err := e.srv.Files.Update(id, &drive.File{Trashed: true}).Fields("id").Context(e.ctx).Do()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return e.googleError(err, "trash Drive file")
+	}
+	return nil
+}
+
+// trashLocal moves a local file to the trash, the way the user deleting it
+// would
+func (e *engine) trashLocal(path string) error {
+	if err := contextmenu.TrashFile(e.store, path); err != nil {
+		return err
+	}
+	e.report.Deleted = append(e.report.Deleted, path)
+	return nil
+}
+
+// sameContent reports whether a local file has the same bytes as a Drive
+// file, so the first sync can link them instead of keeping both
+func (e *engine) sameContent(path string, info os.FileInfo, f *drive.File) bool {
+	if f.Md5Checksum == "" || info.Size() != f.Size {
+		return false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return false
+	}
+	return strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), f.Md5Checksum)
+}
@@ -0,0 +1,377 @@
+package duplicates
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"Finder-2/backend/apperror"
+	contextmenu "Finder-2/backend/context-menu"
+	"Finder-2/backend/database"
+	"Finder-2/backend/entity"
+	"Finder-2/backend/sandbox"
+)
+
+// Actions accepted by Resolve
+const (
+	ActionTrash      = "trash"      // trash every copy except the one kept
+	ActionHardlink   = "hardlink"   // replace every other copy with a hardlink to the one kept
+	ActionKeepNewest = "keepNewest" // trash every copy except the most recently modified
+)
+
+// Only this much of each file is hashed before deciding a full hash is needed
+const partialHashSize = 16 * 1024
+
+// Options controls which files are considered
+type Options struct {
+	MinSize       int64 `json:"minSize"`       // ignore files smaller than this (empty files are always ignored)
+	IncludeHidden bool  `json:"includeHidden"` // also scan hidden and blocked folders like node_modules
+}
+
+// DuplicateFile is one copy within a duplicate set
+type DuplicateFile struct {
+	Path         string `json:"path"`
+	ModifiedTime string `json:"modifiedTime"`
+}
+
+// DuplicateSet is a group of files with identical contents
+type DuplicateSet struct {
+	Hash        string          `json:"hash"`
+	Size        int64           `json:"size"`
+	Files       []DuplicateFile `json:"files"`
+	WastedBytes int64           `json:"wastedBytes"` // bytes freed by keeping only one copy
+}
+
+// Report is the result of a duplicate scan
+type Report struct {
+	Sets         []DuplicateSet `json:"sets"`
+	TotalWasted  int64          `json:"totalWasted"`
+	FilesScanned int            `json:"filesScanned"`
+}
+
+// fileKey identifies a file across hardlinks
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+type candidate struct {
+	path    string
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// FindDuplicates scans roots for files with identical contents. Files are
+// grouped by size, then by a hash of their first bytes, and only the groups
+// that still collide are hashed in full.
+func FindDuplicates(ctx context.Context, roots []string, opts Options) (*Report, error) {
+	bySize, scanned, err := collectBySize(ctx, roots, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]*candidate
+	for _, files := range bySize {
+		if len(files) > 1 {
+			groups = append(groups, files)
+		}
+	}
+
+	// Partial hashes narrow each size group down
+	groups, err = refine(ctx, groups, func(c *candidate) (string, error) {
+		return hashFile(c.path, partialHashSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Files no bigger than the partial read are already fully hashed
+	groups, err = refine(ctx, groups, func(c *candidate) (string, error) {
+		if c.size <= partialHashSize {
+			return c.hash, nil
+		}
+		return hashFile(c.path, -1)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{FilesScanned: scanned}
+	for _, group := range groups {
+		set := DuplicateSet{
+			Hash:        group[0].hash,
+			Size:        group[0].size,
+			WastedBytes: group[0].size * int64(len(group)-1),
+		}
+		for _, c := range group {
+			set.Files = append(set.Files, DuplicateFile{
+				Path:         c.path,
+				ModifiedTime: c.modTime.Format(time.RFC3339),
+			})
+		}
+		sort.Slice(set.Files, func(i, j int) bool {
+			return set.Files[i].Path < set.Files[j].Path
+		})
+
+		report.Sets = append(report.Sets, set)
+		report.TotalWasted += set.WastedBytes
+	}
+
+	sort.Slice(report.Sets, func(i, j int) bool {
+		return report.Sets[i].WastedBytes > report.Sets[j].WastedBytes
+	})
+
+	return report, nil
+}
+
+// collectBySize walks roots and buckets regular files by size. Hardlinks to
+// a file already seen are skipped since they take no extra space.
+func collectBySize(ctx context.Context, roots []string, opts Options) (map[int64][]*candidate, int, error) {
+	bySize := make(map[int64][]*candidate)
+	seenPaths := make(map[string]bool)
+	seenInodes := make(map[fileKey]bool)
+	scanned := 0
+
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				// Skip unreadable folders rather than failing the whole scan
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if d.IsDir() {
+				if path != root && !opts.IncludeHidden && entity.IsBlocked(d.Name()) {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if !opts.IncludeHidden && entity.IsBlocked(d.Name()) {
+				return nil
+			}
+			if seenPaths[path] {
+				return nil
+			}
+			seenPaths[path] = true
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			scanned++
+
+			if info.Size() == 0 || info.Size() < opts.MinSize {
+				return nil
+			}
+			if key, ok := inodeOf(info); ok {
+				if seenInodes[key] {
+					return nil
+				}
+				seenInodes[key] = true
+			}
+
+			bySize[info.Size()] = append(bySize[info.Size()], &candidate{
+				path:    path,
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return bySize, scanned, nil
+}
+
+// refine hashes every candidate in parallel and splits each group by hash,
+// dropping files that no longer have a match
+func refine(ctx context.Context, groups [][]*candidate, hash func(*candidate) (string, error)) ([][]*candidate, error) {
+	jobs := make(chan *candidate)
+	var wg sync.WaitGroup
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				sum, err := hash(c)
+				if err != nil {
+					// Unreadable files can't be proven duplicates
+					sum = ""
+				}
+				c.hash = sum
+			}
+		}()
+	}
+
+	for _, group := range groups {
+		for _, c := range group {
+			if ctx.Err() != nil {
+				break
+			}
+			jobs <- c
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var refined [][]*candidate
+	for _, group := range groups {
+		byHash := make(map[string][]*candidate)
+		for _, c := range group {
+			if c.hash != "" {
+				byHash[c.hash] = append(byHash[c.hash], c)
+			}
+		}
+		for _, matches := range byHash {
+			if len(matches) > 1 {
+				refined = append(refined, matches)
+			}
+		}
+	}
+
+	return refined, nil
+}
+
+// hashFile returns the SHA-256 of the first limit bytes of a file, or of the
+// whole file if limit is negative
+func hashFile(path string, limit int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if limit >= 0 {
+		reader = io.LimitReader(file, limit)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Resolve applies an action to a duplicate set. keepPath names the copy to
+// keep for ActionTrash and ActionHardlink and is ignored for ActionKeepNewest.
+// Every copy is re-verified against the set's hash first, so files changed
+// since the scan are never removed. store has the tags and other records of
+// the copies that are trashed.
+func Resolve(store database.Store, set DuplicateSet, action string, keepPath string) error {
+	if len(set.Files) < 2 {
+		return apperror.New(apperror.CodeInvalid, "duplicate set has fewer than two files")
+	}
+	switch action {
+	case ActionTrash, ActionHardlink, ActionKeepNewest:
+	default:
+		return apperror.New(apperror.CodeInvalid, "unknown action: %s", action)
+	}
+
+	if action == ActionKeepNewest {
+		keepPath = newest(set.Files)
+	}
+
+	found := false
+	for _, f := range set.Files {
+		if f.Path == keepPath {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return apperror.New(apperror.CodeInvalid, "file to keep is not part of the duplicate set: %s", keepPath)
+	}
+
+	// Refuse up front rather than stopping halfway through the set
+	for _, f := range set.Files {
+		if err := verify(f.Path, set); err != nil {
+			return err
+		}
+		if f.Path != keepPath {
+			if _, err := sandbox.Check(f.Path, sandbox.Remove); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, f := range set.Files {
+		if f.Path == keepPath {
+			continue
+		}
+
+		var err error
+		if action == ActionHardlink {
+			err = contextmenu.ReplaceWithHardlink(store, keepPath, f.Path)
+		} else {
+			err = contextmenu.TrashFile(store, f.Path)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to %s %s: %w", action, f.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// verify checks that a file still has the size and contents recorded in the set
+func verify(path string, set DuplicateSet) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return apperror.FromOS(err, path)
+	}
+	if info.Size() != set.Size {
+		return apperror.Conflict(path, "file changed since the scan: %s", path)
+	}
+
+	sum, err := hashFile(path, -1)
+	if err != nil {
+		return apperror.FromOS(err, path)
+	}
+	if sum != set.Hash {
+		return apperror.Conflict(path, "file changed since the scan: %s", path)
+	}
+	return nil
+}
+
+func newest(files []DuplicateFile) string {
+	var newestPath string
+	var newestTime time.Time
+	for _, f := range files {
+		t, err := time.Parse(time.RFC3339, f.ModifiedTime)
+		if err != nil {
+			continue
+		}
+		if newestPath == "" || t.After(newestTime) {
+			newestPath = f.Path
+			newestTime = t
+		}
+	}
+	return newestPath
+}
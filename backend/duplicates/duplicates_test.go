@@ -0,0 +1,186 @@
+package duplicates
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/sandbox"
+)
+
+func setup(t *testing.T) (string, database.Store) {
+	t.Helper()
+	dir := t.TempDir()
+	previous := sandbox.GetPolicy()
+	if err := sandbox.SetPolicy(sandbox.Policy{AllowedRoots: []string{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sandbox.SetPolicy(previous) })
+	return dir, database.NewMemoryStore()
+}
+
+func writeFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setPaths lists the files of each set found, in the report's order
+func setPaths(report *Report) [][]string {
+	var sets [][]string
+	for _, set := range report.Sets {
+		var paths []string
+		for _, f := range set.Files {
+			paths = append(paths, filepath.Base(f.Path))
+		}
+		sets = append(sets, paths)
+	}
+	return sets
+}
+
+func TestFindDuplicatesGroupsBySizeThenContent(t *testing.T) {
+	dir, _ := setup(t)
+	writeFile(t, filepath.Join(dir, "a.txt"), []byte("same words"))
+	writeFile(t, filepath.Join(dir, "sub", "b.txt"), []byte("same words"))
+	writeFile(t, filepath.Join(dir, "c.txt"), []byte("other word")) // same size, other content
+	writeFile(t, filepath.Join(dir, "d.txt"), []byte("same words, longer"))
+	writeFile(t, filepath.Join(dir, "empty1"), nil)
+	writeFile(t, filepath.Join(dir, "empty2"), nil)
+	writeFile(t, filepath.Join(dir, "node_modules", "e.txt"), []byte("same words"))
+
+	report, err := FindDuplicates(context.Background(), []string{dir}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets := setPaths(report)
+	if len(sets) != 1 || len(sets[0]) != 2 || sets[0][0] != "a.txt" || sets[0][1] != "b.txt" {
+		t.Fatalf("sets = %v, want only a.txt and sub/b.txt", sets)
+	}
+	set := report.Sets[0]
+	if set.Size != 10 || set.WastedBytes != 10 || report.TotalWasted != 10 {
+		t.Errorf("size/wasted/total = %d/%d/%d, want 10 each", set.Size, set.WastedBytes, report.TotalWasted)
+	}
+	if want, _ := hashFile(filepath.Join(dir, "a.txt"), -1); set.Hash != want {
+		t.Errorf("hash = %s, want the full hash %s", set.Hash, want)
+	}
+
+	report, err = FindDuplicates(context.Background(), []string{dir}, Options{IncludeHidden: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sets := setPaths(report); len(sets) != 1 || len(sets[0]) != 3 {
+		t.Errorf("with hidden folders sets = %v, want node_modules/e.txt included", sets)
+	}
+}
+
+func TestFindDuplicatesComparesPastPartialHash(t *testing.T) {
+	dir, _ := setup(t)
+	content := bytes.Repeat([]byte("x"), partialHashSize+4096)
+	different := bytes.Clone(content)
+	different[len(different)-1] = 'y'
+	writeFile(t, filepath.Join(dir, "one.bin"), content)
+	writeFile(t, filepath.Join(dir, "two.bin"), content)
+	writeFile(t, filepath.Join(dir, "tail.bin"), different)
+
+	report, err := FindDuplicates(context.Background(), []string{dir}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets := setPaths(report)
+	if len(sets) != 1 || len(sets[0]) != 2 || sets[0][0] != "one.bin" || sets[0][1] != "two.bin" {
+		t.Fatalf("sets = %v, want one.bin and two.bin without tail.bin", sets)
+	}
+	if want, _ := hashFile(filepath.Join(dir, "one.bin"), -1); report.Sets[0].Hash != want {
+		t.Errorf("hash = %s, want the full hash %s", report.Sets[0].Hash, want)
+	}
+}
+
+func TestFindDuplicatesSkipsHardlinks(t *testing.T) {
+	dir, _ := setup(t)
+	writeFile(t, filepath.Join(dir, "a.txt"), []byte("linked"))
+	if err := os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")); err != nil {
+		t.Skip("hardlinks not supported:", err)
+	}
+
+	report, err := FindDuplicates(context.Background(), []string{dir}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Sets) != 0 {
+		t.Errorf("sets = %v, want hardlinks not reported", setPaths(report))
+	}
+}
+
+func TestResolveRefusesFilesChangedSinceScan(t *testing.T) {
+	dir, store := setup(t)
+	keep := filepath.Join(dir, "keep.txt")
+	other := filepath.Join(dir, "other.txt")
+	writeFile(t, keep, []byte("identical"))
+	writeFile(t, other, []byte("identical"))
+
+	report, err := FindDuplicates(context.Background(), []string{dir}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Sets) != 1 {
+		t.Fatalf("sets = %v, want one", setPaths(report))
+	}
+
+	// Same size, so only the hash gives the change away
+	writeFile(t, other, []byte("different"))
+	if err := Resolve(store, report.Sets[0], ActionHardlink, keep); apperror.CodeOf(err) != apperror.CodeConflict {
+		t.Fatalf("resolving = %v, want the changed file refused as a conflict", err)
+	}
+	if err := Resolve(store, report.Sets[0], "shred", keep); apperror.CodeOf(err) != apperror.CodeInvalid {
+		t.Errorf("an unknown action = %v, want invalid", err)
+	}
+	data, err := os.ReadFile(other)
+	if err != nil || string(data) != "different" {
+		t.Errorf("other.txt = %q, %v, want it left alone", data, err)
+	}
+}
+
+func TestResolveHardlinkInvalidatesFolderSizes(t *testing.T) {
+	dir, store := setup(t)
+	keep := filepath.Join(dir, "keep.bin")
+	duplicate := filepath.Join(dir, "nested", "deep", "copy.bin")
+	writeFile(t, keep, bytes.Repeat([]byte("d"), 2048))
+	writeFile(t, duplicate, bytes.Repeat([]byte("d"), 2048))
+
+	report, err := FindDuplicates(context.Background(), []string{dir}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Sets) != 1 {
+		t.Fatalf("sets = %v, want one", setPaths(report))
+	}
+	for _, folder := range []string{dir, filepath.Join(dir, "nested")} {
+		if _, err := foldersize.Calculate(context.Background(), store, folder); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Resolve(store, report.Sets[0], ActionHardlink, keep); err != nil {
+		t.Fatal(err)
+	}
+
+	keepInfo, _ := os.Stat(keep)
+	duplicateInfo, err := os.Stat(duplicate)
+	if err != nil || !os.SameFile(keepInfo, duplicateInfo) {
+		t.Errorf("copy.bin is not a hardlink to keep.bin (%v)", err)
+	}
+	for _, folder := range []string{dir, filepath.Join(dir, "nested")} {
+		if cached, _ := store.GetFolderSize(folder); cached != nil {
+			t.Errorf("size of %s is still cached after the hardlink", folder)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !linux
+
+package duplicates
+
+import "os"
+
+// inodeOf can't identify hardlinks here, so every path is treated as its own file
+func inodeOf(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
@@ -0,0 +1,17 @@
+//go:build darwin || linux
+
+package duplicates
+
+import (
+	"os"
+	"syscall"
+)
+
+// inodeOf identifies the file behind info so hardlinks aren't reported as copies
+func inodeOf(info os.FileInfo) (fileKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: st.Ino}, true
+}
@@ -0,0 +1,18 @@
+//go:build darwin || linux
+
+package entity
+
+import (
+	"os"
+	"syscall"
+)
+
+// inodeOf returns the identity and link count of a file, so hardlinks are
+// counted once
+func inodeOf(info os.FileInfo) (fileKey, uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, 1, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: st.Ino}, uint64(st.Nlink), true
+}
@@ -0,0 +1,237 @@
+package entity
+
+import (
+	"container/heap"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"Finder-2/backend"
+)
+
+// UsageNode is a folder in the disk usage tree. Size is cumulative, and the
+// children of a node always add up to its size, so the tree can be fed
+// straight into a treemap.
+type UsageNode struct {
+	ID        string      `json:"id"` // unique in the tree; see filesID for a Files leaf's
+	Name      string      `json:"name"`
+	Path      string      `json:"path"`
+	Size      int64       `json:"size"`
+	FileCount int         `json:"fileCount"`
+	IsFiles   bool        `json:"isFiles"` // leaf grouping the files directly inside the parent
+	Children  []UsageNode `json:"children"`
+}
+
+// LargeFile is one of the biggest files found under the root
+type LargeFile struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	Size         int64  `json:"size"`
+	Kind         string `json:"kind"`
+	ModifiedTime string `json:"modifiedTime"`
+}
+
+// KindUsage totals the bytes taken by one kind of file
+type KindUsage struct {
+	Kind      string `json:"kind"`
+	Size      int64  `json:"size"`
+	FileCount int    `json:"fileCount"`
+}
+
+// DiskUsage is the result of analyzing a folder
+type DiskUsage struct {
+	Root         UsageNode   `json:"root"`
+	LargestFiles []LargeFile `json:"largestFiles"`
+	ByKind       []KindUsage `json:"byKind"`
+	TotalSize    int64       `json:"totalSize"`
+	TotalFiles   int         `json:"totalFiles"`
+}
+
+// fileKey identifies a file across hardlinks
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+// usageScan carries the running totals for one analysis
+type usageScan struct {
+	ctx      context.Context
+	maxDepth int
+	topN     int
+	largest  largeFileHeap
+	byKind   map[string]*KindUsage
+	seen     map[fileKey]bool // files with more than one link, counted once
+}
+
+// filesID returns the ID of the node grouping the files directly inside the
+// folder at path, which shares the folder's Path. A NUL can't appear in a
+// file name, so no real folder, such as a sibling "foo#files", has this ID.
+func filesID(path string) string {
+	return path + "\x00files"
+}
+
+// GetDiskUsage walks rootPath and reports where its bytes go. Unlike
+// GetFolderTree it doesn't skip blocked folders or stop at project roots,
+// since node_modules and build output are usually what's eating the disk.
+// Folders deeper than maxDepth are counted but not listed as children, and
+// hardlinked files are counted once. It stops early when ctx is cancelled.
+func GetDiskUsage(ctx context.Context, rootPath string, maxDepth int, topN int) (*DiskUsage, error) {
+	info, err := os.Stat(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	scan := &usageScan{
+		ctx:      ctx,
+		maxDepth: maxDepth,
+		topN:     topN,
+		byKind:   make(map[string]*KindUsage),
+		seen:     make(map[fileKey]bool),
+	}
+
+	root := scan.walk(rootPath, info.Name(), 0)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	largest := make([]LargeFile, len(scan.largest))
+	copy(largest, scan.largest)
+	sort.Slice(largest, func(i, j int) bool {
+		return largest[i].Size > largest[j].Size
+	})
+
+	var byKind []KindUsage
+	for _, usage := range scan.byKind {
+		byKind = append(byKind, *usage)
+	}
+	sort.Slice(byKind, func(i, j int) bool {
+		return byKind[i].Size > byKind[j].Size
+	})
+
+	return &DiskUsage{
+		Root:         root,
+		LargestFiles: largest,
+		ByKind:       byKind,
+		TotalSize:    root.Size,
+		TotalFiles:   root.FileCount,
+	}, nil
+}
+
+func (s *usageScan) walk(path string, name string, depth int) UsageNode {
+	node := UsageNode{
+		ID:       path,
+		Name:     name,
+		Path:     path,
+		Children: []UsageNode{},
+	}
+
+	if s.ctx.Err() != nil {
+		return node
+	}
+
+	items, err := os.ReadDir(path)
+	if err != nil {
+		return node // Return node even if we can't read contents
+	}
+
+	files := UsageNode{
+		ID:       filesID(path),
+		Name:     "Files",
+		Path:     path,
+		IsFiles:  true,
+		Children: []UsageNode{},
+	}
+
+	for _, item := range items {
+		itemPath := filepath.Join(path, item.Name())
+
+		// Symlinks are never followed, so nothing is counted twice
+		if item.IsDir() {
+			child := s.walk(itemPath, item.Name(), depth+1)
+			node.Size += child.Size
+			node.FileCount += child.FileCount
+			if depth < s.maxDepth {
+				node.Children = append(node.Children, child)
+			}
+			continue
+		}
+
+		info, err := item.Info()
+		if err != nil {
+			continue
+		}
+		if key, links, ok := inodeOf(info); ok && links > 1 {
+			if s.seen[key] {
+				continue
+			}
+			s.seen[key] = true
+		}
+
+		s.addFile(itemPath, item.Name(), info)
+		files.Size += info.Size()
+		files.FileCount++
+		node.Size += info.Size()
+		node.FileCount++
+	}
+
+	if files.FileCount > 0 && depth < s.maxDepth {
+		node.Children = append(node.Children, files)
+	}
+
+	sort.Slice(node.Children, func(i, j int) bool {
+		return node.Children[i].Size > node.Children[j].Size
+	})
+
+	return node
+}
+
+func (s *usageScan) addFile(path string, name string, info os.FileInfo) {
+	kind := backend.KindOf(name, false, false)
+	usage, ok := s.byKind[kind]
+	if !ok {
+		usage = &KindUsage{Kind: kind}
+		s.byKind[kind] = usage
+	}
+	usage.Size += info.Size()
+	usage.FileCount++
+
+	if s.topN <= 0 {
+		return
+	}
+	if len(s.largest) == s.topN && info.Size() <= s.largest[0].Size {
+		return
+	}
+
+	heap.Push(&s.largest, LargeFile{
+		Name:         name,
+		Path:         path,
+		Size:         info.Size(),
+		Kind:         kind,
+		ModifiedTime: info.ModTime().Format(time.RFC3339),
+	})
+	if len(s.largest) > s.topN {
+		heap.Pop(&s.largest)
+	}
+}
+
+// largeFileHeap is a min-heap on size, so the smallest of the current top N
+// is always the one to evict
+type largeFileHeap []LargeFile
+
+func (h largeFileHeap) Len() int           { return len(h) }
+func (h largeFileHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h largeFileHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *largeFileHeap) Push(x any) {
+	*h = append(*h, x.(LargeFile))
+}
+
+func (h *largeFileHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,97 @@
+package entity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetDiskUsage(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "big.bin"), 1000)
+	writeFile(t, filepath.Join(root, "sub", "small.txt"), 10)
+	if err := os.Link(filepath.Join(root, "big.bin"), filepath.Join(root, "sub", "big-link.bin")); err != nil {
+		t.Skip("hardlinks not supported:", err)
+	}
+
+	usage, err := GetDiskUsage(context.Background(), root, 2, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.TotalSize != 1010 || usage.TotalFiles != 2 {
+		t.Errorf("total = %d bytes in %d files, want 1010 in 2 with the hardlink counted once", usage.TotalSize, usage.TotalFiles)
+	}
+	if len(usage.LargestFiles) != 2 {
+		t.Errorf("largest files = %+v, want 2", usage.LargestFiles)
+	}
+
+	ids := make(map[string]bool)
+	var check func(node UsageNode)
+	check = func(node UsageNode) {
+		if ids[node.ID] {
+			t.Errorf("duplicate node ID %q", node.ID)
+		}
+		ids[node.ID] = true
+		var sum int64
+		for _, child := range node.Children {
+			sum += child.Size
+			check(child)
+		}
+		if len(node.Children) > 0 && sum != node.Size {
+			t.Errorf("children of %s add up to %d, want %d", node.ID, sum, node.Size)
+		}
+	}
+	check(usage.Root)
+	if !ids[filesID(root)] {
+		t.Errorf("no Files node for the root")
+	}
+}
+
+func TestGetDiskUsageFilesIDsDontCollide(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "foo", "a.txt"), 10)
+	writeFile(t, filepath.Join(root, "foo#files", "b.txt"), 20)
+
+	usage, err := GetDiskUsage(context.Background(), root, 2, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]bool)
+	var check func(node UsageNode)
+	check = func(node UsageNode) {
+		if ids[node.ID] {
+			t.Errorf("duplicate node ID %q", node.ID)
+		}
+		ids[node.ID] = true
+		for _, child := range node.Children {
+			check(child)
+		}
+	}
+	check(usage.Root)
+	if !ids[filesID(filepath.Join(root, "foo"))] || !ids[filepath.Join(root, "foo#files")] {
+		t.Errorf("IDs = %v, want both the Files node of foo and the folder foo#files", ids)
+	}
+}
+
+func TestGetDiskUsageCancelled(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "file"), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetDiskUsage(ctx, root, 2, 5); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
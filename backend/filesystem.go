@@ -1,7 +1,14 @@
 package backend
 
 import (
+	"Finder-2/backend/archive"
+	"Finder-2/backend/connections"
+	"Finder-2/backend/database"
+	"Finder-2/backend/drivesync"
+	"Finder-2/backend/gdrive"
 	"Finder-2/backend/icon"
+	"Finder-2/backend/settings"
+	"context"
 	"encoding/base64"
 	"os"
 	"path/filepath"
@@ -10,13 +17,28 @@ import (
 )
 
 type FileItem struct {
-	Name         string `json:"name"`
-	Path         string `json:"path"`
-	IsDirectory  bool   `json:"isDirectory"`
-	IsApp        bool   `json:"isApp"`
-	Size         int64  `json:"size"`
-	ModifiedTime string `json:"modifiedTime"`
-	IconPath     string `json:"iconPath"`
+	Name          string   `json:"name"`
+	Path          string   `json:"path"`
+	IsDirectory   bool     `json:"isDirectory"`
+	IsApp         bool     `json:"isApp"`
+	Size          int64    `json:"size"`
+	ModifiedTime  string   `json:"modifiedTime"`
+	CreatedTime   string   `json:"createdTime"`
+	AccessedTime  string   `json:"accessedTime"`
+	Kind          string   `json:"kind"`
+	MimeType      string   `json:"mimeType"`
+	Permissions   string   `json:"permissions"` // e.g. "-rwxr-xr-x"
+	Mode          uint32   `json:"mode"`        // permission bits, e.g. 0755
+	Owner         string   `json:"owner"`
+	Group         string   `json:"group"`
+	HardLinks     uint64   `json:"hardLinks"`
+	IsExecutable  bool     `json:"isExecutable"`
+	IsSymlink     bool     `json:"isSymlink"`
+	SymlinkTarget string   `json:"symlinkTarget,omitempty"`
+	IsBrokenLink  bool     `json:"isBrokenLink"`
+	Tags          []string `json:"tags,omitempty"`
+	SyncStatus    string   `json:"syncStatus,omitempty"` // set inside folders synced with Google Drive
+	IconPath      string   `json:"iconPath"`
 }
 
 type Folder struct {
@@ -39,6 +61,9 @@ var blocklist = []string{
 	"Utilities",
 }
 
+// tagScheme prefixes the virtual folders that list tagged files
+const tagScheme = "tag://"
+
 var systemFolders = []string{
 	"Chrome Apps.Localized",
 }
@@ -60,12 +85,89 @@ func isBlocked(name string) bool {
 	return false
 }
 
+// NewFileItem builds a FileItem from a path and its Lstat info. Symlinks are
+// resolved so that links to folders can be browsed like folders.
+func NewFileItem(path string, info os.FileInfo) FileItem {
+	name := filepath.Base(path)
+	item := FileItem{Name: name, Path: path}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		item.IsSymlink = true
+		if target, err := os.Readlink(path); err == nil {
+			item.SymlinkTarget = target
+		}
+		if targetInfo, err := os.Stat(path); err == nil {
+			info = targetInfo
+		} else {
+			item.IsBrokenLink = true
+		}
+	}
+
+	details := platformStat(path, info)
+	mode := info.Mode()
+
+	item.IsDirectory = info.IsDir()
+	item.IsApp = strings.HasSuffix(name, ".app")
+	item.Size = info.Size()
+	item.ModifiedTime = info.ModTime().Format(time.RFC3339)
+	item.CreatedTime = details.created.Format(time.RFC3339)
+	item.AccessedTime = details.accessed.Format(time.RFC3339)
+	item.Kind = KindOf(name, item.IsDirectory, item.IsApp)
+	item.MimeType = MimeTypeOf(name, item.IsDirectory)
+	item.Permissions = mode.String()
+	item.Mode = uint32(mode.Perm())
+	item.HardLinks = details.links
+	item.IsExecutable = mode.IsRegular() && mode.Perm()&0111 != 0
+
+	if details.hasOwner {
+		item.Owner = lookupUserName(details.uid)
+		item.Group = lookupGroupName(details.gid)
+	}
+
+	return item
+}
+
+// GetFileInfo returns the full metadata for a single path, sniffing the
+// content type when the extension doesn't identify it
+func GetFileInfo(store database.Store, path string) (FileItem, error) {
+	if gdrive.IsPath(path) {
+		file, err := gdrive.Stat(context.Background(), path)
+		if err != nil {
+			return FileItem{}, err
+		}
+		return driveFileItem(file), nil
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return FileItem{}, err
+	}
+
+	item := NewFileItem(path, info)
+	if !item.IsDirectory && !item.IsBrokenLink && item.MimeType == "application/octet-stream" {
+		if sniffed := sniffMimeType(path); sniffed != "" {
+			item.MimeType = sniffed
+		}
+	}
+
+	// The same helpers as listings, so Get Info agrees with them
+	items := []FileItem{item}
+	AttachTags(store, items)
+	AttachSyncStatus(store, items)
+	return items[0], nil
+}
+
 func GetHomeFolders() ([]Folder, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, err
 	}
 
+	documentsRoot, err := settings.DocumentsRoot()
+	if err != nil {
+		return nil, err
+	}
+
 	var folders []Folder
 
 	// Add system Applications folder
@@ -78,7 +180,7 @@ func GetHomeFolders() ([]Folder, error) {
 	// Add Documents
 	folders = append(folders, Folder{
 		Name: "Documents",
-		Path: filepath.Join(homeDir, "Documents"),
+		Path: documentsRoot,
 		Icon: "folder",
 	})
 
@@ -96,17 +198,46 @@ func GetHomeFolders() ([]Folder, error) {
 		Icon: "folder",
 	})
 
+	// Add Tags (virtual folder with one entry per tag)
+	folders = append(folders, Folder{
+		Name: "Tags",
+		Path: tagScheme,
+		Icon: "tag",
+	})
+
+	if connections.IsGoogleConnected() {
+		folders = append(folders, Folder{
+			Name: "Google Drive",
+			Path: gdrive.Scheme,
+			Icon: "cloud",
+		})
+	}
+
 	return folders, nil
 }
 
-func GetFolderContents(path string) ([]FileItem, error) {
+func GetFolderContents(store database.Store, path string) ([]FileItem, error) {
 	// Handle special "Media" virtual folder
 	if path == "media://" {
 		return getMediaFolderContents()
 	}
 
+	// Handle "tag://" and "tag://<name>" virtual folders
+	if strings.HasPrefix(path, tagScheme) {
+		return getTagFolderContents(store, strings.TrimPrefix(path, tagScheme))
+	}
+
+	// Handle "gdrive://" and "gdrive://<folder id>" Drive folders
+	if gdrive.IsPath(path) {
+		return getDriveFolderContents(path)
+	}
+
 	items, err := os.ReadDir(path)
 	if err != nil {
+		// Archives, and folders inside them, are browsed without extracting
+		if archivePath, inner, ok := archive.SplitPath(path); ok {
+			return getArchiveFolderContents(archivePath, inner)
+		}
 		return nil, err
 	}
 
@@ -121,25 +252,19 @@ func GetFolderContents(path string) ([]FileItem, error) {
 			continue
 		}
 
-		isApp := strings.HasSuffix(item.Name(), ".app")
-		iconPath := ""
-		// Try to get icon for .app files OR any directory in Applications folder
 		itemPath := filepath.Join(path, item.Name())
-		if isApp || (item.IsDir() && (path == "/Applications" || strings.HasSuffix(path, "/Applications"))) {
-			iconPath = icon.GetAppIconBase64(itemPath)
+		fileItem := NewFileItem(itemPath, info)
+
+		// Try to get icon for .app files OR any directory in Applications folder
+		if fileItem.IsApp || (item.IsDir() && (path == "/Applications" || strings.HasSuffix(path, "/Applications"))) {
+			fileItem.IconPath = icon.GetAppIconBase64(itemPath)
 		}
 
-		fileItems = append(fileItems, FileItem{
-			Name:         item.Name(),
-			Path:         filepath.Join(path, item.Name()),
-			IsDirectory:  item.IsDir(),
-			IsApp:        isApp,
-			Size:         info.Size(),
-			ModifiedTime: info.ModTime().Format(time.RFC3339),
-			IconPath:     iconPath,
-		})
+		fileItems = append(fileItems, fileItem)
 	}
 
+	AttachTags(store, fileItems)
+	AttachSyncStatus(store, fileItems)
 	return fileItems, nil
 }
 
@@ -168,26 +293,165 @@ func getMediaFolderContents() ([]FileItem, error) {
 			continue
 		}
 
+		fileItems = append(fileItems, NewFileItem(folder.path, info))
+	}
+
+	return fileItems, nil
+}
+
+// getTagFolderContents lists every tag as a folder when name is empty,
+// otherwise the files carrying that tag
+func getTagFolderContents(store database.TagStore, name string) ([]FileItem, error) {
+	var fileItems []FileItem
+
+	if name == "" {
+		tags, err := store.ListTags()
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			fileItems = append(fileItems, FileItem{
+				Name:         tag.Name,
+				Path:         tagScheme + tag.Name,
+				IsDirectory:  true,
+				ModifiedTime: tag.CreatedAt.Format(time.RFC3339),
+				Kind:         KindFolder,
+				MimeType:     "inode/directory",
+			})
+		}
+		return fileItems, nil
+	}
+
+	paths, err := store.GetPathsWithTag(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			// Skip files deleted outside the app
+			continue
+		}
+		fileItems = append(fileItems, NewFileItem(path, info))
+	}
+
+	AttachTags(store, fileItems)
+	return fileItems, nil
+}
+
+// getDriveFolderContents lists a Google Drive folder
+func getDriveFolderContents(path string) ([]FileItem, error) {
+	files, err := gdrive.List(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileItems []FileItem
+	for _, file := range files {
+		fileItems = append(fileItems, driveFileItem(file))
+	}
+	return fileItems, nil
+}
+
+// driveFileItem maps a Drive file onto a FileItem. Drive has no
+// permissions, owners or links in the local sense, so those stay empty.
+func driveFileItem(file gdrive.File) FileItem {
+	mimeType := file.MimeType
+	if file.IsFolder {
+		mimeType = "inode/directory"
+	}
+
+	return FileItem{
+		Name:         file.Name,
+		Path:         file.Path,
+		IsDirectory:  file.IsFolder,
+		Size:         file.Size,
+		ModifiedTime: file.ModifiedTime.Format(time.RFC3339),
+		CreatedTime:  file.CreatedTime.Format(time.RFC3339),
+		Kind:         KindOfMimeType(file.Name, file.MimeType, file.IsFolder),
+		MimeType:     mimeType,
+	}
+}
+
+// getArchiveFolderContents lists the members of a folder inside an archive.
+// Their paths continue the archive's path, e.g. "/a/foo.zip/inner/file.txt".
+func getArchiveFolderContents(archivePath string, dir string) ([]FileItem, error) {
+	entries, err := archive.ListDir(archivePath, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileItems []FileItem
+	for _, entry := range entries {
+		name := filepath.Base(filepath.FromSlash(entry.Name))
+		if isBlocked(name) {
+			continue
+		}
+
 		fileItems = append(fileItems, FileItem{
-			Name:         folder.name,
-			Path:         folder.path,
-			IsDirectory:  true,
-			IsApp:        false,
-			Size:         info.Size(),
-			ModifiedTime: info.ModTime().Format(time.RFC3339),
-			IconPath:     "",
+			Name:          name,
+			Path:          filepath.Join(archivePath, filepath.FromSlash(entry.Name)),
+			IsDirectory:   entry.IsDirectory,
+			Size:          entry.Size,
+			ModifiedTime:  entry.ModifiedTime,
+			Kind:          KindOf(name, entry.IsDirectory, false),
+			MimeType:      MimeTypeOf(name, entry.IsDirectory),
+			Permissions:   entry.Permissions,
+			IsSymlink:     entry.IsSymlink,
+			SymlinkTarget: entry.LinkTarget,
 		})
 	}
 
 	return fileItems, nil
 }
 
+// AttachTags fills in the Tags of each item from the database. Listings
+// still work without tags if the database is unavailable.
+func AttachTags(store database.TagStore, items []FileItem) {
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = item.Path
+	}
+
+	tagsByPath, err := store.GetTagsForPaths(paths)
+	if err != nil {
+		return
+	}
+
+	for i := range items {
+		items[i].Tags = tagsByPath[items[i].Path]
+	}
+}
+
+// AttachSyncStatus fills in the SyncStatus of items inside folders synced
+// with Google Drive
+func AttachSyncStatus(store database.Store, items []FileItem) {
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = item.Path
+	}
+
+	statuses := drivesync.Statuses(store, paths)
+	for i := range items {
+		items[i].SyncStatus = statuses[items[i].Path]
+	}
+}
+
 // ReadFileContent reads a file and returns its content as base64 for binary files
-// or as plain text for text files
-func ReadFileContent(filePath string) (string, error) {
+// or as plain text for text files. ctx cancels reading a member out of an
+// archive.
+func ReadFileContent(ctx context.Context, filePath string) (string, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return "", err
+		// Members of an archive are read straight out of it
+		archivePath, inner, ok := archive.SplitPath(filePath)
+		if !ok || inner == "" {
+			return "", err
+		}
+		if data, err = archive.ReadMember(ctx, archivePath, inner); err != nil {
+			return "", err
+		}
 	}
 
 	// For now, return everything as base64 to handle all file types
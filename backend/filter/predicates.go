@@ -0,0 +1,244 @@
+package filter
+
+import (
+	"Finder-2/backend"
+	"Finder-2/backend/database"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Predicate reports whether an item should be kept
+type Predicate func(item backend.FileItem) bool
+
+// Criteria describes which items to keep. Zero values mean "no constraint".
+type Criteria struct {
+	Kinds          []string `json:"kinds"`          // any of these FileItem.Kind values
+	Extensions     []string `json:"extensions"`     // any of these, with or without the leading dot
+	MinSize        int64    `json:"minSize"`        // bytes, inclusive
+	MaxSize        int64    `json:"maxSize"`        // bytes, inclusive
+	ModifiedAfter  string   `json:"modifiedAfter"`  // RFC3339, inclusive
+	ModifiedBefore string   `json:"modifiedBefore"` // RFC3339, exclusive
+	AddedAfter     string   `json:"addedAfter"`     // RFC3339, inclusive
+	AddedBefore    string   `json:"addedBefore"`    // RFC3339, exclusive
+	Tags           []string `json:"tags"`           // item must carry every one of these
+}
+
+// Query combines filtering and sorting into one request from the frontend
+type Query struct {
+	Filter Criteria    `json:"filter"`
+	Sort   SortOptions `json:"sort"`
+}
+
+// OfKind keeps items whose kind is one of kinds
+func OfKind(kinds ...string) Predicate {
+	set := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		set[kind] = true
+	}
+	return func(item backend.FileItem) bool {
+		return set[item.Kind]
+	}
+}
+
+// WithExtension keeps files whose extension is one of exts (case-insensitive)
+func WithExtension(exts ...string) Predicate {
+	set := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		set[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
+	return func(item backend.FileItem) bool {
+		if item.IsDirectory {
+			return false
+		}
+		return set[strings.ToLower(strings.TrimPrefix(filepath.Ext(item.Name), "."))]
+	}
+}
+
+// SizeBetween keeps items whose size lies in [min, max]. A zero bound is open.
+func SizeBetween(min, max int64) Predicate {
+	return func(item backend.FileItem) bool {
+		if min > 0 && item.Size < min {
+			return false
+		}
+		if max > 0 && item.Size > max {
+			return false
+		}
+		return true
+	}
+}
+
+// ModifiedBetween keeps items modified in [after, before). A zero bound is open.
+func ModifiedBetween(after, before time.Time) Predicate {
+	return func(item backend.FileItem) bool {
+		return inRange(parseTime(item.ModifiedTime), after, before)
+	}
+}
+
+// AddedBetween keeps items created in [after, before). A zero bound is open.
+func AddedBetween(after, before time.Time) Predicate {
+	return func(item backend.FileItem) bool {
+		added := parseTime(item.CreatedTime)
+		if added.IsZero() {
+			added = parseTime(item.ModifiedTime)
+		}
+		return inRange(added, after, before)
+	}
+}
+
+// HasTags keeps items carrying every one of tags (case-insensitive)
+func HasTags(tags ...string) Predicate {
+	return func(item backend.FileItem) bool {
+		for _, want := range tags {
+			found := false
+			for _, tag := range item.Tags {
+				if strings.EqualFold(tag, want) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Predicates converts the criteria into a list of predicates
+func (c Criteria) Predicates() ([]Predicate, error) {
+	var preds []Predicate
+
+	if len(c.Kinds) > 0 {
+		preds = append(preds, OfKind(c.Kinds...))
+	}
+	if len(c.Extensions) > 0 {
+		preds = append(preds, WithExtension(c.Extensions...))
+	}
+	if c.MinSize > 0 || c.MaxSize > 0 {
+		if c.MaxSize > 0 && c.MinSize > c.MaxSize {
+			return nil, fmt.Errorf("minimum size %d is larger than maximum size %d", c.MinSize, c.MaxSize)
+		}
+		preds = append(preds, SizeBetween(c.MinSize, c.MaxSize))
+	}
+
+	if c.ModifiedAfter != "" || c.ModifiedBefore != "" {
+		after, before, err := parseRange(c.ModifiedAfter, c.ModifiedBefore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modified date range: %w", err)
+		}
+		preds = append(preds, ModifiedBetween(after, before))
+	}
+	if c.AddedAfter != "" || c.AddedBefore != "" {
+		after, before, err := parseRange(c.AddedAfter, c.AddedBefore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid added date range: %w", err)
+		}
+		preds = append(preds, AddedBetween(after, before))
+	}
+
+	if len(c.Tags) > 0 {
+		preds = append(preds, HasTags(c.Tags...))
+	}
+
+	return preds, nil
+}
+
+// Where returns the items that satisfy every predicate
+func Where(items []backend.FileItem, preds ...Predicate) []backend.FileItem {
+	indexes := matching(items, preds)
+	kept := make([]backend.FileItem, len(indexes))
+	for i, idx := range indexes {
+		kept[i] = items[idx]
+	}
+	return kept
+}
+
+// FilterItems returns the items that match the criteria
+func FilterItems(items []backend.FileItem, criteria Criteria) ([]backend.FileItem, error) {
+	preds, err := criteria.Predicates()
+	if err != nil {
+		return nil, err
+	}
+	return Where(items, preds...), nil
+}
+
+// Apply filters and then sorts items according to the query. Tags are read
+// from store when the query filters by them.
+func Apply(store database.TagStore, items []backend.FileItem, query Query) ([]backend.FileItem, error) {
+	items, order, err := arrange(store, items, query)
+	if err != nil {
+		return nil, err
+	}
+
+	arranged := make([]backend.FileItem, len(order))
+	for i, idx := range order {
+		arranged[i] = items[idx]
+	}
+	return arranged, nil
+}
+
+// arrange returns the indexes of the items kept by the query, in sorted
+// order. When the query filters by tag, the items are returned with their
+// tags read from store, since callers may not have attached them.
+func arrange(store database.TagStore, items []backend.FileItem, query Query) ([]backend.FileItem, []int, error) {
+	preds, err := query.Filter.Predicates()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := query.Sort.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if len(query.Filter.Tags) > 0 {
+		tagged := make([]backend.FileItem, len(items))
+		copy(tagged, items)
+		backend.AttachTags(store, tagged)
+		items = tagged
+	}
+	return items, sortOrder(items, matching(items, preds), query.Sort), nil
+}
+
+func matching(items []backend.FileItem, preds []Predicate) []int {
+	var indexes []int
+	for i, item := range items {
+		keep := true
+		for _, pred := range preds {
+			if !pred(item) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func parseRange(afterValue, beforeValue string) (time.Time, time.Time, error) {
+	var after, before time.Time
+	var err error
+
+	if afterValue != "" {
+		if after, err = time.Parse(time.RFC3339, afterValue); err != nil {
+			return after, before, err
+		}
+	}
+	if beforeValue != "" {
+		if before, err = time.Parse(time.RFC3339, beforeValue); err != nil {
+			return after, before, err
+		}
+	}
+	return after, before, nil
+}
+
+func inRange(t, after, before time.Time) bool {
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+	if !before.IsZero() && !t.Before(before) {
+		return false
+	}
+	return true
+}
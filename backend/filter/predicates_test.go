@@ -0,0 +1,82 @@
+package filter
+
+import (
+	"testing"
+
+	"Finder-2/backend"
+	"Finder-2/backend/database"
+)
+
+func TestApplyReadsTagsFromDatabase(t *testing.T) {
+	store := database.NewMemoryStore()
+
+	if err := store.CreateTag("Work", "blue"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddFileTag("/home/u/report.pdf", "Work"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Items straight from the frontend carry no tags
+	items := []backend.FileItem{
+		{Name: "report.pdf", Path: "/home/u/report.pdf"},
+		{Name: "notes.txt", Path: "/home/u/notes.txt"},
+	}
+	kept, err := Apply(store, items, Query{Filter: Criteria{Tags: []string{"work"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 || kept[0].Path != "/home/u/report.pdf" {
+		t.Fatalf("kept %+v, want only report.pdf", kept)
+	}
+	if len(kept[0].Tags) != 1 || kept[0].Tags[0] != "Work" {
+		t.Errorf("tags = %v, want [Work]", kept[0].Tags)
+	}
+	if items[0].Tags != nil {
+		t.Errorf("Apply modified the caller's items")
+	}
+}
+
+func TestCriteriaPredicates(t *testing.T) {
+	items := []backend.FileItem{
+		{Name: "a.txt", Kind: backend.KindText, Size: 10, ModifiedTime: "2024-01-10T00:00:00Z"},
+		{Name: "b.PDF", Kind: backend.KindDocument, Size: 2000, ModifiedTime: "2024-03-01T00:00:00Z"},
+		{Name: "photos", IsDirectory: true, Kind: backend.KindFolder, ModifiedTime: "2024-02-01T00:00:00Z"},
+	}
+
+	tests := []struct {
+		name     string
+		criteria Criteria
+		want     []string
+	}{
+		{"no constraints", Criteria{}, []string{"a.txt", "b.PDF", "photos"}},
+		{"kind", Criteria{Kinds: []string{backend.KindFolder}}, []string{"photos"}},
+		{"extension ignores case and dot", Criteria{Extensions: []string{".pdf"}}, []string{"b.PDF"}},
+		{"size range", Criteria{MinSize: 100, MaxSize: 5000}, []string{"b.PDF"}},
+		{"modified range", Criteria{ModifiedAfter: "2024-01-15T00:00:00Z", ModifiedBefore: "2024-03-01T00:00:00Z"}, []string{"photos"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, err := FilterItems(items, tt.criteria)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, item := range kept {
+				names = append(names, item.Name)
+			}
+			if len(names) != len(tt.want) {
+				t.Fatalf("kept %v, want %v", names, tt.want)
+			}
+			for i := range names {
+				if names[i] != tt.want[i] {
+					t.Fatalf("kept %v, want %v", names, tt.want)
+				}
+			}
+		})
+	}
+
+	if _, err := FilterItems(items, Criteria{MinSize: 10, MaxSize: 5}); err == nil {
+		t.Error("expected an error for an inverted size range")
+	}
+}
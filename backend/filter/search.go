@@ -0,0 +1,27 @@
+package filter
+
+import (
+	"Finder-2/backend"
+	"Finder-2/backend/database"
+	"Finder-2/backend/search"
+)
+
+// ApplyToSearchResults filters and sorts search results by their file items
+func ApplyToSearchResults(store database.TagStore, results []search.SearchResult, query Query) ([]search.SearchResult, error) {
+	items := make([]backend.FileItem, len(results))
+	for i, result := range results {
+		items[i] = result.FileItem
+	}
+
+	items, order, err := arrange(store, items, query)
+	if err != nil {
+		return nil, err
+	}
+
+	arranged := make([]search.SearchResult, len(order))
+	for i, idx := range order {
+		arranged[i] = results[idx]
+		arranged[i].FileItem = items[idx]
+	}
+	return arranged, nil
+}
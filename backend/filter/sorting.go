@@ -2,48 +2,204 @@ package filter
 
 import (
 	"Finder-2/backend"
+	"fmt"
+	"path/filepath"
 	"sort"
 	"strings"
+	"time"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
 )
 
-func SortByName(items []backend.FileItem, ascending bool) []backend.FileItem {
-	sorted := make([]backend.FileItem, len(items))
-	copy(sorted, items)
+// Sort keys accepted in SortKey.Field
+const (
+	KeyName         = "name"
+	KeyKind         = "kind"
+	KeyExtension    = "extension"
+	KeyDateModified = "dateModified"
+	KeyDateAdded    = "dateAdded"
+	KeySize         = "size"
+)
 
-	sort.Slice(sorted, func(i, j int) bool {
-		if ascending {
-			return strings.ToLower(sorted[i].Name) < strings.ToLower(sorted[j].Name)
+// SortKey is a single field to order by
+type SortKey struct {
+	Field     string `json:"field"`
+	Ascending bool   `json:"ascending"`
+}
+
+// SortOptions describes a multi-key ordering. Keys are applied in order,
+// each one breaking ties left by the previous key.
+type SortOptions struct {
+	Keys         []SortKey `json:"keys"`
+	FoldersFirst bool      `json:"foldersFirst"`
+	Natural      bool      `json:"natural"` // "file2" sorts before "file10"
+	Locale       string    `json:"locale"`  // BCP 47 tag such as "en" or "sv"; empty uses the root collation
+}
+
+// Validate reports a sort key naming a field that isn't one of the Key
+// constants, which would otherwise be silently ignored
+func (o SortOptions) Validate() error {
+	for _, key := range o.Keys {
+		switch key.Field {
+		case KeyName, KeyKind, KeyExtension, KeyDateModified, KeyDateAdded, KeySize:
+		default:
+			return fmt.Errorf("unknown sort field: %q", key.Field)
 		}
-		return strings.ToLower(sorted[i].Name) > strings.ToLower(sorted[j].Name)
-	})
+	}
+	return nil
+}
 
-	return sorted
+// sortEntry caches the parsed values compared while sorting
+type sortEntry struct {
+	index    int
+	item     backend.FileItem
+	ext      string
+	modified time.Time
+	added    time.Time
+}
+
+func SortByName(items []backend.FileItem, ascending bool) []backend.FileItem {
+	return Sort(items, SortOptions{
+		Keys:    []SortKey{{Field: KeyName, Ascending: ascending}},
+		Natural: true,
+	})
 }
 
 func SortByDate(items []backend.FileItem, ascending bool) []backend.FileItem {
-	sorted := make([]backend.FileItem, len(items))
-	copy(sorted, items)
+	return Sort(items, SortOptions{
+		Keys:    []SortKey{{Field: KeyDateModified, Ascending: ascending}},
+		Natural: true,
+	})
+}
 
-	sort.Slice(sorted, func(i, j int) bool {
-		if ascending {
-			return sorted[i].ModifiedTime < sorted[j].ModifiedTime
-		}
-		return sorted[i].ModifiedTime > sorted[j].ModifiedTime
+func SortBySize(items []backend.FileItem, ascending bool) []backend.FileItem {
+	return Sort(items, SortOptions{
+		Keys:    []SortKey{{Field: KeySize, Ascending: ascending}},
+		Natural: true,
 	})
+}
 
+// Sort returns a sorted copy of items according to opts
+func Sort(items []backend.FileItem, opts SortOptions) []backend.FileItem {
+	order := sortOrder(items, allIndexes(len(items)), opts)
+
+	sorted := make([]backend.FileItem, len(order))
+	for i, idx := range order {
+		sorted[i] = items[idx]
+	}
 	return sorted
 }
 
-func SortBySize(items []backend.FileItem, ascending bool) []backend.FileItem {
-	sorted := make([]backend.FileItem, len(items))
-	copy(sorted, items)
+// sortOrder sorts the given indexes into items and returns them
+func sortOrder(items []backend.FileItem, indexes []int, opts SortOptions) []int {
+	entries := make([]sortEntry, len(indexes))
+	for i, idx := range indexes {
+		item := items[idx]
+		entries[i] = sortEntry{
+			index:    idx,
+			item:     item,
+			ext:      strings.ToLower(strings.TrimPrefix(filepath.Ext(item.Name), ".")),
+			modified: parseTime(item.ModifiedTime),
+			added:    parseTime(item.CreatedTime),
+		}
+		if entries[i].added.IsZero() {
+			entries[i].added = entries[i].modified
+		}
+	}
+
+	keys := opts.Keys
+	if len(keys) == 0 {
+		keys = []SortKey{{Field: KeyName, Ascending: true}}
+	}
+	coll := newCollator(opts)
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := &entries[i], &entries[j]
+
+		if opts.FoldersFirst && a.item.IsDirectory != b.item.IsDirectory {
+			return a.item.IsDirectory
+		}
+
+		for _, key := range keys {
+			c := compareKey(coll, key.Field, a, b)
+			if c == 0 {
+				continue
+			}
+			if key.Ascending {
+				return c < 0
+			}
+			return c > 0
+		}
 
-	sort.Slice(sorted, func(i, j int) bool {
-		if ascending {
-			return sorted[i].Size < sorted[j].Size
+		// Fall back to name then path so the order is deterministic
+		if c := coll.CompareString(a.item.Name, b.item.Name); c != 0 {
+			return c < 0
 		}
-		return sorted[i].Size > sorted[j].Size
+		return a.item.Path < b.item.Path
 	})
 
-	return sorted
+	order := make([]int, len(entries))
+	for i, e := range entries {
+		order[i] = e.index
+	}
+	return order
+}
+
+// compareKey compares a and b on a single field, returning -1, 0 or 1
+func compareKey(coll *collate.Collator, field string, a, b *sortEntry) int {
+	switch field {
+	case KeyName:
+		return coll.CompareString(a.item.Name, b.item.Name)
+	case KeyKind:
+		return strings.Compare(a.item.Kind, b.item.Kind)
+	case KeyExtension:
+		return coll.CompareString(a.ext, b.ext)
+	case KeyDateModified:
+		return a.modified.Compare(b.modified)
+	case KeyDateAdded:
+		return a.added.Compare(b.added)
+	case KeySize:
+		switch {
+		case a.item.Size < b.item.Size:
+			return -1
+		case a.item.Size > b.item.Size:
+			return 1
+		}
+	}
+	return 0
+}
+
+// newCollator builds a case-insensitive collator for the requested locale.
+// Collators aren't safe for concurrent use, so one is made per sort.
+func newCollator(opts SortOptions) *collate.Collator {
+	tag := language.Und
+	if opts.Locale != "" {
+		if parsed, err := language.Parse(opts.Locale); err == nil {
+			tag = parsed
+		}
+	}
+
+	collOpts := []collate.Option{collate.IgnoreCase}
+	if opts.Natural {
+		collOpts = append(collOpts, collate.Numeric)
+	}
+	return collate.New(tag, collOpts...)
+}
+
+// parseTime parses an RFC3339 timestamp, returning the zero time if it's invalid
+func parseTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func allIndexes(n int) []int {
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return indexes
 }
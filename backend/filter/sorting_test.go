@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"testing"
+
+	"Finder-2/backend"
+	"Finder-2/backend/database"
+)
+
+func names(items []backend.FileItem) []string {
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = item.Name
+	}
+	return out
+}
+
+func sameOrder(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSort(t *testing.T) {
+	items := []backend.FileItem{
+		{Name: "file10.txt", Path: "/a/file10.txt", Size: 30, ModifiedTime: "2024-03-01T00:00:00Z", Kind: "Text"},
+		{Name: "File2.txt", Path: "/a/File2.txt", Size: 10, ModifiedTime: "2024-01-01T00:00:00Z", Kind: "Text"},
+		{Name: "photos", Path: "/a/photos", IsDirectory: true, ModifiedTime: "2024-02-01T00:00:00Z", Kind: "Folder"},
+		{Name: "apple.png", Path: "/a/apple.png", Size: 10, ModifiedTime: "2024-04-01T00:00:00Z", Kind: "Image"},
+		{Name: "Zebra", Path: "/a/Zebra", IsDirectory: true, ModifiedTime: "2024-05-01T00:00:00Z", Kind: "Folder"},
+	}
+
+	tests := []struct {
+		name string
+		opts SortOptions
+		want []string
+	}{
+		{
+			"natural and case-insensitive",
+			SortOptions{Keys: []SortKey{{Field: KeyName, Ascending: true}}, Natural: true},
+			[]string{"apple.png", "File2.txt", "file10.txt", "photos", "Zebra"},
+		},
+		{
+			"plain order puts 10 before 2",
+			SortOptions{Keys: []SortKey{{Field: KeyName, Ascending: true}}},
+			[]string{"apple.png", "file10.txt", "File2.txt", "photos", "Zebra"},
+		},
+		{
+			"folders first",
+			SortOptions{Keys: []SortKey{{Field: KeyName, Ascending: false}}, FoldersFirst: true, Natural: true},
+			[]string{"Zebra", "photos", "file10.txt", "File2.txt", "apple.png"},
+		},
+		{
+			"secondary key breaks ties",
+			SortOptions{Keys: []SortKey{{Field: KeySize, Ascending: true}, {Field: KeyDateModified, Ascending: false}}},
+			[]string{"Zebra", "photos", "apple.png", "File2.txt", "file10.txt"},
+		},
+		{
+			"date descending",
+			SortOptions{Keys: []SortKey{{Field: KeyDateModified, Ascending: false}}},
+			[]string{"Zebra", "apple.png", "file10.txt", "photos", "File2.txt"},
+		},
+		{
+			"kind then name",
+			SortOptions{Keys: []SortKey{{Field: KeyKind, Ascending: true}, {Field: KeyName, Ascending: true}}, Natural: true},
+			[]string{"photos", "Zebra", "apple.png", "File2.txt", "file10.txt"},
+		},
+	}
+	for _, tt := range tests {
+		if got := names(Sort(items, tt.opts)); !sameOrder(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyRejectsUnknownSortField(t *testing.T) {
+	store := database.NewMemoryStore()
+	items := []backend.FileItem{{Name: "a", Path: "/a"}}
+	_, err := Apply(store, items, Query{Sort: SortOptions{Keys: []SortKey{{Field: "colour", Ascending: true}}}})
+	if err == nil {
+		t.Error("sorting by an unknown field succeeded, want an error")
+	}
+	if _, err := Apply(store, items, Query{Sort: SortOptions{Keys: []SortKey{{Field: KeySize}}}}); err != nil {
+		t.Errorf("sorting by size: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package foldersize
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/logging"
+)
+
+var logger = logging.For("foldersize")
+
+// Size is the recursive size of a folder
+type Size struct {
+	Path         string `json:"path"`
+	ApparentSize int64  `json:"apparentSize"` // sum of file lengths
+	DiskSize     int64  `json:"diskSize"`     // bytes actually allocated on disk
+	FileCount    int64  `json:"fileCount"`
+	DirCount     int64  `json:"dirCount"`
+	Cached       bool   `json:"cached"`
+	Complete     bool   `json:"complete"` // false if some entries couldn't be read
+}
+
+// Cached sizes are trusted while the folder's mtime is unchanged, but only
+// for this long since changes deep in the tree don't touch the top mtime
+const cacheTTL = 24 * time.Hour
+
+// fileKey identifies a file across hardlinks
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+// walker accumulates totals while directories are read in parallel
+type walker struct {
+	ctx  context.Context
+	sem  chan struct{}
+	wg   sync.WaitGroup
+	seen sync.Map // fileKey -> struct{}, for files with more than one link
+
+	apparent   atomic.Int64
+	disk       atomic.Int64
+	files      atomic.Int64
+	dirs       atomic.Int64
+	incomplete atomic.Bool
+}
+
+// Calculate returns the recursive size of a folder, using the cache in store
+// when the folder hasn't changed since it was last measured
+func Calculate(ctx context.Context, store database.FolderSizeStore, path string) (*Size, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", path)
+	}
+
+	if cached := lookupCache(store, path, info); cached != nil {
+		return cached, nil
+	}
+
+	size, err := walk(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	storeCache(store, size, info)
+	return size, nil
+}
+
+// CalculateAll measures each folder and reports results as they become
+// available: cached sizes first, then freshly computed ones. It stops early
+// when ctx is cancelled.
+func CalculateAll(ctx context.Context, store database.FolderSizeStore, paths []string, onResult func(Size)) {
+	var pending []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if cached := lookupCache(store, path, info); cached != nil {
+			onResult(*cached)
+			continue
+		}
+		pending = append(pending, path)
+	}
+
+	for _, path := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		size, err := Calculate(ctx, store, path)
+		if err != nil {
+			continue
+		}
+		onResult(*size)
+	}
+}
+
+// Invalidate forgets the cached sizes a change to path makes stale: those of
+// path and every folder beneath it, and those of the folders above it, whose
+// totals include it. File operations call it for each path they add, remove
+// or move, since a change deep in a tree doesn't touch the top folder's mtime.
+func Invalidate(store database.FolderSizeStore, paths ...string) {
+	var above []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if err := store.DeleteFolderSize(path); err != nil {
+			logger.Warn("failed to invalidate folder size", "path", path, "error", err)
+		}
+		for dir := filepath.Dir(path); !seen[dir]; dir = filepath.Dir(dir) {
+			seen[dir] = true
+			above = append(above, dir)
+		}
+	}
+	if err := store.DeleteFolderSizesAt(above); err != nil {
+		logger.Warn("failed to invalidate folder sizes", "error", err)
+	}
+}
+
+func walk(ctx context.Context, root string) (*Size, error) {
+	w := &walker{
+		ctx: ctx,
+		sem: make(chan struct{}, runtime.NumCPU()*2),
+	}
+
+	w.walkDir(root)
+	w.wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Size{
+		Path:         root,
+		ApparentSize: w.apparent.Load(),
+		DiskSize:     w.disk.Load(),
+		FileCount:    w.files.Load(),
+		DirCount:     w.dirs.Load(),
+		Complete:     !w.incomplete.Load(),
+	}, nil
+}
+
+func (w *walker) walkDir(dir string) {
+	if w.ctx.Err() != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.incomplete.Store(true)
+		return
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dir, entry.Name())
+
+		// Info is an lstat, so symlinks are counted as links and never followed
+		info, err := entry.Info()
+		if err != nil {
+			w.incomplete.Store(true)
+			continue
+		}
+
+		if !entry.IsDir() {
+			w.addFile(info)
+			continue
+		}
+
+		_, _, allocated, _ := inodeOf(info)
+		w.disk.Add(allocated)
+		w.dirs.Add(1)
+
+		// Hand the subfolder to another goroutine if one is free, otherwise
+		// walk it on this one
+		select {
+		case w.sem <- struct{}{}:
+			w.wg.Add(1)
+			go func() {
+				defer w.wg.Done()
+				defer func() { <-w.sem }()
+				w.walkDir(entryPath)
+			}()
+		default:
+			w.walkDir(entryPath)
+		}
+	}
+}
+
+func (w *walker) addFile(info os.FileInfo) {
+	key, links, allocated, ok := inodeOf(info)
+	if ok && links > 1 {
+		if _, dup := w.seen.LoadOrStore(key, struct{}{}); dup {
+			return
+		}
+	}
+
+	w.files.Add(1)
+	w.apparent.Add(info.Size())
+	w.disk.Add(allocated)
+}
+
+func lookupCache(store database.FolderSizeStore, path string, info os.FileInfo) *Size {
+	cached, err := store.GetFolderSize(path)
+	if err != nil || cached == nil {
+		return nil
+	}
+	if cached.ModTime != info.ModTime().UnixNano() || time.Since(cached.ComputedAt) > cacheTTL {
+		return nil
+	}
+
+	return &Size{
+		Path:         cached.Path,
+		ApparentSize: cached.ApparentSize,
+		DiskSize:     cached.DiskSize,
+		FileCount:    cached.FileCount,
+		DirCount:     cached.DirCount,
+		Cached:       true,
+		Complete:     true,
+	}
+}
+
+func storeCache(store database.FolderSizeStore, size *Size, info os.FileInfo) {
+	// Partial results would be served as if they were accurate
+	if !size.Complete {
+		return
+	}
+
+	err := store.SaveFolderSize(database.FolderSize{
+		Path:         size.Path,
+		ModTime:      info.ModTime().UnixNano(),
+		ApparentSize: size.ApparentSize,
+		DiskSize:     size.DiskSize,
+		FileCount:    size.FileCount,
+		DirCount:     size.DirCount,
+		ComputedAt:   time.Now(),
+	})
+	if err != nil {
+		logger.Warn("failed to save folder size", "path", size.Path, "error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package foldersize
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Finder-2/backend/database"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	store := database.NewMemoryStore()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 100)
+	writeFile(t, filepath.Join(root, "sub", "b"), 50)
+	if err := os.Link(filepath.Join(root, "a"), filepath.Join(root, "sub", "a-link")); err != nil {
+		t.Skip("hardlinks not supported:", err)
+	}
+
+	size, err := Calculate(context.Background(), store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size.ApparentSize != 150 || size.FileCount != 2 || size.DirCount != 1 {
+		t.Errorf("got %+v, want 150 bytes in 2 files and 1 folder", size)
+	}
+
+	cached, err := Calculate(context.Background(), store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached.Cached || cached.ApparentSize != 150 {
+		t.Errorf("second call got %+v, want the cached size", cached)
+	}
+}
+
+func TestInvalidateForgetsAncestorsOfNestedChanges(t *testing.T) {
+	store := database.NewMemoryStore()
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	sibling := filepath.Join(root, "c")
+	writeFile(t, filepath.Join(nested, "file"), 10)
+	writeFile(t, filepath.Join(sibling, "file"), 10)
+
+	for _, dir := range []string{root, filepath.Join(root, "a"), nested, sibling} {
+		if _, err := Calculate(context.Background(), store, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A change deep in the tree leaves the top folder's mtime alone
+	changed := filepath.Join(nested, "file")
+	writeFile(t, changed, 500)
+	Invalidate(store, changed)
+
+	for _, dir := range []string{root, filepath.Join(root, "a"), nested} {
+		if cached, _ := store.GetFolderSize(dir); cached != nil {
+			t.Errorf("%s is still cached", dir)
+		}
+	}
+	if cached, _ := store.GetFolderSize(sibling); cached == nil {
+		t.Errorf("unrelated folder %s was invalidated", sibling)
+	}
+
+	size, err := Calculate(context.Background(), store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size.Cached || size.ApparentSize != 510 {
+		t.Errorf("got %+v, want a fresh size of 510 bytes", size)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build darwin || linux
+
+package foldersize
+
+import (
+	"os"
+	"syscall"
+)
+
+// inodeOf returns the identity, link count and allocated bytes for a file
+func inodeOf(info os.FileInfo) (fileKey, uint64, int64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, 1, info.Size(), false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: st.Ino}, uint64(st.Nlink), st.Blocks * 512, true
+}
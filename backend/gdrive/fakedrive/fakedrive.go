@@ -0,0 +1,674 @@
+// Package fakedrive is an in-memory stand-in for the parts of the Drive v3
+// API the app uses, so uploads, downloads, folder operations and syncing
+// can be exercised without a Google account:
+//
+//	server := fakedrive.New()
+//	defer server.Close()
+//	gdrive.UseEndpoint(server.Client(), server.Endpoint())
+package fakedrive
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// RootID is the real ID of the fake My Drive, which "root" aliases
+const RootID = "fake-root"
+
+const folderMimeType = "application/vnd.google-apps.folder"
+
+type file struct {
+	meta    drive.File
+	content []byte
+}
+
+// upload is a resumable upload in progress
+type upload struct {
+	meta     drive.File
+	updateID string // file whose content is being replaced, or "" for a new file
+	data     []byte
+}
+
+// Server serves the fake API over HTTP on a local port
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	files   map[string]*file
+	uploads map[string]*upload // resumable sessions, by session ID
+	changes []string           // IDs of changed files, oldest first; a page token is an index
+	nextID  int
+
+	failChunks int           // upload chunks still to refuse, see FailChunks
+	failStatus int           // the status they're refused with
+	failGets   int           // downloads still to refuse, see FailDownloads
+	getStatus  int           // the status they're refused with
+	hold       chan struct{} // closed to release held chunks, see HoldChunks
+	chunks     int           // upload chunks accepted
+}
+
+// New starts a server holding an empty My Drive
+func New() *Server {
+	s := &Server{
+		files:   make(map[string]*file),
+		uploads: make(map[string]*upload),
+	}
+	s.files[RootID] = &file{meta: drive.File{Id: RootID, Name: "My Drive", MimeType: folderMimeType}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/drive/v3/files", s.handleFiles)
+	mux.HandleFunc("/drive/v3/files/", s.handleFile)
+	mux.HandleFunc("/drive/v3/changes/startPageToken", s.handleStartPageToken)
+	mux.HandleFunc("/drive/v3/changes", s.handleChanges)
+	mux.HandleFunc("/upload/drive/v3/files", s.handleUpload)
+	mux.HandleFunc("/upload/drive/v3/files/", s.handleUpload)
+	mux.HandleFunc("/upload/session/", s.handleSession)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Endpoint is the base URL to pass to gdrive.UseEndpoint
+func (s *Server) Endpoint() string {
+	return s.URL + "/drive/v3/"
+}
+
+// Add puts a file in a folder ("root" for My Drive) and returns its ID.
+// Use the folder mime type and nil content for a folder.
+func (s *Server) Add(parentID string, name string, mimeType string, content []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(drive.File{Name: name, MimeType: mimeType, Parents: []string{parentID}}, content).Id
+}
+
+// SetContent replaces a file's bytes, as an edit made elsewhere would
+func (s *Server) SetContent(id string, content []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[s.resolve(id)]
+	if !ok {
+		return false
+	}
+	s.setContent(f, content)
+	s.touch(f)
+	return true
+}
+
+// Trash moves a file to the trash, as a deletion made elsewhere would
+func (s *Server) Trash(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[s.resolve(id)]
+	if !ok {
+		return false
+	}
+	f.meta.Trashed = true
+	s.touch(f)
+	return true
+}
+
+// FailChunks makes the next n chunks of resumable uploads fail with status,
+// as an overloaded server or a dropped connection would. Clients are
+// expected to send them again.
+func (s *Server) FailChunks(n int, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failChunks = n
+	s.failStatus = status
+}
+
+// FailDownloads makes the next n downloads of file content fail with
+// status, so a client's handling of a download that never arrives can be
+// tested
+func (s *Server) FailDownloads(n int, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failGets = n
+	s.getStatus = status
+}
+
+// HoldChunks makes chunks of resumable uploads wait until release is
+// called, or the client gives up, so an upload can be caught while it's
+// running
+func (s *Server) HoldChunks() (release func()) {
+	hold := make(chan struct{})
+	s.mu.Lock()
+	s.hold = hold
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			if s.hold == hold {
+				s.hold = nil
+			}
+			s.mu.Unlock()
+			close(hold)
+		})
+	}
+}
+
+// Chunks returns how many chunks of resumable uploads have been accepted
+func (s *Server) Chunks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chunks
+}
+
+// Uploading returns how many resumable uploads are in progress
+func (s *Server) Uploading() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+// Content returns a file's bytes
+func (s *Server) Content(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[s.resolve(id)]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), f.content...), true
+}
+
+// Children returns the untrashed files in a folder, sorted by name
+func (s *Server) Children(parentID string) []drive.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.children(s.resolve(parentID))
+}
+
+func (s *Server) children(parentID string) []drive.File {
+	var list []drive.File
+	for _, f := range s.files {
+		if !f.meta.Trashed && contains(f.meta.Parents, parentID) {
+			list = append(list, f.meta)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (s *Server) resolve(id string) string {
+	if id == "root" {
+		return RootID
+	}
+	return id
+}
+
+// create stores a new file; the caller holds the lock
+func (s *Server) create(meta drive.File, content []byte) *drive.File {
+	s.nextID++
+	meta.Id = fmt.Sprintf("fake-%d", s.nextID)
+	if meta.MimeType == "" {
+		meta.MimeType = "application/octet-stream"
+	}
+	parents := make([]string, len(meta.Parents))
+	for i, p := range meta.Parents {
+		parents[i] = s.resolve(p)
+	}
+	if len(parents) == 0 {
+		parents = []string{RootID}
+	}
+	meta.Parents = parents
+	now := time.Now().UTC().Format(time.RFC3339)
+	meta.CreatedTime, meta.ModifiedTime = now, now
+	meta.WebViewLink = "https://drive.google.com/file/d/" + meta.Id + "/view"
+
+	f := &file{meta: meta}
+	s.setContent(f, content)
+	s.files[meta.Id] = f
+	s.touch(f)
+	created := f.meta
+	return &created
+}
+
+// setContent stores a file's bytes, with the size and checksum Drive
+// reports for files that aren't Google Docs
+func (s *Server) setContent(f *file, content []byte) {
+	f.content = content
+	if strings.HasPrefix(f.meta.MimeType, "application/vnd.google-apps.") {
+		return
+	}
+	sum := md5.Sum(content)
+	f.meta.Md5Checksum = hex.EncodeToString(sum[:])
+	f.meta.Size = int64(len(content))
+}
+
+// touch records a change to a file in the changes feed
+func (s *Server) touch(f *file) {
+	f.meta.Version++
+	f.meta.ModifiedTime = time.Now().UTC().Format(time.RFC3339Nano)
+	s.changes = append(s.changes, f.meta.Id)
+}
+
+// handleFiles serves files.list and metadata-only files.create
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		s.list(w, r)
+	case http.MethodPost:
+		var meta drive.File
+		if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, s.create(meta, nil))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method)
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	match, err := parseQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var matched []*drive.File
+	for _, f := range s.files {
+		meta := f.meta
+		if f.meta.Id != RootID && match(&meta, s.resolve) {
+			matched = append(matched, &meta)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		iFolder, jFolder := matched[i].MimeType == folderMimeType, matched[j].MimeType == folderMimeType
+		if iFolder != jFolder {
+			return iFolder
+		}
+		return matched[i].Name < matched[j].Name
+	})
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	size, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if size <= 0 {
+		size = 100
+	}
+	if start > len(matched) {
+		start = len(matched)
+	}
+	end := min(start+size, len(matched))
+
+	list := &drive.FileList{Files: matched[start:end]}
+	if end < len(matched) {
+		list.NextPageToken = strconv.Itoa(end)
+	}
+	writeJSON(w, list)
+}
+
+// handleFile serves files.get, files.update, files.copy and files.export
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rest := strings.TrimPrefix(r.URL.Path, "/drive/v3/files/")
+	id, action, _ := strings.Cut(rest, "/")
+	f, ok := s.files[s.resolve(id)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "File not found: "+id)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && action == "" && r.URL.Query().Get("alt") == "media":
+		if strings.HasPrefix(f.meta.MimeType, "application/vnd.google-apps.") {
+			writeError(w, http.StatusForbidden, "Only files with binary content can be downloaded. Use Export with Docs Editors files.")
+			return
+		}
+		if s.failGets > 0 {
+			s.failGets--
+			writeError(w, s.getStatus, "download refused by FailDownloads")
+			return
+		}
+		w.Header().Set("Content-Type", f.meta.MimeType)
+		w.Write(f.content)
+	case r.Method == http.MethodGet && action == "":
+		writeJSON(w, &f.meta)
+	case r.Method == http.MethodGet && action == "export":
+		if !strings.HasPrefix(f.meta.MimeType, "application/vnd.google-apps.") {
+			writeError(w, http.StatusForbidden, "Export only supports Docs Editors files.")
+			return
+		}
+		w.Header().Set("Content-Type", r.URL.Query().Get("mimeType"))
+		w.Write(f.content)
+	case r.Method == http.MethodPatch && action == "":
+		s.update(w, r, f)
+	case r.Method == http.MethodPost && action == "copy":
+		var meta drive.File
+		if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if meta.Name == "" {
+			meta.Name = "Copy of " + f.meta.Name
+		}
+		meta.MimeType = f.meta.MimeType
+		if len(meta.Parents) == 0 {
+			meta.Parents = f.meta.Parents
+		}
+		writeJSON(w, s.create(meta, append([]byte(nil), f.content...)))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" "+r.URL.Path)
+	}
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request, f *file) {
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if raw, ok := patch["name"]; ok {
+		json.Unmarshal(raw, &f.meta.Name)
+	}
+	if raw, ok := patch["trashed"]; ok {
+		json.Unmarshal(raw, &f.meta.Trashed)
+	}
+
+	query := r.URL.Query()
+	if remove := query.Get("removeParents"); remove != "" {
+		var kept []string
+		for _, p := range f.meta.Parents {
+			if !contains(strings.Split(remove, ","), p) {
+				kept = append(kept, p)
+			}
+		}
+		f.meta.Parents = kept
+	}
+	if add := query.Get("addParents"); add != "" {
+		for _, p := range strings.Split(add, ",") {
+			f.meta.Parents = append(f.meta.Parents, s.resolve(p))
+		}
+	}
+	s.touch(f)
+	writeJSON(w, &f.meta)
+}
+
+// handleStartPageToken serves changes.getStartPageToken
+func (s *Server) handleStartPageToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, &drive.StartPageToken{StartPageToken: strconv.Itoa(len(s.changes))})
+}
+
+// handleChanges serves changes.list. Each change carries the file as it is
+// now, like Drive's.
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start, err := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	if err != nil || start < 0 || start > len(s.changes) {
+		writeError(w, http.StatusBadRequest, "Invalid pageToken")
+		return
+	}
+	size, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if size <= 0 {
+		size = 100
+	}
+	end := min(start+size, len(s.changes))
+
+	list := &drive.ChangeList{}
+	for _, id := range s.changes[start:end] {
+		meta := s.files[id].meta
+		list.Changes = append(list.Changes, &drive.Change{
+			ChangeType: "file",
+			FileId:     id,
+			File:       &meta,
+			Time:       meta.ModifiedTime,
+		})
+	}
+	if end < len(s.changes) {
+		list.NextPageToken = strconv.Itoa(end)
+	} else {
+		list.NewStartPageToken = strconv.Itoa(end)
+	}
+	writeJSON(w, list)
+}
+
+// handleUpload serves files.create and files.update with media, as a
+// single multipart request or by starting a resumable session
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	updateID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/upload/drive/v3/files"), "/")
+	if (updateID == "" && r.Method != http.MethodPost) || (updateID != "" && r.Method != http.MethodPatch) {
+		writeError(w, http.StatusMethodNotAllowed, r.Method)
+		return
+	}
+
+	switch r.URL.Query().Get("uploadType") {
+	case "multipart":
+		meta, content, err := readMultipart(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.finishUpload(w, &upload{meta: *meta, updateID: updateID, data: content})
+	case "resumable":
+		var meta drive.File
+		if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if meta.MimeType == "" {
+			meta.MimeType = r.Header.Get("X-Upload-Content-Type")
+		}
+		s.mu.Lock()
+		s.nextID++
+		session := strconv.Itoa(s.nextID)
+		s.uploads[session] = &upload{meta: meta, updateID: updateID}
+		s.mu.Unlock()
+		w.Header().Set("Location", s.URL+"/upload/session/"+session)
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported uploadType")
+	}
+}
+
+// handleSession receives the chunks of a resumable upload. Content-Range
+// ends in "/*" until the last chunk, which carries the total size.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	session := strings.TrimPrefix(r.URL.Path, "/upload/session/")
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	hold := s.hold
+	s.mu.Unlock()
+	if hold != nil {
+		select {
+		case <-hold:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.uploads[session]
+	if !ok {
+		writeError(w, http.StatusNotFound, "upload session not found")
+		return
+	}
+	if s.failChunks > 0 {
+		s.failChunks--
+		writeError(w, s.failStatus, "injected failure")
+		return
+	}
+	s.chunks++
+	u.data = append(u.data, data...)
+
+	if strings.HasSuffix(r.Header.Get("Content-Range"), "/*") {
+		w.Header().Set("X-Http-Status-Code-Override", "308")
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(u.data)-1))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	delete(s.uploads, session)
+	s.finishUpload(w, u)
+}
+
+// finishUpload creates the uploaded file, or replaces the content of the
+// one being updated; the caller holds the lock
+func (s *Server) finishUpload(w http.ResponseWriter, u *upload) {
+	if u.updateID == "" {
+		writeJSON(w, s.create(u.meta, u.data))
+		return
+	}
+
+	f, ok := s.files[s.resolve(u.updateID)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "File not found: "+u.updateID)
+		return
+	}
+	if u.meta.Name != "" {
+		f.meta.Name = u.meta.Name
+	}
+	s.setContent(f, u.data)
+	s.touch(f)
+	writeJSON(w, &f.meta)
+}
+
+func readMultipart(r *http.Request) (*drive.File, []byte, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := multipart.NewReader(r.Body, params["boundary"])
+
+	part, err := reader.NextPart()
+	if err != nil {
+		return nil, nil, err
+	}
+	var meta drive.File
+	if err := json.NewDecoder(part).Decode(&meta); err != nil {
+		return nil, nil, err
+	}
+
+	part, err = reader.NextPart()
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := io.ReadAll(part)
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta.MimeType == "" {
+		meta.MimeType = part.Header.Get("Content-Type")
+	}
+	return &meta, content, nil
+}
+
+// parseQuery understands the clauses gdrive sends, joined by "and":
+// "'id' in parents", "name = '...'", "mimeType = '...'" and
+// "trashed = true|false"
+func parseQuery(q string) (func(*drive.File, func(string) string) bool, error) {
+	var tests []func(*drive.File, func(string) string) bool
+	for _, clause := range splitAnd(q) {
+		switch {
+		case strings.HasSuffix(clause, " in parents"):
+			id := unquote(strings.TrimSuffix(clause, " in parents"))
+			tests = append(tests, func(f *drive.File, resolve func(string) string) bool {
+				return contains(f.Parents, resolve(id))
+			})
+		case strings.HasPrefix(clause, "name = "):
+			name := unquote(strings.TrimPrefix(clause, "name = "))
+			tests = append(tests, func(f *drive.File, _ func(string) string) bool { return f.Name == name })
+		case strings.HasPrefix(clause, "mimeType = "):
+			mimeType := unquote(strings.TrimPrefix(clause, "mimeType = "))
+			tests = append(tests, func(f *drive.File, _ func(string) string) bool { return f.MimeType == mimeType })
+		case clause == "trashed = false" || clause == "trashed = true":
+			trashed := clause == "trashed = true"
+			tests = append(tests, func(f *drive.File, _ func(string) string) bool { return f.Trashed == trashed })
+		default:
+			return nil, fmt.Errorf("unsupported query: %s", clause)
+		}
+	}
+
+	return func(f *drive.File, resolve func(string) string) bool {
+		for _, test := range tests {
+			if !test(f, resolve) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// splitAnd splits a query on " and " outside quotes
+func splitAnd(q string) []string {
+	var clauses []string
+	inQuote, start := false, 0
+	for i := 0; i < len(q); i++ {
+		switch {
+		case q[i] == '\\':
+			i++
+		case q[i] == '\'':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(q[i:], " and "):
+			clauses = append(clauses, strings.TrimSpace(q[start:i]))
+			start = i + len(" and ")
+			i = start - 1
+		}
+	}
+	if rest := strings.TrimSpace(q[start:]); rest != "" {
+		clauses = append(clauses, rest)
+	}
+	return clauses
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "'"), "'")
+	return strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(s)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError replies in the shape googleapi.CheckResponse parses
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"code": status, "message": message},
+	})
+}
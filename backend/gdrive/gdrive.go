@@ -0,0 +1,460 @@
+package gdrive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/connections"
+	"Finder-2/backend/logging"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+var logger = logging.For("gdrive")
+
+// Scheme prefixes Drive paths. Drive allows several files with the same
+// name in a folder, so paths are IDs: "gdrive://" is My Drive and
+// "gdrive://<id>" any file or folder in it.
+const Scheme = "gdrive://"
+
+// rootID is Drive's alias for the top of My Drive
+const rootID = "root"
+
+// FolderMimeType is the mime type Drive gives folders
+const FolderMimeType = "application/vnd.google-apps.folder"
+
+// Fields fetched for every file
+const fileFields = "id, name, mimeType, size, modifiedTime, createdTime, parents, webViewLink, trashed"
+
+// pageSize is the largest page Drive returns
+const pageSize = 1000
+
+// File is a Drive file or folder
+type File struct {
+	ID           string    `json:"id"`
+	Path         string    `json:"path"`
+	Name         string    `json:"name"`
+	MimeType     string    `json:"mimeType"`
+	IsFolder     bool      `json:"isFolder"`
+	Size         int64     `json:"size"` // zero for Google Docs and other native files
+	ModifiedTime time.Time `json:"modifiedTime"`
+	CreatedTime  time.Time `json:"createdTime"`
+	Parents      []string  `json:"parents"`
+	WebLink      string    `json:"webLink"`
+}
+
+// IsPath reports whether path is inside Drive
+func IsPath(path string) bool {
+	return strings.HasPrefix(path, Scheme)
+}
+
+// PathFor returns the path of a Drive file ID
+func PathFor(id string) string {
+	if id == rootID {
+		return Scheme
+	}
+	return Scheme + id
+}
+
+// IDOf returns the Drive file ID a path refers to
+func IDOf(path string) (string, error) {
+	if !IsPath(path) {
+		return "", apperror.New(apperror.CodeInvalid, "%s is not a Google Drive path", path)
+	}
+	id := strings.Trim(strings.TrimPrefix(path, Scheme), "/")
+	if id == "" {
+		return rootID, nil
+	}
+	if strings.ContainsAny(id, "/'\\") {
+		return "", apperror.New(apperror.CodeInvalid, "%s is not a Google Drive path", path)
+	}
+	return id, nil
+}
+
+var (
+	// Set by UseEndpoint to talk to something other than Google, such as a
+	// fake Drive server
+	testClient   *http.Client
+	testEndpoint string
+	endpointMux  sync.RWMutex
+)
+
+// UseEndpoint sends every Drive request to endpoint (for example
+// "http://127.0.0.1:8123/drive/v3/") through client, without the user's
+// Google login. An empty endpoint goes back to Google.
+func UseEndpoint(client *http.Client, endpoint string) {
+	endpointMux.Lock()
+	defer endpointMux.Unlock()
+	testClient = client
+	testEndpoint = endpoint
+}
+
+// Service returns a Drive client for calls this package doesn't wrap, such
+// as the changes feed. It honours UseEndpoint.
+func Service(ctx context.Context) (*drive.Service, error) {
+	return newService(ctx)
+}
+
+func newService(ctx context.Context) (*drive.Service, error) {
+	endpointMux.RLock()
+	client, endpoint := testClient, testEndpoint
+	endpointMux.RUnlock()
+
+	opts := []option.ClientOption{}
+	if endpoint != "" {
+		if client == nil {
+			client = http.DefaultClient
+		}
+		opts = append(opts, option.WithHTTPClient(client), option.WithEndpoint(endpoint))
+	} else {
+		googleClient, err := connections.GetGoogleClient()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, option.WithHTTPClient(googleClient))
+	}
+
+	srv, err := drive.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Drive service: %w", err)
+	}
+	return srv, nil
+}
+
+func fromDrive(f *drive.File) File {
+	file := File{
+		ID:       f.Id,
+		Path:     PathFor(f.Id),
+		Name:     f.Name,
+		MimeType: f.MimeType,
+		IsFolder: f.MimeType == FolderMimeType,
+		Size:     f.Size,
+		Parents:  f.Parents,
+		WebLink:  f.WebViewLink,
+	}
+	file.ModifiedTime, _ = time.Parse(time.RFC3339, f.ModifiedTime)
+	file.CreatedTime, _ = time.Parse(time.RFC3339, f.CreatedTime)
+	return file
+}
+
+// List returns the files in a Drive folder, fetching every page
+func List(ctx context.Context, folderPath string) ([]File, error) {
+	folderID, err := IDOf(folderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := newService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("'%s' in parents and trashed = false", folderID)
+	var files []File
+	err = srv.Files.List().
+		Q(query).
+		Fields("nextPageToken, files("+fileFields+")").
+		OrderBy("folder, name").
+		PageSize(pageSize).
+		Pages(ctx, func(page *drive.FileList) error {
+			for _, f := range page.Files {
+				files = append(files, fromDrive(f))
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, connections.GoogleError(err, "list Drive folder")
+	}
+
+	return files, nil
+}
+
+// Stat returns a single Drive file
+func Stat(ctx context.Context, path string) (File, error) {
+	id, err := IDOf(path)
+	if err != nil {
+		return File{}, err
+	}
+
+	srv, err := newService(ctx)
+	if err != nil {
+		return File{}, err
+	}
+
+	f, err := srv.Files.Get(id).Fields(fileFields).Do()
+	if err != nil {
+		return File{}, connections.GoogleError(err, "get Drive file")
+	}
+	if f.Trashed {
+		return File{}, apperror.NotFound(path)
+	}
+	return fromDrive(f), nil
+}
+
+// Parent returns the path of the folder holding path, or "" at the top of
+// My Drive
+func Parent(ctx context.Context, path string) (string, error) {
+	id, err := IDOf(path)
+	if err != nil || id == rootID {
+		return "", err
+	}
+
+	file, err := Stat(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if len(file.Parents) == 0 {
+		// Shared with the user but outside My Drive
+		return Scheme, nil
+	}
+	return normalizeParent(ctx, file.Parents[0])
+}
+
+// normalizeParent maps My Drive's real ID back to the "gdrive://" root
+func normalizeParent(ctx context.Context, id string) (string, error) {
+	root, err := rootFolderID(ctx)
+	if err != nil {
+		return "", err
+	}
+	if id == root {
+		return Scheme, nil
+	}
+	return PathFor(id), nil
+}
+
+// rootFolderID is the real ID of My Drive, which "root" aliases
+func rootFolderID(ctx context.Context) (string, error) {
+	srv, err := newService(ctx)
+	if err != nil {
+		return "", err
+	}
+	f, err := srv.Files.Get(rootID).Fields("id").Do()
+	if err != nil {
+		return "", connections.GoogleError(err, "get My Drive")
+	}
+	return f.Id, nil
+}
+
+// Rename gives a Drive file a new name. Drive allows duplicate names, but
+// like a local rename this refuses to create one.
+func Rename(ctx context.Context, path string, newName string) error {
+	id, err := IDOf(path)
+	if err != nil {
+		return err
+	}
+	if id == rootID {
+		return apperror.New(apperror.CodeInvalid, "My Drive can't be renamed")
+	}
+	if strings.TrimSpace(newName) == "" {
+		return apperror.New(apperror.CodeInvalid, "name is empty")
+	}
+
+	file, err := Stat(ctx, path)
+	if err != nil {
+		return err
+	}
+	for _, parent := range file.Parents {
+		if err := checkNameFree(ctx, parent, newName, id); err != nil {
+			return err
+		}
+	}
+
+	srv, err := newService(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := srv.Files.Update(id, &drive.File{Name: newName}).Do(); err != nil {
+		return connections.GoogleError(err, "rename Drive file")
+	}
+	return nil
+}
+
+// Move puts a Drive file in another Drive folder, removing it from its
+// current ones
+func Move(ctx context.Context, path string, destFolderPath string) error {
+	id, err := IDOf(path)
+	if err != nil {
+		return err
+	}
+	destID, err := IDOf(destFolderPath)
+	if err != nil {
+		return err
+	}
+	if id == rootID {
+		return apperror.New(apperror.CodeInvalid, "My Drive can't be moved")
+	}
+	if id == destID {
+		return apperror.New(apperror.CodeInvalid, "a folder can't be moved into itself")
+	}
+
+	file, err := Stat(ctx, path)
+	if err != nil {
+		return err
+	}
+	if file.IsFolder {
+		if err := checkNotInside(ctx, destID, id); err != nil {
+			return err
+		}
+	}
+	if err := checkNameFree(ctx, destID, file.Name, id); err != nil {
+		return err
+	}
+
+	srv, err := newService(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = srv.Files.Update(id, &drive.File{}).
+		AddParents(destID).
+		RemoveParents(strings.Join(file.Parents, ",")).
+		Do()
+	if err != nil {
+		return connections.GoogleError(err, "move Drive file")
+	}
+	return nil
+}
+
+// Copy duplicates a Drive file into a Drive folder. Drive can't copy
+// folders.
+func Copy(ctx context.Context, path string, destFolderPath string) error {
+	id, err := IDOf(path)
+	if err != nil {
+		return err
+	}
+	destID, err := IDOf(destFolderPath)
+	if err != nil {
+		return err
+	}
+
+	file, err := Stat(ctx, path)
+	if err != nil {
+		return err
+	}
+	if file.IsFolder {
+		return apperror.New(apperror.CodeInvalid, "Google Drive folders can't be copied")
+	}
+	if err := checkNameFree(ctx, destID, file.Name, ""); err != nil {
+		return err
+	}
+
+	srv, err := newService(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = srv.Files.Copy(id, &drive.File{Name: file.Name, Parents: []string{destID}}).Do()
+	if err != nil {
+		return connections.GoogleError(err, "copy Drive file")
+	}
+	return nil
+}
+
+// Trash moves a Drive file to Drive's trash
+func Trash(ctx context.Context, path string) error {
+	id, err := IDOf(path)
+	if err != nil {
+		return err
+	}
+	if id == rootID {
+		return apperror.New(apperror.CodeInvalid, "My Drive can't be trashed")
+	}
+
+	srv, err := newService(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := srv.Files.Update(id, &drive.File{Trashed: true}).Do(); err != nil {
+		return connections.GoogleError(err, "trash Drive file")
+	}
+	return nil
+}
+
+// CreateFolder makes a folder inside a Drive folder and returns its path
+func CreateFolder(ctx context.Context, parentPath string, name string) (string, error) {
+	parentID, err := IDOf(parentPath)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(name) == "" {
+		return "", apperror.New(apperror.CodeInvalid, "name is empty")
+	}
+	if err := checkNameFree(ctx, parentID, name, ""); err != nil {
+		return "", err
+	}
+
+	srv, err := newService(ctx)
+	if err != nil {
+		return "", err
+	}
+	created, err := srv.Files.Create(&drive.File{
+		Name:     name,
+		MimeType: FolderMimeType,
+		Parents:  []string{parentID},
+	}).Fields("id").Do()
+	if err != nil {
+		return "", connections.GoogleError(err, "create Drive folder")
+	}
+	return PathFor(created.Id), nil
+}
+
+// checkNotInside refuses a move into folderID when it is the folder being
+// moved, or inside it. Drive files can have several parents, so every one is
+// followed up to the top.
+func checkNotInside(ctx context.Context, folderID string, movingID string) error {
+	srv, err := newService(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending := []string{folderID}
+	seen := make(map[string]bool)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == movingID {
+			return apperror.New(apperror.CodeInvalid, "a folder can't be moved into itself or one of its subfolders")
+		}
+		if seen[id] || id == rootID {
+			continue
+		}
+		seen[id] = true
+
+		f, err := srv.Files.Get(id).Fields("id, parents").Context(ctx).Do()
+		if err != nil {
+			return connections.GoogleError(err, "get Drive folder")
+		}
+		pending = append(pending, f.Parents...)
+	}
+	return nil
+}
+
+// checkNameFree returns AlreadyExists when folderID already holds a file
+// called name, other than the one with ID except
+func checkNameFree(ctx context.Context, folderID string, name string, except string) error {
+	srv, err := newService(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("'%s' in parents and name = '%s' and trashed = false", folderID, escapeQuery(name))
+	list, err := srv.Files.List().Q(query).Fields("files(id)").PageSize(10).Do()
+	if err != nil {
+		return connections.GoogleError(err, "check Drive folder")
+	}
+	for _, f := range list.Files {
+		if f.Id != except {
+			return apperror.AlreadyExists(name)
+		}
+	}
+	return nil
+}
+
+// escapeQuery escapes a string for use inside quotes in a Drive query
+func escapeQuery(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
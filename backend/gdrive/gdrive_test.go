@@ -0,0 +1,40 @@
+package gdrive
+
+import (
+	"context"
+	"testing"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/gdrive/fakedrive"
+)
+
+func TestMoveRefusesMovingAFolderIntoItself(t *testing.T) {
+	server := fakedrive.New()
+	UseEndpoint(server.Client(), server.Endpoint())
+	t.Cleanup(func() {
+		UseEndpoint(nil, "")
+		server.Close()
+	})
+	ctx := context.Background()
+
+	outer := server.Add("root", "Outer", FolderMimeType, nil)
+	inner := server.Add(outer, "Inner", FolderMimeType, nil)
+	deepest := server.Add(inner, "Deepest", FolderMimeType, nil)
+	other := server.Add("root", "Other", FolderMimeType, nil)
+
+	for _, dest := range []string{outer, inner, deepest} {
+		if err := Move(ctx, PathFor(outer), PathFor(dest)); apperror.CodeOf(err) != apperror.CodeInvalid {
+			t.Errorf("moving Outer into %s = %v, want invalid", dest, err)
+		}
+	}
+	if children := server.Children(fakedrive.RootID); len(children) != 2 {
+		t.Errorf("My Drive holds %d files after the refused moves, want 2", len(children))
+	}
+
+	if err := Move(ctx, PathFor(inner), PathFor(other)); err != nil {
+		t.Fatalf("moving Inner into a sibling folder: %v", err)
+	}
+	if children := server.Children(other); len(children) != 1 || children[0].Id != inner {
+		t.Errorf("Other holds %v, want Inner", children)
+	}
+}
@@ -0,0 +1,459 @@
+package gdrive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/connections"
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/sandbox"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Progress reports how far an upload or download has got
+type Progress struct {
+	BytesDone  int64  `json:"bytesDone"`
+	BytesTotal int64  `json:"bytesTotal"`
+	FilesDone  int    `json:"filesDone"`
+	FilesTotal int    `json:"filesTotal"`
+	Current    string `json:"current"` // name of the file being transferred
+}
+
+// ProgressFunc receives progress updates; it may be nil
+type ProgressFunc func(Progress)
+
+// Files larger than chunkSize are uploaded with Drive's resumable protocol
+// in pieces this big, so a dropped connection retries one chunk rather
+// than the whole file
+const chunkSize = 8 * 1024 * 1024
+
+// Report at most this often while downloading a large file
+const progressInterval = 256 * 1024
+
+// Formats Google Docs and other native files are downloaded as
+const (
+	ExportOffice = "office" // docx, xlsx and pptx; drawings as pdf
+	ExportPDF    = "pdf"
+)
+
+type exportType struct {
+	mimeType string
+	ext      string
+}
+
+var pdfExport = exportType{"application/pdf", ".pdf"}
+
+var officeExports = map[string]exportType{
+	"application/vnd.google-apps.document":     {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"},
+	"application/vnd.google-apps.spreadsheet":  {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"},
+	"application/vnd.google-apps.presentation": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx"},
+	"application/vnd.google-apps.drawing":      pdfExport,
+}
+
+// exportFor returns what a native file is exported as, or false for ones
+// Drive can't export, such as Forms and shortcuts
+func exportFor(mimeType string, format string) (exportType, bool) {
+	t, ok := officeExports[mimeType]
+	if !ok {
+		return exportType{}, false
+	}
+	if format == ExportPDF {
+		return pdfExport, true
+	}
+	return t, true
+}
+
+// IsNative reports whether a file is a Google Doc, Sheet or other file
+// that only exists inside Drive
+func IsNative(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "application/vnd.google-apps.") && mimeType != FolderMimeType
+}
+
+// tracker accumulates progress across the files of one transfer
+type tracker struct {
+	progress   Progress
+	onProgress ProgressFunc
+}
+
+func (t *tracker) report() {
+	if t.onProgress != nil {
+		t.onProgress(t.progress)
+	}
+}
+
+// Upload copies local files and folders into a Drive folder, renaming any
+// whose names are taken, and returns the Drive paths of what it created
+func Upload(ctx context.Context, localPaths []string, destFolderPath string, onProgress ProgressFunc) ([]string, error) {
+	destID, err := IDOf(destFolderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tracker{onProgress: onProgress}
+	cleaned := make([]string, len(localPaths))
+	for i, p := range localPaths {
+		if cleaned[i], err = sandbox.Clean(p); err != nil {
+			return nil, err
+		}
+		info, err := os.Lstat(cleaned[i])
+		if err != nil {
+			return nil, apperror.FromOS(err, cleaned[i])
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil, apperror.New(apperror.CodeInvalid, "%s can't be uploaded", filepath.Base(cleaned[i]))
+		}
+		if err := measureLocal(cleaned[i], &t.progress); err != nil {
+			return nil, err
+		}
+	}
+	t.report()
+
+	srv, err := newService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	for _, p := range cleaned {
+		id, err := uploadPath(ctx, srv, t, p, destID)
+		if err != nil {
+			return created, err
+		}
+		created = append(created, PathFor(id))
+	}
+	return created, nil
+}
+
+// measureLocal adds the regular files under path to the totals. Symlinks
+// and other special files aren't uploaded.
+func measureLocal(path string, total *Progress) error {
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return apperror.FromOS(err, p)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return apperror.FromOS(err, p)
+		}
+		total.FilesTotal++
+		total.BytesTotal += info.Size()
+		return nil
+	})
+}
+
+func uploadPath(ctx context.Context, srv *drive.Service, t *tracker, path string, parentID string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", apperror.FromOS(err, path)
+	}
+	name, err := uniqueDriveName(ctx, srv, parentID, filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsDir() {
+		return uploadFile(ctx, srv, t, path, name, parentID)
+	}
+
+	folder, err := srv.Files.Create(&drive.File{
+		Name:     name,
+		MimeType: FolderMimeType,
+		Parents:  []string{parentID},
+	}).Fields("id").Context(ctx).Do()
+	if err != nil {
+		return "", connections.GoogleError(err, "create Drive folder")
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", apperror.FromOS(err, path)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && !entry.Type().IsRegular() {
+			continue
+		}
+		// The folder is new, so its children's names can't clash
+		if _, err := uploadPath(ctx, srv, t, filepath.Join(path, entry.Name()), folder.Id); err != nil {
+			return "", err
+		}
+	}
+	return folder.Id, nil
+}
+
+func uploadFile(ctx context.Context, srv *drive.Service, t *tracker, path string, name string, parentID string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", apperror.FromOS(err, path)
+	}
+	defer f.Close()
+
+	t.progress.Current = name
+	t.report()
+	base := t.progress.BytesDone
+
+	created, err := srv.Files.Create(&drive.File{Name: name, Parents: []string{parentID}}).
+		Media(f, googleapi.ChunkSize(chunkSize)).
+		ProgressUpdater(func(current, _ int64) {
+			t.progress.BytesDone = base + current
+			t.report()
+		}).
+		Fields("id").
+		Context(ctx).
+		Do()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		return "", connections.GoogleError(err, "upload "+name)
+	}
+
+	if info, err := f.Stat(); err == nil {
+		t.progress.BytesDone = base + info.Size()
+	}
+	t.progress.FilesDone++
+	t.report()
+	return created.Id, nil
+}
+
+// uniqueDriveName returns name, or "name 1.ext", "name 2.ext" and so on
+// when the folder already has a file called that
+func uniqueDriveName(ctx context.Context, srv *drive.Service, folderID string, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for counter := 1; ; counter++ {
+		query := fmt.Sprintf("'%s' in parents and name = '%s' and trashed = false", folderID, escapeQuery(candidate))
+		list, err := srv.Files.List().Q(query).Fields("files(id)").PageSize(1).Context(ctx).Do()
+		if err != nil {
+			return "", connections.GoogleError(err, "check Drive folder")
+		}
+		if len(list.Files) == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s %d%s", base, counter, ext)
+	}
+}
+
+// Download copies Drive files and folders into a local folder, exporting
+// Google Docs in the given format and renaming anything whose name is
+// taken. It returns the local paths it created. Native files Drive can't
+// export, such as Forms, are skipped. destDir's size in sizes is invalidated.
+func Download(ctx context.Context, sizes database.FolderSizeStore, drivePaths []string, destDir string, format string, onProgress ProgressFunc) ([]string, error) {
+	if format == "" {
+		format = ExportOffice
+	}
+	if format != ExportOffice && format != ExportPDF {
+		return nil, apperror.New(apperror.CodeInvalid, "unknown export format: %s", format)
+	}
+	destDir, err := sandbox.Check(destDir, sandbox.Write)
+	if err != nil {
+		return nil, err
+	}
+	defer foldersize.Invalidate(sizes, destDir)
+
+	t := &tracker{onProgress: onProgress}
+	files := make([]File, len(drivePaths))
+	for i, p := range drivePaths {
+		if files[i], err = Stat(ctx, p); err != nil {
+			return nil, err
+		}
+		if err := measureDrive(ctx, files[i], format, &t.progress); err != nil {
+			return nil, err
+		}
+	}
+	t.report()
+
+	srv, err := newService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	for _, file := range files {
+		path, err := downloadFile(ctx, srv, t, file, destDir, format)
+		if err != nil {
+			return created, err
+		}
+		if path != "" {
+			created = append(created, path)
+		}
+	}
+	return created, nil
+}
+
+// measureDrive adds the files under a Drive file to the totals. Exported
+// files have no size until they're exported, so they only add to the count.
+func measureDrive(ctx context.Context, file File, format string, p *Progress) error {
+	if !file.IsFolder {
+		if IsNative(file.MimeType) {
+			if _, ok := exportFor(file.MimeType, format); !ok {
+				return nil
+			}
+		}
+		p.FilesTotal++
+		p.BytesTotal += file.Size
+		return nil
+	}
+
+	children, err := List(ctx, file.Path)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := measureDrive(ctx, child, format, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func downloadFile(ctx context.Context, srv *drive.Service, t *tracker, file File, destDir string, format string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	name := LocalName(file.Name)
+	if file.IsFolder {
+		dir := uniqueLocalPath(filepath.Join(destDir, name), "")
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return "", apperror.FromOS(err, dir)
+		}
+		children, err := List(ctx, file.Path)
+		if err != nil {
+			return "", err
+		}
+		for _, child := range children {
+			if _, err := downloadFile(ctx, srv, t, child, dir, format); err != nil {
+				return "", err
+			}
+		}
+		return dir, nil
+	}
+
+	var body io.ReadCloser
+	exported := false
+	if IsNative(file.MimeType) {
+		export, ok := exportFor(file.MimeType, format)
+		if !ok {
+			logger.Info("skipping Drive file that can't be exported", "id", file.ID, "mimeType", file.MimeType)
+			return "", nil
+		}
+		if !strings.EqualFold(filepath.Ext(name), export.ext) {
+			name += export.ext
+		}
+		resp, err := srv.Files.Export(file.ID, export.mimeType).Context(ctx).Download()
+		if err != nil {
+			return "", connections.GoogleError(err, "export "+file.Name)
+		}
+		body = resp.Body
+		exported = true
+	} else {
+		resp, err := srv.Files.Get(file.ID).Context(ctx).Download()
+		if err != nil {
+			return "", connections.GoogleError(err, "download "+file.Name)
+		}
+		body = resp.Body
+	}
+	defer body.Close()
+
+	ext := filepath.Ext(name)
+	path := uniqueLocalPath(filepath.Join(destDir, name), ext)
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", apperror.FromOS(err, path)
+	}
+
+	t.progress.Current = file.Name
+	t.report()
+	_, err = io.Copy(&progressWriter{ctx: ctx, w: out, t: t, grow: exported}, body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		return "", fmt.Errorf("failed to download %s: %w", file.Name, err)
+	}
+
+	t.progress.FilesDone++
+	t.report()
+	return path, nil
+}
+
+// progressWriter counts bytes as they're written to a downloaded file.
+// Exports have no size in advance, so their bytes grow the total as well.
+type progressWriter struct {
+	ctx        context.Context
+	w          io.Writer
+	t          *tracker
+	grow       bool
+	unreported int64
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	if err := pw.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := pw.w.Write(p)
+	pw.t.progress.BytesDone += int64(n)
+	if pw.grow {
+		pw.t.progress.BytesTotal += int64(n)
+	}
+	pw.unreported += int64(n)
+	if pw.unreported >= progressInterval {
+		pw.t.report()
+		pw.unreported = 0
+	}
+	return n, err
+}
+
+// LocalName makes a Drive name safe to use as a file name. Drive allows
+// slashes and names like "..".
+func LocalName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == os.PathSeparator || r == 0 {
+			return '_'
+		}
+		return r
+	}, name)
+	if sandbox.CheckName(name) != nil {
+		return "_"
+	}
+	return name
+}
+
+// uniqueLocalPath returns p, or "name 1.ext", "name 2.ext" and so on when p
+// already exists
+func uniqueLocalPath(p string, ext string) string {
+	if _, err := os.Lstat(p); os.IsNotExist(err) {
+		return p
+	}
+
+	dir := filepath.Dir(p)
+	base := strings.TrimSuffix(filepath.Base(p), ext)
+	for counter := 1; ; counter++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s %d%s", base, counter, ext))
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
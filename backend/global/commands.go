@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"Finder-2/backend/settings"
 )
 
 
@@ -14,8 +16,12 @@ func GoUpDirectory(currentPath string, homeDir string) string {
 	}
 
 	// List of top-level folders we don't want to go above
+	documentsRoot, err := settings.DocumentsRoot()
+	if err != nil {
+		documentsRoot = filepath.Join(homeDir, "Documents")
+	}
 	topLevelFolders := []string{
-		filepath.Join(homeDir, "Documents"),
+		documentsRoot,
 		filepath.Join(homeDir, "Downloads"),
 		filepath.Join(homeDir, "Applications"),
 		filepath.Join(homeDir, "Media"),
@@ -7,78 +7,109 @@ import (
 	"os/exec"
 	"path/filepath"
 
+	"Finder-2/backend/apperror"
 	"Finder-2/backend/connections"
 	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/logging"
+	"Finder-2/backend/pointers"
+	"Finder-2/backend/sandbox"
 
 	"google.golang.org/api/drive/v3"
-	"google.golang.org/api/option"
 )
 
+var logger = logging.For("google")
+
 // CreateGoogleDoc creates a new Google Doc and a local .goox pointer file
-func CreateGoogleDoc(directory string, name string) error {
-	client, err := connections.GetGoogleClient()
-	if err != nil {
-		return fmt.Errorf("failed to get Google client: %v", err)
+func CreateGoogleDoc(store database.Store, directory string, name string) error {
+	return CreateGoogleFile(store, directory, name, "google_doc")
+}
+
+// CreateGoogleFile creates a new Google file of the pointer kind recorded
+// under fileType, such as "google_sheet", and a local pointer file for it
+func CreateGoogleFile(store database.Store, directory string, name string, fileType string) error {
+	kind, ok := pointers.KindOfType(fileType)
+	if !ok {
+		return apperror.New(apperror.CodeInvalid, "unknown Google file type %q", fileType)
+	}
+
+	localPath := filepath.Join(directory, name+kind.Extension)
+	if err := sandbox.CheckName(name + kind.Extension); err != nil {
+		return err
+	}
+	if _, err := sandbox.Check(localPath, sandbox.Write); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(localPath); err == nil {
+		return apperror.AlreadyExists(localPath)
 	}
 
-	srv, err := drive.NewService(context.Background(), option.WithHTTPClient(client))
+	srv, err := gdrive.Service(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to create Drive service: %v", err)
+		return err
 	}
 
-	// Create a new Google Doc
 	file := &drive.File{
 		Name:     name,
-		MimeType: "application/vnd.google-apps.document",
+		MimeType: kind.MimeType,
 	}
 
 	createdFile, err := srv.Files.Create(file).Fields("id, name, mimeType, webViewLink").Do()
 	if err != nil {
-		return fmt.Errorf("failed to create Google Doc: %v", err)
+		return connections.GoogleError(err, "create "+kind.Label)
 	}
 
-	// Create the local .goox pointer file
-	localPath := filepath.Join(directory, name+".goox")
-
-	// Write the Google Doc ID to the file as a simple pointer
-	err = os.WriteFile(localPath, []byte(createdFile.Id), 0644)
+	err = pointers.Write(localPath, pointers.Pointer{
+		FileID:   createdFile.Id,
+		MimeType: createdFile.MimeType,
+		Account:  connections.GetConnectedEmail(),
+		Name:     createdFile.Name,
+		WebLink:  createdFile.WebViewLink,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create local pointer file: %v", err)
+		return err
 	}
+	foldersize.Invalidate(store, localPath)
 
 	// Store the mapping in the database
-	err = database.AddExternalFile("google_doc", localPath, createdFile.Id)
+	err = store.AddExternalFile(kind.Type, localPath, createdFile.Id)
 	if err != nil {
-		return fmt.Errorf("failed to save file mapping: %v", err)
+		return fmt.Errorf("failed to save file mapping: %w", err)
 	}
 
 	return nil
 }
 
-// OpenGoogleDoc opens a .goox file by reading its Google Doc ID and opening in browser
-func OpenGoogleDoc(path string) error {
+// OpenGoogleFile opens the Google file a pointer stands for in the browser
+func OpenGoogleFile(store database.ExternalFileStore, path string) error {
 	// First try to get from database
-	externalFile, err := database.GetExternalFileByPath(path)
+	externalFile, err := store.GetExternalFileByPath(path)
 	if err != nil {
-		return fmt.Errorf("failed to check database: %v", err)
+		return fmt.Errorf("failed to check database: %w", err)
 	}
 
 	var fileID string
+	kind, ok := pointers.KindOfPath(path)
 	if externalFile != nil {
 		fileID = externalFile.FileID
+		if k, found := pointers.KindOfType(externalFile.Type); found {
+			kind, ok = k, true
+		}
 	} else {
 		// Fallback: read the file ID directly from the file
-		content, err := os.ReadFile(path)
+		pointer, err := pointers.Read(path)
 		if err != nil {
-			return fmt.Errorf("failed to read pointer file: %v", err)
+			return err
 		}
-		fileID = string(content)
+		fileID = pointer.FileID
+		kind, ok = pointer.Kind(path)
+	}
+	if !ok {
+		return apperror.New(apperror.CodeInvalid, "%s is not a Google file pointer", path)
 	}
-
-	// Google Docs URL format
-	url := fmt.Sprintf("https://docs.google.com/document/d/%s/edit", fileID)
 
 	// Open in default browser using macOS open command
-	cmd := exec.Command("open", url)
+	cmd := exec.Command("open", kind.URL(fileID))
 	return cmd.Run()
 }
@@ -0,0 +1,109 @@
+package google
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/gdrive/fakedrive"
+	"Finder-2/backend/pointers"
+	"Finder-2/backend/sandbox"
+)
+
+// setup allows writes inside a temporary folder and points gdrive at a fake
+// Drive, returning the folder, the store and the server
+func setup(t *testing.T) (string, database.Store, *fakedrive.Server) {
+	t.Helper()
+	dir := t.TempDir()
+	previous := sandbox.GetPolicy()
+	if err := sandbox.SetPolicy(sandbox.Policy{AllowedRoots: []string{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	store := database.NewMemoryStore()
+	server := fakedrive.New()
+	gdrive.UseEndpoint(server.Client(), server.Endpoint())
+	t.Cleanup(func() {
+		gdrive.UseEndpoint(nil, "")
+		server.Close()
+		sandbox.SetPolicy(previous)
+	})
+	return dir, store, server
+}
+
+func TestCreateGoogleFileWritesPointerOfItsKind(t *testing.T) {
+	dir, store, server := setup(t)
+
+	for _, kind := range pointers.Kinds {
+		if err := CreateGoogleFile(store, dir, "Plan", kind.Type); err != nil {
+			t.Fatalf("%s: %v", kind.Type, err)
+		}
+		path := filepath.Join(dir, "Plan"+kind.Extension)
+
+		pointer, err := pointers.Read(path)
+		if err != nil {
+			t.Fatalf("%s: %v", kind.Type, err)
+		}
+		if got, ok := pointer.Kind(path); !ok || got.Type != kind.Type {
+			t.Errorf("%s: pointer is of kind %q", kind.Type, got.Type)
+		}
+		if pointer.MimeType != kind.MimeType || pointer.Name != "Plan" || pointer.FileID == "" {
+			t.Errorf("%s: pointer = %+v", kind.Type, pointer)
+		}
+
+		row, err := store.GetExternalFileByPath(path)
+		if err != nil || row == nil || row.Type != kind.Type || row.FileID != pointer.FileID {
+			t.Errorf("%s: mapping = %+v, %v, want %s for %s", kind.Type, row, err, kind.Type, pointer.FileID)
+		}
+	}
+
+	created := server.Children(fakedrive.RootID)
+	if len(created) != len(pointers.Kinds) {
+		t.Fatalf("Drive holds %d files, want one of each kind", len(created))
+	}
+	for _, f := range created {
+		if _, ok := pointers.KindOfMimeType(f.MimeType); !ok || f.Name != "Plan" {
+			t.Errorf("created %s of type %s", f.Name, f.MimeType)
+		}
+	}
+}
+
+func TestCreateGoogleFileRefusals(t *testing.T) {
+	dir, store, server := setup(t)
+	existing := filepath.Join(dir, "Taken.gsheet")
+	if err := os.WriteFile(existing, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		directory string
+		file      string
+		fileType  string
+		code      string
+	}{
+		{"unknown type", dir, "Plan", "google_spreadsheet", apperror.CodeInvalid},
+		{"existing file", dir, "Taken", "google_sheet", apperror.CodeAlreadyExists},
+		{"outside the sandbox", t.TempDir(), "Plan", "google_doc", apperror.CodePermissionDenied},
+		{"bad name", dir, "a/b", "google_doc", apperror.CodeInvalid},
+	}
+	for _, tt := range tests {
+		err := CreateGoogleFile(store, tt.directory, tt.file, tt.fileType)
+		if err == nil {
+			t.Errorf("%s: CreateGoogleFile succeeded, want it refused", tt.name)
+			continue
+		}
+		if code := apperror.CodeOf(err); code != tt.code {
+			t.Errorf("%s: CreateGoogleFile = %v, want code %s", tt.name, err, tt.code)
+		}
+	}
+
+	if created := server.Children(fakedrive.RootID); len(created) != 0 {
+		t.Errorf("Drive holds %d files after refused creations, want none", len(created))
+	}
+	if rows, _ := store.ListExternalFiles(); len(rows) != 0 {
+		t.Errorf("mappings = %v after refused creations, want none", rows)
+	}
+}
@@ -0,0 +1,116 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/connections"
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/pointers"
+	"Finder-2/backend/sandbox"
+)
+
+// ImportReport says what ImportGoogleFiles did with each file
+type ImportReport struct {
+	Imported []string `json:"imported"` // pointer files written
+	Skipped  []string `json:"skipped"`  // pointers that already stood for a file
+	Errors   []string `json:"errors"`
+}
+
+// ImportGoogleFiles writes a pointer file into directory for each of the
+// Drive files fileIDs, such as Docs picked from ListGoogleDocs, and records
+// it in external_files. Files that already have a pointer are skipped, as
+// are ones no pointer kind stands for; either way the rest carry on.
+func ImportGoogleFiles(ctx context.Context, store database.Store, directory string, fileIDs []string) (*ImportReport, error) {
+	dir, err := sandbox.Check(directory, sandbox.Write)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return nil, apperror.FromOS(err, dir)
+	} else if !info.IsDir() {
+		return nil, apperror.New(apperror.CodeInvalid, "%s is not a folder", dir)
+	}
+
+	srv, err := gdrive.Service(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	account := connections.GetConnectedEmail()
+	report := &ImportReport{}
+	for _, id := range fileIDs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		row, err := store.GetExternalFileByID(id)
+		if err != nil {
+			return report, err
+		}
+		if row != nil {
+			if _, err := os.Lstat(row.Path); err == nil {
+				report.Skipped = append(report.Skipped, row.Path)
+				continue
+			}
+			// The pointer it was linked to is gone, so import it afresh
+			if err := store.DeleteExternalFile(row.Path); err != nil {
+				return report, err
+			}
+		}
+
+		file, err := srv.Files.Get(id).Fields("id, name, mimeType, webViewLink, trashed").Context(ctx).Do()
+		if err != nil {
+			report.Errors = append(report.Errors, connections.GoogleError(err, "get "+id).Error())
+			continue
+		}
+		kind, ok := pointers.KindOfMimeType(file.MimeType)
+		if !ok || file.Trashed {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s can't be imported as a pointer file", file.Name))
+			continue
+		}
+
+		path := uniquePointerPath(dir, gdrive.LocalName(file.Name), kind.Extension)
+		err = pointers.Write(path, pointers.Pointer{
+			FileID:   file.Id,
+			MimeType: file.MimeType,
+			Account:  account,
+			Name:     file.Name,
+			WebLink:  file.WebViewLink,
+		})
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		if err := store.AddExternalFile(kind.Type, path, file.Id); err != nil {
+			os.Remove(path)
+			return report, fmt.Errorf("failed to save file mapping: %w", err)
+		}
+		report.Imported = append(report.Imported, path)
+	}
+	foldersize.Invalidate(store, dir)
+
+	logger.Info("Google files imported",
+		"directory", dir,
+		"imported", len(report.Imported),
+		"skipped", len(report.Skipped),
+		"errors", len(report.Errors))
+	return report, nil
+}
+
+// uniquePointerPath returns the path for a pointer called name in dir, or
+// "name 1.ext", "name 2.ext" and so on when that's taken
+func uniquePointerPath(dir string, name string, ext string) string {
+	path := filepath.Join(dir, name+ext)
+	for counter := 1; ; counter++ {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s %d%s", name, counter, ext))
+	}
+}
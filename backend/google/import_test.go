@@ -0,0 +1,114 @@
+package google
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/gdrive/fakedrive"
+	"Finder-2/backend/pointers"
+)
+
+func TestImportGoogleFilesWritesPointerPerKind(t *testing.T) {
+	dir, store, server := setup(t)
+	doc := server.Add("root", "Plan", "application/vnd.google-apps.document", nil)
+	sheet := server.Add("root", "Budget", "application/vnd.google-apps.spreadsheet", nil)
+	slides := server.Add("root", "Pitch", "application/vnd.google-apps.presentation", nil)
+	pdf := server.Add("root", "Scan.pdf", "application/pdf", []byte("%PDF-1.7"))
+	folder := server.Add("root", "Folder", "application/vnd.google-apps.folder", nil)
+
+	report, err := ImportGoogleFiles(context.Background(), store, dir, []string{doc, sheet, slides, pdf, folder, "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "Plan.goox"),
+		filepath.Join(dir, "Budget.gsheet"),
+		filepath.Join(dir, "Pitch.gslides"),
+	}
+	if !reflect.DeepEqual(report.Imported, want) {
+		t.Errorf("imported %v, want %v", report.Imported, want)
+	}
+	if len(report.Errors) != 3 {
+		t.Errorf("errors = %v, want the PDF, the folder and the missing ID refused", report.Errors)
+	}
+
+	for i, id := range []string{doc, sheet, slides} {
+		path := want[i]
+		pointer, err := pointers.Read(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kind, _ := pointer.Kind(path)
+		if pointer.FileID != id || kind.MimeType != pointer.MimeType {
+			t.Errorf("%s: pointer = %+v of kind %s", filepath.Base(path), pointer, kind.Type)
+		}
+		row, err := store.GetExternalFileByID(id)
+		if err != nil || row == nil || row.Path != path || row.Type != kind.Type {
+			t.Errorf("%s: mapping = %+v, %v", filepath.Base(path), row, err)
+		}
+	}
+}
+
+func TestImportGoogleFilesSkipsLinkedAndAvoidsNames(t *testing.T) {
+	dir, store, server := setup(t)
+	linked := server.Add("root", "Linked", "application/vnd.google-apps.document", nil)
+	relinked := server.Add("root", "Gone", "application/vnd.google-apps.document", nil)
+	taken := server.Add("root", "Notes", "application/vnd.google-apps.document", nil)
+
+	linkedPath := filepath.Join(dir, "elsewhere", "Linked.goox")
+	if err := os.MkdirAll(filepath.Dir(linkedPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := pointers.Write(linkedPath, pointers.Pointer{FileID: linked}); err != nil {
+		t.Fatal(err)
+	}
+	store.AddExternalFile("google_doc", linkedPath, linked)
+	// The pointer this was linked to has been deleted
+	store.AddExternalFile("google_doc", filepath.Join(dir, "deleted.goox"), relinked)
+	// A file of the same name is already there and must be left alone
+	if err := os.WriteFile(filepath.Join(dir, "Notes.goox"), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := ImportGoogleFiles(context.Background(), store, dir, []string{linked, relinked, taken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Skipped, []string{linkedPath}) {
+		t.Errorf("skipped %v, want the linked pointer", report.Skipped)
+	}
+	want := []string{filepath.Join(dir, "Gone.goox"), filepath.Join(dir, "Notes 1.goox")}
+	if !reflect.DeepEqual(report.Imported, want) {
+		t.Errorf("imported %v, want %v", report.Imported, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "Notes.goox")); string(data) != "mine" {
+		t.Error("existing file was overwritten")
+	}
+	if row, _ := store.GetExternalFileByPath(filepath.Join(dir, "deleted.goox")); row != nil {
+		t.Error("mapping to the deleted pointer was kept")
+	}
+}
+
+func TestImportGoogleFilesRefusedBySandbox(t *testing.T) {
+	_, store, server := setup(t)
+	doc := server.Add("root", "Plan", "application/vnd.google-apps.document", nil)
+	outside := t.TempDir()
+
+	_, err := ImportGoogleFiles(context.Background(), store, outside, []string{doc})
+	if code := apperror.CodeOf(err); code != apperror.CodePermissionDenied {
+		t.Errorf("importing outside the allowed folders = %v, want code %s", err, apperror.CodePermissionDenied)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("%d files written outside the allowed folders", len(entries))
+	}
+	if rows, _ := store.ListExternalFiles(); len(rows) != 0 {
+		t.Errorf("mappings = %v after a refused import, want none", rows)
+	}
+	if got := len(server.Children(fakedrive.RootID)); got != 1 {
+		t.Errorf("Drive holds %d files, want it untouched", got)
+	}
+}
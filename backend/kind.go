@@ -0,0 +1,91 @@
+package backend
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// File kinds shown in the UI and used by the sort/filter engine
+const (
+	KindFolder       = "folder"
+	KindApplication  = "application"
+	KindImage        = "image"
+	KindVideo        = "video"
+	KindAudio        = "audio"
+	KindDocument     = "document"
+	KindSpreadsheet  = "spreadsheet"
+	KindPresentation = "presentation"
+	KindArchive      = "archive"
+	KindCode         = "code"
+	KindText         = "text"
+	KindOther        = "other"
+)
+
+var kindsByExtension = map[string]string{
+	".jpg": KindImage, ".jpeg": KindImage, ".png": KindImage, ".gif": KindImage,
+	".heic": KindImage, ".webp": KindImage, ".bmp": KindImage, ".tiff": KindImage,
+	".svg": KindImage, ".ico": KindImage, ".icns": KindImage, ".raw": KindImage,
+	".gdraw": KindImage,
+
+	".mp4": KindVideo, ".mov": KindVideo, ".mkv": KindVideo, ".avi": KindVideo,
+	".webm": KindVideo, ".m4v": KindVideo,
+
+	".mp3": KindAudio, ".wav": KindAudio, ".flac": KindAudio, ".aac": KindAudio,
+	".m4a": KindAudio, ".ogg": KindAudio, ".aiff": KindAudio,
+
+	".pdf": KindDocument, ".doc": KindDocument, ".docx": KindDocument,
+	".pages": KindDocument, ".odt": KindDocument, ".rtf": KindDocument,
+	".goox": KindDocument, ".gform": KindDocument,
+
+	".xls": KindSpreadsheet, ".xlsx": KindSpreadsheet, ".numbers": KindSpreadsheet,
+	".ods": KindSpreadsheet, ".csv": KindSpreadsheet, ".gsheet": KindSpreadsheet,
+
+	".ppt": KindPresentation, ".pptx": KindPresentation, ".key": KindPresentation,
+	".odp": KindPresentation, ".gslides": KindPresentation,
+
+	".zip": KindArchive, ".tar": KindArchive, ".gz": KindArchive, ".tgz": KindArchive,
+	".bz2": KindArchive, ".xz": KindArchive, ".zst": KindArchive, ".7z": KindArchive,
+	".rar": KindArchive, ".dmg": KindArchive,
+
+	".go": KindCode, ".js": KindCode, ".jsx": KindCode, ".ts": KindCode,
+	".tsx": KindCode, ".py": KindCode, ".rs": KindCode, ".c": KindCode,
+	".h": KindCode, ".cpp": KindCode, ".java": KindCode, ".swift": KindCode,
+	".rb": KindCode, ".php": KindCode, ".sh": KindCode, ".html": KindCode,
+	".css": KindCode, ".json": KindCode, ".xml": KindCode, ".yaml": KindCode,
+	".yml": KindCode, ".toml": KindCode, ".sql": KindCode,
+
+	".txt": KindText, ".md": KindText, ".log": KindText,
+}
+
+// Kinds of Google's native files, which have no extension in Drive
+var kindsByMimeType = map[string]string{
+	"application/vnd.google-apps.folder":       KindFolder,
+	"application/vnd.google-apps.document":     KindDocument,
+	"application/vnd.google-apps.spreadsheet":  KindSpreadsheet,
+	"application/vnd.google-apps.presentation": KindPresentation,
+	"application/vnd.google-apps.drawing":      KindImage,
+	"application/vnd.google-apps.form":         KindDocument,
+}
+
+// KindOfMimeType classifies an entry whose name may lack an extension, such
+// as a Drive file, falling back to KindOf
+func KindOfMimeType(name string, mimeType string, isDirectory bool) string {
+	if kind, ok := kindsByMimeType[mimeType]; ok {
+		return kind
+	}
+	return KindOf(name, isDirectory, false)
+}
+
+// KindOf classifies an entry by its name and type
+func KindOf(name string, isDirectory bool, isApp bool) string {
+	if isApp {
+		return KindApplication
+	}
+	if isDirectory {
+		return KindFolder
+	}
+	if kind, ok := kindsByExtension[strings.ToLower(filepath.Ext(name))]; ok {
+		return kind
+	}
+	return KindOther
+}
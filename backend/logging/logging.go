@@ -0,0 +1,208 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// LogFileName is the current log file inside the logs folder; rotated files
+// get a numeric suffix
+const LogFileName = "finder.log"
+
+var (
+	// levels holds the minimum level per subsystem; "" is the default
+	levels   = map[string]slog.Level{"": slog.LevelInfo}
+	levelMux sync.RWMutex
+
+	output    io.Writer = os.Stderr
+	logFile   *rotatingFile
+	logDir    string
+	outputMux sync.RWMutex
+	// outputGen counts changes of output, telling handlers to rebuild
+	outputGen int
+)
+
+// Init starts writing JSON logs to rotating files in dir, as well as to
+// stderr. Until it's called, logs only go to stderr.
+func Init(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	file, err := openRotating(filepath.Join(dir, LogFileName), maxLogSize, maxLogFiles)
+	if err != nil {
+		return err
+	}
+
+	outputMux.Lock()
+	defer outputMux.Unlock()
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = file
+	logDir = dir
+	output = io.MultiWriter(file, os.Stderr)
+	outputGen++
+	return nil
+}
+
+// Close flushes and closes the log file
+func Close() error {
+	outputMux.Lock()
+	defer outputMux.Unlock()
+	output = os.Stderr
+	outputGen++
+	if logFile == nil {
+		return nil
+	}
+	err := logFile.Close()
+	logFile = nil
+	return err
+}
+
+// Dir returns the folder logs are written to, or "" before Init
+func Dir() string {
+	outputMux.RLock()
+	defer outputMux.RUnlock()
+	return logDir
+}
+
+// For returns the logger for a subsystem such as "ai" or "google". Its
+// verbosity can be changed with SetLevel.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&handler{subsystem: subsystem}).With("subsystem", subsystem)
+}
+
+// SetLevel sets the minimum level ("debug", "info", "warn" or "error") for
+// a subsystem, or for every subsystem without its own when subsystem is ""
+func SetLevel(subsystem string, level string) error {
+	l, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	levelMux.Lock()
+	defer levelMux.Unlock()
+	levels[subsystem] = l
+	return nil
+}
+
+// SetLevels replaces every subsystem's level. A missing default is info.
+func SetLevels(byName map[string]string) error {
+	parsed := map[string]slog.Level{"": slog.LevelInfo}
+	for subsystem, level := range byName {
+		l, err := parseLevel(level)
+		if err != nil {
+			return err
+		}
+		parsed[subsystem] = l
+	}
+
+	levelMux.Lock()
+	defer levelMux.Unlock()
+	levels = parsed
+	return nil
+}
+
+// CheckLevel reports whether level is a name SetLevel accepts
+func CheckLevel(level string) error {
+	_, err := parseLevel(level)
+	return err
+}
+
+func parseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("unknown log level: %s", level)
+	}
+	return l, nil
+}
+
+// Levels returns the configured level of each subsystem, "" being the default
+func Levels() map[string]string {
+	levelMux.RLock()
+	defer levelMux.RUnlock()
+
+	out := make(map[string]string, len(levels))
+	for subsystem, level := range levels {
+		out[subsystem] = strings.ToLower(level.String())
+	}
+	return out
+}
+
+func levelFor(subsystem string) slog.Level {
+	levelMux.RLock()
+	defer levelMux.RUnlock()
+	if level, ok := levels[subsystem]; ok {
+		return level
+	}
+	return levels[""]
+}
+
+// handler writes JSON records for one subsystem, checking the subsystem's
+// level on every record so SetLevel applies to existing loggers, and
+// redacting secrets before anything is written. The JSON handler it writes
+// through is built once and rebuilt only when Init or Close swap the output;
+// the rotating file keeps its writer across rotations.
+type handler struct {
+	subsystem string
+	// steps replays WithAttrs and WithGroup calls, in order, onto a new
+	// JSON handler
+	steps []func(slog.Handler) slog.Handler
+
+	mu    sync.Mutex
+	inner slog.Handler
+	gen   int
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levelFor(h.subsystem)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	outputMux.RLock()
+	defer outputMux.RUnlock()
+
+	h.mu.Lock()
+	if h.inner == nil || h.gen != outputGen {
+		var inner slog.Handler = slog.NewJSONHandler(output, &slog.HandlerOptions{
+			Level:       slog.LevelDebug,
+			ReplaceAttr: redactAttr,
+		})
+		for _, step := range h.steps {
+			inner = step(inner)
+		}
+		h.inner = inner
+		h.gen = outputGen
+	}
+	inner := h.inner
+	h.mu.Unlock()
+
+	return inner.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(inner slog.Handler) slog.Handler { return inner.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(inner slog.Handler) slog.Handler { return inner.WithGroup(name) })
+}
+
+func (h *handler) with(step func(slog.Handler) slog.Handler) *handler {
+	steps := make([]func(slog.Handler) slog.Handler, len(h.steps), len(h.steps)+1)
+	copy(steps, h.steps)
+	return &handler{subsystem: h.subsystem, steps: append(steps, step)}
+}
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readRecords decodes each line of the log file in dir
+func readRecords(t *testing.T, dir string) []map[string]any {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, LogFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []map[string]any
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("%s: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestHandlerKeepsAttrsAndGroups(t *testing.T) {
+	dir := t.TempDir()
+	if err := Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close() })
+
+	logger := For("test").With("job", 7).WithGroup("req").With("id", "a")
+	logger.Info("first", "token", "secret-value")
+	logger.Info("second")
+
+	records := readRecords(t, dir)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	for _, record := range records {
+		if record["subsystem"] != "test" || record["job"] != float64(7) {
+			t.Errorf("record %v lost its attributes", record)
+		}
+		req, _ := record["req"].(map[string]any)
+		if req["id"] != "a" {
+			t.Errorf("record %v lost its group", record)
+		}
+	}
+	if strings.Contains(records[0]["req"].(map[string]any)["token"].(string), "secret-value") {
+		t.Error("token was written unredacted")
+	}
+}
+
+func TestRotateReopensFileWhenRenameFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+
+	// A non-empty folder where the rotated file would go makes the rename fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	r, err := openRotating(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"0123456789", "abcdefghij"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("writing %q: %v", line, err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "0123456789abcdefghij" {
+		t.Errorf("log holds %q, want both writes", data)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+	r, err := openRotating(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"1111111111", "2222222222", "3333333333"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{"test.log": "3333333333", "test.log.1": "2222222222", "test.log.2": "1111111111"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
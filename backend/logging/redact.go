@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Attributes whose key contains one of these are never written
+var secretKeys = []string{
+	"token", "secret", "password", "passwd", "api_key", "apikey",
+	"authorization", "cookie", "credential", "refresh", "code_verifier",
+}
+
+// Values that look like credentials are masked wherever they appear:
+// bearer headers, Google access and refresh tokens, and API keys
+var secretValues = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`ya29\.[A-Za-z0-9._-]+`),
+	regexp.MustCompile(`1//[A-Za-z0-9._-]+`),
+	regexp.MustCompile(`csk-[A-Za-z0-9]+`),
+	regexp.MustCompile(`AIza[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`([?&](?:access_token|refresh_token|code|key)=)[^&\s"]+`),
+}
+
+// Redact masks anything in s that looks like a credential
+func Redact(s string) string {
+	for _, re := range secretValues {
+		if re.NumSubexp() > 0 {
+			s = re.ReplaceAllString(s, "${1}"+redacted)
+		} else {
+			s = re.ReplaceAllString(s, redacted)
+		}
+	}
+	return s
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAttr is the ReplaceAttr hook applied to every record
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if isSecretKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
@@ -0,0 +1,135 @@
+package backend
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statDetails holds the platform-specific parts of a stat call
+type statDetails struct {
+	created  time.Time
+	accessed time.Time
+	uid      uint32
+	gid      uint32
+	hasOwner bool
+	links    uint64
+}
+
+// Cache for uid/gid name lookups, which hit /etc/passwd or directory services
+var (
+	userNames  = make(map[uint32]string)
+	groupNames = make(map[uint32]string)
+	ownerMux   sync.RWMutex
+)
+
+// MIME types Go's mime package doesn't know on every platform
+var extraMimeTypes = map[string]string{
+	".md":      "text/markdown",
+	".heic":    "image/heic",
+	".mkv":     "video/x-matroska",
+	".flac":    "audio/flac",
+	".m4a":     "audio/mp4",
+	".tgz":     "application/gzip",
+	".gz":      "application/gzip",
+	".bz2":     "application/x-bzip2",
+	".xz":      "application/x-xz",
+	".zst":     "application/zstd",
+	".7z":      "application/x-7z-compressed",
+	".dmg":     "application/x-apple-diskimage",
+	".pages":   "application/vnd.apple.pages",
+	".numbers": "application/vnd.apple.numbers",
+	".key":     "application/vnd.apple.keynote",
+	".goox":    "application/vnd.google-apps.document",
+	".gsheet":  "application/vnd.google-apps.spreadsheet",
+	".gslides": "application/vnd.google-apps.presentation",
+	".gform":   "application/vnd.google-apps.form",
+	".gdraw":   "application/vnd.google-apps.drawing",
+}
+
+// MimeTypeOf guesses a MIME type from the file name alone
+func MimeTypeOf(name string, isDirectory bool) string {
+	if isDirectory {
+		return "inode/directory"
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	if mimeType, ok := extraMimeTypes[ext]; ok {
+		return mimeType
+	}
+	if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+		// Drop parameters such as "; charset=utf-8"
+		if i := strings.Index(mimeType, ";"); i != -1 {
+			mimeType = mimeType[:i]
+		}
+		return strings.TrimSpace(mimeType)
+	}
+	return "application/octet-stream"
+}
+
+// sniffMimeType reads the start of a file to detect its MIME type
+func sniffMimeType(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, _ := file.Read(buf)
+	if n == 0 {
+		return ""
+	}
+
+	mimeType := http.DetectContentType(buf[:n])
+	if i := strings.Index(mimeType, ";"); i != -1 {
+		mimeType = mimeType[:i]
+	}
+	return mimeType
+}
+
+func lookupUserName(uid uint32) string {
+	ownerMux.RLock()
+	name, ok := userNames[uid]
+	ownerMux.RUnlock()
+	if ok {
+		return name
+	}
+
+	id := strconv.FormatUint(uint64(uid), 10)
+	name = id
+	if u, err := user.LookupId(id); err == nil {
+		name = u.Username
+	}
+
+	ownerMux.Lock()
+	userNames[uid] = name
+	ownerMux.Unlock()
+	return name
+}
+
+func lookupGroupName(gid uint32) string {
+	ownerMux.RLock()
+	name, ok := groupNames[gid]
+	ownerMux.RUnlock()
+	if ok {
+		return name
+	}
+
+	id := strconv.FormatUint(uint64(gid), 10)
+	name = id
+	if g, err := user.LookupGroupId(id); err == nil {
+		name = g.Name
+	}
+
+	ownerMux.Lock()
+	groupNames[gid] = name
+	ownerMux.Unlock()
+	return name
+}
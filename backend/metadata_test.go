@@ -0,0 +1,199 @@
+package backend
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"Finder-2/backend/database"
+)
+
+func TestMimeTypeOf(t *testing.T) {
+	tests := []struct {
+		name        string
+		isDirectory bool
+		want        string
+	}{
+		{"photos", true, "inode/directory"},
+		{"notes.md", false, "text/markdown"},
+		{"IMG_0001.HEIC", false, "image/heic"},
+		{"backup.tar.gz", false, "application/gzip"},
+		{"report.gsheet", false, "application/vnd.google-apps.spreadsheet"},
+		{"index.html", false, "text/html"},
+		{"photo.PNG", false, "image/png"},
+		{"README", false, "application/octet-stream"},
+		{"archive.unknownext", false, "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := MimeTypeOf(tt.name, tt.isDirectory); got != tt.want {
+			t.Errorf("MimeTypeOf(%q, %v) = %q, want %q", tt.name, tt.isDirectory, got, tt.want)
+		}
+	}
+}
+
+func TestSniffMimeType(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"pdf", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"text", []byte("just some words\n"), "text/plain"},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, tt.content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := sniffMimeType(path); got != tt.want {
+			t.Errorf("sniffMimeType(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := sniffMimeType(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("sniffMimeType(missing) = %q, want empty", got)
+	}
+}
+
+func TestGetFileInfoSniffsUnknownExtensions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scan")
+	if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	item, err := GetFileInfo(database.NewMemoryStore(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.MimeType != "image/png" {
+		t.Errorf("MimeType = %q, want image/png", item.MimeType)
+	}
+}
+
+func TestGetFileInfoAttachesTags(t *testing.T) {
+	store := database.NewMemoryStore()
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateTag("Work", "blue"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddFileTag(path, "Work"); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := GetFileInfo(store, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(item.Tags) != 1 || item.Tags[0] != "Work" {
+		t.Errorf("Tags = %v, want [Work] as in a listing", item.Tags)
+	}
+}
+
+func TestLookupOwnerNames(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("no current user:", err)
+	}
+	uid, _ := strconv.ParseUint(current.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(current.Gid, 10, 32)
+
+	if got := lookupUserName(uint32(uid)); got != current.Username {
+		t.Errorf("lookupUserName(%d) = %q, want %q", uid, got, current.Username)
+	}
+	if group, err := user.LookupGroupId(current.Gid); err == nil {
+		if got := lookupGroupName(uint32(gid)); got != group.Name {
+			t.Errorf("lookupGroupName(%d) = %q, want %q", gid, got, group.Name)
+		}
+	}
+
+	// IDs with no account fall back to the number itself
+	const unknown = 3999999
+	if got := lookupUserName(unknown); got != "3999999" {
+		t.Errorf("lookupUserName(%d) = %q, want the number", unknown, got)
+	}
+	if got := lookupGroupName(unknown); got != "3999999" {
+		t.Errorf("lookupGroupName(%d) = %q, want the number", unknown, got)
+	}
+}
+
+func TestNewFileItem(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.md")
+	script := filepath.Join(dir, "run.sh")
+	folder := filepath.Join(dir, "Tools.app")
+	if err := os.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(file, filepath.Join(dir, "notes-link.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("notes.md", filepath.Join(dir, "latest")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("gone.txt", filepath.Join(dir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want FileItem
+	}{
+		{"notes.md", FileItem{Size: 5, MimeType: "text/markdown", Mode: 0644, HardLinks: 2, Permissions: "-rw-r--r--"}},
+		{"run.sh", FileItem{Size: 10, Mode: 0755, HardLinks: 1, IsExecutable: true, Permissions: "-rwxr-xr-x"}},
+		{"Tools.app", FileItem{IsDirectory: true, IsApp: true, MimeType: "inode/directory", Mode: 0755}},
+		{"latest", FileItem{Size: 5, IsSymlink: true, SymlinkTarget: "notes.md", Mode: 0644, HardLinks: 2}},
+		{"dangling", FileItem{IsSymlink: true, SymlinkTarget: "gone.txt", IsBrokenLink: true}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := NewFileItem(path, info)
+		want := tt.want
+
+		if got.Name != tt.name || got.Path != path {
+			t.Errorf("%s: name/path = %q/%q", tt.name, got.Name, got.Path)
+		}
+		if got.IsDirectory != want.IsDirectory || got.IsApp != want.IsApp || got.IsExecutable != want.IsExecutable {
+			t.Errorf("%s: directory/app/executable = %v/%v/%v, want %v/%v/%v", tt.name,
+				got.IsDirectory, got.IsApp, got.IsExecutable, want.IsDirectory, want.IsApp, want.IsExecutable)
+		}
+		if got.IsSymlink != want.IsSymlink || got.SymlinkTarget != want.SymlinkTarget || got.IsBrokenLink != want.IsBrokenLink {
+			t.Errorf("%s: symlink/target/broken = %v/%q/%v, want %v/%q/%v", tt.name,
+				got.IsSymlink, got.SymlinkTarget, got.IsBrokenLink, want.IsSymlink, want.SymlinkTarget, want.IsBrokenLink)
+		}
+		if !want.IsDirectory && !want.IsBrokenLink && got.Size != want.Size {
+			t.Errorf("%s: size = %d, want %d", tt.name, got.Size, want.Size)
+		}
+		if want.MimeType != "" && got.MimeType != want.MimeType {
+			t.Errorf("%s: mime type = %q, want %q", tt.name, got.MimeType, want.MimeType)
+		}
+		if want.Mode != 0 && got.Mode != want.Mode {
+			t.Errorf("%s: mode = %o, want %o", tt.name, got.Mode, want.Mode)
+		}
+		if want.Permissions != "" && got.Permissions != want.Permissions {
+			t.Errorf("%s: permissions = %q, want %q", tt.name, got.Permissions, want.Permissions)
+		}
+		if want.HardLinks != 0 && got.HardLinks != want.HardLinks {
+			t.Errorf("%s: hard links = %d, want %d", tt.name, got.HardLinks, want.HardLinks)
+		}
+		if got.ModifiedTime == "" || got.CreatedTime == "" || got.AccessedTime == "" {
+			t.Errorf("%s: missing times %q/%q/%q", tt.name, got.ModifiedTime, got.CreatedTime, got.AccessedTime)
+		}
+	}
+}
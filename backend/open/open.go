@@ -1,25 +1,38 @@
 package open
 
 import (
+	"context"
 	"os/exec"
 	"strings"
 
+	"Finder-2/backend/database"
+	"Finder-2/backend/gdrive"
 	"Finder-2/backend/google"
+	"Finder-2/backend/pointers"
 )
 
-func OpenFile(path string) error {
-	// Check if this is a .goox file (Google Doc pointer)
-	if strings.HasSuffix(path, ".goox") {
-		return google.OpenGoogleDoc(path)
+func OpenFile(store database.ExternalFileStore, path string) error {
+	// Drive files open in the browser
+	if gdrive.IsPath(path) {
+		file, err := gdrive.Stat(context.Background(), path)
+		if err != nil {
+			return err
+		}
+		return exec.Command("open", file.WebLink).Run()
+	}
+
+	// Pointer files open the Google file they stand for
+	if pointers.TypeOf(path) != "" {
+		return google.OpenGoogleFile(store, path)
 	}
 
 	cmd := exec.Command("open", path)
 	return cmd.Run()
 }
 
-func OpenApplication(path string) error {
+func OpenApplication(store database.ExternalFileStore, path string) error {
 	if !strings.HasSuffix(path, ".app") {
-		return OpenFile(path)
+		return OpenFile(store, path)
 	}
 	cmd := exec.Command("open", "-a", path)
 	return cmd.Run()
@@ -0,0 +1,78 @@
+package pointers
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"Finder-2/backend/apperror"
+)
+
+// FormatVersion is the version of the pointer file format Write produces.
+// Version 0 files, the original format, hold nothing but the file ID.
+const FormatVersion = 1
+
+// Pointer is what a pointer file says about the Google file it stands for,
+// enough to rebuild its external_files row if the database is lost
+type Pointer struct {
+	Version  int    `json:"version"`
+	FileID   string `json:"fileId"`
+	MimeType string `json:"mimeType,omitempty"`
+	Account  string `json:"account,omitempty"` // email of the Google account that owns it
+	Name     string `json:"name,omitempty"`
+	WebLink  string `json:"webLink,omitempty"`
+}
+
+// Kind returns the kind of pointer p is, going by its MIME type, or by the
+// extension of path for files that don't record one
+func (p *Pointer) Kind(path string) (Kind, bool) {
+	if k, ok := KindOfMimeType(p.MimeType); ok {
+		return k, true
+	}
+	return KindOfPath(path)
+}
+
+// Read parses a pointer file in either format. Legacy files get the MIME
+// type their extension implies.
+func Read(path string) (*Pointer, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, apperror.FromOS(err, path)
+	}
+	content = bytes.TrimSpace(content)
+
+	p := &Pointer{}
+	if bytes.HasPrefix(content, []byte("{")) {
+		if err := json.Unmarshal(content, p); err != nil {
+			return nil, apperror.Wrap(apperror.CodeInvalid, err, "%s is not a valid pointer file", path)
+		}
+		if p.Version > FormatVersion {
+			return nil, apperror.New(apperror.CodeInvalid, "%s was written by a newer version of the app", path)
+		}
+	} else {
+		p.FileID = string(content)
+	}
+
+	p.FileID = strings.TrimSpace(p.FileID)
+	if p.FileID == "" {
+		return nil, apperror.New(apperror.CodeInvalid, "%s doesn't name a Google file", path)
+	}
+	if p.MimeType == "" {
+		if k, ok := KindOfPath(path); ok {
+			p.MimeType = k.MimeType
+		}
+	}
+	return p, nil
+}
+
+// Write saves p to path in the current format
+func Write(path string, p Pointer) error {
+	p.Version = FormatVersion
+	content, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+	return apperror.FromOS(os.WriteFile(path, content, 0644), path)
+}
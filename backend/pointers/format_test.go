@@ -0,0 +1,57 @@
+package pointers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Plan.gsheet")
+	want := Pointer{FileID: "sheet-1", MimeType: "application/vnd.google-apps.spreadsheet", Account: "a@example.com", Name: "Plan"}
+	if err := Write(path, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Version = FormatVersion
+	if *got != want {
+		t.Errorf("Read = %+v, want %+v", *got, want)
+	}
+}
+
+func TestReadLegacyPointer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Notes.goox")
+	if err := os.WriteFile(path, []byte("  doc-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != 0 || p.FileID != "doc-1" || p.MimeType != "application/vnd.google-apps.document" {
+		t.Errorf("Read = %+v, want version 0 doc-1 with the Docs MIME type", *p)
+	}
+}
+
+func TestReadRejectsInvalidPointers(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"empty.goox":  "  \n",
+		"broken.goox": "{not json",
+		"newer.goox":  `{"version": 99, "fileId": "x"}`,
+		"noid.goox":   `{"version": 1}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := Read(path); err == nil {
+			t.Errorf("Read(%s) = %+v, want an error", name, *p)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package pointers
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/logging"
+)
+
+var logger = logging.For("pointers")
+
+// Kind describes one sort of pointer file
+type Kind struct {
+	Extension string `json:"extension"`
+	Type      string `json:"type"`     // the external_files type it's recorded under
+	MimeType  string `json:"mimeType"` // of the Google file it stands for
+	Label     string `json:"label"`
+	urlFormat string
+}
+
+// Kinds lists every sort of pointer file. Docs keep the .goox extension they
+// have always had.
+var Kinds = []Kind{
+	{".goox", "google_doc", "application/vnd.google-apps.document", "Google Doc", "https://docs.google.com/document/d/%s/edit"},
+	{".gsheet", "google_sheet", "application/vnd.google-apps.spreadsheet", "Google Sheet", "https://docs.google.com/spreadsheets/d/%s/edit"},
+	{".gslides", "google_slides", "application/vnd.google-apps.presentation", "Google Slides", "https://docs.google.com/presentation/d/%s/edit"},
+	{".gform", "google_form", "application/vnd.google-apps.form", "Google Form", "https://docs.google.com/forms/d/%s/edit"},
+	{".gdraw", "google_drawing", "application/vnd.google-apps.drawing", "Google Drawing", "https://docs.google.com/drawings/d/%s/edit"},
+}
+
+// URL returns the address a pointer's Google file is edited at
+func (k Kind) URL(fileID string) string {
+	return fmt.Sprintf(k.urlFormat, url.PathEscape(fileID))
+}
+
+// KindOfPath returns the kind of a pointer file, going by its extension
+func KindOfPath(path string) (Kind, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, k := range Kinds {
+		if k.Extension == ext {
+			return k, true
+		}
+	}
+	return Kind{}, false
+}
+
+// KindOfType returns the kind recorded under an external_files type
+func KindOfType(fileType string) (Kind, bool) {
+	for _, k := range Kinds {
+		if k.Type == fileType {
+			return k, true
+		}
+	}
+	return Kind{}, false
+}
+
+// KindOfMimeType returns the kind that stands for Google files of mimeType
+func KindOfMimeType(mimeType string) (Kind, bool) {
+	for _, k := range Kinds {
+		if k.MimeType == mimeType {
+			return k, true
+		}
+	}
+	return Kind{}, false
+}
+
+// TypeOf returns the external_files type of a pointer file, or "" when path
+// isn't one
+func TypeOf(path string) string {
+	k, _ := KindOfPath(path)
+	return k.Type
+}
+
+// ReadFileID returns the ID of the online file a pointer stands for
+func ReadFileID(path string) (string, error) {
+	p, err := Read(path)
+	if err != nil {
+		return "", err
+	}
+	return p.FileID, nil
+}
+
+// Moved keeps the mappings of a pointer, or of every pointer inside a
+// folder, after it is renamed or moved. Like tags.Moved it's called after
+// the file operation succeeded; a failure only leaves a row for Reconcile.
+func Moved(store database.ExternalFileStore, oldPath, newPath string) {
+	if err := store.MoveExternalFiles(oldPath, newPath); err != nil {
+		logger.Warn("failed to move external file mappings", "from", oldPath, "to", newPath, "error", err)
+	}
+}
+
+// Copied maps copies of pointers to the same online files as the originals
+func Copied(store database.ExternalFileStore, srcPath, dstPath string) {
+	if err := store.CopyExternalFiles(srcPath, dstPath); err != nil {
+		logger.Warn("failed to copy external file mappings", "from", srcPath, "to", dstPath, "error", err)
+	}
+}
+
+// Removed forgets the mappings of a deleted pointer or folder. The online
+// files themselves are left alone.
+func Removed(store database.ExternalFileStore, path string) {
+	if err := store.DeleteExternalFiles(path); err != nil {
+		logger.Warn("failed to delete external file mappings", "path", path, "error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package pointers
+
+import (
+	"reflect"
+	"testing"
+
+	"Finder-2/backend/database"
+)
+
+// addMappings records each pointer path as standing for its file ID in a
+// fresh store
+func addMappings(t *testing.T, rows map[string]string) database.Store {
+	t.Helper()
+	_, store := setup(t)
+	for path, fileID := range rows {
+		if err := store.AddExternalFile(TypeOf(path), path, fileID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+var fixtureMappings = map[string]string{
+	"/docs/plan.goox":         "doc1",
+	"/docs/sub/budget.gsheet": "sheet1",
+	"/docs-old/notes.goox":    "doc2", // shares a prefix with /docs
+	"/docsplan.goox":          "doc3",
+}
+
+func TestMovedUpdatesMappings(t *testing.T) {
+	store := addMappings(t, fixtureMappings)
+
+	Moved(store, "/docs", "/archive/docs")
+	Moved(store, "/docsplan.goox", "/plan.goox")
+
+	want := map[string]string{
+		"/archive/docs/plan.goox":         "doc1",
+		"/archive/docs/sub/budget.gsheet": "sheet1",
+		"/docs-old/notes.goox":            "doc2",
+		"/plan.goox":                      "doc3",
+	}
+	if got := mappings(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("mappings = %v, want %v", got, want)
+	}
+}
+
+func TestCopiedMapsCopiesToTheSameFiles(t *testing.T) {
+	store := addMappings(t, fixtureMappings)
+
+	Copied(store, "/docs", "/copy")
+	Copied(store, "/docs-old/notes.goox", "/notes copy.goox")
+
+	want := map[string]string{
+		"/docs/plan.goox":         "doc1",
+		"/docs/sub/budget.gsheet": "sheet1",
+		"/copy/plan.goox":         "doc1",
+		"/copy/sub/budget.gsheet": "sheet1",
+		"/docs-old/notes.goox":    "doc2",
+		"/notes copy.goox":        "doc2",
+		"/docsplan.goox":          "doc3",
+	}
+	if got := mappings(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("mappings = %v, want %v", got, want)
+	}
+	row, err := store.GetExternalFileByPath("/copy/sub/budget.gsheet")
+	if err != nil || row == nil || row.Type != "google_sheet" {
+		t.Errorf("copied row = %+v, %v, want type google_sheet", row, err)
+	}
+}
+
+func TestRemovedForgetsMappings(t *testing.T) {
+	store := addMappings(t, fixtureMappings)
+
+	Removed(store, "/docs")
+	Removed(store, "/docsplan.goox")
+
+	want := map[string]string{"/docs-old/notes.goox": "doc2"}
+	if got := mappings(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("mappings = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package pointers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/sandbox"
+)
+
+// RebuildReport says what Rebuild changed
+type RebuildReport struct {
+	Scanned  int      `json:"scanned"`  // pointer files found on disk
+	Added    []string `json:"added"`    // pointers that had no mapping
+	Updated  []string `json:"updated"`  // mappings whose type or file ID disagreed with the pointer
+	Upgraded []string `json:"upgraded"` // legacy pointers rewritten in the current format
+}
+
+// Rebuild repopulates external_files from the pointer files under roots, or
+// the home folder when none are given, trusting what each pointer says over
+// the database. Unlike Reconcile it never drops a mapping, so it's safe to
+// run on a partial set of folders, such as after finder.db was deleted.
+// Legacy ID-only pointers are rewritten in the current format, recording
+// account as their owner.
+func Rebuild(ctx context.Context, store database.ExternalFileStore, roots []string, account string) (*RebuildReport, error) {
+	reconcileMux.Lock()
+	defer reconcileMux.Unlock()
+
+	if len(roots) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		roots = []string{homeDir}
+	}
+
+	found, err := scan(ctx, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RebuildReport{Scanned: len(found)}
+	for path, p := range found {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		row, err := store.GetExternalFileByPath(path)
+		if err != nil {
+			return report, err
+		}
+		switch {
+		case row == nil:
+			if err := store.AddExternalFile(p.fileType, path, p.fileID); err != nil {
+				return report, err
+			}
+			report.Added = append(report.Added, path)
+		case row.Type != p.fileType || row.FileID != p.fileID:
+			if err := store.DeleteExternalFile(path); err != nil {
+				return report, err
+			}
+			if err := store.AddExternalFile(p.fileType, path, p.fileID); err != nil {
+				return report, err
+			}
+			report.Updated = append(report.Updated, path)
+		}
+
+		if p.content.Version < FormatVersion {
+			if err := upgrade(path, *p.content, account); err != nil {
+				logger.Warn("failed to upgrade pointer file", "path", path, "error", err)
+				continue
+			}
+			report.Upgraded = append(report.Upgraded, path)
+		}
+	}
+
+	logger.Info("external files rebuilt",
+		"scanned", report.Scanned,
+		"added", len(report.Added),
+		"updated", len(report.Updated),
+		"upgraded", len(report.Upgraded))
+	return report, nil
+}
+
+// upgrade rewrites a legacy pointer in the current format, filling in what
+// its extension and name imply
+func upgrade(path string, p Pointer, account string) error {
+	if _, err := sandbox.Check(path, sandbox.Write); err != nil {
+		return err
+	}
+
+	if p.Account == "" {
+		p.Account = account
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if kind, ok := p.Kind(path); ok && p.WebLink == "" {
+		p.WebLink = kind.URL(p.FileID)
+	}
+	return Write(path, p)
+}
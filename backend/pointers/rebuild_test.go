@@ -0,0 +1,48 @@
+package pointers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeLegacy writes a pointer in the original format, just the file ID
+func writeLegacy(t *testing.T, path string, fileID string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(fileID), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	dir, store := setup(t)
+	legacy := filepath.Join(dir, "Notes.goox")
+	current := filepath.Join(dir, "Plan.gsheet")
+	writeLegacy(t, legacy, "doc-1")
+	writePointer(t, current, "sheet-1")
+	// A wrong row is corrected and a row without a pointer is left alone
+	store.AddExternalFile("google_doc", current, "wrong")
+	store.AddExternalFile("google_doc", filepath.Join(dir, "other", "x.goox"), "doc-x")
+
+	report, err := Rebuild(context.Background(), store, []string{dir}, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Added) != 1 || len(report.Updated) != 1 || len(report.Upgraded) != 1 {
+		t.Errorf("report = %+v, want 1 added, 1 updated, 1 upgraded", report)
+	}
+
+	got := mappings(t, store)
+	if got[legacy] != "doc-1" || got[current] != "sheet-1" || got[filepath.Join(dir, "other", "x.goox")] != "doc-x" {
+		t.Errorf("mappings = %v", got)
+	}
+
+	p, err := Read(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != FormatVersion || p.Account != "a@example.com" || p.Name != "Notes" || p.WebLink == "" {
+		t.Errorf("upgraded pointer = %+v", *p)
+	}
+}
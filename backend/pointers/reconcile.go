@@ -0,0 +1,262 @@
+package pointers
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"Finder-2/backend/database"
+)
+
+// Folders never scanned for pointer files: they're large and never hold any
+var skipDirs = map[string]bool{
+	"node_modules": true,
+	"Library":      true,
+	"vendor":       true,
+}
+
+// Relink is a stale mapping matched to a pointer file found elsewhere
+type Relink struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Report says what Reconcile changed
+type Report struct {
+	Scanned  int      `json:"scanned"`  // pointer files found on disk
+	Relinked []Relink `json:"relinked"` // mappings whose pointer had moved
+	Removed  []string `json:"removed"`  // mappings whose pointer is gone
+	Adopted  []string `json:"adopted"`  // pointer files that had no mapping
+}
+
+var reconcileMux sync.Mutex
+
+// Reconcile compares external_files with the pointer files under roots, or
+// under the folders known pointers are in when none are given, so the pass
+// at startup doesn't walk the whole home folder; Rebuild finds pointers
+// elsewhere. A mapping whose file is gone is re-pointed to a pointer found
+// with the same file ID, or else dropped, and pointer files without a
+// mapping get one. Mappings on a volume or share that isn't mounted are
+// kept, since their pointers aren't gone. Only pointer mappings are
+// looked at; other rows, such as drivesync's, are left to their owners.
+func Reconcile(ctx context.Context, store database.ExternalFileStore, roots []string) (*Report, error) {
+	reconcileMux.Lock()
+	defer reconcileMux.Unlock()
+
+	rows, err := pointerRows(store)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(roots) == 0 {
+		roots = knownFolders(rows)
+	}
+
+	found, err := scan(ctx, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Scanned: len(found)}
+
+	// Pointers on disk without a mapping, by type and file ID
+	mapped := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		mapped[row.Path] = true
+	}
+	orphans := make(map[string][]string)
+	for path, p := range found {
+		if !mapped[path] {
+			orphans[p.key()] = append(orphans[p.key()], path)
+		}
+	}
+
+	for _, row := range rows {
+		if _, err := os.Lstat(row.Path); !os.IsNotExist(err) {
+			continue
+		}
+
+		key := pointer{fileType: row.Type, fileID: row.FileID}.key()
+		if candidates := orphans[key]; len(candidates) > 0 {
+			to := candidates[0]
+			orphans[key] = candidates[1:]
+			if err := store.UpdateExternalFilePath(row.Path, to); err != nil {
+				return report, err
+			}
+			report.Relinked = append(report.Relinked, Relink{From: row.Path, To: to})
+			continue
+		}
+
+		if !volumeMounted(row.Path) {
+			logger.Debug("keeping mapping on an unmounted volume", "path", row.Path)
+			continue
+		}
+		if err := store.DeleteExternalFile(row.Path); err != nil {
+			return report, err
+		}
+		report.Removed = append(report.Removed, row.Path)
+	}
+
+	for _, paths := range orphans {
+		for _, path := range paths {
+			p := found[path]
+			if err := store.AddExternalFile(p.fileType, path, p.fileID); err != nil {
+				return report, err
+			}
+			report.Adopted = append(report.Adopted, path)
+		}
+	}
+
+	logger.Info("external files reconciled",
+		"scanned", report.Scanned,
+		"relinked", len(report.Relinked),
+		"removed", len(report.Removed),
+		"adopted", len(report.Adopted))
+	return report, nil
+}
+
+// pointerRows returns the external_files rows of every pointer kind
+func pointerRows(store database.ExternalFileStore) ([]database.ExternalFile, error) {
+	var rows []database.ExternalFile
+	for _, k := range Kinds {
+		kindRows, err := store.ListExternalFilesByType(k.Type)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, kindRows...)
+	}
+	return rows, nil
+}
+
+// knownFolders returns the folders holding the pointers in rows that still
+// exist, leaving out any inside another since scan walks into them anyway
+func knownFolders(rows []database.ExternalFile) []string {
+	var folders []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		folder := filepath.Dir(row.Path)
+		if seen[folder] {
+			continue
+		}
+		seen[folder] = true
+		if info, err := os.Stat(folder); err == nil && info.IsDir() {
+			folders = append(folders, folder)
+		}
+	}
+
+	sort.Strings(folders)
+	var roots []string
+	for _, folder := range folders {
+		if n := len(roots); n > 0 && (roots[n-1] == "/" || strings.HasPrefix(folder, roots[n-1]+string(os.PathSeparator))) {
+			continue
+		}
+		roots = append(roots, folder)
+	}
+	return roots
+}
+
+// volumeMounted reports whether the volume or share path is on is mounted.
+// A missing pointer whose folder still exists is certainly gone. Otherwise
+// a path under a mount folder, such as /Volumes/Backup/..., depends on its
+// mount point existing; anywhere else is on the system volume, which always
+// is.
+func volumeMounted(path string) bool {
+	if info, err := os.Stat(filepath.Dir(path)); err == nil && info.IsDir() {
+		return true
+	}
+	mountPoint := mountPointOf(path)
+	if mountPoint == "" {
+		return true
+	}
+	_, err := os.Stat(mountPoint)
+	return err == nil
+}
+
+// mountPointDepths is how many parts of a path under each mount folder name
+// its volume, counting the mount folder: /Volumes/<volume>,
+// /media/<user>/<volume>, /run/user/<uid>/gvfs/<share> and so on
+var mountPointDepths = []struct {
+	prefix string
+	depth  int
+}{
+	{"/Volumes", 2},
+	{"/mnt", 2},
+	{"/media", 3},
+	{"/run/media", 4},
+	{"/run/user", 5},
+}
+
+// mountPointOf returns where the volume holding path is mounted, or "" for
+// paths on the system volume
+func mountPointOf(path string) string {
+	path = filepath.Clean(path)
+	for _, m := range mountPointDepths {
+		if path != m.prefix && !strings.HasPrefix(path, m.prefix+"/") {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		if len(parts) < m.depth {
+			return ""
+		}
+		return "/" + strings.Join(parts[:m.depth], "/")
+	}
+	return ""
+}
+
+type pointer struct {
+	fileType string
+	fileID   string
+	content  *Pointer
+}
+
+func (p pointer) key() string {
+	return p.fileType + "\x00" + p.fileID
+}
+
+// scan finds every readable pointer file under roots, skipping hidden and
+// known-heavy folders
+func scan(ctx context.Context, roots []string) (map[string]pointer, error) {
+	found := make(map[string]pointer)
+
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				// Unreadable folders are skipped rather than failing the scan
+				if d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if d.IsDir() {
+				if path != root && (strings.HasPrefix(d.Name(), ".") || skipDirs[d.Name()]) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if TypeOf(path) == "" || !d.Type().IsRegular() {
+				return nil
+			}
+			content, err := Read(path)
+			if err != nil {
+				return nil
+			}
+			kind, _ := content.Kind(path)
+			found[path] = pointer{fileType: kind.Type, fileID: content.FileID, content: content}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
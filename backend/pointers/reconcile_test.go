@@ -0,0 +1,177 @@
+package pointers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/sandbox"
+)
+
+// setup allows writes inside a temporary folder, uses an empty memory store
+// and returns both
+func setup(t *testing.T) (string, database.Store) {
+	t.Helper()
+	dir := t.TempDir()
+	previous := sandbox.GetPolicy()
+	if err := sandbox.SetPolicy(sandbox.Policy{AllowedRoots: []string{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sandbox.SetPolicy(previous) })
+	return dir, database.NewMemoryStore()
+}
+
+func writePointer(t *testing.T, path string, fileID string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(path, Pointer{FileID: fileID}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mappings(t *testing.T, store database.Store) map[string]string {
+	t.Helper()
+	rows, err := store.ListExternalFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]string, len(rows))
+	for _, row := range rows {
+		byPath[row.Path] = row.FileID
+	}
+	return byPath
+}
+
+func TestReconcile(t *testing.T) {
+	dir, store := setup(t)
+	docs := filepath.Join(dir, "docs")
+
+	// moved.goox was renamed to renamed.goox while the app wasn't running
+	writePointer(t, filepath.Join(docs, "renamed.goox"), "doc-moved")
+	store.AddExternalFile("google_doc", filepath.Join(docs, "moved.goox"), "doc-moved")
+	// deleted.goox is gone from a folder that still exists
+	store.AddExternalFile("google_doc", filepath.Join(docs, "deleted.goox"), "doc-deleted")
+	// new.goox has no mapping yet
+	writePointer(t, filepath.Join(docs, "new.goox"), "doc-new")
+	// kept.goox is fine as it is
+	writePointer(t, filepath.Join(docs, "kept.goox"), "doc-kept")
+	store.AddExternalFile("google_doc", filepath.Join(docs, "kept.goox"), "doc-kept")
+
+	report, err := Reconcile(context.Background(), store, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 3 || len(report.Relinked) != 1 || len(report.Removed) != 1 || len(report.Adopted) != 1 {
+		t.Errorf("report = %+v, want 3 scanned, 1 relinked, 1 removed, 1 adopted", report)
+	}
+
+	want := map[string]string{
+		filepath.Join(docs, "renamed.goox"): "doc-moved",
+		filepath.Join(docs, "new.goox"):     "doc-new",
+		filepath.Join(docs, "kept.goox"):    "doc-kept",
+	}
+	got := mappings(t, store)
+	if len(got) != len(want) {
+		t.Errorf("mappings = %v, want %v", got, want)
+	}
+	for path, id := range want {
+		if got[path] != id {
+			t.Errorf("%s maps to %q, want %q", path, got[path], id)
+		}
+	}
+}
+
+func TestReconcileKeepsMappingsOnMissingFolders(t *testing.T) {
+	dir, store := setup(t)
+	unmounted := "/Volumes/Finder-2 test volume that isn't mounted/a.goox"
+	removedFolder := filepath.Join(dir, "gone", "b.goox")
+	store.AddExternalFile("google_doc", unmounted, "doc-a")
+	store.AddExternalFile("google_doc", removedFolder, "doc-b")
+
+	report, err := Reconcile(context.Background(), store, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := mappings(t, store)
+	if got[unmounted] != "doc-a" {
+		t.Errorf("the mapping on an unmounted volume was dropped: %+v", report)
+	}
+	// A missing folder on the system volume means the pointer is gone
+	if _, ok := got[removedFolder]; ok {
+		t.Errorf("the mapping in a deleted folder was kept: %+v", report)
+	}
+}
+
+func TestReconcileScansKnownFoldersByDefault(t *testing.T) {
+	dir, store := setup(t)
+	known := filepath.Join(dir, "known")
+	writePointer(t, filepath.Join(known, "a.goox"), "doc-a")
+	writePointer(t, filepath.Join(known, "sub", "b.goox"), "doc-b")
+	writePointer(t, filepath.Join(dir, "elsewhere", "c.goox"), "doc-c")
+	store.AddExternalFile("google_doc", filepath.Join(known, "a.goox"), "doc-a")
+
+	report, err := Reconcile(context.Background(), store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 2 || len(report.Adopted) != 1 || report.Adopted[0] != filepath.Join(known, "sub", "b.goox") {
+		t.Errorf("report = %+v, want only the known folder scanned", report)
+	}
+}
+
+func TestReconcileLeavesOtherMappingsAlone(t *testing.T) {
+	dir, store := setup(t)
+	synced := filepath.Join(dir, "synced")
+	writePointer(t, filepath.Join(dir, "docs", "a.goox"), "doc-a")
+	store.AddExternalFile("google_doc", filepath.Join(dir, "docs", "a.goox"), "doc-a")
+	// A synced file deleted outside the app is drivesync's to notice, and
+	// its folder isn't one to scan for pointers
+	writePointer(t, filepath.Join(synced, "stray.goox"), "doc-stray")
+	store.AddExternalFile("gdrive_sync", filepath.Join(synced, "gone.txt"), "drive-gone")
+
+	report, err := Reconcile(context.Background(), store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 1 || len(report.Removed) != 0 || len(report.Adopted) != 0 {
+		t.Errorf("report = %+v, want only docs scanned and nothing removed", report)
+	}
+	if got := mappings(t, store)[filepath.Join(synced, "gone.txt")]; got != "drive-gone" {
+		t.Errorf("the synced file's mapping = %q, want it kept", got)
+	}
+}
+
+func TestKnownFolders(t *testing.T) {
+	dir := t.TempDir()
+	rows := []database.ExternalFile{
+		{Path: filepath.Join(dir, "a.goox")},
+		{Path: filepath.Join(dir, "sub", "b.goox")},
+		{Path: filepath.Join(dir, "a.gsheet")},
+		{Path: "/nonexistent folder for Finder-2/c.goox"},
+	}
+	got := knownFolders(rows)
+	if len(got) != 1 || got[0] != dir {
+		t.Errorf("knownFolders = %v, want [%s]", got, dir)
+	}
+}
+
+func TestMountPointOf(t *testing.T) {
+	tests := map[string]string{
+		"/Volumes/Backup/docs/a.goox":            "/Volumes/Backup",
+		"/media/ann/USB/a.goox":                  "/media/ann/USB",
+		"/run/media/ann/USB/a.goox":              "/run/media/ann/USB",
+		"/run/user/1000/gvfs/smb-share:x/a.goox": "/run/user/1000/gvfs/smb-share:x",
+		"/mnt/nas/a.goox":                        "/mnt/nas",
+		"/home/ann/docs/a.goox":                  "",
+		"/Volumes":                               "",
+	}
+	for path, want := range tests {
+		if got := mountPointOf(path); got != want {
+			t.Errorf("mountPointOf(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package rename
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	tagDateTime         = 0x0132
+	tagExifIFDPointer   = 0x8769
+	tagDateTimeOriginal = 0x9003
+	exifTimeLayout      = "2006:01:02 15:04:05"
+)
+
+// exifDate reads the capture date from a JPEG's EXIF block, preferring
+// DateTimeOriginal over the IFD0 DateTime. ok is false if the file has none.
+func exifDate(path string) (time.Time, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+
+	tiff, ok := findExifSegment(bufio.NewReader(file))
+	if !ok {
+		return time.Time{}, false
+	}
+	return parseTIFFDate(tiff)
+}
+
+// findExifSegment walks the JPEG markers up to the APP1 Exif segment and
+// returns its TIFF payload
+func findExifSegment(r *bufio.Reader) ([]byte, bool) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, false
+	}
+
+	for {
+		var marker [2]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil || marker[0] != 0xFF {
+			return nil, false
+		}
+		// Start of scan: image data follows, no more metadata
+		if marker[1] == 0xDA {
+			return nil, false
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, false
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, false
+		}
+
+		if marker[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], true
+		}
+	}
+}
+
+func parseTIFFDate(tiff []byte) (time.Time, bool) {
+	if len(tiff) < 8 {
+		return time.Time{}, false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, false
+	}
+
+	ifd0 := order.Uint32(tiff[4:8])
+	entries := readIFD(tiff, ifd0, order)
+
+	if ptr, ok := entries[tagExifIFDPointer]; ok {
+		exifEntries := readIFD(tiff, ptr.value, order)
+		if t, ok := entryTime(tiff, exifEntries[tagDateTimeOriginal]); ok {
+			return t, true
+		}
+	}
+	return entryTime(tiff, entries[tagDateTime])
+}
+
+type ifdEntry struct {
+	count uint32
+	value uint32 // inline value or offset into the TIFF block
+}
+
+func readIFD(tiff []byte, offset uint32, order binary.ByteOrder) map[uint16]ifdEntry {
+	entries := make(map[uint16]ifdEntry)
+	if int(offset)+2 > len(tiff) {
+		return entries
+	}
+
+	n := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < n; i++ {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(tiff) {
+			break
+		}
+		entry := tiff[start : start+12]
+		entries[order.Uint16(entry[0:2])] = ifdEntry{
+			count: order.Uint32(entry[4:8]),
+			value: order.Uint32(entry[8:12]),
+		}
+	}
+	return entries
+}
+
+// entryTime decodes an ASCII date entry, which is always stored out of line
+// since EXIF dates are 20 bytes long
+func entryTime(tiff []byte, entry ifdEntry) (time.Time, bool) {
+	if entry.count < 19 || int(entry.value)+int(entry.count) > len(tiff) {
+		return time.Time{}, false
+	}
+
+	raw := strings.TrimRight(string(tiff[entry.value:entry.value+entry.count]), "\x00 ")
+	t, err := time.ParseInLocation(exifTimeLayout, raw, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,317 @@
+package rename
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/foldersize"
+	"Finder-2/backend/pointers"
+	"Finder-2/backend/sandbox"
+	"Finder-2/backend/tags"
+)
+
+// PreviewItem is the planned rename for one file
+type PreviewItem struct {
+	OldPath  string `json:"oldPath"`
+	NewPath  string `json:"newPath"`
+	NewName  string `json:"newName"`
+	Changed  bool   `json:"changed"`
+	Conflict string `json:"conflict,omitempty"` // why the rename can't happen, if it can't
+}
+
+// Preview is the planned result of a batch rename
+type Preview struct {
+	Items        []PreviewItem `json:"items"`
+	HasConflicts bool          `json:"hasConflicts"`
+	// Cycles lists groups of files that swap names (a->b, b->a). They are
+	// renamed safely through temporary names and are not conflicts.
+	Cycles [][]string `json:"cycles"`
+}
+
+// move is one rename that was applied
+type move struct {
+	from string
+	to   string
+}
+
+// Applied batches, most recent last, for UndoLastRename
+var (
+	history    [][]move
+	historyMux sync.Mutex
+)
+
+// PreviewRename computes what applying rules to paths would do without
+// touching the disk
+func PreviewRename(paths []string, rules []Rule) (*Preview, error) {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &Preview{Cycles: [][]string{}}
+	sources := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if sources[path] {
+			return nil, fmt.Errorf("path selected twice: %s", path)
+		}
+		sources[path] = true
+	}
+
+	byTarget := make(map[string][]int)
+	for i, path := range paths {
+		path = filepath.Clean(path)
+		newName := apply(compiled, path, i)
+		newPath := filepath.Join(filepath.Dir(path), newName)
+
+		preview.Items = append(preview.Items, PreviewItem{
+			OldPath:  path,
+			NewPath:  newPath,
+			NewName:  newName,
+			Changed:  newPath != path,
+			Conflict: validateName(newName),
+		})
+		byTarget[newPath] = append(byTarget[newPath], i)
+	}
+
+	for i := range preview.Items {
+		item := &preview.Items[i]
+		if item.Conflict == "" && item.Changed {
+			if same := byTarget[item.NewPath]; len(same) > 1 {
+				other := same[0]
+				if other == i {
+					other = same[1]
+				}
+				item.Conflict = "same name as " + filepath.Base(preview.Items[other].OldPath)
+			} else if !sources[item.NewPath] && existsAsOtherFile(item.NewPath, item.OldPath) {
+				item.Conflict = "a file with this name already exists"
+			}
+		}
+
+		if item.Conflict != "" {
+			preview.HasConflicts = true
+		}
+	}
+
+	preview.Cycles = findCycles(preview.Items)
+	return preview, nil
+}
+
+// ApplyRename renames paths according to rules, carrying their tags, pointer
+// mappings and folder sizes in store along. Either every file is renamed
+// or, if any rename fails, the ones already done are rolled back.
+func ApplyRename(store database.Store, paths []string, rules []Rule) (*Preview, error) {
+	preview, err := PreviewRename(paths, rules)
+	if err != nil {
+		return nil, err
+	}
+	if preview.HasConflicts {
+		return preview, fmt.Errorf("rename has conflicts")
+	}
+
+	var moves []move
+	for _, item := range preview.Items {
+		if item.Changed {
+			if _, err := sandbox.Check(item.OldPath, sandbox.Remove); err != nil {
+				return preview, err
+			}
+			moves = append(moves, move{from: item.OldPath, to: item.NewPath})
+		}
+	}
+
+	if err := applyMoves(store, moves); err != nil {
+		return preview, err
+	}
+
+	historyMux.Lock()
+	history = append(history, moves)
+	historyMux.Unlock()
+
+	return preview, nil
+}
+
+// UndoLastRename reverses the most recent batch rename
+func UndoLastRename(store database.Store) error {
+	historyMux.Lock()
+	defer historyMux.Unlock()
+
+	if len(history) == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	last := history[len(history)-1]
+	reversed := make([]move, len(last))
+	for i, m := range last {
+		reversed[i] = move{from: m.to, to: m.from}
+	}
+
+	for _, m := range reversed {
+		if _, err := sandbox.Check(m.from, sandbox.Remove); err != nil {
+			return err
+		}
+		if _, err := os.Lstat(m.from); err != nil {
+			return fmt.Errorf("cannot undo, %s is gone: %w", m.from, err)
+		}
+		if _, err := os.Lstat(m.to); err == nil && !isSource(reversed, m.to) {
+			return fmt.Errorf("cannot undo, %s already exists", m.to)
+		}
+	}
+
+	if err := applyMoves(store, reversed); err != nil {
+		return err
+	}
+
+	history = history[:len(history)-1]
+	return nil
+}
+
+// applyMoves renames in two phases: every source to a temporary name, then
+// every temporary name to its target. This makes swaps and chains safe and
+// handles case-only renames on case-insensitive filesystems.
+func applyMoves(store database.Store, moves []move) error {
+	stamp := time.Now().UnixNano()
+	temps := make([]string, len(moves))
+	for i, m := range moves {
+		temps[i] = filepath.Join(filepath.Dir(m.from), fmt.Sprintf(".rename-%d-%d", stamp, i))
+	}
+
+	// Phase one: sources to temporary names
+	for i, m := range moves {
+		if err := os.Rename(m.from, temps[i]); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				os.Rename(temps[j], moves[j].from)
+			}
+			return fmt.Errorf("failed to rename %s: %w", filepath.Base(m.from), err)
+		}
+	}
+
+	// Phase two: temporary names to targets. Every source is out of the way
+	// by now, so anything at a target appeared after the preview and is
+	// never overwritten.
+	for i, m := range moves {
+		err := fs.ErrExist
+		if _, statErr := os.Lstat(m.to); errors.Is(statErr, fs.ErrNotExist) {
+			err = os.Rename(temps[i], m.to)
+		}
+		if err != nil {
+			for j := i - 1; j >= 0; j-- {
+				os.Rename(moves[j].to, temps[j])
+			}
+			for j := range moves {
+				os.Rename(temps[j], moves[j].from)
+			}
+			return fmt.Errorf("failed to rename %s to %s: %w", filepath.Base(m.from), filepath.Base(m.to), err)
+		}
+	}
+
+	// The metadata follows the same two phases, since moving it straight
+	// from source to target would merge the rows of a swap into one file
+	for i, m := range moves {
+		moveMetadata(store, m.from, temps[i])
+	}
+	for i, m := range moves {
+		moveMetadata(store, temps[i], m.to)
+	}
+	return nil
+}
+
+// moveMetadata carries the tags, pointer mappings and folder sizes of from
+// over to to
+func moveMetadata(store database.Store, from string, to string) {
+	tags.Moved(store, from, to)
+	pointers.Moved(store, from, to)
+	foldersize.Invalidate(store, from, to)
+}
+
+func validateName(name string) string {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return "name is empty"
+	case strings.ContainsRune(name, '/') || strings.ContainsRune(name, os.PathSeparator):
+		return "name cannot contain a path separator"
+	case strings.ContainsRune(name, 0):
+		return "name contains an invalid character"
+	case len(name) > 255:
+		return "name is too long"
+	}
+	return ""
+}
+
+// existsAsOtherFile reports whether target exists and isn't source itself,
+// which it can be on case-insensitive filesystems
+func existsAsOtherFile(target string, source string) bool {
+	targetInfo, err := os.Lstat(target)
+	if err != nil {
+		return false
+	}
+	sourceInfo, err := os.Lstat(source)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(targetInfo, sourceInfo)
+}
+
+// findCycles returns the groups of renames whose targets form a loop
+func findCycles(items []PreviewItem) [][]string {
+	next := make(map[string]string)
+	for _, item := range items {
+		if item.Changed && item.Conflict == "" {
+			next[item.OldPath] = item.NewPath
+		}
+	}
+
+	cycles := [][]string{}
+	visited := make(map[string]bool)
+	for _, item := range items {
+		start := item.OldPath
+		if visited[start] {
+			continue
+		}
+
+		var chain []string
+		onChain := make(map[string]bool)
+		for path := start; ; {
+			if onChain[path] {
+				// Keep only the part of the chain that loops
+				for i, p := range chain {
+					if p == path {
+						cycles = append(cycles, chain[i:])
+						break
+					}
+				}
+				break
+			}
+			if visited[path] {
+				break
+			}
+			to, ok := next[path]
+			if !ok {
+				break
+			}
+			chain = append(chain, path)
+			onChain[path] = true
+			path = to
+		}
+
+		for _, p := range chain {
+			visited[p] = true
+		}
+	}
+	return cycles
+}
+
+func isSource(moves []move, path string) bool {
+	for _, m := range moves {
+		if m.from == path {
+			return true
+		}
+	}
+	return false
+}
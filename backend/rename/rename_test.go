@@ -0,0 +1,195 @@
+package rename
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/sandbox"
+)
+
+func setup(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	previous := sandbox.GetPolicy()
+	if err := sandbox.SetPolicy(sandbox.Policy{AllowedRoots: []string{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sandbox.SetPolicy(previous) })
+	return dir
+}
+
+func write(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// sqliteStore opens a real database, whose UPDATE OR REPLACE moves would
+// merge a swap's rows if they weren't staged like the files
+func sqliteStore(t *testing.T) database.Store {
+	t.Helper()
+	store, err := database.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// checkMetadata fails unless path has exactly the tag and the Drive file ID
+func checkMetadata(t *testing.T, store database.Store, path string, tag string, fileID string) {
+	t.Helper()
+	if tags, err := store.GetFileTags(path); err != nil || !reflect.DeepEqual(tags, []string{tag}) {
+		t.Errorf("tags of %s = %v, %v; want [%s]", filepath.Base(path), tags, err, tag)
+	}
+	if row, err := store.GetExternalFileByPath(path); err != nil || row == nil || row.FileID != fileID {
+		t.Errorf("mapping of %s = %+v, %v; want %s", filepath.Base(path), row, err, fileID)
+	}
+}
+
+func TestApplyRenameSwapsAndUndoes(t *testing.T) {
+	dir := setup(t)
+	store := sqliteStore(t)
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	write(t, a, "A")
+	write(t, b, "B")
+	for _, f := range []struct{ path, tag, id string }{{a, "red", "ID-A"}, {b, "blue", "ID-B"}} {
+		if err := store.CreateTag(f.tag, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddFileTag(f.path, f.tag); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddExternalFile("google_doc", f.path, f.id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a -> b and b -> a through one regex rule
+	rules := []Rule{{Type: RuleReplace, Find: `^(a|b)$`, Replace: "x$1", Regex: true}, {Type: RuleReplace, Find: "xa", Replace: "b"}, {Type: RuleReplace, Find: "xb", Replace: "a"}}
+	preview, err := ApplyRename(store, []string{a, b}, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Cycles) != 1 {
+		t.Errorf("cycles = %v, want one swap", preview.Cycles)
+	}
+	if read(t, a) != "B" || read(t, b) != "A" {
+		t.Fatalf("files weren't swapped")
+	}
+	checkMetadata(t, store, a, "blue", "ID-B")
+	checkMetadata(t, store, b, "red", "ID-A")
+
+	if err := UndoLastRename(store); err != nil {
+		t.Fatal(err)
+	}
+	if read(t, a) != "A" || read(t, b) != "B" {
+		t.Fatalf("undo didn't restore the original names")
+	}
+	checkMetadata(t, store, a, "red", "ID-A")
+	checkMetadata(t, store, b, "blue", "ID-B")
+
+	if err := UndoLastRename(store); err == nil {
+		t.Error("second undo succeeded with nothing to undo")
+	}
+}
+
+func TestPreviewRenameConflicts(t *testing.T) {
+	dir := setup(t)
+	one, two, taken := filepath.Join(dir, "one.txt"), filepath.Join(dir, "two.txt"), filepath.Join(dir, "same.txt")
+	write(t, one, "")
+	write(t, two, "")
+
+	preview, err := PreviewRename([]string{one, two}, []Rule{{Type: RuleReplace, Find: `^.*$`, Replace: "same", Regex: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !preview.HasConflicts || preview.Items[0].Conflict == "" || preview.Items[1].Conflict == "" {
+		t.Errorf("two files renamed to one name weren't flagged: %+v", preview.Items)
+	}
+
+	write(t, taken, "")
+	preview, err = PreviewRename([]string{one}, []Rule{{Type: RuleReplace, Find: "one", Replace: "same"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !preview.HasConflicts {
+		t.Errorf("renaming onto an existing file wasn't flagged")
+	}
+	if _, err := ApplyRename(database.NewMemoryStore(), []string{one}, []Rule{{Type: RuleReplace, Find: "one", Replace: "same"}}); err == nil {
+		t.Error("ApplyRename went ahead despite a conflict")
+	}
+	if read(t, taken) != "" {
+		t.Error("existing file was overwritten")
+	}
+}
+
+func TestApplyMovesNeverOverwritesNewTargets(t *testing.T) {
+	dir := setup(t)
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	x, late := filepath.Join(dir, "x.txt"), filepath.Join(dir, "late.txt")
+	write(t, a, "A")
+	write(t, b, "B")
+	// Created after the preview, so only applyMoves can notice it
+	write(t, late, "late")
+
+	err := applyMoves(database.NewMemoryStore(), []move{{from: a, to: x}, {from: b, to: late}})
+	if err == nil {
+		t.Fatal("applyMoves succeeded, want the existing target refused")
+	}
+	if read(t, late) != "late" {
+		t.Error("target created after the preview was overwritten")
+	}
+	if read(t, a) != "A" || read(t, b) != "B" {
+		t.Error("sources weren't restored after the failed rename")
+	}
+	if _, err := os.Lstat(x); err == nil {
+		t.Error("first rename wasn't rolled back")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("%d entries left in the folder, want no temporary files", len(entries))
+	}
+}
+
+func TestUndoLastRenameChecksSandbox(t *testing.T) {
+	dir := setup(t)
+	a := filepath.Join(dir, "a.txt")
+	write(t, a, "A")
+	if _, err := ApplyRename(database.NewMemoryStore(), []string{a}, []Rule{{Type: RuleReplace, Find: "a", Replace: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sandbox.SetPolicy(sandbox.Policy{AllowedRoots: []string{t.TempDir()}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := UndoLastRename(database.NewMemoryStore()); err == nil {
+		t.Error("undo succeeded outside the allowed folders")
+	}
+	if read(t, filepath.Join(dir, "b.txt")) != "A" {
+		t.Error("undo renamed a file outside the allowed folders")
+	}
+
+	if err := sandbox.SetPolicy(sandbox.Policy{AllowedRoots: []string{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := UndoLastRename(database.NewMemoryStore()); err != nil {
+		t.Fatal(err)
+	}
+	if read(t, a) != "A" {
+		t.Error("undo didn't restore the name once allowed")
+	}
+}
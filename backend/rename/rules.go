@@ -0,0 +1,229 @@
+package rename
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rule types accepted in Rule.Type
+const (
+	RuleReplace   = "replace"   // find/replace, literal or regex
+	RuleSequence  = "sequence"  // add an incrementing number
+	RuleCase      = "case"      // change letter case
+	RuleDate      = "date"      // add the modification or capture date
+	RuleExtension = "extension" // change or remove the extension
+)
+
+// Rule is one step of a batch rename. Rules run in order, each on the result
+// of the previous one, and only touch the name without its extension unless
+// noted otherwise.
+type Rule struct {
+	Type string `json:"type"`
+
+	// replace
+	Find             string `json:"find"`
+	Replace          string `json:"replace"` // may use $1 etc. when Regex is set
+	Regex            bool   `json:"regex"`
+	IgnoreCase       bool   `json:"ignoreCase"`
+	IncludeExtension bool   `json:"includeExtension"` // also search the extension
+
+	// sequence and date
+	Position  string `json:"position"`  // "prefix" or "suffix" (default)
+	Separator string `json:"separator"` // placed between the name and the addition
+
+	// sequence
+	Start   int `json:"start"`
+	Step    int `json:"step"` // defaults to 1
+	Padding int `json:"padding"`
+
+	// case
+	Case string `json:"case"` // "lower", "upper" or "title"
+
+	// date
+	DateSource string `json:"dateSource"` // "modified" (default) or "exif"
+	DateFormat string `json:"dateFormat"` // tokens YYYY YY MM DD hh mm ss, defaults to "YYYY-MM-DD"
+
+	// extension
+	Extension string `json:"extension"` // new extension, with or without the dot; empty removes it
+}
+
+// compiledRule is a Rule with its regex prepared once for the whole batch
+type compiledRule struct {
+	Rule
+	pattern *regexp.Regexp
+}
+
+func compileRules(rules []Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, len(rules))
+	for i, rule := range rules {
+		compiled[i] = compiledRule{Rule: rule}
+
+		switch rule.Type {
+		case RuleReplace:
+			if rule.Find == "" {
+				return nil, fmt.Errorf("rule %d: find text cannot be empty", i+1)
+			}
+			expr := rule.Find
+			if !rule.Regex {
+				expr = regexp.QuoteMeta(expr)
+			}
+			if rule.IgnoreCase {
+				expr = "(?i)" + expr
+			}
+			pattern, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern: %w", i+1, err)
+			}
+			compiled[i].pattern = pattern
+		case RuleCase:
+			if rule.Case != "lower" && rule.Case != "upper" && rule.Case != "title" {
+				return nil, fmt.Errorf("rule %d: unknown case %q", i+1, rule.Case)
+			}
+		case RuleDate:
+			if rule.DateSource != "" && rule.DateSource != "modified" && rule.DateSource != "exif" {
+				return nil, fmt.Errorf("rule %d: unknown date source %q", i+1, rule.DateSource)
+			}
+		case RuleSequence, RuleExtension:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown rule type %q", i+1, rule.Type)
+		}
+	}
+	return compiled, nil
+}
+
+// apply runs the rules on one file's name. index is the file's position in
+// the selection, used for sequence numbers.
+func apply(rules []compiledRule, path string, index int) string {
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	for _, rule := range rules {
+		switch rule.Type {
+		case RuleReplace:
+			if rule.IncludeExtension {
+				full := rule.replace(stem + ext)
+				ext = filepath.Ext(full)
+				stem = strings.TrimSuffix(full, ext)
+			} else {
+				stem = rule.replace(stem)
+			}
+		case RuleSequence:
+			step := rule.Step
+			if step == 0 {
+				step = 1
+			}
+			number := fmt.Sprintf("%0*d", rule.Padding, rule.Start+index*step)
+			stem = rule.insert(stem, number)
+		case RuleCase:
+			stem = changeCase(stem, rule.Case)
+		case RuleDate:
+			stem = rule.insert(stem, formatDate(fileDate(path, rule.DateSource), rule.DateFormat))
+		case RuleExtension:
+			ext = ""
+			if trimmed := strings.TrimPrefix(rule.Extension, "."); trimmed != "" {
+				ext = "." + trimmed
+			}
+		}
+	}
+
+	return stem + ext
+}
+
+func (r compiledRule) replace(s string) string {
+	if r.Regex {
+		return r.pattern.ReplaceAllString(s, r.Replace)
+	}
+	return r.pattern.ReplaceAllLiteralString(s, r.Replace)
+}
+
+func (r compiledRule) insert(stem string, addition string) string {
+	if r.Position == "prefix" {
+		return addition + r.Separator + stem
+	}
+	return stem + r.Separator + addition
+}
+
+func changeCase(s string, mode string) string {
+	switch mode {
+	case "lower":
+		return strings.ToLower(s)
+	case "upper":
+		return strings.ToUpper(s)
+	case "title":
+		runes := []rune(strings.ToLower(s))
+		startOfWord := true
+		for i, r := range runes {
+			if startOfWord && unicode.IsLetter(r) {
+				runes[i] = unicode.ToUpper(r)
+			}
+			startOfWord = !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}
+		return string(runes)
+	}
+	return s
+}
+
+// fileDate returns the date to insert, falling back to the modification time
+// when a photo has no EXIF date
+func fileDate(path string, source string) time.Time {
+	if source == "exif" {
+		if t, ok := exifDate(path); ok {
+			return t
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// dateTokens maps the placeholders of a date pattern to Go layouts, longest
+// first so "YYYY" isn't read as two "YY"
+var dateTokens = []struct {
+	token  string
+	layout string
+}{
+	{"YYYY", "2006"},
+	{"YY", "06"},
+	{"MM", "01"},
+	{"DD", "02"},
+	{"hh", "15"},
+	{"mm", "04"},
+	{"ss", "05"},
+}
+
+// formatDate renders a pattern such as "YYYY-MM-DD". Only the placeholders
+// are formatted; everything else is copied as is, so "Trip 2 YYYY" keeps
+// its 2 even though Go layouts would read it as the day.
+func formatDate(t time.Time, format string) string {
+	if format == "" {
+		format = "YYYY-MM-DD"
+	}
+
+	var b strings.Builder
+	for rest := format; rest != ""; {
+		matched := false
+		for _, dt := range dateTokens {
+			if strings.HasPrefix(rest, dt.token) {
+				b.WriteString(t.Format(dt.layout))
+				rest = rest[len(dt.token):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			_, size := utf8.DecodeRuneInString(rest)
+			b.WriteString(rest[:size])
+			rest = rest[size:]
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package rename
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2024, time.March, 7, 9, 5, 3, 0, time.UTC)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", "2024-03-07"},
+		{"YYYY-MM-DD", "2024-03-07"},
+		{"YYMMDD_hhmmss", "240307_090503"},
+		{"Trip 2 YYYY", "Trip 2 2024"},
+		{"01 Jan Mon PM", "01 Jan Mon PM"},
+		{"DD.MM.YYYY at 15h", "07.03.2024 at 15h"},
+		{"YYYYY", "2024Y"},
+		{"été YYYY", "été 2024"},
+	}
+	for _, tt := range tests {
+		if got := formatDate(date, tt.format); got != tt.want {
+			t.Errorf("formatDate(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		path  string
+		index int
+		want  string
+	}{
+		{"literal replace", []Rule{{Type: RuleReplace, Find: ".", Replace: "_"}}, "/d/a.b.txt", 0, "a_b.txt"},
+		{"regex replace", []Rule{{Type: RuleReplace, Find: `(\d+)`, Replace: "n$1", Regex: true}}, "/d/img12.jpg", 0, "imgn12.jpg"},
+		{"ignore case", []Rule{{Type: RuleReplace, Find: "IMG", Replace: "Photo", IgnoreCase: true}}, "/d/img_1.jpg", 0, "Photo_1.jpg"},
+		{"include extension", []Rule{{Type: RuleReplace, Find: "jpeg", Replace: "jpg", IncludeExtension: true}}, "/d/a.jpeg", 0, "a.jpg"},
+		{"sequence", []Rule{{Type: RuleSequence, Start: 1, Step: 2, Padding: 3, Separator: "-"}}, "/d/a.txt", 2, "a-005.txt"},
+		{"sequence prefix", []Rule{{Type: RuleSequence, Position: "prefix", Separator: " "}}, "/d/a.txt", 1, "1 a.txt"},
+		{"case", []Rule{{Type: RuleCase, Case: "upper"}}, "/d/abc.txt", 0, "ABC.txt"},
+		{"remove extension", []Rule{{Type: RuleExtension}}, "/d/abc.txt", 0, "abc"},
+		{"change extension", []Rule{{Type: RuleExtension, Extension: "md"}}, "/d/abc.txt", 0, "abc.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := compileRules(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := apply(compiled, tt.path, tt.index); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRulesRejectsInvalid(t *testing.T) {
+	for _, rules := range [][]Rule{
+		{{Type: RuleReplace}},
+		{{Type: RuleReplace, Find: "(", Regex: true}},
+		{{Type: RuleCase, Case: "sponge"}},
+		{{Type: RuleDate, DateSource: "ctime"}},
+		{{Type: "shuffle"}},
+	} {
+		if _, err := compileRules(rules); err == nil {
+			t.Errorf("compileRules(%+v) succeeded", rules)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"Finder-2/backend/apperror"
+)
+
+// Access is the kind of operation a path is checked for
+type Access int
+
+const (
+	// Write covers creating something at path or writing into it
+	Write Access = iota
+	// Remove covers renaming, moving or trashing path itself. An allowed
+	// root can be written into but never removed.
+	Remove
+)
+
+// Error codes, so the UI can explain why an operation was refused
+const (
+	CodeInvalidPath  = "invalid_path"
+	CodeOutsideRoots = "outside_allowed_roots"
+	CodeProtected    = "protected_path"
+)
+
+// Error is returned when the policy refuses a path
+type Error struct {
+	Code    string `json:"code"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorCode maps the refusal onto the app-wide error codes
+func (e *Error) ErrorCode() string {
+	if e.Code == CodeInvalidPath {
+		return apperror.CodeInvalid
+	}
+	return apperror.CodePermissionDenied
+}
+
+// ErrorReason is the sandbox's own code, saying why the path was refused
+func (e *Error) ErrorReason() string {
+	return e.Code
+}
+
+// Policy is the configurable part of the sandbox
+type Policy struct {
+	AllowedRoots   []string `json:"allowedRoots"`   // mutations must stay inside one of these
+	ProtectedPaths []string `json:"protectedPaths"` // never modified, even inside an allowed root
+}
+
+var (
+	policy    Policy
+	policyMux sync.RWMutex
+)
+
+func init() {
+	policy = DefaultPolicy()
+}
+
+// DefaultPolicy allows changes under the home folder and mounted volumes,
+// and protects system folders and the home folder's sensitive ones
+func DefaultPolicy() Policy {
+	p := Policy{
+		AllowedRoots:   []string{"/Volumes", "/media", "/mnt", "/run/media"},
+		ProtectedPaths: BuiltinProtectedPaths(),
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		p.AllowedRoots = append([]string{homeDir}, p.AllowedRoots...)
+	}
+	return p
+}
+
+// BuiltinProtectedPaths are the system folders and the home folder's
+// sensitive ones. SetPolicy always protects them, whatever the policy says.
+func BuiltinProtectedPaths() []string {
+	paths := []string{
+		"/System", "/Library", "/bin", "/sbin", "/usr", "/etc", "/var",
+		"/private", "/dev", "/proc", "/sys", "/boot", "/Applications",
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		for _, name := range []string{"Library", ".Trash", ".ssh", ".gnupg", ".finder-2"} {
+			paths = append(paths, filepath.Join(homeDir, name))
+		}
+	}
+	return paths
+}
+
+// GetPolicy returns the policy in effect
+func GetPolicy() Policy {
+	policyMux.RLock()
+	defer policyMux.RUnlock()
+	return Policy{
+		AllowedRoots:   append([]string(nil), policy.AllowedRoots...),
+		ProtectedPaths: append([]string(nil), policy.ProtectedPaths...),
+	}
+}
+
+// CheckPolicy reports whether p can be used. Every path must be absolute,
+// and the root folder can't be allowed since that would allow everything.
+func CheckPolicy(p Policy) error {
+	for _, list := range [][]string{p.AllowedRoots, p.ProtectedPaths} {
+		for _, path := range list {
+			if !filepath.IsAbs(path) {
+				return &Error{Code: CodeInvalidPath, Path: path, Message: fmt.Sprintf("%s is not an absolute path", path)}
+			}
+		}
+	}
+	for _, root := range p.AllowedRoots {
+		if filepath.Clean(root) == string(os.PathSeparator) {
+			return &Error{Code: CodeInvalidPath, Path: root, Message: "the root folder can't be an allowed folder"}
+		}
+	}
+	return nil
+}
+
+// SetPolicy replaces the policy. The built-in protected paths are added to
+// the ones p lists, so a policy can't unprotect system folders.
+func SetPolicy(p Policy) error {
+	if err := CheckPolicy(p); err != nil {
+		return err
+	}
+
+	protected := append([]string(nil), p.ProtectedPaths...)
+	listed := make(map[string]bool, len(protected))
+	for _, path := range protected {
+		listed[filepath.Clean(path)] = true
+	}
+	for _, path := range BuiltinProtectedPaths() {
+		if !listed[path] {
+			protected = append(protected, path)
+		}
+	}
+
+	policyMux.Lock()
+	defer policyMux.Unlock()
+	policy = Policy{
+		AllowedRoots:   append([]string(nil), p.AllowedRoots...),
+		ProtectedPaths: protected,
+	}
+	return nil
+}
+
+// Check normalizes path, resolves symlinks and returns the cleaned path if
+// the policy allows the given access to it
+func Check(path string, access Access) (string, error) {
+	cleaned, err := Clean(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Removing a symlink affects the link, so only its folder is resolved.
+	// Writing into a path follows it wherever it leads.
+	resolved := resolve(cleaned)
+	if access == Remove {
+		resolved = filepath.Join(resolve(filepath.Dir(cleaned)), filepath.Base(cleaned))
+	}
+
+	p := GetPolicy()
+
+	for _, protected := range p.ProtectedPaths {
+		if isWithin(resolved, resolve(filepath.Clean(protected))) {
+			return "", &Error{Code: CodeProtected, Path: cleaned, Message: fmt.Sprintf("%s is a protected location", cleaned)}
+		}
+	}
+
+	for _, root := range p.AllowedRoots {
+		root = resolve(filepath.Clean(root))
+		if !isWithin(resolved, root) {
+			continue
+		}
+		if access == Remove && resolved == root {
+			return "", &Error{Code: CodeProtected, Path: cleaned, Message: fmt.Sprintf("%s can't be moved or removed", cleaned)}
+		}
+		return cleaned, nil
+	}
+
+	return "", &Error{Code: CodeOutsideRoots, Path: cleaned, Message: fmt.Sprintf("%s is outside the folders this app may change", cleaned)}
+}
+
+// Clean rejects empty, relative and malformed paths and returns path cleaned
+func Clean(path string) (string, error) {
+	switch {
+	case path == "":
+		return "", &Error{Code: CodeInvalidPath, Message: "no path given"}
+	case strings.ContainsRune(path, 0):
+		return "", &Error{Code: CodeInvalidPath, Path: path, Message: "path contains an invalid character"}
+	case !filepath.IsAbs(path):
+		return "", &Error{Code: CodeInvalidPath, Path: path, Message: fmt.Sprintf("%s is not an absolute path", path)}
+	}
+	return filepath.Clean(path), nil
+}
+
+// CheckName rejects names that aren't a single path element, such as
+// "../x" or "a/b", so joining them onto a folder can't escape it
+func CheckName(name string) error {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return &Error{Code: CodeInvalidPath, Path: name, Message: "name is empty"}
+	case strings.ContainsRune(name, '/') || strings.ContainsRune(name, os.PathSeparator):
+		return &Error{Code: CodeInvalidPath, Path: name, Message: fmt.Sprintf("%s contains a path separator", name)}
+	case strings.ContainsRune(name, 0):
+		return &Error{Code: CodeInvalidPath, Path: name, Message: "name contains an invalid character"}
+	}
+	return nil
+}
+
+// resolve follows symlinks in path. EvalSymlinks fails for paths that don't
+// exist yet, so the deepest existing ancestor is resolved and the rest
+// re-appended.
+func resolve(path string) string {
+	rest := ""
+	for current := path; ; {
+		if resolved, err := filepath.EvalSymlinks(current); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(current), rest)
+		current = parent
+	}
+}
+
+func isWithin(path string, root string) bool {
+	if root == string(os.PathSeparator) {
+		return true
+	}
+	return path == root || strings.HasPrefix(path, root+string(os.PathSeparator))
+}
@@ -0,0 +1,111 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// usePolicy sets p for the test and restores the previous policy after it
+func usePolicy(t *testing.T, p Policy) {
+	t.Helper()
+	previous := GetPolicy()
+	if err := SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetPolicy(previous) })
+}
+
+func reason(err error) string {
+	var sandboxErr *Error
+	if errors.As(err, &sandboxErr) {
+		return sandboxErr.Code
+	}
+	return ""
+}
+
+func TestCheck(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	protected := filepath.Join(root, "keep")
+	usePolicy(t, Policy{AllowedRoots: []string{root}, ProtectedPaths: []string{protected}})
+
+	// A link inside the root that leads out of it
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		access Access
+		reason string
+	}{
+		{filepath.Join(root, "a.txt"), Write, ""},
+		{filepath.Join(root, "new", "deeper", "a.txt"), Write, ""},
+		{root, Write, ""},
+		{root, Remove, CodeProtected},
+		{filepath.Join(root, "a", "..", "..", "x"), Write, CodeOutsideRoots},
+		{filepath.Join(outside, "a.txt"), Write, CodeOutsideRoots},
+		{filepath.Join(root, "out", "a.txt"), Write, CodeOutsideRoots},
+		{filepath.Join(root, "out"), Remove, ""},
+		{filepath.Join(protected, "a.txt"), Write, CodeProtected},
+		{"relative/a.txt", Write, CodeInvalidPath},
+		{"", Write, CodeInvalidPath},
+	}
+	for _, tt := range tests {
+		_, err := Check(tt.path, tt.access)
+		if got := reason(err); got != tt.reason {
+			t.Errorf("Check(%q, %d) = %v, want reason %q", tt.path, tt.access, err, tt.reason)
+		}
+	}
+}
+
+func TestSetPolicyKeepsBuiltinProtectedPaths(t *testing.T) {
+	root := t.TempDir()
+	usePolicy(t, Policy{AllowedRoots: []string{root, "/usr"}})
+
+	got := GetPolicy()
+	for _, path := range BuiltinProtectedPaths() {
+		found := false
+		for _, protected := range got.ProtectedPaths {
+			found = found || protected == path
+		}
+		if !found {
+			t.Errorf("%s is no longer protected", path)
+		}
+	}
+	if _, err := Check("/usr/local/a.txt", Write); reason(err) != CodeProtected {
+		t.Errorf("writing under /usr = %v, want it protected", err)
+	}
+}
+
+func TestSetPolicyRefusesRootFolder(t *testing.T) {
+	previous := GetPolicy()
+	for _, root := range []string{"/", "/tmp/..", "//"} {
+		if err := SetPolicy(Policy{AllowedRoots: []string{root}}); reason(err) != CodeInvalidPath {
+			t.Errorf("SetPolicy with %q allowed = %v, want it refused", root, err)
+		}
+	}
+	if err := SetPolicy(Policy{AllowedRoots: []string{"relative"}}); reason(err) != CodeInvalidPath {
+		t.Errorf("SetPolicy with a relative root = %v, want it refused", err)
+	}
+
+	got := GetPolicy()
+	if len(got.AllowedRoots) != len(previous.AllowedRoots) {
+		t.Errorf("a refused policy changed the allowed roots to %v", got.AllowedRoots)
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	for _, name := range []string{"a.txt", ".hidden", "a..b"} {
+		if err := CheckName(name); err != nil {
+			t.Errorf("CheckName(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "a/b", "../x", "a\x00b"} {
+		if err := CheckName(name); err == nil {
+			t.Errorf("CheckName(%q) = nil, want an error", name)
+		}
+	}
+}
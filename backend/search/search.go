@@ -2,6 +2,9 @@ package search
 
 import (
 	"Finder-2/backend"
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -10,24 +13,109 @@ import (
 
 type SearchResult struct {
 	FileItem    backend.FileItem `json:"fileItem"`
-	MatchType   string           `json:"matchType"`   // "filename"
+	MatchType   string           `json:"matchType"`   // "filename" or "tag"
 	MatchedLine string           `json:"matchedLine"` // Not used for filename searches
 }
 
 // Search searches for files by name using fd (extremely fast and reliable)
-func Search(directory string, query string) ([]SearchResult, error) {
-	return fdSearch(directory, query)
+func Search(store database.TagStore, directory string, query string) ([]SearchResult, error) {
+	return fdSearch(store, directory, query)
 }
 
 // SearchFilenames is an alias for Search for backward compatibility
-func SearchFilenames(directory string, query string) ([]SearchResult, error) {
-	return fdSearch(directory, query)
+func SearchFilenames(store database.TagStore, directory string, query string) ([]SearchResult, error) {
+	return fdSearch(store, directory, query)
+}
+
+// SearchWithTags searches by name like Search, keeping only files that carry
+// every one of tagNames. An empty query lists all tagged files under directory.
+func SearchWithTags(store database.TagStore, directory string, query string, tagNames []string) ([]SearchResult, error) {
+	if len(tagNames) == 0 {
+		return fdSearch(store, directory, query)
+	}
+
+	var results []SearchResult
+	var err error
+	if query == "" {
+		results, err = taggedUnder(store, directory, tagNames[0])
+	} else {
+		results, err = fdSearch(store, directory, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tagged []SearchResult
+	for _, result := range results {
+		if hasAllTags(result.FileItem.Tags, tagNames) {
+			tagged = append(tagged, result)
+		}
+	}
+
+	return tagged, nil
+}
+
+// taggedUnder returns the files beneath directory that carry the tag
+func taggedUnder(store database.TagStore, directory string, tagName string) ([]SearchResult, error) {
+	if _, err := os.Stat(directory); err != nil {
+		return nil, apperror.FromOS(err, directory)
+	}
+
+	paths, err := store.GetPathsWithTag(tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []backend.FileItem
+	directory = filepath.Clean(directory)
+	for _, path := range paths {
+		if !database.IsBeneath(path, directory) {
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		items = append(items, backend.NewFileItem(path, info))
+	}
+	backend.AttachTags(store, items)
+
+	results := make([]SearchResult, len(items))
+	for i, item := range items {
+		results[i] = SearchResult{
+			FileItem:  item,
+			MatchType: "tag",
+		}
+	}
+	return results, nil
+}
+
+func hasAllTags(have []string, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if strings.EqualFold(h, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }
 
 // fdSearch uses fd to search for files by name (extremely fast)
-func fdSearch(directory string, query string) ([]SearchResult, error) {
+func fdSearch(store database.TagStore, directory string, query string) ([]SearchResult, error) {
 	var results []SearchResult
 
+	// fd exits with 1 both for no matches and for a bad directory, so the
+	// directory is checked first
+	if _, err := os.Stat(directory); err != nil {
+		return results, apperror.FromOS(err, directory)
+	}
+
 	// Use fd to search for files with optimizations
 	// -i: case insensitive
 	// --exclude: exclude common slow directories
@@ -44,6 +132,9 @@ func fdSearch(directory string, query string) ([]SearchResult, error) {
 		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
 			return results, nil
 		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return results, apperror.New(apperror.CodeNotFound, "search requires the fd command to be installed")
+		}
 		return results, err
 	}
 
@@ -55,20 +146,12 @@ func fdSearch(directory string, query string) ([]SearchResult, error) {
 		}
 
 		// Get file info
-		info, err := os.Stat(line)
+		info, err := os.Lstat(line)
 		if err != nil {
 			continue
 		}
 
-		fileItem := backend.FileItem{
-			Name:         filepath.Base(line),
-			Path:         line,
-			IsDirectory:  info.IsDir(),
-			IsApp:        strings.HasSuffix(line, ".app"),
-			Size:         info.Size(),
-			ModifiedTime: info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
-			IconPath:     "",
-		}
+		fileItem := backend.NewFileItem(line, info)
 
 		results = append(results, SearchResult{
 			FileItem:  fileItem,
@@ -76,5 +159,14 @@ func fdSearch(directory string, query string) ([]SearchResult, error) {
 		})
 	}
 
+	items := make([]backend.FileItem, len(results))
+	for i, result := range results {
+		items[i] = result.FileItem
+	}
+	backend.AttachTags(store, items)
+	for i := range results {
+		results[i].FileItem.Tags = items[i].Tags
+	}
+
 	return results, nil
 }
@@ -0,0 +1,89 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"Finder-2/backend/database"
+)
+
+func setup(t *testing.T) (string, database.Store) {
+	t.Helper()
+	return t.TempDir(), database.NewMemoryStore()
+}
+
+func tag(t *testing.T, store database.Store, path string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := store.CreateTag(name, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddFileTag(path, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func resultPaths(results []SearchResult) []string {
+	var paths []string
+	for _, r := range results {
+		paths = append(paths, r.FileItem.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestSearchWithTagsListsTaggedFilesUnderDirectory(t *testing.T) {
+	dir, store := setup(t)
+	docs := filepath.Join(dir, "docs")
+	both := filepath.Join(docs, "sub", "both.txt")
+	workOnly := filepath.Join(docs, "work.txt")
+	sibling := filepath.Join(dir, "docs-old", "both.txt")
+	tag(t, store, both, "Work", "urgent")
+	tag(t, store, workOnly, "work")
+	tag(t, store, sibling, "work", "urgent")
+
+	tests := []struct {
+		directory string
+		tags      []string
+		want      []string
+	}{
+		{docs, []string{"work"}, []string{both, workOnly}},
+		{docs, []string{"WORK", "urgent"}, []string{both}},
+		{docs + "/", []string{"work"}, []string{both, workOnly}},
+		{dir, []string{"urgent"}, []string{sibling, both}},
+		{"/", []string{"urgent"}, []string{sibling, both}},
+	}
+	for _, tt := range tests {
+		results, err := SearchWithTags(store, tt.directory, "", tt.tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := append([]string(nil), tt.want...)
+		sort.Strings(want)
+		if got := resultPaths(results); !reflect.DeepEqual(got, want) {
+			t.Errorf("SearchWithTags(%s, %v) = %v, want %v", tt.directory, tt.tags, got, want)
+		}
+		for _, r := range results {
+			if r.MatchType != "tag" {
+				t.Errorf("%s matched by %q, want tag", r.FileItem.Path, r.MatchType)
+			}
+		}
+	}
+}
+
+func TestSearchWithTagsMissingDirectory(t *testing.T) {
+	dir, store := setup(t)
+	if _, err := SearchWithTags(store, filepath.Join(dir, "missing"), "", []string{"work"}); err == nil {
+		t.Error("searching a missing folder succeeded, want an error")
+	}
+}
@@ -0,0 +1,262 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"Finder-2/backend/logging"
+	"Finder-2/backend/sandbox"
+)
+
+var logger = logging.For("settings")
+
+// Settings is every user-configurable option. Each field is stored in the
+// settings table under its JSON name, and only while it differs from its
+// default, so fields added later and defaults changed later take effect
+// until the user changes them.
+type Settings struct {
+	// Port of the local server Google redirects to after login. It must
+	// match a redirect URI registered for the OAuth client.
+	CallbackPort int `json:"callbackPort"`
+	// Model used for every AI request
+	AIModel string `json:"aiModel"`
+	// Folder the sidebar shows as Documents and AI recommendations search;
+	// empty means ~/Documents
+	DocumentsRoot string `json:"documentsRoot"`
+	// Whether tags are also written to the user.xdg.tags extended attribute
+	MirrorTagsToXattrs bool `json:"mirrorTagsToXattrs"`
+	// Minimum log level per subsystem, "" being the default for the rest
+	LogLevels map[string]string `json:"logLevels"`
+	// Folders that may be changed and folders that never may
+	PathPolicy sandbox.Policy `json:"pathPolicy"`
+}
+
+// Defaults returns the settings used before anything is changed
+func Defaults() Settings {
+	return Settings{
+		CallbackPort:       8080,
+		AIModel:            "qwen-3-235b-a22b-instruct-2507",
+		DocumentsRoot:      "",
+		MirrorTagsToXattrs: false,
+		LogLevels:          map[string]string{"": "info"},
+		PathPolicy:         sandbox.DefaultPolicy(),
+	}
+}
+
+var (
+	current     = Defaults()
+	currentMux  sync.RWMutex
+	listeners   []func(Settings)
+	listenerMux sync.Mutex
+	// saveMux is held from reading the settings to saving them, so
+	// concurrent changes don't overwrite each other
+	saveMux sync.Mutex
+)
+
+// Get returns the settings in effect
+func Get() Settings {
+	currentMux.RLock()
+	defer currentMux.RUnlock()
+	return current.clone()
+}
+
+// DocumentsRoot returns the configured Documents folder, or ~/Documents
+func DocumentsRoot() (string, error) {
+	if root := Get().DocumentsRoot; root != "" {
+		return root, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, "Documents"), nil
+}
+
+// OnChange registers fn to be called with the new settings after every
+// successful Update
+func OnChange(fn func(Settings)) {
+	listenerMux.Lock()
+	defer listenerMux.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// Load reads the settings from store over the defaults and applies them.
+// Values that no longer validate are reset to their default.
+func Load(store database.SettingsStore) error {
+	saveMux.Lock()
+	defer saveMux.Unlock()
+
+	stored, err := store.ListSettings()
+	if err != nil {
+		return err
+	}
+
+	s := Defaults()
+	for key, value := range stored {
+		field := map[string]json.RawMessage{key: json.RawMessage(value)}
+		data, _ := json.Marshal(field)
+
+		candidate := s.clone()
+		if err := json.Unmarshal(data, &candidate); err != nil {
+			logger.Warn("ignoring unreadable setting", "key", key, "error", err)
+			continue
+		}
+		if err := candidate.Validate(); err != nil {
+			logger.Warn("ignoring invalid setting", "key", key, "error", err)
+			continue
+		}
+		s = candidate
+	}
+
+	currentMux.Lock()
+	current = s
+	currentMux.Unlock()
+
+	apply(s)
+	return nil
+}
+
+// Update validates s, saves it to store and applies it, then notifies
+// listeners
+func Update(store database.SettingsStore, s Settings) (Settings, error) {
+	saveMux.Lock()
+	saved, err := save(store, s)
+	saveMux.Unlock()
+	if err != nil {
+		return Settings{}, err
+	}
+
+	notify(saved)
+	return saved.clone(), nil
+}
+
+// Modify applies change to a copy of the current settings and saves it,
+// for callers that change a single option. No other change can land
+// between reading the settings and saving them.
+func Modify(store database.SettingsStore, change func(*Settings)) (Settings, error) {
+	saveMux.Lock()
+	s := Get()
+	change(&s)
+	saved, err := save(store, s)
+	saveMux.Unlock()
+	if err != nil {
+		return Settings{}, err
+	}
+
+	notify(saved)
+	return saved.clone(), nil
+}
+
+// save validates s and writes it to store in one transaction, then makes
+// it current. saveMux must be held.
+func save(store database.SettingsStore, s Settings) (Settings, error) {
+	if err := s.Validate(); err != nil {
+		return Settings{}, err
+	}
+	s = s.clone()
+
+	fields, err := toFields(s)
+	if err != nil {
+		return Settings{}, err
+	}
+	defaults, err := toFields(Defaults())
+	if err != nil {
+		return Settings{}, err
+	}
+	overrides := make(map[string]string)
+	var unset []string
+	for key, value := range fields {
+		if value == defaults[key] {
+			unset = append(unset, key)
+		} else {
+			overrides[key] = value
+		}
+	}
+	if err := store.SaveSettings(overrides, unset); err != nil {
+		return Settings{}, fmt.Errorf("failed to save settings: %w", err)
+	}
+
+	currentMux.Lock()
+	current = s
+	currentMux.Unlock()
+
+	apply(s)
+	return s, nil
+}
+
+// notify calls every listener with s
+func notify(s Settings) {
+	listenerMux.Lock()
+	fns := make([]func(Settings), len(listeners))
+	copy(fns, listeners)
+	listenerMux.Unlock()
+	for _, fn := range fns {
+		fn(s.clone())
+	}
+}
+
+// Validate reports the first invalid option
+func (s Settings) Validate() error {
+	switch {
+	case s.CallbackPort < 1024 || s.CallbackPort > 65535:
+		return apperror.New(apperror.CodeInvalid, "callback port must be between 1024 and 65535")
+	case s.AIModel == "":
+		return apperror.New(apperror.CodeInvalid, "AI model cannot be empty")
+	case s.DocumentsRoot != "" && !filepath.IsAbs(s.DocumentsRoot):
+		return apperror.New(apperror.CodeInvalid, "Documents folder must be an absolute path")
+	}
+
+	for subsystem, level := range s.LogLevels {
+		if err := logging.CheckLevel(level); err != nil {
+			return apperror.Wrap(apperror.CodeInvalid, err, "invalid log level for %q", subsystem)
+		}
+	}
+
+	return sandbox.CheckPolicy(s.PathPolicy)
+}
+
+// apply pushes the settings other packages hold in their own state
+func apply(s Settings) {
+	if err := logging.SetLevels(s.LogLevels); err != nil {
+		logger.Error("failed to apply log levels", "error", err)
+	}
+	if err := sandbox.SetPolicy(s.PathPolicy); err != nil {
+		logger.Error("failed to apply path policy", "error", err)
+	}
+}
+
+// toFields encodes each top-level field as its own JSON value
+func toFields(s Settings) (map[string]string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(raw))
+	for key, value := range raw {
+		fields[key] = string(value)
+	}
+	return fields, nil
+}
+
+func (s Settings) clone() Settings {
+	levels := make(map[string]string, len(s.LogLevels))
+	for subsystem, level := range s.LogLevels {
+		levels[subsystem] = level
+	}
+	s.LogLevels = levels
+	s.PathPolicy = sandbox.Policy{
+		AllowedRoots:   append([]string(nil), s.PathPolicy.AllowedRoots...),
+		ProtectedPaths: append([]string(nil), s.PathPolicy.ProtectedPaths...),
+	}
+	return s
+}
@@ -0,0 +1,111 @@
+package settings
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/sandbox"
+)
+
+func setup(t *testing.T) database.Store {
+	t.Helper()
+	store := database.NewMemoryStore()
+	previous := Get()
+	t.Cleanup(func() {
+		currentMux.Lock()
+		current = previous
+		currentMux.Unlock()
+		apply(previous)
+	})
+	return store
+}
+
+func TestUpdateStoresOnlyOverrides(t *testing.T) {
+	store := setup(t)
+
+	s := Defaults()
+	s.CallbackPort = 9090
+	if _, err := Update(store, s); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.ListSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored["callbackPort"] != "9090" {
+		t.Errorf("stored %v, want only callbackPort", stored)
+	}
+
+	// Going back to the default forgets the override
+	s.CallbackPort = Defaults().CallbackPort
+	if _, err := Update(store, s); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := store.ListSettings(); len(stored) != 0 {
+		t.Errorf("stored %v after restoring the defaults, want nothing", stored)
+	}
+}
+
+func TestLoadAppliesOverridesOverDefaults(t *testing.T) {
+	store := setup(t)
+	root := t.TempDir()
+	store.SetSetting("pathPolicy", `{"allowedRoots":["`+root+`"],"protectedPaths":[]}`)
+	store.SetSetting("callbackPort", `80`) // invalid, so ignored
+
+	if err := Load(store); err != nil {
+		t.Fatal(err)
+	}
+	got := Get()
+	if got.CallbackPort != Defaults().CallbackPort {
+		t.Errorf("CallbackPort = %d, want the default", got.CallbackPort)
+	}
+	if len(got.PathPolicy.AllowedRoots) != 1 || got.PathPolicy.AllowedRoots[0] != root {
+		t.Errorf("AllowedRoots = %v, want [%s]", got.PathPolicy.AllowedRoots, root)
+	}
+	if _, err := sandbox.Check("/etc/hosts", sandbox.Write); err == nil {
+		t.Error("a policy without protected paths unprotected /etc")
+	}
+}
+
+func TestUpdateRefusesRootFolder(t *testing.T) {
+	store := setup(t)
+	s := Defaults()
+	s.PathPolicy.AllowedRoots = []string{"/"}
+	if _, err := Update(store, s); err == nil {
+		t.Error("allowing the root folder succeeded, want an error")
+	}
+}
+
+func TestConcurrentModifyKeepsEveryChange(t *testing.T) {
+	store := setup(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := Modify(store, func(s *Settings) {
+				s.LogLevels[fmt.Sprintf("subsystem%d", i)] = "debug"
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if levels := Get().LogLevels; len(levels) != 21 {
+		t.Errorf("%d log levels after 20 concurrent changes, want 21: %v", len(levels), levels)
+	}
+	if err := Load(store); err != nil {
+		t.Fatal(err)
+	}
+	if levels := Get().LogLevels; len(levels) != 21 {
+		t.Errorf("%d log levels stored, want 21", len(levels))
+	}
+	if stored, _ := store.ListSettings(); len(stored) != 1 {
+		t.Errorf("stored %v, want only logLevels", stored)
+	}
+}
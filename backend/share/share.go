@@ -5,46 +5,48 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"path/filepath"
 	"strings"
 
+	"Finder-2/backend/apperror"
 	"Finder-2/backend/connections"
 	"Finder-2/backend/database"
+	"Finder-2/backend/logging"
 
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/option"
 )
 
+var logger = logging.For("share")
 
 func ShareFileViaEmail(filePath string, recipientEmail string) error {
-	log.Printf("Sharing file %s with %s", filePath, recipientEmail)
+	logger.Info("sharing file", "path", filePath)
 
 	// Get Google auth data
 	authData, err := database.GetGoogleAuth()
 	if err != nil {
-		return fmt.Errorf("failed to get Google auth: %v", err)
+		return fmt.Errorf("failed to get Google auth: %w", err)
 	}
 	if authData == nil {
-		return fmt.Errorf("not connected to Google. Please connect your Google account first")
+		return apperror.NotConnected("Google")
 	}
 
 	// Get authenticated Google client
 	client, err := connections.GetGoogleClient()
 	if err != nil {
-		return fmt.Errorf("failed to get Google client: %v", err)
+		return fmt.Errorf("failed to get Google client: %w", err)
 	}
 
 	// Create Gmail service
 	gmailService, err := gmail.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
-		return fmt.Errorf("failed to create Gmail service: %v", err)
+		return fmt.Errorf("failed to create Gmail service: %w", err)
 	}
 
 	// Read the file
 	fileContent, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %v", err)
+		return apperror.FromOS(err, filePath)
 	}
 
 	// Get filename
@@ -53,16 +55,16 @@ func ShareFileViaEmail(filePath string, recipientEmail string) error {
 	// Create email message with attachment
 	message, err := createEmailWithAttachment(authData.Email, recipientEmail, fileName, fileContent)
 	if err != nil {
-		return fmt.Errorf("failed to create email: %v", err)
+		return fmt.Errorf("failed to create email: %w", err)
 	}
 
 	// Send the email
 	_, err = gmailService.Users.Messages.Send("me", message).Do()
 	if err != nil {
-		return fmt.Errorf("failed to send email: %v", err)
+		return connections.GoogleError(err, "send email")
 	}
 
-	log.Printf("Successfully sent %s to %s", fileName, recipientEmail)
+	logger.Info("file shared", "path", filePath)
 	return nil
 }
 
@@ -0,0 +1,26 @@
+package backend
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// platformStat reads birth/access times, ownership and link count from the
+// stat data APFS/HFS+ already returned with info
+func platformStat(path string, info os.FileInfo) statDetails {
+	details := statDetails{created: info.ModTime(), accessed: info.ModTime(), links: 1}
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return details
+	}
+
+	details.created = time.Unix(st.Birthtimespec.Sec, st.Birthtimespec.Nsec)
+	details.accessed = time.Unix(st.Atimespec.Sec, st.Atimespec.Nsec)
+	details.uid = st.Uid
+	details.gid = st.Gid
+	details.links = uint64(st.Nlink)
+	details.hasOwner = true
+	return details
+}
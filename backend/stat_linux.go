@@ -0,0 +1,30 @@
+package backend
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// platformStat reads access time, ownership and link count from info and the
+// birth time via statx, which not every filesystem records
+func platformStat(path string, info os.FileInfo) statDetails {
+	details := statDetails{created: info.ModTime(), accessed: info.ModTime(), links: 1}
+
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		details.accessed = time.Unix(st.Atim.Sec, st.Atim.Nsec)
+		details.uid = st.Uid
+		details.gid = st.Gid
+		details.links = uint64(st.Nlink)
+		details.hasOwner = true
+	}
+
+	var stx unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, path, 0, unix.STATX_BTIME, &stx)
+	if err == nil && stx.Mask&unix.STATX_BTIME != 0 && stx.Btime.Sec != 0 {
+		details.created = time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec))
+	}
+	return details
+}
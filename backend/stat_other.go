@@ -0,0 +1,10 @@
+//go:build !darwin && !linux
+
+package backend
+
+import "os"
+
+// platformStat falls back to the modification time where richer stat data isn't available
+func platformStat(path string, info os.FileInfo) statDetails {
+	return statDetails{created: info.ModTime(), accessed: info.ModTime(), links: 1}
+}
@@ -0,0 +1,73 @@
+//go:build darwin || linux
+
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlatformStat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(path, filepath.Join(dir, "second.txt")); err != nil {
+		t.Fatal(err)
+	}
+	accessed := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	modified := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, accessed, modified); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	details := platformStat(path, info)
+	if !details.hasOwner {
+		t.Fatal("hasOwner = false, want the owner read from stat")
+	}
+	if details.uid != uint32(os.Getuid()) || details.gid != uint32(os.Getgid()) {
+		t.Errorf("uid/gid = %d/%d, want %d/%d", details.uid, details.gid, os.Getuid(), os.Getgid())
+	}
+	if details.links != 2 {
+		t.Errorf("links = %d, want 2", details.links)
+	}
+	if !details.accessed.Equal(accessed) {
+		t.Errorf("accessed = %v, want %v", details.accessed, accessed)
+	}
+	if details.created.IsZero() {
+		t.Error("created is zero, want the birth time or the modification time")
+	}
+}
+
+func TestPlatformStatWithoutStatData(t *testing.T) {
+	modified := time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC)
+	details := platformStat("/nonexistent", fakeInfo{modified: modified})
+	if details.hasOwner {
+		t.Error("hasOwner = true without stat data")
+	}
+	if details.links != 1 {
+		t.Errorf("links = %d, want 1", details.links)
+	}
+	if !details.created.Equal(modified) || !details.accessed.Equal(modified) {
+		t.Errorf("created/accessed = %v/%v, want both %v", details.created, details.accessed, modified)
+	}
+}
+
+// fakeInfo is a FileInfo whose Sys isn't a *syscall.Stat_t
+type fakeInfo struct {
+	modified time.Time
+}
+
+func (f fakeInfo) Name() string       { return "fake" }
+func (f fakeInfo) Size() int64        { return 0 }
+func (f fakeInfo) Mode() os.FileMode  { return 0644 }
+func (f fakeInfo) ModTime() time.Time { return f.modified }
+func (f fakeInfo) IsDir() bool        { return false }
+func (f fakeInfo) Sys() any           { return nil }
@@ -0,0 +1,143 @@
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/settings"
+)
+
+// Named colors the UI knows how to draw; anything else must be a hex color
+var namedColors = map[string]bool{
+	"":       true,
+	"red":    true,
+	"orange": true,
+	"yellow": true,
+	"green":  true,
+	"blue":   true,
+	"purple": true,
+	"gray":   true,
+}
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// CreateTag adds a tag, or recolors it if it already exists
+func CreateTag(store database.TagStore, name, color string) error {
+	name = strings.TrimSpace(name)
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if !namedColors[color] && !hexColor.MatchString(color) {
+		return fmt.Errorf("invalid tag color: %s", color)
+	}
+
+	return store.CreateTag(name, color)
+}
+
+func ListTags(store database.TagStore) ([]database.Tag, error) {
+	return store.ListTags()
+}
+
+// DeleteTag removes a tag from the database and from every tagged file's xattr
+func DeleteTag(store database.TagStore, name string) error {
+	paths, err := store.GetPathsWithTag(name)
+	if err != nil {
+		return err
+	}
+
+	if err := store.DeleteTag(name); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		syncXattr(store, path)
+	}
+	return nil
+}
+
+// AddTag attaches a tag to a file, creating the tag if needed
+func AddTag(store database.TagStore, path, name string) error {
+	name = strings.TrimSpace(name)
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	tag, err := store.GetTag(name)
+	if err != nil {
+		return err
+	}
+	if tag == nil {
+		if err := store.CreateTag(name, ""); err != nil {
+			return err
+		}
+	}
+
+	if err := store.AddFileTag(path, name); err != nil {
+		return err
+	}
+
+	syncXattr(store, path)
+	return nil
+}
+
+func RemoveTag(store database.TagStore, path, name string) error {
+	if err := store.RemoveFileTag(path, name); err != nil {
+		return err
+	}
+
+	syncXattr(store, path)
+	return nil
+}
+
+func GetFileTags(store database.TagStore, path string) ([]string, error) {
+	return store.GetFileTags(path)
+}
+
+// Moved keeps tags attached to a file or folder after it is renamed or moved.
+// The xattr travels with the file, so only the database needs updating.
+func Moved(store database.TagStore, oldPath, newPath string) error {
+	return store.MoveFileTags(oldPath, newPath)
+}
+
+// Copied gives a copy the same tags as its source
+func Copied(store database.TagStore, srcPath, dstPath string) error {
+	if err := store.CopyFileTags(srcPath, dstPath); err != nil {
+		return err
+	}
+
+	syncXattr(store, dstPath)
+	return nil
+}
+
+// Removed forgets the tags of a deleted file or folder
+func Removed(store database.TagStore, path string) error {
+	return store.DeleteFileTags(path)
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("tag name cannot be empty")
+	}
+	// Commas separate tags in user.xdg.tags and slashes would break tag:// paths
+	if strings.ContainsAny(name, ",/") {
+		return fmt.Errorf("tag name cannot contain ',' or '/': %s", name)
+	}
+	return nil
+}
+
+// syncXattr rewrites the xattr from the database, unless the
+// mirrorTagsToXattrs setting is off. Failures are ignored since many
+// filesystems don't support user xattrs and the database is authoritative.
+func syncXattr(store database.TagStore, path string) {
+	if !settings.Get().MirrorTagsToXattrs {
+		return
+	}
+
+	names, err := store.GetFileTags(path)
+	if err != nil {
+		return
+	}
+	writeXattr(path, names)
+}
@@ -0,0 +1,69 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/settings"
+)
+
+// setup uses a fresh MemoryStore and sets whether tags are mirrored to xattrs
+func setup(t *testing.T, mirror bool) database.Store {
+	t.Helper()
+	store := database.NewMemoryStore()
+	previous := settings.Get()
+	if _, err := settings.Modify(store, func(s *settings.Settings) { s.MirrorTagsToXattrs = mirror }); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		settings.Update(store, previous)
+	})
+	return store
+}
+
+func TestAddTagValidatesAndCreatesTags(t *testing.T) {
+	store := setup(t, false)
+	dir := t.TempDir()
+
+	for _, name := range []string{"", "  ", "a,b", "a/b"} {
+		if err := AddTag(store, dir+"/x.txt", name); err == nil {
+			t.Errorf("AddTag(store, %q) succeeded, want it refused", name)
+		}
+	}
+	if err := AddTag(store, dir+"/x.txt", " Work "); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := store.GetTag("work")
+	if err != nil || tag == nil || tag.Name != "Work" {
+		t.Errorf("GetTag(work) = %v, %v, want the trimmed Work tag", tag, err)
+	}
+}
+
+func TestFileOperationsCarryTags(t *testing.T) {
+	store := setup(t, false)
+	for _, path := range []string{"/docs/a.txt", "/docs/sub/b.txt", "/docs-old/c.txt"} {
+		if err := AddTag(store, path, "work"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Moved(store, "/docs", "/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copied(store, "/archive/a.txt", "/copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Removed(store, "/archive/sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := store.GetPathsWithTag("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/archive/a.txt", "/copy.txt", "/docs-old/c.txt"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,24 @@
+package tags
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// xdgTagsAttr is the extended attribute KDE and other Linux file managers read tags from
+const xdgTagsAttr = "user.xdg.tags"
+
+// writeXattr stores names as a comma-separated user.xdg.tags attribute,
+// removing the attribute when there are no tags left
+func writeXattr(path string, names []string) error {
+	if len(names) == 0 {
+		err := unix.Removexattr(path, xdgTagsAttr)
+		if errors.Is(err, unix.ENODATA) {
+			return nil
+		}
+		return err
+	}
+	return unix.Setxattr(path, xdgTagsAttr, []byte(strings.Join(names, ",")), 0)
+}
@@ -0,0 +1,89 @@
+package tags
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattr returns the user.xdg.tags attribute of path, skipping the test
+// where the filesystem has no user xattrs
+func readXattr(t *testing.T, path string) (string, bool) {
+	t.Helper()
+	buf := make([]byte, 1024)
+	n, err := unix.Getxattr(path, xdgTagsAttr, buf)
+	switch {
+	case errors.Is(err, unix.ENODATA):
+		return "", false
+	case errors.Is(err, unix.ENOTSUP):
+		t.Skip("user xattrs not supported here")
+	case err != nil:
+		t.Fatal(err)
+	}
+	return string(buf[:n]), true
+}
+
+func touch(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Setxattr(path, "user.probe", []byte("1"), 0); errors.Is(err, unix.ENOTSUP) {
+		t.Skip("user xattrs not supported here")
+	}
+}
+
+func TestTagsMirroredToXattr(t *testing.T) {
+	store := setup(t, true)
+	path := filepath.Join(t.TempDir(), "x.txt")
+	copyPath := filepath.Join(filepath.Dir(path), "copy.txt")
+	touch(t, path)
+	touch(t, copyPath)
+
+	if err := AddTag(store, path, "work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddTag(store, path, "home"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := readXattr(t, path); got != "home,work" {
+		t.Errorf("xattr = %q, want home,work", got)
+	}
+
+	if err := Copied(store, path, copyPath); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := readXattr(t, copyPath); got != "home,work" {
+		t.Errorf("copy's xattr = %q, want home,work", got)
+	}
+
+	if err := RemoveTag(store, path, "work"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := readXattr(t, path); got != "home" {
+		t.Errorf("xattr = %q, want home", got)
+	}
+
+	if err := DeleteTag(store, "home"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := readXattr(t, path); ok {
+		t.Errorf("xattr = %q after the last tag was deleted, want it removed", got)
+	}
+}
+
+func TestTagsNotMirroredWhenOff(t *testing.T) {
+	store := setup(t, false)
+	path := filepath.Join(t.TempDir(), "x.txt")
+	touch(t, path)
+
+	if err := AddTag(store, path, "work"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := readXattr(t, path); ok {
+		t.Errorf("xattr = %q with mirroring off, want none", got)
+	}
+}
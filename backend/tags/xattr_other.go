@@ -0,0 +1,8 @@
+//go:build !linux
+
+package tags
+
+// writeXattr is a no-op where user.xdg.tags isn't used
+func writeXattr(path string, names []string) error {
+	return nil
+}
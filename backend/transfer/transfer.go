@@ -0,0 +1,293 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"Finder-2/backend/apperror"
+	"Finder-2/backend/database"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/logging"
+)
+
+var logger = logging.For("transfer")
+
+// Kinds of transfer
+const (
+	KindUpload   = "upload"   // local files into a Drive folder
+	KindDownload = "download" // Drive files into a local folder
+)
+
+// Job statuses
+const (
+	StatusQueued   = "queued"
+	StatusRunning  = "running"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+	StatusCanceled = "canceled"
+)
+
+// Job is an upload or download waiting in, or taken from, the queue
+type Job struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Sources     []string        `json:"sources"`
+	Destination string          `json:"destination"`
+	Format      string          `json:"format,omitempty"` // gdrive.ExportOffice or gdrive.ExportPDF, downloads only
+	Status      string          `json:"status"`
+	Progress    gdrive.Progress `json:"progress"`
+	Error       string          `json:"error,omitempty"`
+	Results     []string        `json:"results,omitempty"` // paths created, including by a failed job
+	CreatedAt   time.Time       `json:"createdAt"`
+	FinishedAt  time.Time       `json:"finishedAt,omitempty"`
+
+	ctx context.Context // set while running
+}
+
+// finished reports whether a job will change no further
+func (j *Job) finished() bool {
+	return j.Status == StatusDone || j.Status == StatusFailed || j.Status == StatusCanceled
+}
+
+var (
+	jobs    []*Job
+	nextID  int
+	cancels = make(map[string]context.CancelFunc)
+	mux     sync.Mutex
+
+	// wake tells the worker a job was queued
+	wake = make(chan struct{}, 1)
+
+	listeners   []func(Job)
+	listenerMux sync.Mutex
+)
+
+// Start runs queued jobs one at a time until ctx is done, invalidating the
+// folder sizes in sizes that downloads change. Jobs may be queued before
+// it's called.
+func Start(ctx context.Context, sizes database.FolderSizeStore) {
+	go func() {
+		for {
+			job := next(ctx)
+			if job == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-wake:
+				}
+				continue
+			}
+			run(job, sizes)
+		}
+	}()
+}
+
+// OnUpdate registers fn to be called with a copy of a job whenever it's
+// queued, makes progress or finishes
+func OnUpdate(fn func(Job)) {
+	listenerMux.Lock()
+	defer listenerMux.Unlock()
+	listeners = append(listeners, fn)
+}
+
+func notify(job Job) {
+	listenerMux.Lock()
+	fns := make([]func(Job), len(listeners))
+	copy(fns, listeners)
+	listenerMux.Unlock()
+
+	for _, fn := range fns {
+		fn(job)
+	}
+}
+
+// Upload queues local files and folders to be uploaded into a Drive folder
+func Upload(localPaths []string, driveFolder string) (Job, error) {
+	if len(localPaths) == 0 {
+		return Job{}, apperror.New(apperror.CodeInvalid, "nothing selected to upload")
+	}
+	for _, p := range localPaths {
+		if gdrive.IsPath(p) {
+			return Job{}, apperror.New(apperror.CodeInvalid, "%s is already in Google Drive", p)
+		}
+	}
+	if _, err := gdrive.IDOf(driveFolder); err != nil {
+		return Job{}, err
+	}
+	return enqueue(&Job{Kind: KindUpload, Sources: localPaths, Destination: driveFolder}), nil
+}
+
+// Download queues Drive files and folders to be downloaded into a local
+// folder, exporting Google Docs in format
+func Download(drivePaths []string, localDir string, format string) (Job, error) {
+	if len(drivePaths) == 0 {
+		return Job{}, apperror.New(apperror.CodeInvalid, "nothing selected to download")
+	}
+	for _, p := range drivePaths {
+		if _, err := gdrive.IDOf(p); err != nil {
+			return Job{}, err
+		}
+	}
+	if gdrive.IsPath(localDir) {
+		return Job{}, apperror.New(apperror.CodeInvalid, "%s is not a folder on this computer", localDir)
+	}
+	if format == "" {
+		format = gdrive.ExportOffice
+	}
+	if format != gdrive.ExportOffice && format != gdrive.ExportPDF {
+		return Job{}, apperror.New(apperror.CodeInvalid, "unknown export format: %s", format)
+	}
+	return enqueue(&Job{Kind: KindDownload, Sources: drivePaths, Destination: localDir, Format: format}), nil
+}
+
+func enqueue(job *Job) Job {
+	mux.Lock()
+	nextID++
+	job.ID = strconv.Itoa(nextID)
+	job.Status = StatusQueued
+	job.CreatedAt = time.Now()
+	jobs = append(jobs, job)
+	snapshot := *job
+	mux.Unlock()
+
+	notify(snapshot)
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return snapshot
+}
+
+// next marks the oldest queued job running and returns it, or nil when
+// there's nothing to do
+func next(ctx context.Context) *Job {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	for _, job := range jobs {
+		if job.Status == StatusQueued {
+			jobCtx, cancel := context.WithCancel(ctx)
+			cancels[job.ID] = cancel
+			job.Status = StatusRunning
+			job.ctx = jobCtx
+			return job
+		}
+	}
+	return nil
+}
+
+func run(job *Job, sizes database.FolderSizeStore) {
+	notify(update(job, func(j *Job) {}))
+
+	onProgress := func(p gdrive.Progress) {
+		notify(update(job, func(j *Job) { j.Progress = p }))
+	}
+
+	var results []string
+	var err error
+	switch job.Kind {
+	case KindUpload:
+		results, err = gdrive.Upload(job.ctx, job.Sources, job.Destination, onProgress)
+	case KindDownload:
+		results, err = gdrive.Download(job.ctx, sizes, job.Sources, job.Destination, job.Format, onProgress)
+	}
+
+	mux.Lock()
+	cancel := cancels[job.ID]
+	delete(cancels, job.ID)
+	mux.Unlock()
+	canceled := errors.Is(job.ctx.Err(), context.Canceled)
+	cancel()
+
+	notify(update(job, func(j *Job) {
+		j.Results = results
+		j.FinishedAt = time.Now()
+		switch {
+		case canceled:
+			j.Status = StatusCanceled
+		case err != nil:
+			j.Status = StatusFailed
+			j.Error = err.Error()
+			logger.Warn("transfer failed", "id", j.ID, "kind", j.Kind, "error", err)
+		default:
+			j.Status = StatusDone
+		}
+	}))
+}
+
+// update changes a job under the lock and returns a copy of it
+func update(job *Job, fn func(*Job)) Job {
+	mux.Lock()
+	defer mux.Unlock()
+	fn(job)
+	return *job
+}
+
+// List returns every job still remembered, oldest first
+func List() []Job {
+	mux.Lock()
+	defer mux.Unlock()
+
+	list := make([]Job, len(jobs))
+	for i, job := range jobs {
+		list[i] = *job
+	}
+	return list
+}
+
+// Cancel stops a running job or removes a queued one. Finished jobs are
+// left as they are.
+func Cancel(id string) error {
+	mux.Lock()
+	var job *Job
+	for _, j := range jobs {
+		if j.ID == id {
+			job = j
+		}
+	}
+	if job == nil {
+		mux.Unlock()
+		return apperror.New(apperror.CodeNotFound, "no transfer with ID %s", id)
+	}
+
+	if job.Status == StatusRunning {
+		cancels[id]()
+		mux.Unlock()
+		return nil
+	}
+	queued := job.Status == StatusQueued
+	if queued {
+		job.Status = StatusCanceled
+		job.FinishedAt = time.Now()
+	}
+	snapshot := *job
+	mux.Unlock()
+
+	if queued {
+		notify(snapshot)
+	}
+	return nil
+}
+
+// ClearFinished forgets every job that has finished
+func ClearFinished() {
+	mux.Lock()
+	defer mux.Unlock()
+
+	kept := jobs[:0]
+	for _, job := range jobs {
+		if !job.finished() {
+			kept = append(kept, job)
+		}
+	}
+	for i := len(kept); i < len(jobs); i++ {
+		jobs[i] = nil
+	}
+	jobs = kept
+}
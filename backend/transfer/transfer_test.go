@@ -0,0 +1,260 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"Finder-2/backend/database"
+	"Finder-2/backend/gdrive"
+	"Finder-2/backend/gdrive/fakedrive"
+	"Finder-2/backend/sandbox"
+)
+
+// large is big enough to be uploaded in three resumable chunks
+var large = bytes.Repeat([]byte("0123456789abcdef"), (2*8*1024*1024+4096)/16)
+
+// setup points gdrive at a fake Drive and runs the queue until the test ends
+func setup(t *testing.T) *fakedrive.Server {
+	t.Helper()
+	server := fakedrive.New()
+	gdrive.UseEndpoint(server.Client(), server.Endpoint())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	Start(ctx, database.NewMemoryStore())
+	t.Cleanup(func() {
+		cancel()
+		gdrive.UseEndpoint(nil, "")
+		server.Close()
+		ClearFinished()
+	})
+	return server
+}
+
+func writeLocal(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// wait polls until the job with id satisfies done
+func wait(t *testing.T, id string, done func(Job) bool) Job {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, job := range List() {
+			if job.ID == id && done(job) {
+				return job
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s didn't get there in time: %+v", id, List())
+	return Job{}
+}
+
+func finished(job Job) bool {
+	return job.finished()
+}
+
+// updates collects the updates for one job
+type updates struct {
+	mu   sync.Mutex
+	jobs []Job
+}
+
+func watch(id string) *updates {
+	u := &updates{}
+	OnUpdate(func(job Job) {
+		if job.ID == id {
+			u.mu.Lock()
+			u.jobs = append(u.jobs, job)
+			u.mu.Unlock()
+		}
+	})
+	return u
+}
+
+func (u *updates) list() []Job {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]Job(nil), u.jobs...)
+}
+
+func TestResumableUploadReportsProgress(t *testing.T) {
+	server := setup(t)
+	path := writeLocal(t, "big.bin", large)
+
+	// Watch before the job can start, using the ID it will get
+	release := server.HoldChunks()
+	job, err := Upload([]string{path}, gdrive.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := watch(job.ID)
+	release()
+
+	job = wait(t, job.ID, finished)
+	if job.Status != StatusDone {
+		t.Fatalf("job = %+v, want done", job)
+	}
+	if server.Chunks() != 3 {
+		t.Errorf("uploaded in %d chunks, want 3", server.Chunks())
+	}
+	files := server.Children("root")
+	if len(files) != 1 || files[0].Name != "big.bin" {
+		t.Fatalf("My Drive holds %v, want big.bin", files)
+	}
+	if content, _ := server.Content(files[0].Id); !bytes.Equal(content, large) {
+		t.Errorf("uploaded %d bytes, want %d matching", len(content), len(large))
+	}
+	if len(job.Results) != 1 || job.Results[0] != gdrive.PathFor(files[0].Id) {
+		t.Errorf("results = %v", job.Results)
+	}
+
+	var last int64
+	partial := 0
+	for _, update := range seen.list() {
+		if update.Progress.BytesDone < last {
+			t.Errorf("progress went back from %d to %d", last, update.Progress.BytesDone)
+		}
+		last = update.Progress.BytesDone
+		if last > 0 && last < int64(len(large)) {
+			partial++
+		}
+	}
+	if partial == 0 {
+		t.Error("no progress reported between chunks")
+	}
+	if job.Progress.BytesDone != int64(len(large)) || job.Progress.BytesTotal != int64(len(large)) || job.Progress.FilesDone != 1 {
+		t.Errorf("final progress = %+v", job.Progress)
+	}
+}
+
+func TestUploadRetriesFailedChunks(t *testing.T) {
+	server := setup(t)
+	path := writeLocal(t, "big.bin", large)
+	server.FailChunks(2, http.StatusServiceUnavailable)
+
+	job, err := Upload([]string{path}, gdrive.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = wait(t, job.ID, finished)
+	if job.Status != StatusDone {
+		t.Fatalf("job = %+v, want done after retrying", job)
+	}
+	files := server.Children("root")
+	if len(files) != 1 {
+		t.Fatalf("My Drive holds %v, want one file", files)
+	}
+	if content, _ := server.Content(files[0].Id); !bytes.Equal(content, large) {
+		t.Errorf("uploaded %d bytes after retrying, want %d matching", len(content), len(large))
+	}
+}
+
+func TestCancelRunningUpload(t *testing.T) {
+	server := setup(t)
+	path := writeLocal(t, "big.bin", large)
+	release := server.HoldChunks()
+	defer release()
+
+	job, err := Upload([]string{path}, gdrive.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, job.ID, func(j Job) bool { return j.Status == StatusRunning && server.Uploading() == 1 })
+
+	if err := Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	job = wait(t, job.ID, finished)
+	if job.Status != StatusCanceled {
+		t.Errorf("job = %+v, want canceled", job)
+	}
+	if files := server.Children("root"); len(files) != 0 {
+		t.Errorf("a canceled upload created %v", files)
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	server := setup(t)
+	release := server.HoldChunks()
+	defer release()
+
+	first, err := Upload([]string{writeLocal(t, "big.bin", large)}, gdrive.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Upload([]string{writeLocal(t, "small.txt", []byte("hello"))}, gdrive.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, first.ID, func(j Job) bool { return j.Status == StatusRunning })
+
+	if err := Cancel(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	if job := wait(t, first.ID, finished); job.Status != StatusDone {
+		t.Errorf("first job = %+v, want done", job)
+	}
+	if job := wait(t, second.ID, finished); job.Status != StatusCanceled {
+		t.Errorf("second job = %+v, want canceled", job)
+	}
+	files := server.Children("root")
+	if len(files) != 1 || files[0].Name != "big.bin" {
+		t.Errorf("My Drive holds %v, want only big.bin", files)
+	}
+	if err := Cancel("no such job"); err == nil {
+		t.Error("canceling an unknown job succeeded")
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server := setup(t)
+	id := server.Add("root", "notes.txt", "text/plain", []byte("hello"))
+	dir := t.TempDir()
+	previous := sandbox.GetPolicy()
+	if err := sandbox.SetPolicy(sandbox.Policy{AllowedRoots: []string{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	defer sandbox.SetPolicy(previous)
+
+	job, err := Download([]string{gdrive.PathFor(id)}, dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = wait(t, job.ID, finished)
+	if job.Status != StatusDone {
+		t.Fatalf("job = %+v, want done", job)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "notes.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("downloaded %q, %v, want hello", data, err)
+	}
+}
+
+func TestQueueRejectsInvalidJobs(t *testing.T) {
+	if _, err := Upload(nil, gdrive.Scheme); err == nil {
+		t.Error("uploading nothing was queued")
+	}
+	if _, err := Upload([]string{gdrive.Scheme + "x"}, gdrive.Scheme); err == nil {
+		t.Error("uploading a Drive file was queued")
+	}
+	if _, err := Download([]string{"/tmp/x"}, t.TempDir(), ""); err == nil {
+		t.Error("downloading a local file was queued")
+	}
+	if _, err := Download([]string{gdrive.Scheme + "x"}, t.TempDir(), "odt"); err == nil {
+		t.Error("downloading in an unknown format was queued")
+	}
+}
@@ -1,6 +1,7 @@
 import React, { useState, useEffect, useRef } from 'react';
 import { HiCheck } from 'react-icons/hi';
 import { GetAICommands, ExecuteAICommands } from '../../wailsjs/go/main/App';
+import { errorMessage } from '../types/errors';
 
 interface Command {
   action: string;
@@ -65,7 +66,7 @@ const AISearch: React.FC<AISearchProps> = ({ isOpen, onClose, currentPath, onCom
       // Select all commands by default
       setSelectedCommands(new Set((commands || []).map((_: any, i: number) => i)));
     } catch (err) {
-      setError(err instanceof Error ? err.message : 'An error occurred');
+      setError(errorMessage(err));
     } finally {
       setLoading(false);
     }
@@ -91,7 +92,7 @@ const AISearch: React.FC<AISearchProps> = ({ isOpen, onClose, currentPath, onCom
         handleClose();
       }
     } catch (err) {
-      setError(err instanceof Error ? err.message : 'An error occurred');
+      setError(errorMessage(err));
     } finally {
       setLoading(false);
     }
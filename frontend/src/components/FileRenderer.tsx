@@ -4,6 +4,7 @@ import { TransformWrapper, TransformComponent } from 'react-zoom-pan-pinch';
 import { HiChevronLeft, HiChevronRight } from 'react-icons/hi2';
 import { FileItem } from '../types/filesystem';
 import { ReadFileContent } from '../../wailsjs/go/main/App';
+import { errorMessage } from '../types/errors';
 
 // IMPORTANT: Worker must be set in the same module where you use react-pdf
 pdfjs.GlobalWorkerOptions.workerSrc = new URL(
@@ -36,7 +37,7 @@ const FileRenderer: React.FC<FileRendererProps> = ({ file }) => {
         const content = await ReadFileContent(file.path);
         setFileContent(content);
       } catch (err) {
-        setError(`Failed to load file: ${err}`);
+        setError(`Failed to load file: ${errorMessage(err)}`);
       } finally {
         setLoading(false);
       }
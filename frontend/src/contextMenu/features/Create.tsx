@@ -1,5 +1,6 @@
 import React, { useState } from 'react';
 import { CreateFile, CreateFolder, CreateGoogleDoc } from '../../../wailsjs/go/main/App';
+import { errorMessage } from '../../types/errors';
 
 interface CreateProps {
   x: number;
@@ -28,7 +29,7 @@ const Create: React.FC<CreateProps> = ({ x, y, filePath, onClose, onRefresh, isF
         })
         .catch(err => {
           console.error('Create Google Doc error:', err);
-          alert('Failed to create Google Doc: ' + err);
+          alert('Failed to create Google Doc: ' + errorMessage(err));
         });
       return;
     }
@@ -1,5 +1,6 @@
 import React, { useState } from 'react';
 import { ShareFile } from '../../../wailsjs/go/main/App';
+import { errorMessage } from '../../types/errors';
 
 interface ShareProps {
   x: number;
@@ -39,7 +40,7 @@ const Share: React.FC<ShareProps> = ({ x, y, filePath, onClose }) => {
             .then(() => console.log('Successfully shared with:', email))
             .catch(err => {
               console.error('Share error with', email, ':', err);
-              throw new Error(`Failed to share with ${email}: ${err}`);
+              throw new Error(`Failed to share with ${email}: ${errorMessage(err)}`);
             })
         )
       )
@@ -12,6 +12,7 @@ import {
 import '@xyflow/react/dist/style.css';
 import { GetFolderTree } from '../../wailsjs/go/main/App';
 import { HiXMark } from 'react-icons/hi2';
+import { errorMessage } from '../types/errors';
 
 interface FolderNode {
   name: string;
@@ -162,7 +163,7 @@ const EntityRenderer: React.FC<EntityRendererProps> = ({ folderPath, onClose })
           setEdges(newEdges);
         }
       } catch (err) {
-        setError(err instanceof Error ? err.message : 'Failed to load folder tree');
+        setError(errorMessage(err));
       } finally {
         setLoading(false);
       }
@@ -2,6 +2,7 @@ import React, { useState, useEffect } from 'react';
 import Navbar from '../navbar/Navbar';
 import { StartGoogleLogin, IsGoogleConnected, GetGoogleEmail, DisconnectGoogle, ListGoogleDocs, ListGmailMessages } from '../../wailsjs/go/main/App';
 import { BrowserOpenURL } from '../../wailsjs/runtime/runtime';
+import { errorMessage } from '../types/errors';
 
 const API: React.FC = () => {
   const [isConnected, setIsConnected] = useState(false);
@@ -85,7 +86,7 @@ const API: React.FC = () => {
       setShowDocsModal(true);
     } catch (error) {
       console.error('Error fetching Google Docs:', error);
-      alert('Error: ' + error);
+      alert('Error: ' + errorMessage(error));
     }
   };
 
@@ -99,7 +100,7 @@ const API: React.FC = () => {
       setShowGmailModal(true);
     } catch (error) {
       console.error('Error fetching Gmail messages:', error);
-      alert('Error: ' + error);
+      alert('Error: ' + errorMessage(error));
     }
   };
 
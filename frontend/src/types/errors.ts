@@ -0,0 +1,36 @@
+// Errors from Go bindings reject with this shape (see backend/apperror)
+export type AppErrorCode =
+  | 'not_found'
+  | 'already_exists'
+  | 'permission_denied'
+  | 'cross_device'
+  | 'not_connected'
+  | 'reauth_required'
+  | 'ai_provider_error'
+  | 'quota_exceeded'
+  | 'password_required'
+  | 'conflict'
+  | 'invalid'
+  | 'unknown';
+
+export interface AppError {
+  code: AppErrorCode;
+  reason?: string;
+  message: string;
+  path?: string;
+}
+
+export function isAppError(err: unknown): err is AppError {
+  return typeof err === 'object' && err !== null && 'code' in err && 'message' in err;
+}
+
+// errorMessage returns something readable for any rejected binding call
+export function errorMessage(err: unknown): string {
+  if (isAppError(err)) {
+    return err.message;
+  }
+  if (err instanceof Error) {
+    return err.message;
+  }
+  return String(err);
+}
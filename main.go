@@ -3,6 +3,8 @@ package main
 import (
 	"embed"
 
+	"Finder-2/backend/apperror"
+
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
@@ -26,6 +28,8 @@ func main() {
 		BackgroundColour: &options.RGBA{R: 255, G: 255, B: 255, A: 1},
 		OnStartup:        app.startup,
 		OnShutdown:       app.shutdown,
+		// Errors reach the frontend as {code, message, path} objects
+		ErrorFormatter: apperror.Format,
 		Bind: []interface{}{
 			app,
 		},